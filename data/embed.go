@@ -0,0 +1,52 @@
+package data
+
+import (
+	"embed"
+)
+
+// GSL is the General Service List, one headword per line in rough frequency order.
+//
+//go:embed gsl.txt
+var GSL string
+
+// CEFRDescriptors is the CEFR writing descriptor table for A1-C2.
+//
+//go:embed cefr_descriptors.json
+var CEFRDescriptors []byte
+
+// DiscourseMarkers maps each discourse function to its markers.
+//
+//go:embed discourse_markers.json
+var DiscourseMarkers []byte
+
+// LeveledTopics maps each CEFR level (A1-C2) to quiz topics suited to it.
+//
+//go:embed leveled_topics.json
+var LeveledTopics []byte
+
+// TimeMultipliers holds the base minutes per quiz type, the default for other
+// types, and the multiplier per CEFR level.
+//
+//go:embed time_multipliers.json
+var TimeMultipliers []byte
+
+// CMUDict is a subset of the CMU Pronouncing Dictionary in its original
+// "WORD  PHONEMES" format, with ";;;" comment lines. It covers about 430 common
+// learner words, not the full ~130K entries; other words fall back to Gemini.
+// The full cmudict 0.7b or cmudict.dict file can replace it as is.
+//
+//go:embed cmudict.txt
+var CMUDict string
+
+// Rubrics holds the built-in scoring rubrics, one "<name>.txt" per rubric whose
+// first line is a brief description and the rest the scoring instructions.
+//
+//go:embed rubrics/*.txt
+var Rubrics embed.FS
+
+// Collocations maps common nouns to the verbs and adjectives that naturally go
+// with them ("collocates") and to learners' frequent wrong choices ("mistakes",
+// wrong word -> right one).
+//
+//go:embed collocations.json
+var Collocations []byte
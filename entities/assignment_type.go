@@ -7,6 +7,7 @@ const (
     FillInTheBlank
     ShortAnswer
     Essay
+    Collocations
 )
 
 var AssignmentTypeNames = map[AssignmentType]string{
@@ -14,6 +15,7 @@ var AssignmentTypeNames = map[AssignmentType]string{
     FillInTheBlank: "Fill in the Blank",
     ShortAnswer:    "Short Answer",
     Essay:          "Essay",
+    Collocations:   "Collocations",
 }
 
 func (a AssignmentType) String() string {
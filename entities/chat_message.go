@@ -0,0 +1,42 @@
+package entities
+
+import "time"
+
+// ChatMessage is a chatbot answer kept so feedback on it can be analysed with its context.
+type ChatMessage struct {
+	MessageID string    `json:"message_id"`
+	SessionID string    `json:"session_id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	Question  string    `json:"question"`
+	Answer    string    `json:"answer"`
+	Mode      string    `json:"mode"`
+	Persona   string    `json:"persona"`
+	Language  string    `json:"language,omitempty"`
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Keyed by the answer's session, or by rater outside sessions, so repeated
+	// feedback updates
+	Feedback map[string]ChatFeedback `json:"feedback,omitempty"`
+}
+
+// ChatFeedback is an up or down rating of a chatbot answer.
+type ChatFeedback struct {
+	SessionID string    `json:"session_id,omitempty"`
+	Rater     string    `json:"rater,omitempty"`
+	Rating    string    `json:"rating"` // up, down
+	Comment   string    `json:"comment,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Chat feedback ratings
+const (
+	ChatRatingUp   = "up"
+	ChatRatingDown = "down"
+)
+
+// RatedChatMessage is a down-rated answer with the feedback it received.
+type RatedChatMessage struct {
+	ChatMessage
+	Feedback ChatFeedback `json:"feedback"`
+}
@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+// Commit is the latest commit on the branch the server is built from.
+type Commit struct {
+	Repository string    `json:"repository"` // owner/name
+	Branch     string    `json:"branch"`
+	SHA        string    `json:"sha"`
+	Message    string    `json:"message"`
+	Author     string    `json:"author"`
+	Date       time.Time `json:"date"`
+	URL        string    `json:"url"`
+}
@@ -0,0 +1,35 @@
+package entities
+
+import "time"
+
+// Feedback is a message a user sent about the app.
+type Feedback struct {
+	ID           int64     `json:"id"`
+	UserName     string    `json:"user_name,omitempty"`
+	UserFeedback string    `json:"user_feedback"`
+	Rating       int       `json:"rating,omitempty"`   // 1-5, 0 when not given
+	Category     string    `json:"category,omitempty"` // bug, content_quality, feature_request, other
+	ClientIP     string    `json:"client_ip"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	WebhookStatus string `json:"webhook_status,omitempty"` // pending, delivered, failed; empty without a webhook
+	WebhookError  string `json:"webhook_error,omitempty"`  // Why delivery failed
+}
+
+// Webhook delivery states of a feedback item
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// FeedbackSummary aggregates the feedback sent since a point in time.
+type FeedbackSummary struct {
+	Since          time.Time      `json:"since"`
+	Total          int            `json:"total"`
+	CategoryCounts map[string]int `json:"category_counts"` // Feedback without a category is counted as "uncategorized"
+	RatedCount     int            `json:"rated_count"`
+	AverageRating  float64        `json:"average_rating"` // Over rated feedback only, 0 without any
+	RecentLowRated []Feedback     `json:"recent_low_rated"`
+}
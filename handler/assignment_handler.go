@@ -8,12 +8,16 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
-	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"EngPal/data"
 	"EngPal/internal"
+	"EngPal/internal/config"
+	"EngPal/utils"
 
 	"google.golang.org/genai"
 )
@@ -24,16 +28,48 @@ type GenerateQuizzesRequest struct {
 	AssignmentTypes []string `json:"assignment_types"`
 	EnglishLevel    string   `json:"english_level"`
 	TotalQuestions  int      `json:"total_questions"`
+
+	CustomTemplates []QuestionTemplate `json:"custom_templates,omitempty"`
+
+	DifficultyProgression bool `json:"difficulty_progression,omitempty"` // Warm-up, practice and challenge thirds
+
+	CollocationsOnly bool `json:"collocations_only,omitempty"` // Every question on collocations of the topic, which must be a single word
+
+	Prerequisites []string `json:"prerequisites,omitempty"` // Topics the students have already mastered
+
+	RequiredBloomsDistribution map[string]int `json:"required_blooms_distribution,omitempty"` // Bloom's level -> questions, summing to TotalQuestions
+}
+
+// QuestionTemplate describes a user-defined question format
+type QuestionTemplate struct {
+	TypeName   string `json:"type_name"`
+	Format     string `json:"format"`      // Natural language description of the format
+	JSONSchema string `json:"json_schema"` // Expected Gemini output schema for this type
 }
 
 type Quiz struct {
-	ID           int      `json:"id"`
-	Type         string   `json:"type"`
-	Question     string   `json:"question"`
-	Answer       string   `json:"answer,omitempty"`
-	Options      []string `json:"options,omitempty"`
-	CorrectIndex int      `json:"correct_index,omitempty"`
-	Explanation  string   `json:"explanation,omitempty"`
+	ID           int                    `json:"id"`
+	Type         string                 `json:"type"`
+	Question     string                 `json:"question"`
+	Answer       string                 `json:"answer,omitempty"`
+	Options      []string               `json:"options,omitempty"`
+	CorrectIndex int                    `json:"correct_index,omitempty"`
+	Explanation  string                 `json:"explanation,omitempty"`
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
+
+	DifficultyTier string `json:"difficulty_tier,omitempty"` // warmup, practice, challenge (progression mode only)
+
+	PrerequisiteAssumed bool `json:"prerequisite_assumed,omitempty"` // Written assuming the request's prerequisites
+
+	EstimatedTimeMinutes float64 `json:"estimated_time_minutes"` // For the type, adjusted for the level
+
+	BloomLevel string `json:"bloom_level,omitempty"` // remember, understand, apply, analyze, evaluate, create
+
+	// Collocations only
+	HeadWord            string   `json:"head_word,omitempty"`            // e.g. "make"
+	Sentence            string   `json:"sentence,omitempty"`             // e.g. "She needs to make a _____ about her future."
+	Distractors         []string `json:"distractors,omitempty"`          // Plausible but wrong collocates
+	CollocationStrength string   `json:"collocation_strength,omitempty"` // strong, medium
 }
 
 type QuizResponse struct {
@@ -42,6 +78,19 @@ type QuizResponse struct {
 	Total     int    `json:"total"`
 	Generated int    `json:"generated"`
 	Quizzes   []Quiz `json:"quizzes"`
+
+	ProgressionMode bool `json:"progression_mode"`
+
+	TotalEstimatedTimeMinutes float64 `json:"total_estimated_time_minutes"`
+
+	BloomsDistribution map[string]int `json:"blooms_distribution"` // Questions per Bloom's level
+}
+
+// Minutes to spend on a question, by type and level
+type QuizTimeEstimates struct {
+	BaseMinutes        map[string]float64 `json:"base_minutes"`         // By assignment type
+	DefaultBaseMinutes float64            `json:"default_base_minutes"` // For custom types
+	LevelMultipliers   map[string]float64 `json:"level_multipliers"`    // By CEFR level; 1 for unknown levels
 }
 
 // Gemini API structures
@@ -70,12 +119,19 @@ type GeminiQuizData struct {
 }
 
 type GeminiQuiz struct {
-	Type         string   `json:"type"`
-	Question     string   `json:"question"`
-	Answer       string   `json:"answer,omitempty"`
-	Options      []string `json:"options,omitempty"`
-	CorrectIndex int      `json:"correct_index,omitempty"`
-	Explanation  string   `json:"explanation,omitempty"`
+	Type         string                 `json:"type"`
+	Question     string                 `json:"question"`
+	Answer       string                 `json:"answer,omitempty"`
+	Options      []string               `json:"options,omitempty"`
+	CorrectIndex int                    `json:"correct_index,omitempty"`
+	Explanation  string                 `json:"explanation,omitempty"`
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
+	BloomLevel   string                 `json:"bloom_level,omitempty"`
+
+	HeadWord            string   `json:"head_word,omitempty"`
+	Sentence            string   `json:"sentence,omitempty"`
+	Distractors         []string `json:"distractors,omitempty"`
+	CollocationStrength string   `json:"collocation_strength,omitempty"`
 }
 
 // Cache struct
@@ -86,11 +142,64 @@ type cacheItem struct {
 
 var cache = make(map[string]cacheItem)
 
-// Gemini API configuration
-const GEMINI_API_URL = "https://generativelanguage.googleapis.com/v1beta/models/gemini-pro:generateContent"
+// Maximum number of custom question templates per request
+const MAX_CUSTOM_TEMPLATES = 3
+
+// Limits on prerequisite topics
+const (
+	MAX_PREREQUISITES      = 5
+	MAX_PREREQUISITE_WORDS = 10
+)
+
+// Topic pre-check: results are cached per normalized topic, and a slow check is skipped
+const (
+	TOPIC_VALIDATION_CACHE_DURATION = 24 * time.Hour
+	TOPIC_VALIDATION_TIMEOUT        = 5 * time.Second
+)
+
+// Levels of Bloom's taxonomy, from the lowest cognitive level
+var bloomLevels = []string{"remember", "understand", "apply", "analyze", "evaluate", "create"}
+
+// Topic suggestions
+const (
+	DEFAULT_SUGGESTED_TOPICS = 5
+	MAX_SUGGESTED_TOPICS     = 10
+	AI_SUGGESTED_TOPICS      = 3 // Added to the static topics with include_ai_generated
+	AI_TOPICS_TIMEOUT        = 5 * time.Second
+)
+
+// Question time estimates, loaded from the embedded data file
+var quizTimeEstimates = loadQuizTimeEstimates()
+
+func loadQuizTimeEstimates() QuizTimeEstimates {
+	var estimates QuizTimeEstimates
+	if err := json.Unmarshal(data.TimeMultipliers, &estimates); err != nil {
+		log.Fatalf("Failed to load quiz time multipliers: %v", err)
+	}
+	return estimates
+}
+
+// Quiz topics per CEFR level, loaded from the embedded data file
+var leveledTopics = loadLeveledTopics()
+
+func loadLeveledTopics() map[string][]string {
+	var topics map[string][]string
+	if err := json.Unmarshal(data.LeveledTopics, &topics); err != nil {
+		log.Fatalf("Failed to load leveled topics: %v", err)
+	}
+	return topics
+}
+
+// Result of the topic pre-check
+type topicValidation struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason"` // In Vietnamese
+}
 
-// Thêm dòng này để lấy API key từ biến môi trường
-var GEMINI_API_KEY = os.Getenv("GEMINI_API_KEY")
+var (
+	topicValidationCache      = make(map[string]cacheItem)
+	topicValidationCacheMutex sync.RWMutex
+)
 
 // EnglishLevel enum
 var englishLevels = map[int]string{
@@ -108,8 +217,18 @@ var assignmentTypes = map[int]string{
 	2: "Fill in the Blank",
 	3: "Short Answer",
 	4: "Essay",
+	5: "Collocations",
 }
 
+const COLLOCATIONS_TYPE = "Collocations"
+
+// Difficulty tiers of progression mode, easiest first
+const (
+	DIFFICULTY_TIER_WARMUP    = "warmup"
+	DIFFICULTY_TIER_PRACTICE  = "practice"
+	DIFFICULTY_TIER_CHALLENGE = "challenge"
+)
+
 // Difficulty mapping for different English levels
 var difficultyMapping = map[string]string{
 	"A1 - Beginner":           "very basic vocabulary and simple grammar structures",
@@ -129,33 +248,55 @@ func GenerateAssignment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A collocation set uses only the collocation type
+	if request.CollocationsOnly {
+		request.AssignmentTypes = []string{COLLOCATIONS_TYPE}
+	}
+
 	// Validation
 	if err := validateRequest(request); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Check cache
+	// Check cache (custom templates are per-request and never cached)
+	useCache := len(request.CustomTemplates) == 0
 	cacheKey := generateCacheKey(request)
 	now := time.Now()
-	if item, found := cache[cacheKey]; found && item.ExpiresAt.After(now) {
+	if item, found := cache[cacheKey]; useCache && found && item.ExpiresAt.After(now) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(item.Data)
 		return
 	}
 
+	// Ask Gemini whether the topic suits an English quiz; if it can't answer, go ahead
+	validation, err := validateTopicWithGemini(request.Topic)
+	if err != nil {
+		logf(r, "Topic pre-check skipped for %q: %v", request.Topic, err)
+	} else if !validation.Valid {
+		logf(r, "Moderation: rejected quiz topic %q: %s", request.Topic, validation.Reason)
+		http.Error(w, "chủ đề không phù hợp: "+validation.Reason, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if len(request.Prerequisites) > 0 {
+		logf(r, "Prerequisite chain: %s -> %s", strings.Join(request.Prerequisites, " -> "), request.Topic)
+	}
+
 	// Generate quizzes using Gemini API
 	quizResponse, err := generateQuizzesWithGemini(request)
 	if err != nil {
-		log.Printf("Error generating quizzes: %v", err)
+		logf(r, "Error generating quizzes: %v", err)
 		http.Error(w, "Failed to generate quizzes", http.StatusInternalServerError)
 		return
 	}
 
 	// Cache for 10 minutes
-	cache[cacheKey] = cacheItem{Data: quizResponse, ExpiresAt: now.Add(10 * time.Minute)}
+	if useCache {
+		cache[cacheKey] = cacheItem{Data: quizResponse, ExpiresAt: now.Add(10 * time.Minute)}
+	}
 
-	log.Printf("Generated %d quizzes for topic: %s", len(quizResponse.Quizzes), request.Topic)
+	logf(r, "Generated %d quizzes for topic: %s", len(quizResponse.Quizzes), request.Topic)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(quizResponse)
@@ -173,17 +314,106 @@ func validateRequest(request GenerateQuizzesRequest) error {
 	if request.TotalQuestions < 1 || request.TotalQuestions > 50 {
 		return errors.New("số lượng câu hỏi phải nằm trong khoảng 1 đến 50")
 	}
-	if len(request.AssignmentTypes) > request.TotalQuestions {
+	if len(request.CustomTemplates) > MAX_CUSTOM_TEMPLATES {
+		return fmt.Errorf("chỉ được định nghĩa tối đa %d dạng câu hỏi tùy chỉnh", MAX_CUSTOM_TEMPLATES)
+	}
+	if err := validateCustomTemplates(request.CustomTemplates); err != nil {
+		return err
+	}
+	totalTypes := len(request.AssignmentTypes) + len(request.CustomTemplates)
+	if totalTypes > request.TotalQuestions {
 		return errors.New("số lượng câu hỏi không được nhỏ hơn số dạng câu hỏi mà bạn chọn")
 	}
-	if len(request.AssignmentTypes) == 0 {
+	if totalTypes == 0 {
 		return errors.New("phải chọn ít nhất một loại câu hỏi")
 	}
+	if request.DifficultyProgression && request.TotalQuestions < 3 {
+		return errors.New("chế độ tăng dần độ khó cần ít nhất 3 câu hỏi")
+	}
+	if len(request.Prerequisites) > MAX_PREREQUISITES {
+		return fmt.Errorf("chỉ được khai báo tối đa %d chủ đề tiên quyết", MAX_PREREQUISITES)
+	}
+	for _, prerequisite := range request.Prerequisites {
+		words := len(strings.Fields(prerequisite))
+		if words == 0 {
+			return errors.New("chủ đề tiên quyết không được để trống")
+		}
+		if words > MAX_PREREQUISITE_WORDS {
+			return fmt.Errorf("chủ đề tiên quyết không được chứa nhiều hơn %d từ", MAX_PREREQUISITE_WORDS)
+		}
+	}
+	if err := validateBloomsDistribution(request); err != nil {
+		return err
+	}
+	if request.CollocationsOnly {
+		if len(strings.Fields(request.Topic)) != 1 {
+			return errors.New("chế độ chỉ kết hợp từ cần chủ đề là một từ duy nhất")
+		}
+		if len(request.CustomTemplates) > 0 {
+			return errors.New("chế độ chỉ kết hợp từ không hỗ trợ dạng câu hỏi tùy chỉnh")
+		}
+	}
+	return nil
+}
+
+// Check the required Bloom's levels are known and add up to the total
+func validateBloomsDistribution(request GenerateQuizzesRequest) error {
+	if len(request.RequiredBloomsDistribution) == 0 {
+		return nil
+	}
+	if request.DifficultyProgression {
+		return errors.New("chế độ tăng dần độ khó không hỗ trợ phân bố cấp độ Bloom")
+	}
+	sum := 0
+	for level, count := range request.RequiredBloomsDistribution {
+		if !contains(bloomLevels, level) {
+			return fmt.Errorf("cấp độ Bloom không hợp lệ: %s (%s)", level, strings.Join(bloomLevels, ", "))
+		}
+		if count < 0 {
+			return fmt.Errorf("số câu hỏi ở cấp độ Bloom %s không được âm", level)
+		}
+		sum += count
+	}
+	if sum != request.TotalQuestions {
+		return fmt.Errorf("tổng số câu hỏi theo cấp độ Bloom (%d) phải bằng số lượng câu hỏi (%d)", sum, request.TotalQuestions)
+	}
+	return nil
+}
+
+// Validate custom question templates
+func validateCustomTemplates(templates []QuestionTemplate) error {
+	seen := make(map[string]bool)
+	for _, template := range templates {
+		name := strings.TrimSpace(template.TypeName)
+		if name == "" {
+			return errors.New("tên dạng câu hỏi tùy chỉnh không được để trống")
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("dạng câu hỏi tùy chỉnh \"%s\" bị trùng", name)
+		}
+		for _, builtIn := range assignmentTypes {
+			if strings.EqualFold(builtIn, name) {
+				return fmt.Errorf("dạng câu hỏi tùy chỉnh \"%s\" trùng với dạng có sẵn", name)
+			}
+		}
+		seen[strings.ToLower(name)] = true
+
+		if strings.TrimSpace(template.Format) == "" {
+			return fmt.Errorf("phải mô tả định dạng cho dạng câu hỏi \"%s\"", name)
+		}
+		if !json.Valid([]byte(template.JSONSchema)) {
+			return fmt.Errorf("json_schema của dạng câu hỏi \"%s\" không phải JSON hợp lệ", name)
+		}
+	}
 	return nil
 }
 
 // Generate quizzes using Gemini API
 func generateQuizzesWithGemini(req GenerateQuizzesRequest) (*QuizResponse, error) {
+	if req.DifficultyProgression {
+		return generateProgressionQuizzes(req)
+	}
+
 	// Build prompt for Gemini
 	prompt := buildGeminiPrompt(req)
 
@@ -194,17 +424,27 @@ func generateQuizzesWithGemini(req GenerateQuizzesRequest) (*QuizResponse, error
 	}
 
 	// Parse response
-	quizzes, err := parseGeminiResponse(geminiResp, req.AssignmentTypes)
+	quizzes, err := parseGeminiResponse(geminiResp, req.AssignmentTypes, req.CustomTemplates)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse gemini response: %w", err)
 	}
+	if req.CollocationsOnly {
+		quizzes = filterSeedWordCollocations(quizzes, req.Topic)
+	}
+
+	// Drop near-duplicate questions
+	threshold := config.QuizDedupThreshold()
+	quizzes = deduplicateQuizzes(quizzes, threshold)
 
 	// Ensure we have the right number of questions
 	if len(quizzes) < req.TotalQuestions {
 		// If we don't have enough, try to generate more
 		additionalQuizzes, err := generateAdditionalQuizzes(req, len(quizzes))
 		if err == nil {
-			quizzes = append(quizzes, additionalQuizzes...)
+			if req.CollocationsOnly {
+				additionalQuizzes = filterSeedWordCollocations(additionalQuizzes, req.Topic)
+			}
+			quizzes = deduplicateQuizzes(append(quizzes, additionalQuizzes...), threshold)
 		}
 	}
 
@@ -216,6 +456,8 @@ func generateQuizzesWithGemini(req GenerateQuizzesRequest) (*QuizResponse, error
 	// Add IDs to quizzes
 	for i := range quizzes {
 		quizzes[i].ID = i + 1
+		quizzes[i].PrerequisiteAssumed = len(req.Prerequisites) > 0
+		quizzes[i].EstimatedTimeMinutes = estimateQuizMinutes(quizzes[i].Type, req.EnglishLevel)
 	}
 
 	response := &QuizResponse{
@@ -224,11 +466,144 @@ func generateQuizzesWithGemini(req GenerateQuizzesRequest) (*QuizResponse, error
 		Total:     req.TotalQuestions,
 		Generated: len(quizzes),
 		Quizzes:   quizzes,
+
+		TotalEstimatedTimeMinutes: totalEstimatedMinutes(quizzes),
+		BloomsDistribution:        bloomsDistribution(quizzes),
 	}
+	warnBloomsDivergence(req.RequiredBloomsDistribution, response.BloomsDistribution)
 
 	return response, nil
 }
 
+// Generate warm-up, practice and challenge thirds one level below, at and one level
+// above the requested level, then merge them easiest first.
+func generateProgressionQuizzes(req GenerateQuizzesRequest) (*QuizResponse, error) {
+	warmupCount := req.TotalQuestions / 3
+	challengeCount := req.TotalQuestions / 3
+	tiers := []struct {
+		Name  string
+		Level string
+		Count int
+	}{
+		{DIFFICULTY_TIER_WARMUP, shiftEnglishLevel(req.EnglishLevel, -1), warmupCount},
+		{DIFFICULTY_TIER_PRACTICE, req.EnglishLevel, req.TotalQuestions - warmupCount - challengeCount},
+		{DIFFICULTY_TIER_CHALLENGE, shiftEnglishLevel(req.EnglishLevel, 1), challengeCount},
+	}
+
+	// The three prompts are independent, so they run in parallel
+	results := make([][]Quiz, len(tiers))
+	errs := make([]error, len(tiers))
+	var wg sync.WaitGroup
+	for i, tier := range tiers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tierReq := req
+			tierReq.DifficultyProgression = false
+			tierReq.EnglishLevel = tier.Level
+			tierReq.TotalQuestions = tier.Count
+			response, err := generateQuizzesWithGemini(tierReq)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s tier: %w", tier.Name, err)
+				return
+			}
+			results[i] = response.Quizzes
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var quizzes []Quiz
+	for i, tier := range tiers {
+		for _, quiz := range results[i] {
+			quiz.DifficultyTier = tier.Name
+			quizzes = append(quizzes, quiz)
+		}
+	}
+
+	// Tiers were generated separately, so drop questions repeated across them
+	quizzes = deduplicateQuizzes(quizzes, config.QuizDedupThreshold())
+	for i := range quizzes {
+		quizzes[i].ID = i + 1
+	}
+
+	return &QuizResponse{
+		Topic:           req.Topic,
+		Level:           req.EnglishLevel,
+		Total:           req.TotalQuestions,
+		Generated:       len(quizzes),
+		Quizzes:         quizzes,
+		ProgressionMode: true,
+
+		TotalEstimatedTimeMinutes: totalEstimatedMinutes(quizzes),
+		BloomsDistribution:        bloomsDistribution(quizzes),
+	}, nil
+}
+
+// Number of questions at each Bloom's level; untagged questions are not counted
+func bloomsDistribution(quizzes []Quiz) map[string]int {
+	distribution := make(map[string]int, len(bloomLevels))
+	for _, level := range bloomLevels {
+		distribution[level] = 0
+	}
+	for _, quiz := range quizzes {
+		if quiz.BloomLevel != "" {
+			distribution[quiz.BloomLevel]++
+		}
+	}
+	return distribution
+}
+
+// Gemini does not always follow the requested levels; the quizzes are still served
+func warnBloomsDivergence(required, actual map[string]int) {
+	if len(required) == 0 {
+		return
+	}
+	var differences []string
+	for _, level := range bloomLevels {
+		if required[level] != actual[level] {
+			differences = append(differences, fmt.Sprintf("%s %d/%d", level, actual[level], required[level]))
+		}
+	}
+	if len(differences) > 0 {
+		log.Printf("Warning: Bloom's distribution differs from the request (actual/required): %s", strings.Join(differences, ", "))
+	}
+}
+
+// Minutes to spend on a question of the type at the level ("B1" or "B1 - Intermediate")
+func estimateQuizMinutes(quizType, level string) float64 {
+	minutes, exists := quizTimeEstimates.BaseMinutes[quizType]
+	if !exists {
+		minutes = quizTimeEstimates.DefaultBaseMinutes
+	}
+	code, _, _ := strings.Cut(strings.ToUpper(strings.TrimSpace(level)), " ")
+	if multiplier, exists := quizTimeEstimates.LevelMultipliers[code]; exists {
+		minutes *= multiplier
+	}
+	return roundTo(minutes, 1)
+}
+
+func totalEstimatedMinutes(quizzes []Quiz) float64 {
+	total := 0.0
+	for _, quiz := range quizzes {
+		total += quiz.EstimatedTimeMinutes
+	}
+	return roundTo(total, 1)
+}
+
+// The English level offset steps from the given one, clamped to A1-C2.
+// Levels outside englishLevels are returned unchanged.
+func shiftEnglishLevel(level string, offset int) string {
+	for index, name := range englishLevels {
+		if name == level || strings.HasPrefix(name, strings.ToUpper(strings.TrimSpace(level))+" ") {
+			return englishLevels[min(max(index+offset, 1), len(englishLevels))]
+		}
+	}
+	return level
+}
+
 // Build comprehensive prompt for Gemini
 func buildGeminiPrompt(req GenerateQuizzesRequest) string {
 	difficulty, exists := difficultyMapping[req.EnglishLevel]
@@ -236,7 +611,11 @@ func buildGeminiPrompt(req GenerateQuizzesRequest) string {
 		difficulty = "intermediate level"
 	}
 
-	typeDistribution := distributeQuestionTypes(req.AssignmentTypes, req.TotalQuestions)
+	allTypes := append([]string{}, req.AssignmentTypes...)
+	for _, template := range req.CustomTemplates {
+		allTypes = append(allTypes, template.TypeName)
+	}
+	typeDistribution := distributeQuestionTypes(allTypes, req.TotalQuestions)
 
 	prompt := fmt.Sprintf(`Create %d high-quality quiz questions about "%s" for %s English level students.
 
@@ -261,25 +640,40 @@ FORMATTING RULES:
       "question": "question text here",
       "options": ["A", "B", "C", "D"],
       "correct_index": 0,
-      "explanation": "detailed explanation"
+      "explanation": "detailed explanation",
+      "bloom_level": "understand"
     },
     {
       "type": "Fill in the Blank",
       "question": "Complete this sentence: The weather today is _____ than yesterday.",
       "answer": "better",
-      "explanation": "explanation here"
+      "explanation": "explanation here",
+      "bloom_level": "apply"
     },
     {
       "type": "Short Answer",
       "question": "question text here",
       "answer": "expected answer",
-      "explanation": "explanation here" 
+      "explanation": "explanation here",
+      "bloom_level": "analyze"
     },
     {
       "type": "Essay",
       "question": "essay question here",
       "answer": "sample key points or structure",
-      "explanation": "grading criteria and expectations"
+      "explanation": "grading criteria and expectations",
+      "bloom_level": "evaluate"
+    },
+    {
+      "type": "Collocations",
+      "question": "Which word goes with \"make\"?",
+      "head_word": "make",
+      "sentence": "She needs to make a _____ about her future.",
+      "answer": "decision",
+      "distractors": ["result", "work", "effort"],
+      "collocation_strength": "strong",
+      "explanation": "We make a decision; we do work and make an effort but not here",
+      "bloom_level": "remember"
     }
   ]
 }
@@ -289,17 +683,80 @@ QUALITY STANDARDS:
 - Fill in the Blank: Clear context, single correct answer
 - Short Answer: Specific, measurable expected responses
 - Essay: Clear prompts with specific requirements
+- Collocations: head_word is the word being practised, sentence has one _____ gap for the word that collocates with it, distractors are plausible words that do NOT collocate with the head word in that sentence, collocation_strength is "strong" or "medium"
 - All questions must test different aspects of the topic
 - Vary sentence structures and vocabulary within the appropriate level
 - Include practical, real-world applications when possible
-
+%s%s%s%s
 Generate exactly %d questions now:`,
 		req.TotalQuestions, req.Topic, req.EnglishLevel, req.EnglishLevel, difficulty, req.Topic, req.TotalQuestions,
-		formatTypeDistribution(typeDistribution), req.TotalQuestions)
+		formatTypeDistribution(typeDistribution), formatCustomTemplates(req.CustomTemplates), formatCollocationFocus(req), formatPrerequisites(req), formatBloomsTaxonomy(req), req.TotalQuestions)
 
 	return prompt
 }
 
+// Focus every question on the seed word in collocations-only mode
+func formatCollocationFocus(req GenerateQuizzesRequest) string {
+	if !req.CollocationsOnly {
+		return ""
+	}
+	return fmt.Sprintf(`
+COLLOCATION FOCUS:
+- Every question practises collocations of the seed word "%s", which must be the head_word of every question
+- Cover different collocates and patterns (verb + noun, adjective + noun, adverb + adjective, ...), not the same collocate twice
+`, req.Topic)
+}
+
+// Tell Gemini what the students already know
+func formatPrerequisites(req GenerateQuizzesRequest) string {
+	if len(req.Prerequisites) == 0 {
+		return ""
+	}
+	var prerequisites []string
+	for _, prerequisite := range req.Prerequisites {
+		prerequisites = append(prerequisites, strings.Join(strings.Fields(prerequisite), " "))
+	}
+	return fmt.Sprintf(`
+PRIOR KNOWLEDGE:
+Students have already mastered: %s. Do not test these concepts; instead focus on %s assuming this prior knowledge.
+`, strings.Join(prerequisites, ", "), req.Topic)
+}
+
+// Ask Gemini to tag each question with its Bloom's level, at the requested counts if any
+func formatBloomsTaxonomy(req GenerateQuizzesRequest) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`
+BLOOM'S TAXONOMY:
+- Tag every question with the cognitive level it tests in "bloom_level", one of: %s
+`, strings.Join(bloomLevels, ", ")))
+	if len(req.RequiredBloomsDistribution) == 0 {
+		sb.WriteString("- Span several levels rather than only remember and understand\n")
+		return sb.String()
+	}
+	sb.WriteString("- Write exactly this many questions at each level:\n")
+	for _, level := range bloomLevels {
+		if count := req.RequiredBloomsDistribution[level]; count > 0 {
+			sb.WriteString(fmt.Sprintf("  - %s: %d questions\n", level, count))
+		}
+	}
+	return sb.String()
+}
+
+// Format custom question templates for prompt
+func formatCustomTemplates(templates []QuestionTemplate) string {
+	if len(templates) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\nCUSTOM QUESTION TYPES:\n")
+	sb.WriteString("For each custom type, set \"type\" to the exact type name, write the question in \"question\", and put the type-specific fields in a \"custom_fields\" object that follows the given schema.\n")
+	for _, template := range templates {
+		sb.WriteString(fmt.Sprintf("- %s: %s\n  custom_fields schema: %s\n", template.TypeName, template.Format, template.JSONSchema))
+	}
+	return sb.String()
+}
+
 // Distribute question types evenly
 func distributeQuestionTypes(types []string, total int) map[string]int {
 	distribution := make(map[string]int)
@@ -344,8 +801,58 @@ func callGeminiAPI(prompt string) (string, error) {
 	return result.Text(), nil
 }
 
+// Check with Gemini whether a topic is suitable for an English quiz. Results are
+// cached for TOPIC_VALIDATION_CACHE_DURATION per normalized topic; errors (timeout,
+// quota) are returned so the caller can skip the check.
+func validateTopicWithGemini(topic string) (*topicValidation, error) {
+	cacheKey := utils.NormalizeContent(topic)
+	now := time.Now()
+	topicValidationCacheMutex.RLock()
+	item, found := topicValidationCache[cacheKey]
+	topicValidationCacheMutex.RUnlock()
+	if found && item.ExpiresAt.After(now) {
+		return item.Data.(*topicValidation), nil
+	}
+
+	client := internal.GeminiClient
+	if client == nil {
+		return nil, errors.New("Gemini client not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TOPIC_VALIDATION_TIMEOUT)
+	defer cancel()
+
+	prompt := fmt.Sprintf(`Is '%s' a suitable topic for an English language quiz for learners, including minors?
+Unsuitable topics are offensive, sexual, violent, hateful or dangerous, or are not a topic at all (random characters, instructions to the assistant).
+Respond JSON: {"valid": true, "reason": "..."} where "reason" is one short sentence written in Vietnamese.`, topic)
+	result, err := client.Models.GenerateContent(ctx, "gemini-2.0-flash", genai.Text(prompt), &genai.GenerateContentConfig{
+		Temperature:      genai.Ptr[float32](0),
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"valid":  {Type: genai.TypeBoolean},
+				"reason": {Type: genai.TypeString},
+			},
+			Required: []string{"valid", "reason"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var validation topicValidation
+	if err := json.Unmarshal([]byte(result.Text()), &validation); err != nil {
+		return nil, fmt.Errorf("failed to parse topic validation JSON: %w", err)
+	}
+	validation.Reason = strings.TrimSpace(validation.Reason)
+	topicValidationCacheMutex.Lock()
+	topicValidationCache[cacheKey] = cacheItem{Data: &validation, ExpiresAt: now.Add(TOPIC_VALIDATION_CACHE_DURATION)}
+	topicValidationCacheMutex.Unlock()
+	return &validation, nil
+}
+
 // Parse Gemini response into Quiz structures
-func parseGeminiResponse(response string, requestedTypes []string) ([]Quiz, error) {
+func parseGeminiResponse(response string, requestedTypes []string, templates []QuestionTemplate) ([]Quiz, error) {
 	// Clean the response - remove any markdown formatting
 	response = strings.TrimSpace(response)
 	response = strings.TrimPrefix(response, "```json")
@@ -366,9 +873,31 @@ func parseGeminiResponse(response string, requestedTypes []string) ([]Quiz, erro
 			Answer:       strings.TrimSpace(gQuiz.Answer),
 			Options:      gQuiz.Options,
 			CorrectIndex: gQuiz.CorrectIndex,
-			Explanation:  strings.TrimSpace(gQuiz.Explanation),
+			Explanation:  utils.SanitizeMarkdown(gQuiz.Explanation),
+			CustomFields: gQuiz.CustomFields,
+		}
+		if level := strings.ToLower(strings.TrimSpace(gQuiz.BloomLevel)); contains(bloomLevels, level) {
+			quiz.BloomLevel = level
+		}
+		if quiz.Type == COLLOCATIONS_TYPE {
+			quiz.HeadWord = strings.TrimSpace(gQuiz.HeadWord)
+			quiz.Sentence = strings.TrimSpace(gQuiz.Sentence)
+			quiz.Distractors = gQuiz.Distractors
+			quiz.CollocationStrength = strings.ToLower(strings.TrimSpace(gQuiz.CollocationStrength))
+			if quiz.CollocationStrength != "strong" && quiz.CollocationStrength != "medium" {
+				quiz.CollocationStrength = ""
+			}
 		}
 
+		// Custom types are validated against their template
+		if template, found := findTemplate(templates, quiz.Type); found {
+			if isValidCustomQuiz(quiz, template) {
+				quizzes = append(quizzes, quiz)
+			}
+			continue
+		}
+		quiz.CustomFields = nil
+
 		// Validate question type
 		if !contains(requestedTypes, quiz.Type) {
 			continue
@@ -400,11 +929,72 @@ func isValidQuiz(quiz Quiz) bool {
 		return quiz.Answer != ""
 	case "Essay":
 		return true // Essay questions just need a question
+	case COLLOCATIONS_TYPE:
+		return quiz.HeadWord != "" && quiz.Sentence != "" && quiz.Answer != ""
 	default:
 		return false
 	}
 }
 
+// Keep the collocation questions whose head word is the seed word
+func filterSeedWordCollocations(quizzes []Quiz, seedWord string) []Quiz {
+	var kept []Quiz
+	for _, quiz := range quizzes {
+		if strings.EqualFold(quiz.HeadWord, strings.TrimSpace(seedWord)) {
+			kept = append(kept, quiz)
+		}
+	}
+	return kept
+}
+
+// Find the custom template for a question type
+func findTemplate(templates []QuestionTemplate, typeName string) (QuestionTemplate, bool) {
+	for _, template := range templates {
+		if strings.EqualFold(strings.TrimSpace(template.TypeName), strings.TrimSpace(typeName)) {
+			return template, true
+		}
+	}
+	return QuestionTemplate{}, false
+}
+
+// Validate a custom quiz against the fields its template expects
+func isValidCustomQuiz(quiz Quiz, template QuestionTemplate) bool {
+	if quiz.Question == "" {
+		return false
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(template.JSONSchema), &schema); err != nil {
+		// Non-object schemas can't be checked field by field
+		return true
+	}
+
+	// Accept either a JSON Schema ("required"/"properties") or an example object
+	var expected []string
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, field := range required {
+			if name, ok := field.(string); ok {
+				expected = append(expected, name)
+			}
+		}
+	} else if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for name := range properties {
+			expected = append(expected, name)
+		}
+	} else if _, isJSONSchema := schema["type"]; !isJSONSchema {
+		for name := range schema {
+			expected = append(expected, name)
+		}
+	}
+
+	for _, field := range expected {
+		if _, exists := quiz.CustomFields[field]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
 // Generate additional quizzes if needed
 func generateAdditionalQuizzes(req GenerateQuizzesRequest, currentCount int) ([]Quiz, error) {
 	needed := req.TotalQuestions - currentCount
@@ -420,7 +1010,7 @@ func generateAdditionalQuizzes(req GenerateQuizzesRequest, currentCount int) ([]
 Make sure these questions are completely different from any previous questions about this topic.
 Focus on different aspects, use different vocabulary, and vary the question formats.
 
-Use the same JSON format as before and ensure high quality, IELTS/TOEIC-style questions.`,
+Use the same JSON format as before, tagging each question with its Bloom's taxonomy "bloom_level", and ensure high quality, IELTS/TOEIC-style questions.`,
 		needed, req.Topic, req.EnglishLevel)
 
 	response, err := callGeminiAPI(prompt)
@@ -428,7 +1018,65 @@ Use the same JSON format as before and ensure high quality, IELTS/TOEIC-style qu
 		return nil, err
 	}
 
-	return parseGeminiResponse(response, req.AssignmentTypes)
+	return parseGeminiResponse(response, req.AssignmentTypes, req.CustomTemplates)
+}
+
+// Remove questions whose word bigrams overlap an earlier question's by more than threshold (Jaccard)
+func deduplicateQuizzes(quizzes []Quiz, threshold float64) []Quiz {
+	unique := make([]Quiz, 0, len(quizzes))
+	uniqueBigrams := make([]map[string]bool, 0, len(quizzes))
+
+	for _, quiz := range quizzes {
+		// Collocation questions share one instruction, so their sentences are compared
+		text := quiz.Question
+		if quiz.Sentence != "" {
+			text = quiz.Sentence
+		}
+		bigrams := questionBigrams(text)
+		duplicate := false
+		for _, other := range uniqueBigrams {
+			if jaccardSimilarity(bigrams, other) > threshold {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, quiz)
+			uniqueBigrams = append(uniqueBigrams, bigrams)
+		}
+	}
+
+	if removed := len(quizzes) - len(unique); removed > 0 {
+		log.Printf("Removed %d near-duplicate quiz questions (threshold %.2f)", removed, threshold)
+	}
+	return unique
+}
+
+// Word bigrams of a question; single-word questions use the word itself
+func questionBigrams(question string) map[string]bool {
+	words := utils.ExtractWords(question)
+	bigrams := make(map[string]bool)
+	if len(words) == 1 {
+		bigrams[words[0]] = true
+	}
+	for i := 0; i+1 < len(words); i++ {
+		bigrams[words[i]+" "+words[i+1]] = true
+	}
+	return bigrams
+}
+
+// Jaccard similarity of two sets
+func jaccardSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for item := range a {
+		if b[item] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
 }
 
 // Helper function to check if slice contains string
@@ -442,24 +1090,115 @@ func contains(slice []string, item string) bool {
 }
 
 // SuggestTopics suggests random topics for quizzes.
+// GET /api/assignment/suggest-topics?level=A1&count=5&include_ai_generated=true
+// Topics come from the given CEFR level, or from every level when it is missing or unknown.
 func SuggestTopics(w http.ResponseWriter, r *http.Request) {
-	topics := []string{
-		"Business Communication", "Environmental Science", "Technology Innovation",
-		"Global Economics", "Cultural Diversity", "Health and Wellness",
-		"Digital Marketing", "Sustainable Development", "Artificial Intelligence",
-		"International Relations", "Climate Change", "Social Media Impact",
+	query := r.URL.Query()
+
+	count := DEFAULT_SUGGESTED_TOPICS
+	if value := query.Get("count"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > MAX_SUGGESTED_TOPICS {
+			http.Error(w, fmt.Sprintf("count phải nằm trong khoảng 1 đến %d", MAX_SUGGESTED_TOPICS), http.StatusBadRequest)
+			return
+		}
+		count = parsed
+	}
+	includeAI := false
+	if value := query.Get("include_ai_generated"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "include_ai_generated phải là true hoặc false", http.StatusBadRequest)
+			return
+		}
+		includeAI = parsed
+	}
+
+	// Accept both "B1" and "B1 - Intermediate"
+	level, _, _ := strings.Cut(strings.ToUpper(strings.TrimSpace(query.Get("level"))), " ")
+	var topics []string
+	if levelTopics, known := leveledTopics[level]; known {
+		topics = append(topics, levelTopics...)
+	} else {
+		level = ""
+		for _, levelName := range cefrLevelOrder {
+			topics = append(topics, leveledTopics[levelName]...)
+		}
 	}
 
-	rand.Seed(time.Now().UnixNano())
 	rand.Shuffle(len(topics), func(i, j int) { topics[i], topics[j] = topics[j], topics[i] })
+	suggestedTopics := topics[:min(count, len(topics))]
 
-	suggestedTopics := topics[:5] // Return 5 random topics
+	response := map[string]interface{}{
+		"topics": suggestedTopics,
+	}
+	if level != "" {
+		response["level"] = level
+	}
+	if includeAI {
+		aiTopics, err := generateAITopics(level, suggestedTopics)
+		if err != nil {
+			logf(r, "Error generating AI topic suggestions: %v", err)
+		}
+		response["topics"] = append(suggestedTopics, aiTopics...)
+		response["ai_generated_topics"] = aiTopics
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"topics": suggestedTopics,
+	json.NewEncoder(w).Encode(response)
+}
+
+// Ask Gemini for AI_SUGGESTED_TOPICS fresh topics for the level (any level when empty),
+// leaving out the ones already suggested. Returns no topics on error.
+func generateAITopics(level string, exclude []string) ([]string, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return []string{}, errors.New("Gemini client not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), AI_TOPICS_TIMEOUT)
+	defer cancel()
+
+	audience := "English learners of any level"
+	if level != "" {
+		audience = "English learners at CEFR level " + level
+	}
+	prompt := fmt.Sprintf(`Suggest %d fresh, specific topics for an English quiz for %s, including minors.
+Each topic is 1-4 words in English. Do not repeat these topics: %s.
+Respond JSON: {"topics": ["..."]}`, AI_SUGGESTED_TOPICS, audience, strings.Join(exclude, ", "))
+	result, err := client.Models.GenerateContent(ctx, "gemini-2.0-flash", genai.Text(prompt), &genai.GenerateContentConfig{
+		Temperature:      genai.Ptr[float32](1),
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"topics": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+			},
+			Required: []string{"topics"},
+		},
 	})
+	if err != nil {
+		return []string{}, err
+	}
+
+	var generated struct {
+		Topics []string `json:"topics"`
+	}
+	if err := json.Unmarshal([]byte(result.Text()), &generated); err != nil {
+		return []string{}, fmt.Errorf("failed to parse topic suggestions JSON: %w", err)
+	}
+	topics := []string{}
+	for _, topic := range generated.Topics {
+		topic = strings.TrimSpace(topic)
+		if topic == "" || slices.ContainsFunc(exclude, func(t string) bool { return strings.EqualFold(t, topic) }) {
+			continue
+		}
+		topics = append(topics, topic)
+		if len(topics) == AI_SUGGESTED_TOPICS {
+			break
+		}
+	}
+	return topics, nil
 }
 
 // GET /api/assignment/get-english-levels
@@ -468,6 +1207,12 @@ func GetEnglishLevels(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(englishLevels)
 }
 
+// GET /api/assignment/time-estimates - base minutes per question type and level multipliers
+func GetQuizTimeEstimates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quizTimeEstimates)
+}
+
 // GET /api/assignment/get-assignment-types
 func GetAssignmentTypes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -476,5 +1221,18 @@ func GetAssignmentTypes(w http.ResponseWriter, r *http.Request) {
 
 // Helper function to generate cache key.
 func generateCacheKey(req GenerateQuizzesRequest) string {
-	return strings.ToLower(req.Topic) + "-" + strings.Join(req.AssignmentTypes, "-") + "-" + req.EnglishLevel + "-" + strconv.Itoa(req.TotalQuestions)
+	return strings.ToLower(req.Topic) + "-" + strings.Join(req.AssignmentTypes, "-") + "-" + req.EnglishLevel + "-" + strconv.Itoa(req.TotalQuestions) +
+		"-" + strconv.FormatBool(req.DifficultyProgression) + "-" + strconv.FormatBool(req.CollocationsOnly) +
+		"-" + strings.ToLower(strings.Join(req.Prerequisites, "|")) + "-" + formatBloomsKey(req.RequiredBloomsDistribution)
+}
+
+// The required Bloom's distribution in a fixed order, e.g. "remember:2,apply:3"
+func formatBloomsKey(distribution map[string]int) string {
+	var parts []string
+	for _, level := range bloomLevels {
+		if count := distribution[level]; count > 0 {
+			parts = append(parts, level+":"+strconv.Itoa(count))
+		}
+	}
+	return strings.Join(parts, ",")
 }
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJaccardSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"She goes to school every day", "She goes to school every day", 1},
+		{"She goes to school every day", "He plays football on Sundays", 0},
+		{"I like green apples", "I like red apples", 0.2}, // 1 shared bigram of 5
+		{"", "She goes to school", 0},
+	}
+	for _, test := range tests {
+		if got := jaccardSimilarity(questionBigrams(test.a), questionBigrams(test.b)); got != test.want {
+			t.Errorf("similarity of %q and %q = %g, want %g", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestDeduplicateQuizzes(t *testing.T) {
+	tests := []struct {
+		name      string
+		questions []string
+		threshold float64
+		wantIDs   []int
+	}{
+		{
+			name: "near-duplicate wording",
+			questions: []string{
+				"What is the past tense of the verb go?",
+				"What is the past tense of the verb 'go'?",
+				"Choose the correct article: ___ apple a day.",
+			},
+			threshold: 0.5,
+			wantIDs:   []int{1, 3},
+		},
+		{
+			name: "same knowledge from a slightly different angle",
+			questions: []string{
+				"Which word is a synonym of happy?",
+				"Which word is a synonym of happy in this list?",
+				"Which word is an antonym of cold?",
+			},
+			threshold: 0.5,
+			wantIDs:   []int{1, 3},
+		},
+		{
+			name: "distinct questions kept",
+			questions: []string{
+				"What is the plural of child?",
+				"Fill in the blank: She ___ to work by bus.",
+				"Which sentence uses the present perfect correctly?",
+			},
+			threshold: 0.5,
+			wantIDs:   []int{1, 2, 3},
+		},
+		{
+			name: "strict threshold keeps similar questions",
+			questions: []string{
+				"Which word is a synonym of happy?",
+				"Which word is a synonym of happy in this list?",
+			},
+			threshold: 0.9,
+			wantIDs:   []int{1, 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quizzes := make([]Quiz, len(test.questions))
+			for i, question := range test.questions {
+				quizzes[i] = Quiz{ID: i + 1, Question: question}
+			}
+
+			var gotIDs []int
+			for _, quiz := range deduplicateQuizzes(quizzes, test.threshold) {
+				gotIDs = append(gotIDs, quiz.ID)
+			}
+			if !reflect.DeepEqual(gotIDs, test.wantIDs) {
+				t.Errorf("kept %v, want %v", gotIDs, test.wantIDs)
+			}
+		})
+	}
+}
+
+func TestDeduplicateQuizzesComparesCollocationSentences(t *testing.T) {
+	instruction := "Choose the word that collocates best with the sentence."
+	quizzes := []Quiz{
+		{ID: 1, Question: instruction, Sentence: "I need to ___ a decision about my future."},
+		{ID: 2, Question: instruction, Sentence: "She always ___ her homework after dinner."},
+		{ID: 3, Question: instruction, Sentence: "I need to ___ a decision about my future!"},
+	}
+	if kept := deduplicateQuizzes(quizzes, 0.5); len(kept) != 2 || kept[0].ID != 1 || kept[1].ID != 2 {
+		t.Errorf("kept %+v, want quizzes 1 and 2", kept)
+	}
+}
+
+func TestValidateRequestPrerequisites(t *testing.T) {
+	tenWords := "one two three four five six seven eight nine ten"
+	tests := []struct {
+		name          string
+		prerequisites []string
+		wantErr       bool
+	}{
+		{"none", nil, false},
+		{"chain", []string{"present simple", "past simple"}, false},
+		{"longest allowed", []string{tenWords}, false},
+		{"most allowed", []string{"a", "b", "c", "d", "e"}, false},
+		{"too many", []string{"a", "b", "c", "d", "e", "f"}, true},
+		{"too long", []string{tenWords + " eleven"}, true},
+		{"blank", []string{"present simple", "  "}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := GenerateQuizzesRequest{
+				Topic:           "Present perfect",
+				EnglishLevel:    "B1",
+				TotalQuestions:  5,
+				AssignmentTypes: []string{"Multiple Choice"},
+				Prerequisites:   test.prerequisites,
+			}
+			if err := validateRequest(request); (err != nil) != test.wantErr {
+				t.Errorf("validateRequest() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildGeminiPromptPrerequisites(t *testing.T) {
+	request := GenerateQuizzesRequest{
+		Topic:           "Present perfect",
+		EnglishLevel:    "B1",
+		TotalQuestions:  5,
+		AssignmentTypes: []string{"Multiple Choice"},
+	}
+	if prompt := buildGeminiPrompt(request); strings.Contains(prompt, "PRIOR KNOWLEDGE") {
+		t.Error("the prompt mentions prior knowledge without prerequisites")
+	}
+
+	request.Prerequisites = []string{"present  simple", "past simple"}
+	prompt := buildGeminiPrompt(request)
+	want := "Students have already mastered: present simple, past simple. Do not test these concepts; instead focus on Present perfect assuming this prior knowledge."
+	if !strings.Contains(prompt, want) {
+		t.Errorf("the prompt does not include %q:\n%s", want, prompt)
+	}
+}
+
+func TestGenerateCacheKeyPrerequisites(t *testing.T) {
+	request := GenerateQuizzesRequest{Topic: "Present perfect", EnglishLevel: "B1", TotalQuestions: 5, AssignmentTypes: []string{"Multiple Choice"}}
+	withPrerequisites := request
+	withPrerequisites.Prerequisites = []string{"past simple"}
+	if generateCacheKey(request) == generateCacheKey(withPrerequisites) {
+		t.Error("requests with and without prerequisites share a cache key")
+	}
+}
+
+func TestValidateTopicWithGeminiIsCached(t *testing.T) {
+	gemini := useFakeGemini(t, answerGemini(`{"valid": false, "reason": " Chủ đề không phù hợp. "}`))
+	t.Cleanup(func() {
+		topicValidationCacheMutex.Lock()
+		clear(topicValidationCache)
+		topicValidationCacheMutex.Unlock()
+	})
+
+	for _, topic := range []string{"Test cached topic", "  test CACHED topic "} {
+		validation, err := validateTopicWithGemini(topic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if validation.Valid || validation.Reason != "Chủ đề không phù hợp." {
+			t.Errorf("%q: validation = %+v", topic, validation)
+		}
+	}
+	if calls := len(gemini.received()); calls != 1 {
+		t.Errorf("Gemini was called %d times for the same topic, want once", calls)
+	}
+}
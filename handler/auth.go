@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"EngPal/internal/config"
+	"EngPal/security"
+)
+
+// JWT claim of administrators
+const ADMIN_CLAIM = "admin"
+
+// Check the request's Bearer JWT for a true boolean claim. Returns the status to
+// reject the request with: 401 without a valid token, 403 without the claim.
+func requireJWTClaim(r *http.Request, claim string) (int, bool) {
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		return http.StatusUnauthorized, false
+	}
+	claims, err := security.ParseJWT(token, config.JWTSecret())
+	if err != nil {
+		return http.StatusUnauthorized, false
+	}
+	if granted, _ := claims[claim].(bool); !granted {
+		return http.StatusForbidden, false
+	}
+	return 0, true
+}
+
+// The subject of the request's Bearer JWT, or "" without a valid token
+func jwtSubject(r *http.Request) string {
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		return ""
+	}
+	claims, err := security.ParseJWT(token, config.JWTSecret())
+	if err != nil {
+		return ""
+	}
+	subject, _ := claims["sub"].(string)
+	return subject
+}
+
+// Write the error for a request rejected by requireJWTClaim.
+func writeJWTClaimError(w http.ResponseWriter, status int, forbiddenMessage string) {
+	if status == http.StatusUnauthorized {
+		http.Error(w, "token đăng nhập không hợp lệ hoặc đã hết hạn", status)
+		return
+	}
+	http.Error(w, forbiddenMessage, status)
+}
+
+const (
+	MIN_ACCESS_KEY_LENGTH = 16
+	MAX_ACCESS_KEY_LENGTH = 256
+)
+
+// Letters, digits and the punctuation used by base64 and URL-safe tokens
+var accessKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._~+/=-]+$`)
+
+var (
+	errMissingAccessKey = errors.New("missing access key")
+	errInvalidAccessKey = errors.New("invalid access key")
+)
+
+type accessKeyContextKey struct{}
+
+// Read the access key from "Authorization: Bearer <key>" or, failing that, the
+// X-Access-Key header, and check its format
+func accessKeyFromHeaders(r *http.Request) (string, error) {
+	key := ""
+	if header := strings.TrimSpace(r.Header.Get("Authorization")); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return "", errInvalidAccessKey
+		}
+		key = strings.TrimSpace(token)
+	} else {
+		key = strings.TrimSpace(r.Header.Get("X-Access-Key"))
+	}
+
+	if key == "" {
+		return "", errMissingAccessKey
+	}
+	if len(key) < MIN_ACCESS_KEY_LENGTH || len(key) > MAX_ACCESS_KEY_LENGTH || !accessKeyPattern.MatchString(key) {
+		return "", errInvalidAccessKey
+	}
+	return key, nil
+}
+
+// RequireAccessKey rejects requests without a well-formed access key with 401 and
+// passes the key on to the handler in the request context.
+func RequireAccessKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := accessKeyFromHeaders(r)
+		if err != nil {
+			writeAccessKeyError(w, r, err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), accessKeyContextKey{}, key)))
+	}
+}
+
+// AccessKey returns the key stored by RequireAccessKey, or "" outside it.
+func AccessKey(r *http.Request) string {
+	key, _ := r.Context().Value(accessKeyContextKey{}).(string)
+	return key
+}
+
+func writeAccessKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	code := "invalid_access_key"
+	if errors.Is(err, errMissingAccessKey) {
+		code = "missing_access_key"
+	}
+	writeLocalizedError(w, http.StatusUnauthorized, code, r.URL.Query().Get("language"), PERSONA_TEACHER, nil)
+}
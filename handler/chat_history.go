@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"EngPal/internal"
+	"EngPal/internal/config"
+
+	"google.golang.org/genai"
+)
+
+// A session's latest CHAT_HISTORY_TURNS turns are always sent to Gemini verbatim.
+// Once its history outgrows CHAT_HISTORY_TOKEN_BUDGET, the turns before them are
+// folded into a running summary in the background after the answer is sent. Until
+// the summary catches up, or if it cannot be generated, the oldest turns are dropped.
+
+const (
+	CHARS_PER_TOKEN        = 4 // Estimate for text Gemini has not counted, like questions
+	MAX_CHAT_SUMMARY_WORDS = 200
+	CHAT_SUMMARY_TIMEOUT   = 30 * time.Second
+)
+
+// Sent in the model's turn after the summary, so the history keeps alternating
+const CHAT_SUMMARY_ACKNOWLEDGEMENT = "Got it, I remember our conversation so far."
+
+// Folds turns into a running summary, replaced in tests
+var chatHistorySummarizer = summarizeChatTurns
+
+// Titles a session from its transcript, replaced in tests
+var chatTitleGenerator = generateChatTitle
+
+// Rough token count of text Gemini has not counted
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + CHARS_PER_TOKEN - 1) / CHARS_PER_TOKEN
+}
+
+// Tokens of a turn: the answer as Gemini counted it, the question and image estimated
+func (message ChatSessionMessage) tokens() int {
+	answerTokens := message.OutputTokens
+	if answerTokens == 0 {
+		answerTokens = estimateTokens(message.Answer)
+	}
+	questionTokens := estimateTokens(message.Question)
+	if message.ImageRef != "" {
+		questionTokens += CHAT_IMAGE_TOKENS
+	}
+	return questionTokens + answerTokens
+}
+
+// The learner's turn: the question, with its image while the image is still stored
+func (message ChatSessionMessage) questionContent() *genai.Content {
+	parts := []*genai.Part{genai.NewPartFromText(message.Question)}
+	if message.ImageRef != "" {
+		if image := loadChatImagePart(message.ImageRef); image != nil {
+			parts = append(parts, image)
+		} else {
+			parts = append(parts, genai.NewPartFromText(CHAT_IMAGE_PLACEHOLDER))
+		}
+	}
+	return genai.NewContentFromParts(parts, genai.RoleUser)
+}
+
+func chatSummaryTurn(summary string) string {
+	return "Summary of our conversation so far:\n" + summary
+}
+
+// Tokens of the history that has not been summarized, with the summary itself.
+// The caller holds chatSessionsMutex.
+func (session *ChatSession) historyTokens() int {
+	tokens := 0
+	if session.Summary != "" {
+		tokens += estimateTokens(chatSummaryTurn(session.Summary)) + estimateTokens(CHAT_SUMMARY_ACKNOWLEDGEMENT)
+	}
+	for _, message := range session.Messages[session.SummarizedTurns:] {
+		tokens += message.tokens()
+	}
+	return tokens
+}
+
+// The history Gemini sees: the running summary, then as many of the latest turns after
+// it as fit CHAT_HISTORY_TOKEN_BUDGET. The caller holds chatSessionsMutex.
+func (session *ChatSession) historyContents() []*genai.Content {
+	budget := config.ChatHistoryTokenBudget()
+	var contents []*genai.Content
+	if session.Summary != "" {
+		summary := chatSummaryTurn(session.Summary)
+		budget -= estimateTokens(summary) + estimateTokens(CHAT_SUMMARY_ACKNOWLEDGEMENT)
+		contents = append(contents,
+			genai.NewContentFromText(summary, genai.RoleUser),
+			genai.NewContentFromText(CHAT_SUMMARY_ACKNOWLEDGEMENT, genai.RoleModel))
+	}
+
+	turns := session.Messages[session.SummarizedTurns:]
+	first := len(turns)
+	for first > 0 && turns[first-1].tokens() <= budget {
+		budget -= turns[first-1].tokens()
+		first--
+	}
+	for _, message := range turns[first:] {
+		contents = append(contents,
+			message.questionContent(),
+			genai.NewContentFromText(message.Answer, genai.RoleModel))
+	}
+	return contents
+}
+
+// Start folding the turns before the latest CHAT_HISTORY_TURNS into the summary once
+// the history is over budget. The caller holds chatSessionsMutex.
+func (session *ChatSession) summarizeIfOverBudget() {
+	upTo := len(session.Messages) - config.ChatHistoryTurns()
+	if session.summarizing || upTo <= session.SummarizedTurns || session.historyTokens() <= config.ChatHistoryTokenBudget() {
+		return
+	}
+	session.summarizing = true
+	go summarizeChatSession(session.ID, session.Summary, slices.Clone(session.Messages[session.SummarizedTurns:upTo]), upTo)
+}
+
+// Start generating a title once the learner has asked MIN_CHAT_TITLE_USER_MESSAGES
+// questions. Until one is generated, every answer tries again. The caller holds
+// chatSessionsMutex.
+func (session *ChatSession) titleIfReady() {
+	if session.Title != "" || session.titling || len(session.Messages) < MIN_CHAT_TITLE_USER_MESSAGES {
+		return
+	}
+	transcript, _, err := buildChatTranscript(session.transcript(MAX_CHAT_TRANSCRIPT_WORDS))
+	if err != nil {
+		log.Printf("Error building the transcript to title chat session %s: %v", session.ID, err)
+		return
+	}
+	session.titling = true
+	go titleChatSession(session.ID, transcript, chatTitleGenerator)
+}
+
+// Store a generated title, unless the learner set one meanwhile. Failures are only
+// logged; the next answer tries again.
+func titleChatSession(sessionID, transcript string, generate func(string) (string, error)) {
+	title, err := generate(transcript)
+
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+	session, exists := chatSessions[sessionID]
+	if !exists {
+		return
+	}
+	session.titling = false
+	if err != nil {
+		log.Printf("Error generating a title for chat session %s: %v", sessionID, err)
+		return
+	}
+	if session.Title == "" {
+		session.Title = title
+	}
+}
+
+// Fold turns into a session's summary. On failure the summary is left as it was and
+// the prompt keeps dropping the oldest turns; the next answer tries again.
+func summarizeChatSession(sessionID, summary string, turns []ChatSessionMessage, upTo int) {
+	updated, err := chatHistorySummarizer(summary, turns)
+
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+	session, exists := chatSessions[sessionID]
+	if !exists {
+		return
+	}
+	session.summarizing = false
+	if err != nil {
+		log.Printf("Error summarizing chat session %s, trimming its history instead: %v", sessionID, err)
+		return
+	}
+	session.Summary = updated
+	session.SummarizedTurns = upTo
+}
+
+// Ask Gemini to add turns to the running summary of a conversation.
+func summarizeChatTurns(summary string, turns []ChatSessionMessage) (string, error) {
+	var transcript strings.Builder
+	for _, message := range turns {
+		fmt.Fprintf(&transcript, "Learner: %s\nTutor: %s\n\n", message.Question, message.Answer)
+	}
+	if summary == "" {
+		summary = "(none yet)"
+	}
+	prompt := fmt.Sprintf(`Update the running summary of a conversation between an English learner and their English tutor, so the tutor can continue it without the full transcript.
+- Keep every fact about the learner: name, age, level, goals, interests and the mistakes they keep making
+- Keep what was explained or practised, and anything the tutor promised to come back to
+- Leave out greetings and small talk
+- Write plain English sentences, at most %d words, with no markdown
+
+CURRENT SUMMARY:
+%s
+
+NEW TURNS:
+%s`, MAX_CHAT_SUMMARY_WORDS, summary, transcript.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), CHAT_SUMMARY_TIMEOUT)
+	defer cancel()
+	result, _, err := internal.GenerateWithFallback(ctx, chatbotModels, genai.Text(prompt), &genai.GenerateContentConfig{
+		Temperature:    genai.Ptr[float32](0),
+		SafetySettings: chatbotSafetySettings(),
+	})
+	if err != nil {
+		return "", err
+	}
+	recordChatbotUsage(internal.UsageOf(result))
+	if _, blocked := blockedCategory(result); blocked {
+		return "", errResponseBlocked
+	}
+	updated := strings.TrimSpace(result.Text())
+	if updated == "" {
+		return "", errors.New("empty summary")
+	}
+	return updated, nil
+}
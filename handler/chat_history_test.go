@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"EngPal/internal/config"
+
+	"google.golang.org/genai"
+)
+
+// Use a small history window and budget for the test
+func useChatHistoryConfig(t *testing.T, turns, budget int) {
+	t.Helper()
+	cfg, _ := config.Load()
+	cfg.ChatHistoryTurns = turns
+	cfg.ChatHistoryTokenBudget = budget
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+}
+
+// Replace the Gemini summarizer for the test
+func useChatHistorySummarizer(t *testing.T, summarizer func(string, []ChatSessionMessage) (string, error)) {
+	t.Helper()
+	original := chatHistorySummarizer
+	chatHistorySummarizer = summarizer
+	t.Cleanup(func() { chatHistorySummarizer = original })
+}
+
+func deleteChatSession(sessionID string) {
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+	delete(chatSessions, sessionID)
+	delete(expiredChatSessions, sessionID)
+}
+
+// Wait for a background summary of the session to finish
+func waitForChatSummary(t *testing.T, sessionID string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		chatSessionsMutex.Lock()
+		summarizing := chatSessions[sessionID].summarizing
+		chatSessionsMutex.Unlock()
+		if !summarizing {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("the summary never finished")
+}
+
+func contentsText(contents []*genai.Content) string {
+	var text strings.Builder
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			text.WriteString(part.Text + "\n")
+		}
+	}
+	return text.String()
+}
+
+func contentsTokens(contents []*genai.Content) int {
+	tokens := 0
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			tokens += estimateTokens(part.Text)
+		}
+	}
+	return tokens
+}
+
+// The learner's question and the tutor's answer of a simulated turn
+func simulatedTurn(turn int) (string, string) {
+	switch turn {
+	case 0:
+		return "Remember: my name is Lan and I am preparing for the IELTS exam in June.", "Nice to meet you, Lan! We will practise for IELTS together."
+	case 10:
+		return "Remember: I always forget the s on verbs after he and she.", "That is the third person s. Let's practise it: she goes, he likes, it works."
+	}
+	question := fmt.Sprintf("Question %d: can you give me another example sentence using the present perfect tense, please?", turn)
+	answer := fmt.Sprintf("Answer %d: Sure! \"I have lived in Hanoi for five years.\" We use the present perfect for actions that started in the past and continue now. ", turn) +
+		strings.Repeat("Try making your own sentence with 'have' and a past participle. ", 2)
+	return question, answer
+}
+
+// Send 50 turns through a session, checking every prompt's history stays under budget
+func simulateChatSession(t *testing.T, sessionID string, budget int) []*genai.Content {
+	t.Helper()
+	var history []*genai.Content
+	var caller chatSessionCaller
+	for turn := 0; turn < 50; turn++ {
+		question, answer := simulatedTurn(turn)
+		secret, err := beginChatSessionMessage(sessionID, caller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != "" {
+			caller.Secret = secret
+		}
+		contents := chatSessionContents(sessionID, genai.NewPartFromText(question))
+		history = contents[:len(contents)-1]
+		if tokens := contentsTokens(history); tokens > budget {
+			t.Fatalf("turn %d: history of %d tokens is over the budget of %d", turn, tokens, budget)
+		}
+		endChatSessionMessage(sessionID, ChatSessionMessage{Question: question, Answer: answer, Model: "test"})
+		waitForChatSummary(t, sessionID)
+	}
+	return history
+}
+
+func TestChatHistorySummarizesOldTurns(t *testing.T) {
+	const budget = 600
+	useChatHistoryConfig(t, 3, budget)
+	// Keeps the facts the learner asked to be remembered, like a good summary would
+	useChatHistorySummarizer(t, func(summary string, turns []ChatSessionMessage) (string, error) {
+		facts := []string{}
+		if summary != "" {
+			facts = append(facts, summary)
+		}
+		for _, turn := range turns {
+			if strings.HasPrefix(turn.Question, "Remember:") {
+				facts = append(facts, strings.TrimPrefix(turn.Question, "Remember: "))
+			}
+		}
+		return strings.Join(facts, " "), nil
+	})
+	sessionID := "test-summarized-session"
+	defer deleteChatSession(sessionID)
+
+	history := simulateChatSession(t, sessionID, budget)
+
+	text := contentsText(history)
+	if !strings.HasPrefix(text, chatSummaryTurn("")) {
+		t.Errorf("history does not start with the summary:\n%s", text)
+	}
+	for _, fact := range []string{"my name is Lan", "preparing for the IELTS exam", "forget the s on verbs"} {
+		if !strings.Contains(text, fact) {
+			t.Errorf("early fact %q was lost from the history", fact)
+		}
+	}
+	if strings.Contains(text, "Nice to meet you, Lan!") {
+		t.Error("the first turn is still sent verbatim")
+	}
+	if _, latestAnswer := simulatedTurn(48); !strings.Contains(text, latestAnswer) {
+		t.Error("the latest turn is missing from the history")
+	}
+
+	chatSessionsMutex.Lock()
+	session := chatSessions[sessionID]
+	summarizedTurns, storedMessages := session.SummarizedTurns, len(session.Messages)
+	chatSessionsMutex.Unlock()
+	if summarizedTurns == 0 || summarizedTurns > storedMessages-3 {
+		t.Errorf("summarized %d of %d turns, want some but not the latest 3", summarizedTurns, storedMessages)
+	}
+	if storedMessages != 50 {
+		t.Errorf("the session stores %d messages, want all 50", storedMessages)
+	}
+}
+
+func TestChatHistoryFallsBackToTruncation(t *testing.T) {
+	const budget = 600
+	useChatHistoryConfig(t, 3, budget)
+	summaries := 0
+	useChatHistorySummarizer(t, func(string, []ChatSessionMessage) (string, error) {
+		summaries++
+		return "", errors.New("gemini unavailable")
+	})
+	sessionID := "test-truncated-session"
+	defer deleteChatSession(sessionID)
+
+	history := simulateChatSession(t, sessionID, budget)
+
+	text := contentsText(history)
+	if strings.Contains(text, chatSummaryTurn("")) {
+		t.Error("history has a summary although summarizing failed")
+	}
+	if _, latestAnswer := simulatedTurn(48); !strings.Contains(text, latestAnswer) {
+		t.Error("the latest turn is missing from the history")
+	}
+	if summaries < 2 {
+		t.Errorf("summarizing was tried %d times, want it retried after failures", summaries)
+	}
+}
+
+func TestChatHistoryUnderBudgetIsVerbatim(t *testing.T) {
+	useChatHistoryConfig(t, 3, 100000)
+	useChatHistorySummarizer(t, func(string, []ChatSessionMessage) (string, error) {
+		t.Error("a history under budget was summarized")
+		return "", nil
+	})
+	sessionID := "test-verbatim-session"
+	defer deleteChatSession(sessionID)
+
+	history := simulateChatSession(t, sessionID, 100000)
+	if len(history) != 2*49 {
+		t.Errorf("history has %d contents, want every earlier turn", len(history))
+	}
+	if history[0].Role != genai.RoleUser || history[1].Role != genai.RoleModel {
+		t.Errorf("turns are not sent as user and model contents")
+	}
+}
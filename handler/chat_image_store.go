@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// Session messages keep only the SHA-256 of an attached image. The images themselves
+// are kept here, shared by hash, so later turns can show them to Gemini again. Once
+// the store is over MAX_STORED_CHAT_IMAGE_BYTES the oldest images are dropped, and the
+// history mentions the image instead.
+
+const MAX_STORED_CHAT_IMAGE_BYTES = 64 << 20
+
+// Gemini's token count for an image up to 384 pixels on both sides, used as the
+// estimate for every image in a session's history
+const CHAT_IMAGE_TOKENS = 258
+
+// Sent in place of an image that is no longer stored
+const CHAT_IMAGE_PLACEHOLDER = "(I attached an image here.)"
+
+type storedChatImage struct {
+	Data     []byte
+	MIMEType string
+}
+
+var (
+	chatImages      = make(map[string]storedChatImage)
+	chatImageOrder  []string // Oldest first
+	chatImageBytes  int
+	chatImagesMutex sync.Mutex
+)
+
+// Store an image part and return its reference, "sha256:" and the hex digest.
+func storeChatImage(image *genai.Part) string {
+	if image == nil || image.InlineData == nil {
+		return ""
+	}
+	digest := sha256.Sum256(image.InlineData.Data)
+	ref := "sha256:" + hex.EncodeToString(digest[:])
+
+	chatImagesMutex.Lock()
+	defer chatImagesMutex.Unlock()
+
+	if _, exists := chatImages[ref]; exists {
+		return ref
+	}
+	chatImages[ref] = storedChatImage{Data: image.InlineData.Data, MIMEType: image.InlineData.MIMEType}
+	chatImageOrder = append(chatImageOrder, ref)
+	chatImageBytes += len(image.InlineData.Data)
+	for chatImageBytes > MAX_STORED_CHAT_IMAGE_BYTES && len(chatImageOrder) > 1 {
+		oldest := chatImageOrder[0]
+		chatImageOrder = chatImageOrder[1:]
+		chatImageBytes -= len(chatImages[oldest].Data)
+		delete(chatImages, oldest)
+	}
+	return ref
+}
+
+// The stored image for a reference, or nil once it has been dropped
+func loadChatImagePart(ref string) *genai.Part {
+	chatImagesMutex.Lock()
+	defer chatImagesMutex.Unlock()
+
+	image, exists := chatImages[ref]
+	if !exists {
+		return nil
+	}
+	return genai.NewPartFromBytes(image.Data, image.MIMEType)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// Start the test with an empty image store
+func useEmptyChatImageStore(t *testing.T) {
+	t.Helper()
+	chatImagesMutex.Lock()
+	images, order, size := chatImages, chatImageOrder, chatImageBytes
+	chatImages, chatImageOrder, chatImageBytes = make(map[string]storedChatImage), nil, 0
+	chatImagesMutex.Unlock()
+	t.Cleanup(func() {
+		chatImagesMutex.Lock()
+		chatImages, chatImageOrder, chatImageBytes = images, order, size
+		chatImagesMutex.Unlock()
+	})
+}
+
+func TestStoreChatImage(t *testing.T) {
+	useEmptyChatImageStore(t)
+
+	photo := genai.NewPartFromBytes([]byte("a photo of a street sign"), "image/png")
+	ref := storeChatImage(photo)
+	if !strings.HasPrefix(ref, "sha256:") || len(ref) != len("sha256:")+64 {
+		t.Fatalf("ref = %q, want sha256: and a hex digest", ref)
+	}
+	if again := storeChatImage(genai.NewPartFromBytes([]byte("a photo of a street sign"), "image/png")); again != ref {
+		t.Errorf("the same image got refs %q and %q", ref, again)
+	}
+	if other := storeChatImage(genai.NewPartFromBytes([]byte("a photo of a menu"), "image/png")); other == ref {
+		t.Error("different images got the same ref")
+	}
+	if chatImageBytes != len("a photo of a street sign")+len("a photo of a menu") {
+		t.Errorf("stored %d bytes, want each image once", chatImageBytes)
+	}
+	if storeChatImage(nil) != "" {
+		t.Error("no image got a ref")
+	}
+
+	loaded := loadChatImagePart(ref)
+	if loaded == nil || !bytes.Equal(loaded.InlineData.Data, photo.InlineData.Data) || loaded.InlineData.MIMEType != "image/png" {
+		t.Errorf("loaded %+v, want the stored photo", loaded)
+	}
+}
+
+func TestStoreChatImageDropsOldestOverLimit(t *testing.T) {
+	useEmptyChatImageStore(t)
+
+	var refs []string
+	for i := byte(0); i < 3; i++ {
+		large := bytes.Repeat([]byte{i}, MAX_STORED_CHAT_IMAGE_BYTES/2-1)
+		refs = append(refs, storeChatImage(genai.NewPartFromBytes(large, "image/jpeg")))
+	}
+	if loadChatImagePart(refs[0]) != nil {
+		t.Error("the oldest image is still stored over the limit")
+	}
+	if loadChatImagePart(refs[1]) == nil || loadChatImagePart(refs[2]) == nil {
+		t.Error("newer images were dropped")
+	}
+	if chatImageBytes > MAX_STORED_CHAT_IMAGE_BYTES {
+		t.Errorf("stored %d bytes, over the limit of %d", chatImageBytes, MAX_STORED_CHAT_IMAGE_BYTES)
+	}
+}
+
+func TestChatHistoryIncludesStoredImages(t *testing.T) {
+	useEmptyChatImageStore(t)
+	useChatHistoryConfig(t, 6, 100000)
+	sessionID := "test-image-session"
+	defer deleteChatSession(sessionID)
+
+	photo := genai.NewPartFromBytes([]byte("a photo of a street sign"), "image/png")
+	secret, err := beginChatSessionMessage(sessionID, chatSessionCaller{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endChatSessionMessage(sessionID, ChatSessionMessage{Question: "What does this sign say?", Answer: "It says \"No parking\".", ImageRef: storeChatImage(photo)})
+	if _, err := beginChatSessionMessage(sessionID, chatSessionCaller{Secret: secret}); err != nil {
+		t.Fatal(err)
+	}
+	defer endChatSessionMessage(sessionID, ChatSessionMessage{})
+
+	contents := chatSessionContents(sessionID, genai.NewPartFromText("And the small text under it?"))
+	if parts := contents[0].Parts; len(parts) != 2 || parts[1].InlineData == nil || !bytes.Equal(parts[1].InlineData.Data, photo.InlineData.Data) {
+		t.Errorf("the earlier question was sent as %+v, want its text and image", parts)
+	}
+
+	useEmptyChatImageStore(t) // The image has been dropped since
+	contents = chatSessionContents(sessionID, genai.NewPartFromText("And the small text under it?"))
+	if parts := contents[0].Parts; len(parts) != 2 || parts[1].Text != CHAT_IMAGE_PLACEHOLDER {
+		t.Errorf("the earlier question was sent as %+v, want its text and the placeholder", parts)
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"EngPal/internal/config"
+	"EngPal/repository"
+)
+
+// How many chatbot messages a user has left in the current minute and UTC day
+type ChatbotQuota struct {
+	MinuteLimit     int       `json:"minute_limit"`
+	MinuteRemaining int       `json:"minute_remaining"`
+	MinuteResetAt   time.Time `json:"minute_reset_at"`
+	DailyLimit      int       `json:"daily_limit"`
+	DailyRemaining  int       `json:"daily_remaining"`
+	DailyResetAt    time.Time `json:"daily_reset_at"`
+}
+
+// Where chatbot message counts are kept, set by SetChatQuotaRepo at startup
+var chatQuotaRepo repository.ChatQuotaRepo
+
+// SetChatQuotaRepo sets the repository chatbot message counts are kept in.
+func SetChatQuotaRepo(repo repository.ChatQuotaRepo) {
+	chatQuotaRepo = repo
+}
+
+// Charge one message to the caller once their question has passed the local checks
+// and before the first model call, so rejected questions cost nothing and no model
+// call goes unpaid. Returns false once they have sent CHAT_RATE_LIMIT
+// messages this minute or CHAT_DAILY_QUOTA today. Without a repository every message
+// is allowed.
+func consumeChatQuota(r *http.Request) (ChatbotQuota, bool) {
+	if chatQuotaRepo == nil {
+		return ChatbotQuota{}, true
+	}
+	usage, allowed := chatQuotaRepo.Consume(chatQuotaIdentity(r), time.Now(), config.ChatRateLimit(), config.ChatDailyQuota())
+	return chatbotQuotaFrom(usage), allowed
+}
+
+// Who the chatbot limits apply to: the subject of a valid JWT, else the client IP.
+// Nothing the client can make up, like a user ID, picks the bucket. Classrooms share
+// an IP, so signed-in learners get their own.
+func chatQuotaIdentity(r *http.Request) string {
+	if subject := jwtSubject(r); subject != "" {
+		return "user:" + subject
+	}
+	return "ip:" + clientIP(r)
+}
+
+func chatbotQuotaFrom(usage repository.ChatQuotaUsage) ChatbotQuota {
+	minuteLimit, dailyLimit := config.ChatRateLimit(), config.ChatDailyQuota()
+	return ChatbotQuota{
+		MinuteLimit:     minuteLimit,
+		MinuteRemaining: max(0, minuteLimit-usage.MinuteCount),
+		MinuteResetAt:   usage.MinuteResetAt,
+		DailyLimit:      dailyLimit,
+		DailyRemaining:  max(0, dailyLimit-usage.DailyCount),
+		DailyResetAt:    usage.DailyResetAt,
+	}
+}
+
+// The error code for a message over the quota, with the limit it hit and when that resets
+func chatQuotaError(quota ChatbotQuota) (code string, limit int, resetAt time.Time) {
+	if quota.DailyRemaining == 0 {
+		return "chat_quota_exceeded", quota.DailyLimit, quota.DailyResetAt
+	}
+	return "chat_rate_limited", quota.MinuteLimit, quota.MinuteResetAt
+}
+
+// Write the 429 for a message over the quota, with Retry-After
+func writeChatQuotaError(w http.ResponseWriter, request Conversation, quota ChatbotQuota) {
+	code, limit, resetAt := chatQuotaError(quota)
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(time.Until(resetAt).Seconds())))))
+	writeChatError(w, request, http.StatusTooManyRequests, code, map[string]interface{}{
+		"limit":    limit,
+		"reset_at": resetAt,
+		"quota":    quota,
+	})
+}
+
+// GET /api/chatbot/quota - the caller's remaining chatbot messages, for the same
+// identity the messages are charged to
+func GetChatbotQuota(w http.ResponseWriter, r *http.Request) {
+	quota := ChatbotQuota{MinuteLimit: config.ChatRateLimit(), MinuteRemaining: config.ChatRateLimit(),
+		DailyLimit: config.ChatDailyQuota(), DailyRemaining: config.ChatDailyQuota()}
+	if chatQuotaRepo != nil {
+		quota = chatbotQuotaFrom(chatQuotaRepo.Usage(chatQuotaIdentity(r), time.Now()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quota)
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"EngPal/internal/config"
+	"EngPal/repository/repo_impl"
+)
+
+// Count chatbot messages in a fresh repository for the test, allowing perMinute a
+// minute and perDay a day
+func useChatQuota(t *testing.T, perMinute, perDay int) {
+	t.Helper()
+	cfg, _ := config.Load()
+	cfg.ChatRateLimit = perMinute
+	cfg.ChatDailyQuota = perDay
+	config.Use(cfg)
+	SetChatQuotaRepo(repo_impl.NewChatQuotaRepoImpl())
+	t.Cleanup(func() {
+		SetChatQuotaRepo(nil)
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+}
+
+// A one-second silent WAV clip
+func sampleWAV() []byte {
+	const byteRate = 8000
+	var clip bytes.Buffer
+	clip.WriteString("RIFF")
+	binary.Write(&clip, binary.LittleEndian, uint32(36+byteRate))
+	clip.WriteString("WAVEfmt ")
+	binary.Write(&clip, binary.LittleEndian, []uint32{16, 1<<16 | 1, 8000, byteRate, 8<<16 | 1})
+	clip.WriteString("data")
+	binary.Write(&clip, binary.LittleEndian, uint32(byteRate))
+	clip.Write(make([]byte, byteRate))
+	return clip.Bytes()
+}
+
+func TestChatQuotaIsChargedBeforeGemini(t *testing.T) {
+	useEmptyTopicCache(t)
+	useChatQuota(t, 1, 100)
+	gemini := useFakeGemini(t, answerGemini(`{"topic": "english_learning"}`))
+
+	ask := func(question string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/chatbot/generate-answer", strings.NewReader(`{"question": "`+question+`"}`))
+		request.RemoteAddr = "203.0.113.20:1234"
+		GenerateAnswer(recorder, request)
+		return recorder.Code
+	}
+	ask("How do I use the present perfect?")
+	calls := len(gemini.received())
+	if calls == 0 {
+		t.Fatal("the first question never reached Gemini")
+	}
+	if status := ask("When do I use the past perfect?"); status != http.StatusTooManyRequests {
+		t.Errorf("second question in a minute: status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if after := len(gemini.received()); after != calls {
+		t.Errorf("the question over the quota made %d Gemini calls, want none", after-calls)
+	}
+}
+
+func TestChatQuotaIsChargedBeforeTranscription(t *testing.T) {
+	useChatQuota(t, 1, 100)
+	gemini := useFakeGemini(t, answerGemini(`{"text": "How do I use the present perfect?"}`))
+
+	send := func() int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("audio", "question.wav")
+		part.Write(sampleWAV())
+		form.Close()
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/chatbot/generate-answer/audio", &body)
+		request.Header.Set("Content-Type", form.FormDataContentType())
+		request.RemoteAddr = "203.0.113.21:1234"
+		GenerateAnswerFromAudio(recorder, request)
+		return recorder.Code
+	}
+	send()
+	calls := len(gemini.received())
+	if calls == 0 {
+		t.Fatal("the first clip was never transcribed")
+	}
+	if status := send(); status != http.StatusTooManyRequests {
+		t.Errorf("second clip in a minute: status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if after := len(gemini.received()); after != calls {
+		t.Errorf("the clip over the quota made %d Gemini calls, want none", after-calls)
+	}
+}
+
+func TestChatbotWebSocketChargesQuotaBeforeTopicCheck(t *testing.T) {
+	useEmptyTopicCache(t)
+	useChatQuota(t, 0, 100)
+	gemini := useFakeGemini(t, answerGemini(`{"topic": "english_learning"}`))
+
+	frames := askOverWebSocket(t, "How do I use the present perfect?")
+	if last := frames[len(frames)-1]; last.Type != STREAM_FRAME_ERROR || last.Error != "chat_rate_limited" {
+		t.Errorf("last frame = %+v, want a chat_rate_limited error", last)
+	}
+	if calls := gemini.received(); len(calls) != 0 {
+		t.Errorf("a question over the quota made %d Gemini calls, want none", len(calls))
+	}
+}
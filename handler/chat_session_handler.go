@@ -0,0 +1,563 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"EngPal/internal/config"
+	"EngPal/utils"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/genai"
+)
+
+// A chatbot session keyed by the client's session ID, with its history
+type ChatSession struct {
+	ID            string               `json:"id"`
+	Title         string               `json:"title,omitempty"` // Generated after the second question, or set by the learner
+	Persona       string               `json:"persona"`
+	EnglishLevel  string               `json:"english_level,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	LastMessageAt time.Time            `json:"last_message_at"`
+	Messages      []ChatSessionMessage `json:"messages"`
+
+	// Running summary of Messages[:SummarizedTurns], sent instead of those turns
+	Summary         string `json:"summary,omitempty"`
+	SummarizedTurns int    `json:"summarized_turns,omitempty"`
+
+	// Gemini tokens of every answer in the session, including ones that failed
+	PromptTokens     int     `json:"prompt_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+
+	owner       string // JWT subject of the learner who started it, "" when not signed in
+	secret      string // Returned when the session starts; lets its client back in without a JWT
+	inFlight    int    // Answers being generated; the session is not expired while > 0
+	summarizing bool   // A summary of older turns is being generated
+	titling     bool   // A title is being generated
+}
+
+// A session without its messages, as listed by the API
+type ChatSessionOverview struct {
+	ID               string    `json:"id"`
+	Title            string    `json:"title,omitempty"`
+	Persona          string    `json:"persona"`
+	EnglishLevel     string    `json:"english_level,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	LastMessageAt    time.Time `json:"last_message_at"`
+	MessageCount     int       `json:"message_count"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	OutputTokens     int       `json:"output_tokens"`
+	EstimatedCostUSD float64   `json:"estimated_cost_usd"`
+}
+
+// Who sends a session message, and the settings a new session starts with
+type chatSessionCaller struct {
+	Subject      string // JWT subject, "" when not signed in
+	Secret       string // The session secret the client sent
+	Persona      string
+	EnglishLevel string
+}
+
+type ChatSessionMessage struct {
+	MessageID    string    `json:"message_id,omitempty"` // For POST /api/chatbot/messages/{id}/feedback
+	Question     string    `json:"question"`
+	Answer       string    `json:"answer"`
+	Model        string    `json:"model"`
+	PromptTokens int       `json:"prompt_tokens,omitempty"` // As reported by Gemini
+	OutputTokens int       `json:"output_tokens,omitempty"`
+	ImageRef     string    `json:"image_ref,omitempty"` // "sha256:..." of an image sent with the question
+	SentAt       time.Time `json:"sent_at"`
+}
+
+type ChatSessionStats struct {
+	ActiveSessions  int    `json:"active_sessions"`
+	StoredMessages  int    `json:"stored_messages"`
+	SessionsCreated int    `json:"sessions_created"`
+	SessionsExpired int    `json:"sessions_expired"`
+	IdleTimeout     string `json:"idle_timeout"`
+	Retention       string `json:"retention"`
+}
+
+// How often the sweeper looks for expired sessions
+const CHAT_SESSION_SWEEP_INTERVAL = 10 * time.Minute
+
+// Sessions started by POST /api/chatbot/sessions get random 32-character hex IDs, and
+// every session a 64-character hex secret
+const (
+	CHAT_SESSION_ID_BYTE_COUNT     = 16
+	CHAT_SESSION_SECRET_BYTE_COUNT = 32
+)
+
+// Header carrying the session secret on HTTP requests
+const CHAT_SESSION_SECRET_HEADER = "X-Session-Secret"
+
+// Chat export formats
+const (
+	CHAT_EXPORT_MARKDOWN = "markdown"
+	CHAT_EXPORT_JSON     = "json"
+)
+
+// How personas are named in exported transcripts
+var chatPersonaNames = map[string]string{
+	PERSONA_ENGPAL:  "EngPal",
+	PERSONA_TEACHER: "Teacher",
+}
+
+var (
+	errChatSessionExpired   = errors.New("chat session expired")
+	errChatSessionForbidden = errors.New("chat session belongs to someone else")
+)
+
+var (
+	chatSessions = make(map[string]*ChatSession)
+	// Expired session IDs, remembered for the retention period so reuse is reported
+	expiredChatSessions = make(map[string]time.Time)
+	chatSessionStats    ChatSessionStats
+	chatSessionsMutex   sync.Mutex
+)
+
+// Whether a session has gone idle too long or passed the hard retention limit.
+// Sessions with an answer being generated never expire.
+func (session *ChatSession) expired(now time.Time) bool {
+	if session.inFlight > 0 {
+		return false
+	}
+	return now.Sub(session.LastMessageAt) > config.ChatSessionIdleTimeout() ||
+		now.Sub(session.CreatedAt) > config.ChatSessionRetention()
+}
+
+func (session *ChatSession) overview() ChatSessionOverview {
+	return ChatSessionOverview{
+		ID:               session.ID,
+		Title:            session.Title,
+		Persona:          session.Persona,
+		EnglishLevel:     session.EnglishLevel,
+		CreatedAt:        session.CreatedAt,
+		LastMessageAt:    session.LastMessageAt,
+		MessageCount:     len(session.Messages),
+		PromptTokens:     session.PromptTokens,
+		OutputTokens:     session.OutputTokens,
+		EstimatedCostUSD: session.EstimatedCostUSD,
+	}
+}
+
+// The session's messages as a transcript, oldest first, stopping before maxWords words
+func (session *ChatSession) transcript(maxWords int) []ChatTranscriptMessage {
+	var messages []ChatTranscriptMessage
+	words := 0
+	for _, message := range session.Messages {
+		words += utils.GetTotalWords(message.Question) + utils.GetTotalWords(message.Answer)
+		if words > maxWords {
+			break
+		}
+		messages = append(messages,
+			ChatTranscriptMessage{Role: "user", Content: message.Question},
+			ChatTranscriptMessage{Role: "assistant", Content: message.Answer})
+	}
+	return messages
+}
+
+// Whether the caller may use the session: its signed-in owner, or anyone with its secret
+func (session *ChatSession) allows(caller chatSessionCaller) bool {
+	if session.owner != "" && caller.Subject == session.owner {
+		return true
+	}
+	return caller.Secret != "" && subtle.ConstantTimeCompare([]byte(caller.Secret), []byte(session.secret)) == 1
+}
+
+// Whether the caller may use the session. Sessions that have ended allow no one.
+func chatSessionAllows(sessionID string, caller chatSessionCaller) bool {
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+	session, exists := chatSessions[sessionID]
+	return exists && session.allows(caller)
+}
+
+// A random hex string of byteCount bytes
+func randomHex(byteCount int) (string, error) {
+	value := make([]byte, byteCount)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(value), nil
+}
+
+// Start a session owned by the caller. The caller holds chatSessionsMutex.
+func startChatSession(sessionID string, caller chatSessionCaller, now time.Time) (*ChatSession, error) {
+	secret, err := randomHex(CHAT_SESSION_SECRET_BYTE_COUNT)
+	if err != nil {
+		return nil, err
+	}
+	session := &ChatSession{
+		ID:            sessionID,
+		Persona:       normalizePersona(caller.Persona),
+		EnglishLevel:  strings.ToUpper(strings.TrimSpace(caller.EnglishLevel)),
+		CreatedAt:     now,
+		LastMessageAt: now,
+		owner:         caller.Subject,
+		secret:        secret,
+	}
+	chatSessions[sessionID] = session
+	chatSessionStats.SessionsCreated++
+	return session, nil
+}
+
+// Mark a message as in flight in its session, starting the session on first use.
+// Returns the new session's secret when it was started, errChatSessionExpired if the
+// session has expired and errChatSessionForbidden if the caller may not use it.
+func beginChatSessionMessage(sessionID string, caller chatSessionCaller) (string, error) {
+	if sessionID == "" {
+		return "", nil // Sessionless chat
+	}
+
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+
+	now := time.Now()
+	if _, expired := expiredChatSessions[sessionID]; expired {
+		return "", errChatSessionExpired
+	}
+	session, exists := chatSessions[sessionID]
+	if exists && session.expired(now) {
+		expireChatSession(session, now)
+		return "", errChatSessionExpired
+	}
+	newSecret := ""
+	if !exists {
+		var err error
+		if session, err = startChatSession(sessionID, caller, now); err != nil {
+			return "", err
+		}
+		newSecret = session.secret
+	} else if !session.allows(caller) {
+		return "", errChatSessionForbidden
+	}
+	session.inFlight++
+	session.LastMessageAt = now
+	return newSecret, nil
+}
+
+// Finish an in-flight message, adding it to the session history if it was answered.
+func endChatSessionMessage(sessionID string, message ChatSessionMessage) {
+	if sessionID == "" {
+		return
+	}
+
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+
+	session, exists := chatSessions[sessionID]
+	if !exists {
+		return
+	}
+	session.inFlight--
+	session.LastMessageAt = time.Now()
+	session.PromptTokens += message.PromptTokens
+	session.OutputTokens += message.OutputTokens
+	session.EstimatedCostUSD = estimateChatbotCost(session.PromptTokens, session.OutputTokens)
+	if message.Answer != "" {
+		message.SentAt = session.LastMessageAt
+		session.Messages = append(session.Messages, message)
+		session.summarizeIfOverBudget()
+		session.titleIfReady()
+	}
+}
+
+// The session's history as Gemini contents, oldest first, followed by parts as the new
+// question. Sessionless questions are sent on their own.
+func chatSessionContents(sessionID string, parts ...*genai.Part) []*genai.Content {
+	var contents []*genai.Content
+	chatSessionsMutex.Lock()
+	if session, exists := chatSessions[sessionID]; exists {
+		contents = session.historyContents()
+	}
+	chatSessionsMutex.Unlock()
+	return append(contents, genai.NewContentFromParts(parts, genai.RoleUser))
+}
+
+// Delete a session and its messages. The caller holds chatSessionsMutex.
+func expireChatSession(session *ChatSession, now time.Time) {
+	delete(chatSessions, session.ID)
+	expiredChatSessions[session.ID] = now
+	chatSessionStats.SessionsExpired++
+}
+
+// Delete expired sessions and forget expired IDs older than the retention period.
+func sweepChatSessions() {
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+
+	now := time.Now()
+	expired := 0
+	for _, session := range chatSessions {
+		if session.expired(now) {
+			expireChatSession(session, now)
+			expired++
+		}
+	}
+	for sessionID, expiredAt := range expiredChatSessions {
+		if now.Sub(expiredAt) > config.ChatSessionRetention() {
+			delete(expiredChatSessions, sessionID)
+		}
+	}
+	if expired > 0 {
+		log.Printf("Expired %d chat sessions", expired)
+	}
+}
+
+// StartChatSessionSweeper deletes expired chatbot sessions in the background every
+// CHAT_SESSION_SWEEP_INTERVAL until ctx is cancelled.
+func StartChatSessionSweeper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(CHAT_SESSION_SWEEP_INTERVAL)
+		defer ticker.Stop()
+		MarkReady(READINESS_CHAT_SESSION_SWEEPER)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepChatSessions()
+			}
+		}
+	}()
+}
+
+// GET /api/chatbot/sessions/stats - session counts (admin only)
+func GetChatSessionStats(w http.ResponseWriter, r *http.Request) {
+	if status, ok := requireJWTClaim(r, ADMIN_CLAIM); !ok {
+		writeJWTClaimError(w, status, "chỉ quản trị viên mới xem được thống kê phiên chat")
+		return
+	}
+
+	chatSessionsMutex.Lock()
+	stats := chatSessionStats
+	stats.ActiveSessions = len(chatSessions)
+	for _, session := range chatSessions {
+		stats.StoredMessages += len(session.Messages)
+	}
+	chatSessionsMutex.Unlock()
+
+	stats.IdleTimeout = config.ChatSessionIdleTimeout().String()
+	stats.Retention = config.ChatSessionRetention().String()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GET /api/chatbot/sessions/{id} - the session's settings and token usage, without its
+// messages (see the export for those)
+func GetChatSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := chatSessionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session.overview())
+}
+
+// The session in the URL, copied, for a caller allowed to see it. Writes the error and
+// returns false for unknown, expired or someone else's sessions.
+func chatSessionForRequest(w http.ResponseWriter, r *http.Request) (ChatSession, bool) {
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+
+	session := findChatSessionForRequest(w, r)
+	if session == nil {
+		return ChatSession{}, false
+	}
+	snapshot := *session
+	snapshot.Messages = slices.Clone(session.Messages)
+	return snapshot, true
+}
+
+// The session in the URL for a caller allowed to see it, or nil after writing the
+// error. The caller holds chatSessionsMutex.
+func findChatSessionForRequest(w http.ResponseWriter, r *http.Request) *ChatSession {
+	caller := chatSessionCaller{Subject: jwtSubject(r), Secret: r.Header.Get(CHAT_SESSION_SECRET_HEADER)}
+	now := time.Now()
+	session, exists := chatSessions[mux.Vars(r)["id"]]
+	if exists && session.expired(now) {
+		expireChatSession(session, now)
+		exists = false
+	}
+	if !exists {
+		http.Error(w, "không tìm thấy cuộc trò chuyện", http.StatusNotFound)
+		return nil
+	}
+	if !session.allows(caller) {
+		http.Error(w, "bạn không có quyền xem cuộc trò chuyện này", http.StatusForbidden)
+		return nil
+	}
+	return session
+}
+
+// GET /api/chatbot/sessions - the signed-in learner's sessions, most recent first
+func ListChatSessions(w http.ResponseWriter, r *http.Request) {
+	subject := jwtSubject(r)
+	if subject == "" {
+		http.Error(w, "token đăng nhập không hợp lệ hoặc đã hết hạn", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	sessions := []ChatSessionOverview{}
+	chatSessionsMutex.Lock()
+	for _, session := range chatSessions {
+		if session.owner == subject && !session.expired(now) {
+			sessions = append(sessions, session.overview())
+		}
+	}
+	chatSessionsMutex.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastMessageAt.After(sessions[j].LastMessageAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// PATCH /api/chatbot/sessions/{id} - renames the session. The title is sanitized like
+// model output and replaces any generated one.
+func UpdateChatSession(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+	title := strings.Join(strings.Fields(utils.MarkdownToPlainText(utils.SanitizeMarkdown(request.Title))), " ")
+	if title == "" {
+		http.Error(w, "tiêu đề không được để trống", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(title) > MAX_CHAT_TITLE_LENGTH {
+		http.Error(w, fmt.Sprintf("tiêu đề không được dài hơn %d ký tự", MAX_CHAT_TITLE_LENGTH), http.StatusBadRequest)
+		return
+	}
+
+	chatSessionsMutex.Lock()
+	session := findChatSessionForRequest(w, r)
+	if session == nil {
+		chatSessionsMutex.Unlock()
+		return
+	}
+	session.Title = title
+	overview := session.overview()
+	chatSessionsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(overview)
+}
+
+// POST /api/chatbot/sessions - starts a session. The body may set the persona and
+// english_level noted on exports. Send the returned secret in X-Session-Secret (or
+// session_secret over WebSocket) to use the session without the owner's JWT.
+func CreateChatSession(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Persona      string `json:"persona"`
+		EnglishLevel string `json:"english_level"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sessionID, err := randomHex(CHAT_SESSION_ID_BYTE_COUNT)
+	var session *ChatSession
+	if err == nil {
+		chatSessionsMutex.Lock()
+		session, err = startChatSession(sessionID, chatSessionCaller{Subject: jwtSubject(r), Persona: request.Persona, EnglishLevel: request.EnglishLevel}, time.Now())
+		chatSessionsMutex.Unlock()
+	}
+	if err != nil {
+		logf(r, "Error starting chat session: %v", err)
+		http.Error(w, "không tạo được cuộc trò chuyện", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"session_id":     session.ID,
+		"session_secret": session.secret,
+		"persona":        session.Persona,
+		"english_level":  session.EnglishLevel,
+		"created_at":     session.CreatedAt,
+	})
+}
+
+// GET /api/chatbot/sessions/{id}/export?format=markdown|json - the full transcript.
+// JSON has the stored session schema, so it can be imported again.
+func ExportChatSession(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format == "" {
+		format = CHAT_EXPORT_MARKDOWN
+	}
+	if format != CHAT_EXPORT_MARKDOWN && format != CHAT_EXPORT_JSON {
+		http.Error(w, "định dạng xuất không hợp lệ (markdown, json)", http.StatusBadRequest)
+		return
+	}
+
+	session, ok := chatSessionForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if format == CHAT_EXPORT_JSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-%s.json"`, session.ID))
+		json.NewEncoder(w).Encode(session)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-%s.md"`, session.ID))
+	w.Write([]byte(renderChatTranscriptMarkdown(session)))
+}
+
+// The transcript as Q&A blocks under a header with the persona and learner level
+func renderChatTranscriptMarkdown(session ChatSession) string {
+	const timeFormat = "2006-01-02 15:04 UTC"
+	persona := chatPersonaNames[session.Persona]
+	level := session.EnglishLevel
+	if level == "" {
+		level = "not given"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# EngPal chat transcript\n\n")
+	sb.WriteString(fmt.Sprintf("- **Session:** %s\n", session.ID))
+	sb.WriteString(fmt.Sprintf("- **Persona:** %s\n", persona))
+	sb.WriteString(fmt.Sprintf("- **Learner level:** %s\n", level))
+	sb.WriteString(fmt.Sprintf("- **Started:** %s\n", session.CreatedAt.UTC().Format(timeFormat)))
+	sb.WriteString(fmt.Sprintf("- **Messages:** %d\n", len(session.Messages)))
+	for _, message := range session.Messages {
+		sentAt := message.SentAt.UTC().Format(timeFormat)
+		sb.WriteString("\n---\n\n")
+		sb.WriteString(fmt.Sprintf("**Learner** · %s\n\n%s\n\n", sentAt, message.Question))
+		if message.ImageRef != "" {
+			sb.WriteString("_(image attached)_\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("**%s** · %s\n\n%s\n", persona, sentAt, message.Answer))
+	}
+	return sb.String()
+}
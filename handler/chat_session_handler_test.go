@@ -0,0 +1,531 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"EngPal/internal/config"
+
+	"github.com/gorilla/mux"
+)
+
+const testJWTSecret = "test-jwt-secret"
+
+// An HS256 token for the claims, signed with the JWT secret the test configures
+func signTestJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	cfg, _ := config.Load()
+	cfg.JWTSecret = testJWTSecret
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// The statuses of a request to an admin-only handler without a token, with a
+// learner's token and with an admin's, and the admin's response
+func requestAsEachCaller(t *testing.T, handler http.HandlerFunc, method, target string) (anonymous, learner int, admin *httptest.ResponseRecorder) {
+	t.Helper()
+	tokens := []string{
+		"",
+		signTestJWT(t, map[string]interface{}{"sub": "minh", "exp": time.Now().Add(time.Hour).Unix()}),
+		signTestJWT(t, map[string]interface{}{"sub": "lan", "admin": true, "exp": time.Now().Add(time.Hour).Unix()}),
+	}
+	recorders := make([]*httptest.ResponseRecorder, len(tokens))
+	for i, token := range tokens {
+		request := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorders[i] = httptest.NewRecorder()
+		handler(recorders[i], request)
+	}
+	return recorders[0].Code, recorders[1].Code, recorders[2]
+}
+
+// Serve a chat session request through the routes that read {id}
+func serveChatSessionRequest(request *http.Request) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/chatbot/sessions", CreateChatSession).Methods("POST")
+	router.HandleFunc("/api/chatbot/sessions", ListChatSessions).Methods("GET")
+	router.HandleFunc("/api/chatbot/sessions/{id}", GetChatSession).Methods("GET")
+	router.HandleFunc("/api/chatbot/sessions/{id}", UpdateChatSession).Methods("PATCH")
+	router.HandleFunc("/api/chatbot/sessions/{id}/export", ExportChatSession).Methods("GET")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Start a session through the API and add two turns to it
+func startTestChatSession(t *testing.T, authorization string) (string, string) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/api/chatbot/sessions", strings.NewReader(`{"persona":"teacher","english_level":"b1"}`))
+	if authorization != "" {
+		request.Header.Set("Authorization", "Bearer "+authorization)
+	}
+	recorder := serveChatSessionRequest(request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("starting a session: status = %d, want %d", recorder.Code, http.StatusCreated)
+	}
+	var created struct {
+		SessionID     string `json:"session_id"`
+		SessionSecret string `json:"session_secret"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	t.Cleanup(func() { deleteChatSession(created.SessionID) })
+
+	caller := chatSessionCaller{Secret: created.SessionSecret}
+	turns := [][2]string{
+		{"What is the past tense of go?", "The past tense of **go** is *went*."},
+		{"Can you use it in a sentence?", "Sure: \"I went to school yesterday.\""},
+	}
+	for _, turn := range turns {
+		if _, err := beginChatSessionMessage(created.SessionID, caller); err != nil {
+			t.Fatal(err)
+		}
+		endChatSessionMessage(created.SessionID, ChatSessionMessage{Question: turn[0], Answer: turn[1], Model: "test"})
+	}
+	return created.SessionID, created.SessionSecret
+}
+
+func exportChatSession(sessionID, format, secret, authorization string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/api/chatbot/sessions/"+sessionID+"/export?format="+format, nil)
+	if secret != "" {
+		request.Header.Set(CHAT_SESSION_SECRET_HEADER, secret)
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", "Bearer "+authorization)
+	}
+	return serveChatSessionRequest(request)
+}
+
+func TestExportChatSessionJSONMatchesStoredSession(t *testing.T) {
+	sessionID, secret := startTestChatSession(t, "")
+
+	recorder := exportChatSession(sessionID, CHAT_EXPORT_JSON, secret, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	body := strings.TrimSpace(recorder.Body.String())
+
+	chatSessionsMutex.Lock()
+	stored, _ := json.Marshal(chatSessions[sessionID])
+	chatSessionsMutex.Unlock()
+	if body != string(stored) {
+		t.Errorf("exported %s, want the stored session %s", body, stored)
+	}
+
+	var exported ChatSession
+	if err := json.Unmarshal([]byte(body), &exported); err != nil {
+		t.Fatalf("decoding export: %v", err)
+	}
+	if len(exported.Messages) != 2 || exported.ID != sessionID || exported.Persona != PERSONA_TEACHER || exported.EnglishLevel != "B1" {
+		t.Errorf("exported session %+v", exported)
+	}
+	if strings.Contains(body, secret) {
+		t.Error("the export leaks the session secret")
+	}
+}
+
+func TestExportChatSessionMarkdown(t *testing.T) {
+	sessionID, secret := startTestChatSession(t, "")
+
+	recorder := exportChatSession(sessionID, "", secret, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/markdown") {
+		t.Errorf("Content-Type = %q, want markdown by default", contentType)
+	}
+	markdown := recorder.Body.String()
+	for _, want := range []string{
+		"**Session:** " + sessionID,
+		"**Persona:** Teacher",
+		"**Learner level:** B1",
+		"**Messages:** 2",
+		"**Learner** · ",
+		"What is the past tense of go?",
+		"**Teacher** · ",
+		"The past tense of **go** is *went*.",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, markdown)
+		}
+	}
+	if first, second := strings.Index(markdown, "past tense of go"), strings.Index(markdown, "use it in a sentence"); first > second {
+		t.Error("turns are out of order")
+	}
+}
+
+func TestExportChatSessionAccess(t *testing.T) {
+	owner := signTestJWT(t, map[string]interface{}{"sub": "learner-1", "exp": time.Now().Add(time.Hour).Unix()})
+	sessionID, secret := startTestChatSession(t, owner)
+	someoneElse := signTestJWT(t, map[string]interface{}{"sub": "learner-2", "exp": time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name          string
+		sessionID     string
+		format        string
+		secret        string
+		authorization string
+		want          int
+	}{
+		{"session secret", sessionID, CHAT_EXPORT_JSON, secret, "", http.StatusOK},
+		{"owner's JWT", sessionID, CHAT_EXPORT_JSON, "", owner, http.StatusOK},
+		{"no credentials", sessionID, CHAT_EXPORT_JSON, "", "", http.StatusForbidden},
+		{"wrong secret", sessionID, CHAT_EXPORT_JSON, strings.Repeat("0", len(secret)), "", http.StatusForbidden},
+		{"someone else's JWT", sessionID, CHAT_EXPORT_JSON, "", someoneElse, http.StatusForbidden},
+		{"unknown session", "no-such-session", CHAT_EXPORT_JSON, secret, "", http.StatusNotFound},
+		{"unknown format", sessionID, "pdf", secret, "", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := exportChatSession(test.sessionID, test.format, test.secret, test.authorization); recorder.Code != test.want {
+				t.Errorf("status = %d, want %d", recorder.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestChatSessionMessagesNeedAccess(t *testing.T) {
+	sessionID := "test-owned-session"
+	defer deleteChatSession(sessionID)
+
+	secret, err := beginChatSessionMessage(sessionID, chatSessionCaller{Persona: PERSONA_TEACHER})
+	if err != nil || secret == "" {
+		t.Fatalf("starting a session returned %q, %v; want a secret", secret, err)
+	}
+	endChatSessionMessage(sessionID, ChatSessionMessage{Question: "hi", Answer: "hello"})
+
+	if _, err := beginChatSessionMessage(sessionID, chatSessionCaller{}); err != errChatSessionForbidden {
+		t.Errorf("joining without the secret: err = %v, want %v", err, errChatSessionForbidden)
+	}
+	again, err := beginChatSessionMessage(sessionID, chatSessionCaller{Secret: secret})
+	if err != nil {
+		t.Fatalf("joining with the secret: %v", err)
+	}
+	endChatSessionMessage(sessionID, ChatSessionMessage{Question: "bye", Answer: "goodbye"})
+	if again != "" {
+		t.Error("joining an existing session returned a new secret")
+	}
+}
+
+func TestChatSessionTokenTotals(t *testing.T) {
+	sessionID, secret := startTestChatSession(t, "")
+	caller := chatSessionCaller{Secret: secret}
+	messages := []ChatSessionMessage{
+		{Question: "What does 'ubiquitous' mean?", Answer: "It means found everywhere.", PromptTokens: 1200, OutputTokens: 300},
+		{Question: "A blocked question", PromptTokens: 800}, // No answer, but its tokens were spent
+	}
+	for _, message := range messages {
+		if _, err := beginChatSessionMessage(sessionID, caller); err != nil {
+			t.Fatal(err)
+		}
+		endChatSessionMessage(sessionID, message)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/api/chatbot/sessions/"+sessionID, nil)
+	request.Header.Set(CHAT_SESSION_SECRET_HEADER, secret)
+	recorder := serveChatSessionRequest(request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	var overview ChatSessionOverview
+	if err := json.NewDecoder(recorder.Body).Decode(&overview); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	want := ChatSessionOverview{MessageCount: 3, PromptTokens: 2000, OutputTokens: 300, EstimatedCostUSD: 0.00032}
+	if overview.MessageCount != want.MessageCount || overview.PromptTokens != want.PromptTokens ||
+		overview.OutputTokens != want.OutputTokens || overview.EstimatedCostUSD != want.EstimatedCostUSD {
+		t.Errorf("overview = %+v, want %+v", overview, want)
+	}
+}
+
+// Replace the Gemini title generator for the test
+func useChatTitleGenerator(t *testing.T, generator func(string) (string, error)) {
+	t.Helper()
+	original := chatTitleGenerator
+	chatTitleGenerator = generator
+	t.Cleanup(func() { chatTitleGenerator = original })
+}
+
+// Wait for a background title of the session to finish, and return the title
+func waitForChatTitle(t *testing.T, sessionID string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		chatSessionsMutex.Lock()
+		session := chatSessions[sessionID]
+		titling, title := session.titling, session.Title
+		chatSessionsMutex.Unlock()
+		if !titling {
+			return title
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("the title never finished")
+	return ""
+}
+
+func TestChatSessionTitleIsGeneratedAfterSecondQuestion(t *testing.T) {
+	calls := 0
+	useChatTitleGenerator(t, func(transcript string) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("gemini unavailable")
+		}
+		return "Practising the past tense", nil
+	})
+	sessionID := "test-titled-session"
+	defer deleteChatSession(sessionID)
+
+	caller := chatSessionCaller{}
+	titles := []string{}
+	for turn := 0; turn < 4; turn++ {
+		secret, err := beginChatSessionMessage(sessionID, caller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != "" {
+			caller.Secret = secret
+		}
+		endChatSessionMessage(sessionID, ChatSessionMessage{Question: fmt.Sprintf("Question %d", turn), Answer: "Answer"})
+		titles = append(titles, waitForChatTitle(t, sessionID))
+	}
+
+	// None after one question, a failure after the second, retried after the third
+	want := []string{"", "", "Practising the past tense", "Practising the past tense"}
+	if !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles after each answer = %q, want %q", titles, want)
+	}
+	if calls != 2 {
+		t.Errorf("generated a title %d times, want 2", calls)
+	}
+}
+
+func patchChatSessionTitle(sessionID, title, secret string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"title": title})
+	request := httptest.NewRequest(http.MethodPatch, "/api/chatbot/sessions/"+sessionID, strings.NewReader(string(body)))
+	if secret != "" {
+		request.Header.Set(CHAT_SESSION_SECRET_HEADER, secret)
+	}
+	return serveChatSessionRequest(request)
+}
+
+func TestUpdateChatSessionTitle(t *testing.T) {
+	useChatTitleGenerator(t, func(string) (string, error) { return "Generated title", nil })
+	sessionID, secret := startTestChatSession(t, "")
+	waitForChatTitle(t, sessionID)
+
+	tests := []struct {
+		name      string
+		title     string
+		secret    string
+		wantCode  int
+		wantTitle string
+	}{
+		{"markdown and HTML stripped", "  **My** <b>irregular</b>\nverbs  ", secret, http.StatusOK, "My irregular verbs"},
+		{"script removed", "Verbs<script>alert(1)</script>", secret, http.StatusOK, "Verbs"},
+		{"empty", "  ", secret, http.StatusBadRequest, "Verbs"},
+		{"too long", strings.Repeat("a", MAX_CHAT_TITLE_LENGTH+1), secret, http.StatusBadRequest, "Verbs"},
+		{"without the secret", "Stolen", "", http.StatusForbidden, "Verbs"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := patchChatSessionTitle(sessionID, test.title, test.secret); recorder.Code != test.wantCode {
+				t.Errorf("status = %d, want %d", recorder.Code, test.wantCode)
+			}
+			chatSessionsMutex.Lock()
+			title := chatSessions[sessionID].Title
+			chatSessionsMutex.Unlock()
+			if title != test.wantTitle {
+				t.Errorf("title = %q, want %q", title, test.wantTitle)
+			}
+		})
+	}
+
+	// A title set by the learner is not replaced by a generated one
+	chatSessionsMutex.Lock()
+	session := chatSessions[sessionID]
+	session.titleIfReady()
+	title := session.Title
+	chatSessionsMutex.Unlock()
+	if title != "Verbs" {
+		t.Errorf("title = %q after another answer, want the learner's", title)
+	}
+}
+
+func TestListChatSessions(t *testing.T) {
+	useChatTitleGenerator(t, func(string) (string, error) { return "Past tense", nil })
+	owner := signTestJWT(t, map[string]interface{}{"sub": "learner-1", "exp": time.Now().Add(time.Hour).Unix()})
+	older, _ := startTestChatSession(t, owner)
+	waitForChatTitle(t, older)
+	newer, _ := startTestChatSession(t, owner)
+	waitForChatTitle(t, newer)
+	someoneElses, _ := startTestChatSession(t, "")
+	waitForChatTitle(t, someoneElses)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/chatbot/sessions", nil)
+	request.Header.Set("Authorization", "Bearer "+owner)
+	recorder := serveChatSessionRequest(request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	var response struct {
+		Sessions []ChatSessionOverview `json:"sessions"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	var ids []string
+	for _, session := range response.Sessions {
+		ids = append(ids, session.ID)
+		if session.Title != "Past tense" {
+			t.Errorf("session %s has title %q", session.ID, session.Title)
+		}
+	}
+	if want := []string{newer, older}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("listed %v, want the owner's sessions %v, most recent first", ids, want)
+	}
+
+	if recorder := serveChatSessionRequest(httptest.NewRequest(http.MethodGet, "/api/chatbot/sessions", nil)); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("status without a JWT = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
+
+// Configure short session lifetimes for the test
+func useChatSessionLifetimes(t *testing.T, idleTimeout, retention time.Duration) {
+	t.Helper()
+	cfg, _ := config.Load()
+	cfg.ChatSessionIdleTimeout = idleTimeout
+	cfg.ChatSessionRetention = retention
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+}
+
+// Start a session whose creation and last message lie in the past
+func startAgedChatSession(t *testing.T, sessionID string, age, idle time.Duration) {
+	t.Helper()
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+	now := time.Now()
+	session, err := startChatSession(sessionID, chatSessionCaller{}, now.Add(-age))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.LastMessageAt = now.Add(-idle)
+	t.Cleanup(func() { deleteChatSession(sessionID) })
+}
+
+func TestChatSessionExpiry(t *testing.T) {
+	useChatSessionLifetimes(t, time.Hour, 24*time.Hour)
+	now := time.Now()
+	tests := []struct {
+		name    string
+		session ChatSession
+		want    bool
+	}{
+		{"recently active", ChatSession{CreatedAt: now.Add(-2 * time.Hour), LastMessageAt: now.Add(-time.Minute)}, false},
+		{"idle too long", ChatSession{CreatedAt: now.Add(-2 * time.Hour), LastMessageAt: now.Add(-61 * time.Minute)}, true},
+		{"past retention while active", ChatSession{CreatedAt: now.Add(-25 * time.Hour), LastMessageAt: now.Add(-time.Minute)}, true},
+		{"idle with an answer in flight", ChatSession{CreatedAt: now.Add(-25 * time.Hour), LastMessageAt: now.Add(-2 * time.Hour), inFlight: 1}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.session.expired(now); got != test.want {
+				t.Errorf("expired = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpiredChatSessionIsNotReused(t *testing.T) {
+	useChatSessionLifetimes(t, time.Hour, 24*time.Hour)
+	sessionID := "test-idle-session"
+	startAgedChatSession(t, sessionID, 2*time.Hour, 2*time.Hour)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if _, err := beginChatSessionMessage(sessionID, chatSessionCaller{}); !errors.Is(err, errChatSessionExpired) {
+			t.Fatalf("attempt %d: err = %v, want %v", attempt, err, errChatSessionExpired)
+		}
+	}
+	chatSessionsMutex.Lock()
+	_, stored := chatSessions[sessionID]
+	chatSessionsMutex.Unlock()
+	if stored {
+		t.Error("the expired session is still stored")
+	}
+}
+
+func TestSweepChatSessions(t *testing.T) {
+	useChatSessionLifetimes(t, time.Hour, 24*time.Hour)
+	startAgedChatSession(t, "test-sweep-active", 2*time.Hour, time.Minute)
+	startAgedChatSession(t, "test-sweep-idle", 2*time.Hour, 2*time.Hour)
+	startAgedChatSession(t, "test-sweep-retired", 25*time.Hour, time.Minute)
+	startAgedChatSession(t, "test-sweep-in-flight", 2*time.Hour, 2*time.Hour)
+	chatSessionsMutex.Lock()
+	chatSessions["test-sweep-in-flight"].inFlight++
+	expiredChatSessions["test-sweep-forgotten"] = time.Now().Add(-25 * time.Hour)
+	expiredBefore := chatSessionStats.SessionsExpired
+	chatSessionsMutex.Unlock()
+	t.Cleanup(func() { deleteChatSession("test-sweep-forgotten") })
+
+	sweepChatSessions()
+
+	chatSessionsMutex.Lock()
+	defer chatSessionsMutex.Unlock()
+	for sessionID, wantStored := range map[string]bool{
+		"test-sweep-active":    true,
+		"test-sweep-idle":      false,
+		"test-sweep-retired":   false,
+		"test-sweep-in-flight": true,
+	} {
+		if _, stored := chatSessions[sessionID]; stored != wantStored {
+			t.Errorf("%s stored = %v, want %v", sessionID, stored, wantStored)
+		}
+		if _, remembered := expiredChatSessions[sessionID]; remembered == wantStored {
+			t.Errorf("%s remembered as expired = %v, want %v", sessionID, remembered, !wantStored)
+		}
+	}
+	if _, remembered := expiredChatSessions["test-sweep-forgotten"]; remembered {
+		t.Error("an ID that expired before the retention period is still remembered")
+	}
+	if expired := chatSessionStats.SessionsExpired - expiredBefore; expired != 2 {
+		t.Errorf("%d sessions counted as expired, want 2", expired)
+	}
+}
+
+func TestGetChatSessionStatsIsAdminOnly(t *testing.T) {
+	anonymous, learner, admin := requestAsEachCaller(t, GetChatSessionStats, http.MethodGet, "/api/chatbot/sessions/stats")
+	if anonymous != http.StatusUnauthorized || learner != http.StatusForbidden || admin.Code != http.StatusOK {
+		t.Fatalf("statuses = %d, %d, %d, want %d, %d, %d", anonymous, learner, admin.Code, http.StatusUnauthorized, http.StatusForbidden, http.StatusOK)
+	}
+	var stats ChatSessionStats
+	if err := json.NewDecoder(admin.Body).Decode(&stats); err != nil || stats.IdleTimeout == "" {
+		t.Errorf("admin response %s: %v", admin.Body, err)
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"EngPal/entities"
+	"EngPal/repository"
+
+	"github.com/gorilla/mux"
+)
+
+type ChatFeedbackRequest struct {
+	Rating  string `json:"rating"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Feedback ratings
+const (
+	FEEDBACK_RATING_UP   = entities.ChatRatingUp
+	FEEDBACK_RATING_DOWN = entities.ChatRatingDown
+)
+
+const (
+	MAX_FEEDBACK_COMMENT_LEN = 500
+	DEFAULT_DOWN_RATED_LIMIT = 50
+	MAX_DOWN_RATED_LIMIT     = 200
+	ANONYMOUS_FEEDBACK_RATER = "anonymous" // Rater when the request has no username
+)
+
+// Answers are kept for a week, under random 16-character hex IDs, and older ones
+// are deleted every CHAT_MESSAGE_SWEEP_INTERVAL
+const (
+	CHAT_MESSAGE_RETENTION      = 7 * 24 * time.Hour
+	CHAT_MESSAGE_ID_BYTE_COUNT  = 8
+	CHAT_MESSAGE_SWEEP_INTERVAL = time.Hour
+)
+
+// Where answers and the feedback on them are kept, set by SetChatMessageRepo at startup
+var chatMessageRepo repository.ChatMessageRepo
+
+// SetChatMessageRepo sets the repository chatbot answers and their feedback are kept in.
+func SetChatMessageRepo(repo repository.ChatMessageRepo) {
+	chatMessageRepo = repo
+}
+
+// A new random message ID, or "" if none could be generated
+func newChatMessageID() string {
+	id := make([]byte, CHAT_MESSAGE_ID_BYTE_COUNT)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Error generating chat message ID: %v", err)
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// Keep an answer under its message ID until it is older than CHAT_MESSAGE_RETENTION.
+func recordChatMessage(messageID string, request Conversation, response ChatResponse) {
+	if messageID == "" || chatMessageRepo == nil {
+		return
+	}
+	err := chatMessageRepo.Create(&entities.ChatMessage{
+		MessageID: messageID,
+		SessionID: request.SessionID,
+		Username:  request.username,
+		Question:  request.Question,
+		Answer:    response.MessageInMarkdown,
+		Mode:      request.Mode,
+		Persona:   request.Persona,
+		Language:  request.Language,
+		Model:     response.Model,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error recording chat message %s: %v", messageID, err)
+	}
+}
+
+// Delete the answers older than CHAT_MESSAGE_RETENTION.
+func sweepChatMessages() {
+	if chatMessageRepo == nil {
+		return
+	}
+	deleted, err := chatMessageRepo.DeleteBefore(time.Now().Add(-CHAT_MESSAGE_RETENTION))
+	if err != nil {
+		log.Printf("Error deleting old chat messages: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d chat messages", deleted)
+	}
+}
+
+// StartChatMessageSweeper deletes old chatbot answers in the background every
+// CHAT_MESSAGE_SWEEP_INTERVAL until ctx is cancelled. The returned channel is closed
+// once the sweeper has stopped.
+func StartChatMessageSweeper(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(CHAT_MESSAGE_SWEEP_INTERVAL)
+		defer ticker.Stop()
+		MarkReady(READINESS_CHAT_MESSAGE_SWEEPER)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepChatMessages()
+			}
+		}
+	}()
+	return done
+}
+
+// POST /api/chatbot/messages/{id}/feedback - rates an answer up or down. Answers in a
+// session are rated by that session, with its owner's JWT or X-Session-Secret, and
+// rating one again replaces the earlier feedback.
+func SubmitChatFeedback(w http.ResponseWriter, r *http.Request) {
+	var request ChatFeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	request.Rating = strings.ToLower(strings.TrimSpace(request.Rating))
+	if request.Rating != FEEDBACK_RATING_UP && request.Rating != FEEDBACK_RATING_DOWN {
+		http.Error(w, "đánh giá không hợp lệ (up, down)", http.StatusBadRequest)
+		return
+	}
+	request.Comment = strings.TrimSpace(request.Comment)
+	if utf8.RuneCountInString(request.Comment) > MAX_FEEDBACK_COMMENT_LEN {
+		http.Error(w, fmt.Sprintf("bình luận không được dài hơn %d ký tự", MAX_FEEDBACK_COMMENT_LEN), http.StatusBadRequest)
+		return
+	}
+
+	rater := strings.TrimSpace(r.URL.Query().Get("username"))
+	if rater == "" {
+		rater = ANONYMOUS_FEEDBACK_RATER
+	}
+	feedback := entities.ChatFeedback{Rater: rater, Rating: request.Rating, Comment: request.Comment, UpdatedAt: time.Now()}
+
+	if chatMessageRepo == nil {
+		http.Error(w, "chưa cấu hình nơi lưu tin nhắn chatbot", http.StatusServiceUnavailable)
+		return
+	}
+	messageID := mux.Vars(r)["id"]
+	record, err := chatMessageRepo.Get(messageID)
+	if errors.Is(err, repository.ErrChatMessageNotFound) {
+		http.Error(w, "không tìm thấy tin nhắn", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logf(r, "Error loading chat message %s: %v", messageID, err)
+		http.Error(w, "không đọc được tin nhắn", http.StatusInternalServerError)
+		return
+	}
+	sessionID := record.SessionID
+	feedbackKey := rater
+	if sessionID != "" {
+		caller := chatSessionCaller{Subject: jwtSubject(r), Secret: r.Header.Get(CHAT_SESSION_SECRET_HEADER)}
+		if !chatSessionAllows(sessionID, caller) {
+			http.Error(w, "bạn không có quyền đánh giá tin nhắn này", http.StatusForbidden)
+			return
+		}
+		feedback.SessionID = sessionID
+		feedbackKey = sessionID
+	}
+
+	if err := chatMessageRepo.SetFeedback(messageID, feedbackKey, feedback); err != nil {
+		logf(r, "Error saving feedback on chat message %s: %v", messageID, err)
+		http.Error(w, "không lưu được đánh giá", http.StatusInternalServerError)
+		return
+	}
+
+	logf(r, "%s rated chat message %s %s", rater, messageID, request.Rating)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feedback)
+}
+
+// GET /api/chatbot/feedback/down-rated - recent down-rated answers with context (admin only)
+func GetDownRatedChatMessages(w http.ResponseWriter, r *http.Request) {
+	if status, ok := requireJWTClaim(r, ADMIN_CLAIM); !ok {
+		writeJWTClaimError(w, status, "chỉ quản trị viên mới xem được đánh giá chatbot")
+		return
+	}
+
+	limit := DEFAULT_DOWN_RATED_LIMIT
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > MAX_DOWN_RATED_LIMIT {
+			http.Error(w, fmt.Sprintf("limit phải nằm trong khoảng 1 đến %d", MAX_DOWN_RATED_LIMIT), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	if chatMessageRepo == nil {
+		http.Error(w, "chưa cấu hình nơi lưu tin nhắn chatbot", http.StatusServiceUnavailable)
+		return
+	}
+	messages, err := chatMessageRepo.ListDownRated(limit)
+	if err != nil {
+		logf(r, "Error listing down-rated chat messages: %v", err)
+		http.Error(w, "không đọc được đánh giá", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": messages,
+	})
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"EngPal/entities"
+	"EngPal/repository/repo_impl"
+
+	"github.com/gorilla/mux"
+)
+
+// Keep chatbot answers in a fresh file for the test
+func useChatMessageRepo(t *testing.T) *repo_impl.ChatMessageRepoImpl {
+	t.Helper()
+	repo, err := repo_impl.NewChatMessageRepoImpl(filepath.Join(t.TempDir(), "chat_messages.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetChatMessageRepo(repo)
+	t.Cleanup(func() {
+		SetChatMessageRepo(nil)
+		repo.Close()
+	})
+	return repo
+}
+
+// Serve a feedback request through the route that reads {id}
+func serveChatFeedbackRequest(request *http.Request) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/chatbot/messages/{id}/feedback", SubmitChatFeedback).Methods("POST")
+	router.HandleFunc("/api/chatbot/feedback/down-rated", GetDownRatedChatMessages).Methods("GET")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func rateChatMessage(messageID, query, secret string, feedback ChatFeedbackRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(feedback)
+	request := httptest.NewRequest(http.MethodPost, "/api/chatbot/messages/"+messageID+"/feedback"+query, strings.NewReader(string(body)))
+	if secret != "" {
+		request.Header.Set(CHAT_SESSION_SECRET_HEADER, secret)
+	}
+	return serveChatFeedbackRequest(request)
+}
+
+// Answer a question in writeChatAnswer, as GenerateAnswer does
+func answerTestChatQuestion(t *testing.T, request Conversation, answer string) ChatResponse {
+	t.Helper()
+	request.sessionMessage = &ChatSessionMessage{Question: request.Question}
+	recorder := httptest.NewRecorder()
+	writeChatAnswer(recorder, ChatResponse{MessageInMarkdown: answer, Model: "test"}, request)
+	if request.SessionID != "" {
+		endChatSessionMessage(request.SessionID, *request.sessionMessage)
+	}
+
+	var response ChatResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if response.MessageID == "" {
+		t.Fatal("the answer has no message ID")
+	}
+	return response
+}
+
+func chatFeedbackOf(t *testing.T, messageID string) map[string]entities.ChatFeedback {
+	t.Helper()
+	record, err := chatMessageRepo.Get(messageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record.Feedback
+}
+
+func TestSessionMessagesHaveMessageIDs(t *testing.T) {
+	useChatMessageRepo(t)
+	sessionID := "test-feedback-ids-session"
+	defer deleteChatSession(sessionID)
+	if _, err := beginChatSessionMessage(sessionID, chatSessionCaller{}); err != nil {
+		t.Fatal(err)
+	}
+	response := answerTestChatQuestion(t, Conversation{Question: "What is a noun?", Persona: PERSONA_TEACHER, SessionID: sessionID}, "A naming word.")
+
+	chatSessionsMutex.Lock()
+	stored := chatSessions[sessionID].Messages[0].MessageID
+	chatSessionsMutex.Unlock()
+	if stored != response.MessageID {
+		t.Errorf("the session stored message ID %q, want the answer's %q", stored, response.MessageID)
+	}
+	record, err := chatMessageRepo.Get(response.MessageID)
+	if err != nil || record.SessionID != sessionID || record.Persona != PERSONA_TEACHER || record.Model != "test" {
+		t.Errorf("recorded %+v, want the answer with its session and context", record)
+	}
+}
+
+func TestSessionFeedbackUpdatesPerSession(t *testing.T) {
+	useChatMessageRepo(t)
+	sessionID := "test-feedback-session"
+	defer deleteChatSession(sessionID)
+	secret, err := beginChatSessionMessage(sessionID, chatSessionCaller{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageID := answerTestChatQuestion(t, Conversation{Question: "What is a verb?", SessionID: sessionID}, "An action word.").MessageID
+
+	if recorder := rateChatMessage(messageID, "", "", ChatFeedbackRequest{Rating: "up"}); recorder.Code != http.StatusForbidden {
+		t.Errorf("rating without the session secret: status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+	for _, rating := range []string{"up", "down"} {
+		if recorder := rateChatMessage(messageID, "?username=lan", secret, ChatFeedbackRequest{Rating: rating, Comment: "Too short"}); recorder.Code != http.StatusOK {
+			t.Fatalf("rating %s: status = %d, want %d", rating, recorder.Code, http.StatusOK)
+		}
+	}
+	// Another username in the same session still updates the session's feedback
+	if recorder := rateChatMessage(messageID, "?username=mai", secret, ChatFeedbackRequest{Rating: "down", Comment: "Wrong"}); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	feedback := chatFeedbackOf(t, messageID)
+	if len(feedback) != 1 {
+		t.Fatalf("the message has %d feedback entries, want 1 for its session: %+v", len(feedback), feedback)
+	}
+	if got := feedback[sessionID]; got.Rating != FEEDBACK_RATING_DOWN || got.Comment != "Wrong" || got.SessionID != sessionID {
+		t.Errorf("feedback = %+v, want the latest down rating", got)
+	}
+
+	admin := signTestJWT(t, map[string]interface{}{"sub": "lan", "admin": true, "exp": time.Now().Add(time.Hour).Unix()})
+	request := httptest.NewRequest(http.MethodGet, "/api/chatbot/feedback/down-rated", nil)
+	request.Header.Set("Authorization", "Bearer "+admin)
+	recorder := serveChatFeedbackRequest(request)
+	var response struct {
+		Messages []entities.RatedChatMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	listed := 0
+	for _, message := range response.Messages {
+		if message.MessageID == messageID {
+			listed++
+			if message.Question != "What is a verb?" || message.Answer != "An action word." || message.SessionID != sessionID {
+				t.Errorf("down-rated message %+v is missing its context", message)
+			}
+		}
+	}
+	if listed != 1 {
+		t.Errorf("the down-rated message is listed %d times, want once", listed)
+	}
+}
+
+func TestSessionlessFeedbackIsKeyedByRater(t *testing.T) {
+	useChatMessageRepo(t)
+	messageID := answerTestChatQuestion(t, Conversation{Question: "What is an adverb?"}, "A word that describes a verb.").MessageID
+
+	for _, query := range []string{"?username=lan", "?username=lan", "?username=mai", ""} {
+		if recorder := rateChatMessage(messageID, query, "", ChatFeedbackRequest{Rating: "up"}); recorder.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", query, recorder.Code, http.StatusOK)
+		}
+	}
+	feedback := chatFeedbackOf(t, messageID)
+	for _, rater := range []string{"lan", "mai", ANONYMOUS_FEEDBACK_RATER} {
+		if _, exists := feedback[rater]; !exists {
+			t.Errorf("no feedback from %s", rater)
+		}
+	}
+	if len(feedback) != 3 {
+		t.Errorf("the message has %d feedback entries, want one per rater", len(feedback))
+	}
+}
+
+func TestChatFeedbackValidation(t *testing.T) {
+	useChatMessageRepo(t)
+	messageID := answerTestChatQuestion(t, Conversation{Question: "What is an adjective?"}, "A describing word.").MessageID
+
+	tests := []struct {
+		name      string
+		messageID string
+		feedback  ChatFeedbackRequest
+		want      int
+	}{
+		{"rating is case-insensitive", messageID, ChatFeedbackRequest{Rating: " Down "}, http.StatusOK},
+		{"unknown rating", messageID, ChatFeedbackRequest{Rating: "meh"}, http.StatusBadRequest},
+		{"longest comment", messageID, ChatFeedbackRequest{Rating: "down", Comment: strings.Repeat("ă", MAX_FEEDBACK_COMMENT_LEN)}, http.StatusOK},
+		{"comment too long", messageID, ChatFeedbackRequest{Rating: "down", Comment: strings.Repeat("a", MAX_FEEDBACK_COMMENT_LEN+1)}, http.StatusBadRequest},
+		{"unknown message", "no-such-message", ChatFeedbackRequest{Rating: "up"}, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := rateChatMessage(test.messageID, "", "", test.feedback); recorder.Code != test.want {
+				t.Errorf("status = %d, want %d", recorder.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestGetDownRatedChatMessagesIsAdminOnly(t *testing.T) {
+	useChatMessageRepo(t)
+	anonymous, learner, admin := requestAsEachCaller(t, GetDownRatedChatMessages, http.MethodGet, "/api/chatbot/feedback/down-rated")
+	if anonymous != http.StatusUnauthorized || learner != http.StatusForbidden || admin.Code != http.StatusOK {
+		t.Errorf("statuses = %d, %d, %d, want %d, %d, %d", anonymous, learner, admin.Code, http.StatusUnauthorized, http.StatusForbidden, http.StatusOK)
+	}
+}
+
+func TestSweepChatMessagesDeletesOldAnswers(t *testing.T) {
+	repo := useChatMessageRepo(t)
+	now := time.Now()
+	for messageID, createdAt := range map[string]time.Time{"old": now.Add(-CHAT_MESSAGE_RETENTION - time.Minute), "recent": now.Add(-time.Hour)} {
+		if err := repo.Create(&entities.ChatMessage{MessageID: messageID, Question: "What is a noun?", CreatedAt: createdAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sweepChatMessages()
+	if _, err := repo.Get("old"); err == nil {
+		t.Error("an answer older than the retention period was kept")
+	}
+	if _, err := repo.Get("recent"); err != nil {
+		t.Errorf("a recent answer was deleted: %v", err)
+	}
+	if recorder := rateChatMessage("old", "", "", ChatFeedbackRequest{Rating: "down"}); recorder.Code != http.StatusNotFound {
+		t.Errorf("rating a deleted answer: status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestChatAnswerSchemaRequiresFollowups(t *testing.T) {
+	for _, practiceMode := range []bool{false, true} {
+		schema := chatAnswerSchema(practiceMode)
+		followups := schema.Properties["suggested_followups"]
+		if followups == nil || !slices.Contains(schema.Required, "suggested_followups") {
+			t.Fatalf("practice %v: suggested_followups is not a required property", practiceMode)
+		}
+		if *followups.MinItems != MIN_SUGGESTED_FOLLOWUPS || *followups.MaxItems != MAX_SUGGESTED_FOLLOWUPS {
+			t.Errorf("practice %v: follow-ups allow %d-%d items, want %d-%d", practiceMode,
+				*followups.MinItems, *followups.MaxItems, MIN_SUGGESTED_FOLLOWUPS, MAX_SUGGESTED_FOLLOWUPS)
+		}
+		if hasCorrections := slices.Contains(schema.Required, "corrections"); hasCorrections != practiceMode {
+			t.Errorf("practice %v: corrections required = %v", practiceMode, hasCorrections)
+		}
+	}
+}
+
+func TestParseChatAnswerFollowups(t *testing.T) {
+	const question = "What is the past tense of go?"
+	tests := []struct {
+		name      string
+		followups []string
+		want      []string
+	}{
+		{
+			name:      "kept in order",
+			followups: []string{"Can you give me an example?", "What about 'come'?"},
+			want:      []string{"Can you give me an example?", "What about 'come'?"},
+		},
+		{
+			name:      "blank, duplicate and repeated question dropped",
+			followups: []string{"  ", "What is the past tense of go", "Can you give me an example?", "can you give me an example", "What about 'come'?"},
+			want:      []string{"Can you give me an example?", "What about 'come'?"},
+		},
+		{
+			name:      "capped",
+			followups: []string{"One more?", "Another one?", "What about 'come'?", "And 'see'?"},
+			want:      []string{"One more?", "Another one?", "What about 'come'?"},
+		},
+		{
+			name:      "missing",
+			followups: nil,
+			want:      []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, _ := json.Marshal(map[string]interface{}{
+				"answer":              " The past tense of **go** is *went*. ",
+				"suggested_followups": test.followups,
+			})
+			result, err := parseChatAnswer(string(response), question, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.MessageInMarkdown != "The past tense of **go** is *went*." {
+				t.Errorf("answer = %q", result.MessageInMarkdown)
+			}
+			if !reflect.DeepEqual(result.SuggestedFollowups, test.want) {
+				t.Errorf("follow-ups = %q, want %q", result.SuggestedFollowups, test.want)
+			}
+		})
+	}
+}
+
+func TestParseChatAnswerErrors(t *testing.T) {
+	for _, response := range []string{`not json`, `{"answer": "  ", "suggested_followups": ["Why?"]}`, `{}`} {
+		if _, err := parseChatAnswer(response, "Why?", false); err == nil {
+			t.Errorf("parsing %s succeeded, want an error", response)
+		}
+	}
+}
+
+func TestParseChatAnswerPracticeFeedback(t *testing.T) {
+	response := `{"answer": "Good question!", "suggested_followups": ["Why?", "How?"], "is_correct": false,
+		"corrections": [{"original": "goed", "correction": "went", "explanation": "Irregular verb"}], "praise": ""}`
+	result, err := parseChatAnswer(response, "Yesterday I goed home.", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.PracticeFeedback == nil || result.PracticeFeedback.IsCorrect || len(result.PracticeFeedback.Corrections) != 1 {
+		t.Fatalf("practice feedback = %+v, want the correction", result.PracticeFeedback)
+	}
+	if !strings.HasPrefix(result.MessageInMarkdown, "Good question!\n\n") || !strings.Contains(result.MessageInMarkdown, "went") {
+		t.Errorf("answer does not include the feedback: %q", result.MessageInMarkdown)
+	}
+
+	result, _ = parseChatAnswer(`{"answer": "Nice!", "suggested_followups": [], "is_correct": true, "corrections": [{"original": "a", "correction": "b", "explanation": "c"}]}`, "I went home.", true)
+	if !result.PracticeFeedback.IsCorrect || len(result.PracticeFeedback.Corrections) != 0 || result.PracticeFeedback.Praise == "" {
+		t.Errorf("a correct question got feedback %+v, want praise and no corrections", result.PracticeFeedback)
+	}
+}
+
+func TestFollowupsOnlyInChatMode(t *testing.T) {
+	chat, _ := json.Marshal(ChatResponse{MessageInMarkdown: "Hi", SuggestedFollowups: []string{"Why?", "How?"}})
+	if !strings.Contains(string(chat), `"suggested_followups":["Why?","How?"]`) {
+		t.Errorf("chat answer %s has no follow-ups", chat)
+	}
+
+	utilityResponses := []ChatResponse{
+		{MessageInMarkdown: "**xin chào**", Translation: &Translation{Translations: []string{"xin chào"}}},
+		{MessageInMarkdown: "### go", Definition: &Definition{Word: "go"}},
+		{MessageInMarkdown: "✅", GrammarCheck: &GrammarCheck{IsCorrect: true}},
+	}
+	for _, response := range utilityResponses {
+		if body, _ := json.Marshal(response); strings.Contains(string(body), "suggested_followups") {
+			t.Errorf("utility mode answer %s has follow-ups", body)
+		}
+	}
+}
+
+func TestGenerateAnswerChecksTopic(t *testing.T) {
+	useEmptyTopicCache(t)
+	useFakeGemini(t, answerTopicChecks(map[string]string{
+		"Write me a Python script": TOPIC_UNRELATED,
+		"Tell me something nasty":  TOPIC_INAPPROPRIATE,
+	}, "unused"))
+
+	tests := []struct {
+		question    string
+		wantStatus  int
+		wantMessage string
+	}{
+		{"Write me a Python script", http.StatusOK, localizedMessage("off_topic_redirect", "vi", PERSONA_TEACHER, nil)},
+		{"Tell me something nasty", http.StatusUnprocessableEntity, localizedMessage("inappropriate_content", "", PERSONA_TEACHER, nil)},
+	}
+	for _, test := range tests {
+		body, _ := json.Marshal(map[string]string{"question": test.question, "persona": PERSONA_TEACHER})
+		recorder := httptest.NewRecorder()
+		GenerateAnswer(recorder, httptest.NewRequest(http.MethodPost, "/api/chatbot/generate-answer", strings.NewReader(string(body))))
+		if recorder.Code != test.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", test.question, recorder.Code, test.wantStatus, recorder.Body)
+		}
+		if !strings.Contains(recorder.Body.String(), test.wantMessage) {
+			t.Errorf("%s: response %s does not contain %q", test.question, recorder.Body, test.wantMessage)
+		}
+	}
+}
+
+func TestGetChatbotUsageIsAdminOnly(t *testing.T) {
+	anonymous, learner, admin := requestAsEachCaller(t, GetChatbotUsage, http.MethodGet, "/api/chatbot/usage")
+	if anonymous != http.StatusUnauthorized || learner != http.StatusForbidden || admin.Code != http.StatusOK {
+		t.Fatalf("statuses = %d, %d, %d, want %d, %d, %d", anonymous, learner, admin.Code, http.StatusUnauthorized, http.StatusForbidden, http.StatusOK)
+	}
+	var usage struct {
+		Days []ChatbotDailyUsage `json:"days"`
+	}
+	if err := json.NewDecoder(admin.Body).Decode(&usage); err != nil || usage.Days == nil {
+		t.Errorf("admin response %s: %v", admin.Body, err)
+	}
+}
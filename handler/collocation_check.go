@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"EngPal/data"
+	"EngPal/internal"
+	"EngPal/utils"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// Unknown word pairs above which Gemini is asked about them
+	COLLOCATION_QUERY_THRESHOLD = 5
+	MAX_COLLOCATION_QUERY_PAIRS = 20
+	COLLOCATION_QUERY_TIMEOUT   = 10 * time.Second
+	COLLOCATION_QUERY_MODEL     = "gemini-2.0-flash"
+)
+
+// Collocations database loaded from the embedded data file
+var collocationDatabase = loadCollocations()
+
+func loadCollocations() map[string]utils.CollocationEntry {
+	var collocations map[string]utils.CollocationEntry
+	if err := json.Unmarshal(data.Collocations, &collocations); err != nil {
+		log.Fatalf("Failed to load collocations: %v", err)
+	}
+	return collocations
+}
+
+// Collocation errors of the content: known mistakes from the database and, when
+// more than COLLOCATION_QUERY_THRESHOLD word pairs are not in it, the pairs Gemini
+// finds unnatural within ctx. Without Gemini, or once ctx is done, only the known
+// mistakes are returned.
+func checkCollocationErrors(ctx context.Context, content string) []utils.CollocationError {
+	collocationErrors, unknown := utils.CheckCollocations(content, collocationDatabase)
+	if len(unknown) <= COLLOCATION_QUERY_THRESHOLD || ctx.Err() != nil {
+		return collocationErrors
+	}
+	if len(unknown) > MAX_COLLOCATION_QUERY_PAIRS {
+		unknown = unknown[:MAX_COLLOCATION_QUERY_PAIRS]
+	}
+
+	answers, err := queryCollocations(ctx, unknown)
+	if err != nil {
+		log.Printf("Error checking collocations with Gemini: %v", err)
+		return collocationErrors
+	}
+	for _, answer := range answers {
+		if answer.Natural || !contains(unknown, strings.ToLower(strings.TrimSpace(answer.Phrase))) {
+			continue
+		}
+		collocationErrors = append(collocationErrors, utils.CollocationError{
+			Phrase:       answer.Phrase,
+			Issue:        "Not a natural collocation in English",
+			BetterPhrase: strings.TrimSpace(answer.Suggestion),
+			Frequency:    utils.COLLOCATION_UNUSUAL,
+		})
+	}
+	return collocationErrors
+}
+
+type geminiCollocationAnswer struct {
+	Phrase     string `json:"phrase"`
+	Natural    bool   `json:"natural"`
+	Suggestion string `json:"suggestion"`
+}
+
+// Ask Gemini in one call whether each word pair is a natural collocation
+func queryCollocations(ctx context.Context, phrases []string) ([]geminiCollocationAnswer, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return nil, errors.New("Gemini client not initialized")
+	}
+	ctx, cancel := context.WithTimeout(ctx, COLLOCATION_QUERY_TIMEOUT)
+	defer cancel()
+
+	quoted := make([]string, len(phrases))
+	for i, phrase := range phrases {
+		quoted[i] = fmt.Sprintf("%q", phrase)
+	}
+	prompt := fmt.Sprintf(`Are these phrases natural English collocations: [%s]?
+For each phrase, exactly as given, set "natural" and, when it is not natural, give in "suggestion" the phrase a native speaker would use instead.
+Return JSON: [{phrase, natural, suggestion}]`, strings.Join(quoted, ", "))
+
+	itemSchema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"phrase":     {Type: genai.TypeString},
+			"natural":    {Type: genai.TypeBoolean},
+			"suggestion": {Type: genai.TypeString},
+		},
+		Required: []string{"phrase", "natural"},
+	}
+	result, err := client.Models.GenerateContent(ctx, COLLOCATION_QUERY_MODEL, genai.Text(prompt), &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   &genai.Schema{Type: genai.TypeArray, Items: itemSchema},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var answers []geminiCollocationAnswer
+	if err := json.Unmarshal([]byte(result.Text()), &answers); err != nil {
+		return nil, fmt.Errorf("failed to parse collocations JSON: %w", err)
+	}
+	return answers, nil
+}
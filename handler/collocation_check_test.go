@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckCollocationErrorsWithinContext(t *testing.T) {
+	// Six word pairs the database does not know, enough to ask Gemini
+	const content = "I painted the decision. She cooked her homework. They sang an effort. We cleaned our progress. He drank the research. You folded the exercise."
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		wantErrors int
+		wantCalls  int
+	}{
+		{"checked by Gemini", context.Background(), 1, 1},
+		{"context already done", expired, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gemini := useFakeGemini(t, answerGemini(`[{"phrase": "painted decision", "natural": false, "suggestion": "made a decision"}]`))
+			collocationErrors := checkCollocationErrors(test.ctx, content)
+			if len(collocationErrors) != test.wantErrors {
+				t.Errorf("errors = %+v, want %d", collocationErrors, test.wantErrors)
+			}
+			if calls := len(gemini.received()); calls != test.wantCalls {
+				t.Errorf("made %d Gemini calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"EngPal/utils"
+)
+
+const (
+	MAX_EXTENDED_TOTAL_WORDS = 5000
+	EXTENDED_CHUNK_WORDS     = 800 // Words per chunk reviewed in one Gemini call
+
+	// Larger context window for the long chunks of extended reviews
+	EXTENDED_REVIEW_MODEL = "gemini-1.5-pro"
+
+	// JWT claim that allows extended mode
+	EXTENDED_ACCESS_CLAIM = "extended_access"
+
+	// Essays longer than MAX_SINGLE_REVIEW_WORDS are reviewed in chunks without extended mode
+	MAX_SINGLE_REVIEW_WORDS = 1000
+	CHUNKED_REVIEW_WORDS    = 800
+	CHUNK_OVERLAP_WORDS     = 100 // Words of the previous chunk sent along as context
+)
+
+// Review a long essay in EXTENDED_CHUNK_WORDS chunks in parallel and combine the
+// chunk reviews into one.
+func generateExtendedReview(req GenerateCommentRequest, startTime time.Time) (*ReviewResponse, error) {
+	chunks := splitReviewChunks(req.Content, EXTENDED_CHUNK_WORDS)
+	response, err := reviewInChunks(req, chunks, nil, EXTENDED_REVIEW_MODEL, startTime)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Generated extended review of %d words in %d chunks", response.WordCount, len(chunks))
+	return response, nil
+}
+
+// Review an essay of more than MAX_SINGLE_REVIEW_WORDS in CHUNKED_REVIEW_WORDS
+// chunks. Each chunk is sent with the last CHUNK_OVERLAP_WORDS of the one before it
+// as context only, so that its review follows on without repeating the overlap.
+func chunkedReview(req GenerateCommentRequest, startTime time.Time) (*ReviewResponse, error) {
+	chunks := splitReviewChunks(req.Content, CHUNKED_REVIEW_WORDS)
+	contexts := make([]string, len(chunks))
+	for i := 1; i < len(chunks); i++ {
+		words := strings.Fields(chunks[i-1])
+		contexts[i] = strings.Join(words[max(0, len(words)-CHUNK_OVERLAP_WORDS):], " ")
+	}
+
+	response, err := reviewInChunks(req, chunks, contexts, REVIEW_MODEL, startTime)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Generated chunked review of %d words in %d chunks", response.WordCount, len(chunks))
+	return response, nil
+}
+
+// Review the chunks in parallel, each with its preceding context if any, and
+// combine the chunk reviews into one for the whole content
+func reviewInChunks(req GenerateCommentRequest, chunks, contexts []string, model string, startTime time.Time) (*ReviewResponse, error) {
+	chunkData := make([]*GeminiReviewData, len(chunks))
+	errs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chunkReq := req
+			chunkReq.Content = chunk
+			if contexts != nil {
+				chunkReq.precedingContext = contexts[i]
+			}
+			geminiResp, err := callGeminiForReviewModel(model, buildReviewPrompt(chunkReq))
+			if err != nil {
+				errs[i] = fmt.Errorf("gemini API call failed for chunk %d: %w", i+1, err)
+				return
+			}
+			chunkData[i], errs[i] = parseGeminiReviewResponse(geminiResp, chunkReq)
+		}()
+	}
+	wg.Wait()
+
+	// Every chunk is needed for the scores to cover the whole essay
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response := assembleReviewResponse(context.Background(), mergeChunkReviews(chunkData, chunks, req), req, startTime)
+	response.Chunked = true
+	response.ChunkCount = len(chunks)
+	return response, nil
+}
+
+// Split content into chunks of about maxWords words at sentence boundaries,
+// keeping paragraph breaks. A single sentence longer than maxWords is its own chunk.
+func splitReviewChunks(content string, maxWords int) []string {
+	var chunks []string
+	var current strings.Builder
+	words := 0
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+		words = 0
+	}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(paragraph) == "" {
+			if words > 0 {
+				current.WriteString("\n") // Keep blank lines between paragraphs
+			}
+			continue
+		}
+		sentences := utils.SplitSentences(paragraph)
+		for i, sentence := range sentences {
+			sentenceWords := getTotalWords(sentence)
+			if words > 0 && words+sentenceWords > maxWords {
+				flush()
+			}
+			if words > 0 && i > 0 {
+				current.WriteString(" ")
+			}
+			current.WriteString(strings.TrimSpace(sentence))
+			words += sentenceWords
+		}
+		if words > 0 {
+			current.WriteString("\n")
+		}
+	}
+	flush()
+	return chunks
+}
+
+// Combine chunk reviews: scores and levels are averaged weighted by the chunks' word
+// counts, lists are merged without duplicates, counts are summed and the corrected
+// versions are joined in order.
+func mergeChunkReviews(reviews []*GeminiReviewData, chunks []string, req GenerateCommentRequest) *GeminiReviewData {
+	merged := &GeminiReviewData{CEFRDescriptors: make(map[string]bool)}
+	totalWords := float64(max(1, getTotalWords(strings.Join(chunks, " "))))
+
+	levelSum := 0.0
+	sentenceOffset := 0 // Sentences in the chunks before this one
+	var feedback, focusedFeedback, corrected, enhanced, native, comparisons []string
+	anyCorrected := false
+	seenStrengths, seenAreas, seenIssues, seenWords := make(map[string]bool), make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for i, review := range reviews {
+		weight := float64(getTotalWords(chunks[i])) / totalWords
+		merged.Scores.Grammar += review.Scores.Grammar * weight
+		merged.Scores.Vocabulary += review.Scores.Vocabulary * weight
+		merged.Scores.Coherence += review.Scores.Coherence * weight
+		merged.Scores.TaskResponse += review.Scores.TaskResponse * weight
+		merged.Scores.Overall += review.Scores.Overall * weight
+		merged.Scores.ContextualVocabularyScore += review.Scores.ContextualVocabularyScore * weight
+
+		levelSum += float64(max(0, slices.Index(cefrLevelOrder, strings.ToUpper(review.EstimatedLevel)))) * weight
+		if review.OverallFeedback != "" {
+			feedback = append(feedback, review.OverallFeedback)
+		}
+		if review.FocusedFeedback != "" {
+			focusedFeedback = append(focusedFeedback, review.FocusedFeedback)
+		}
+		if review.CorrectedVersion != "" {
+			corrected = append(corrected, review.CorrectedVersion)
+			anyCorrected = true
+		} else {
+			corrected = append(corrected, chunks[i])
+		}
+		if review.EnhancedVersion != "" && review.NativeVersion != "" {
+			enhanced = append(enhanced, review.EnhancedVersion)
+			native = append(native, review.NativeVersion)
+		}
+		if review.VersionComparison != "" {
+			comparisons = append(comparisons, review.VersionComparison)
+		}
+		if merged.PurposeAppropriateness == "" {
+			merged.PurposeAppropriateness = review.PurposeAppropriateness
+		}
+
+		merged.StrengthPoints = appendUnique(merged.StrengthPoints, seenStrengths, review.StrengthPoints...)
+		merged.ImprovementAreas = appendUnique(merged.ImprovementAreas, seenAreas, review.ImprovementAreas...)
+		merged.MnemonicWords = appendUnique(merged.MnemonicWords, seenWords, review.MnemonicWords...)
+		for _, suggestion := range review.Suggestions {
+			key := strings.ToLower(strings.TrimSpace(suggestion.Issue))
+			if key != "" && seenIssues[key] {
+				continue
+			}
+			seenIssues[key] = true
+			merged.Suggestions = append(merged.Suggestions, suggestion)
+		}
+		merged.ContextualVocabularyIssues = append(merged.ContextualVocabularyIssues, review.ContextualVocabularyIssues...)
+		// Annotations are numbered per chunk; only the first MAX_ANNOTATED_SENTENCES overall are kept
+		if len(merged.SentenceGrammarAnnotations) == sentenceOffset {
+			for _, annotation := range review.SentenceGrammarAnnotations {
+				if len(merged.SentenceGrammarAnnotations) == MAX_ANNOTATED_SENTENCES {
+					break
+				}
+				annotation.SentenceIndex += sentenceOffset
+				merged.SentenceGrammarAnnotations = append(merged.SentenceGrammarAnnotations, annotation)
+			}
+		}
+		sentenceOffset += len(utils.SplitSentences(chunks[i]))
+
+		for id, demonstrated := range review.CEFRDescriptors {
+			merged.CEFRDescriptors[id] = merged.CEFRDescriptors[id] || demonstrated
+		}
+		for j, errorCount := range review.GrammarErrorBreakdown.counts() {
+			*merged.GrammarErrorBreakdown.fields()[j] += errorCount
+		}
+	}
+
+	merged.Scores = ReviewCriteria{
+		Grammar:                   clampScore(merged.Scores.Grammar),
+		Vocabulary:                clampScore(merged.Scores.Vocabulary),
+		Coherence:                 clampScore(merged.Scores.Coherence),
+		TaskResponse:              clampScore(merged.Scores.TaskResponse),
+		Overall:                   clampScore(merged.Scores.Overall),
+		ContextualVocabularyScore: clampScore(merged.Scores.ContextualVocabularyScore),
+	}
+	merged.EstimatedLevel = cefrLevelOrder[min(len(cefrLevelOrder)-1, int(levelSum+0.5))]
+	merged.OverallFeedback = strings.Join(feedback, "\n\n")
+	merged.FocusedFeedback = strings.Join(focusedFeedback, "\n\n")
+	if anyCorrected {
+		merged.CorrectedVersion = strings.Join(corrected, "\n\n")
+	}
+	// A rewrite missing a chunk would leave out part of the text
+	if len(enhanced) == len(reviews) {
+		merged.EnhancedVersion = strings.Join(enhanced, "\n\n")
+		merged.NativeVersion = strings.Join(native, "\n\n")
+		merged.VersionComparison = strings.Join(comparisons, "\n\n")
+	}
+	merged.Suggestions = limitSuggestions(merged.Suggestions, req.MaxSuggestions, req.FilterPriority)
+	return merged
+}
+
+// Append the values not seen yet, compared case-insensitively
+func appendUnique(list []string, seen map[string]bool, values ...string) []string {
+	for _, value := range values {
+		key := strings.ToLower(strings.TrimSpace(value))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		list = append(list, value)
+	}
+	return list
+}
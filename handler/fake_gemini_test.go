@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"EngPal/internal"
+
+	"google.golang.org/genai"
+)
+
+// A generateContent or streamGenerateContent call received by the fake Gemini server
+type fakeGeminiCall struct {
+	Model    string
+	Stream   bool
+	Contents []*genai.Content `json:"contents"`
+}
+
+// A Gemini API stand-in that answers generateContent calls with the text the test
+// chooses, or with an error status
+type fakeGemini struct {
+	mutex  sync.Mutex
+	calls  []fakeGeminiCall
+	answer func(call fakeGeminiCall) (status int, text string)
+}
+
+// Point internal.GeminiClient at a fake Gemini server for the test
+func useFakeGemini(t *testing.T, answer func(call fakeGeminiCall) (status int, text string)) *fakeGemini {
+	t.Helper()
+	fake := &fakeGemini{answer: answer}
+	server := httptest.NewServer(fake)
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := internal.GeminiClient
+	internal.GeminiClient = client
+	t.Cleanup(func() {
+		internal.GeminiClient = original
+		server.Close()
+	})
+	return fake
+}
+
+func (fake *fakeGemini) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var call fakeGeminiCall
+	json.NewDecoder(r.Body).Decode(&call)
+	// The path ends in /models/<model>:generateContent or :streamGenerateContent
+	call.Model, _, _ = strings.Cut(path.Base(r.URL.Path), ":")
+	call.Stream = strings.HasSuffix(r.URL.Path, ":streamGenerateContent")
+
+	fake.mutex.Lock()
+	fake.calls = append(fake.calls, call)
+	fake.mutex.Unlock()
+
+	status, text := fake.answer(call)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": status, "message": text}})
+		return
+	}
+	response, _ := json.Marshal(genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{Content: genai.NewContentFromText(text, genai.RoleModel)}},
+	})
+	if call.Stream {
+		// The whole answer as a single server-sent event
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: %s\n\n", response)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// The generateContent calls the fake has answered
+func (fake *fakeGemini) received() []fakeGeminiCall {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return append([]fakeGeminiCall{}, fake.calls...)
+}
+
+// Always answer with text
+func answerGemini(text string) func(fakeGeminiCall) (int, string) {
+	return func(fakeGeminiCall) (int, string) { return http.StatusOK, text }
+}
+
+// A small sample image of the given size and MIME type (image/png or image/jpeg),
+// whose pixels depend on seed so different seeds give different bytes
+func sampleImage(t *testing.T, mimeType string, width, height int, seed uint8) []byte {
+	t.Helper()
+	picture := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			picture.Set(x, y, color.RGBA{R: seed, G: uint8(x), B: uint8(y), A: 255})
+		}
+	}
+	var buffer bytes.Buffer
+	var err error
+	if mimeType == "image/jpeg" {
+		err = jpeg.Encode(&buffer, picture, nil)
+	} else {
+		err = png.Encode(&buffer, picture)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"EngPal/internal/config"
+)
+
+// Why a feedback submission was dropped
+const (
+	FEEDBACK_DROP_RATE_LIMITED = "rate_limited"
+	FEEDBACK_DROP_DUPLICATE    = "duplicate"
+	FEEDBACK_DROP_TOO_LARGE    = "too_large"
+)
+
+const (
+	FEEDBACK_RATE_WINDOW = time.Minute
+	// Tracked IPs and texts above which stale entries are swept
+	FEEDBACK_GUARD_SWEEP_SIZE = 1000
+)
+
+// Submissions accepted and dropped since the server started
+type FeedbackSubmissionStats struct {
+	Since           time.Time      `json:"since"`
+	Accepted        int            `json:"accepted"`
+	Dropped         int            `json:"dropped"`
+	DroppedByReason map[string]int `json:"dropped_by_reason"` // rate_limited, duplicate, too_large
+}
+
+// Recent submission times per client IP
+var (
+	feedbackSubmissions      = make(map[string][]time.Time)
+	feedbackSubmissionsMutex sync.Mutex
+)
+
+// When each feedback text was last stored, by content hash
+var (
+	recentFeedbackHashes      = make(map[string]time.Time)
+	recentFeedbackHashesMutex sync.Mutex
+)
+
+var (
+	feedbackStats = FeedbackSubmissionStats{
+		Since:           time.Now().UTC(),
+		DroppedByReason: map[string]int{FEEDBACK_DROP_RATE_LIMITED: 0, FEEDBACK_DROP_DUPLICATE: 0, FEEDBACK_DROP_TOO_LARGE: 0},
+	}
+	feedbackStatsMutex sync.Mutex
+)
+
+// Record a submission from the IP, reporting whether it is within
+// config.FeedbackRateLimit per FEEDBACK_RATE_WINDOW and, if not, how long until
+// the oldest submission leaves the window
+func allowFeedbackFrom(ip string) (bool, time.Duration) {
+	now := time.Now()
+	cutoff := now.Add(-FEEDBACK_RATE_WINDOW)
+
+	feedbackSubmissionsMutex.Lock()
+	defer feedbackSubmissionsMutex.Unlock()
+	if len(feedbackSubmissions) > FEEDBACK_GUARD_SWEEP_SIZE {
+		for address, times := range feedbackSubmissions {
+			if times[len(times)-1].Before(cutoff) {
+				delete(feedbackSubmissions, address)
+			}
+		}
+	}
+
+	recent := feedbackSubmissions[ip][:0]
+	for _, at := range feedbackSubmissions[ip] {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= config.FeedbackRateLimit() {
+		feedbackSubmissions[ip] = recent
+		return false, recent[0].Sub(cutoff)
+	}
+	feedbackSubmissions[ip] = append(recent, now)
+	return true, 0
+}
+
+// The feedback text ignoring case and spacing, so trivially edited repeats match
+func feedbackContentHash(text string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(text), " "))))
+	return hex.EncodeToString(sum[:])
+}
+
+// Claim the text for storing, reporting false when the same text was stored or
+// claimed within config.FeedbackDedupeWindow
+func claimFeedbackContent(hash string) bool {
+	now := time.Now()
+	cutoff := now.Add(-config.FeedbackDedupeWindow())
+
+	recentFeedbackHashesMutex.Lock()
+	defer recentFeedbackHashesMutex.Unlock()
+	if len(recentFeedbackHashes) > FEEDBACK_GUARD_SWEEP_SIZE {
+		for key, storedAt := range recentFeedbackHashes {
+			if storedAt.Before(cutoff) {
+				delete(recentFeedbackHashes, key)
+			}
+		}
+	}
+	if storedAt, found := recentFeedbackHashes[hash]; found && storedAt.After(cutoff) {
+		return false
+	}
+	recentFeedbackHashes[hash] = now
+	return true
+}
+
+// Let the text be sent again after it could not be stored
+func releaseFeedbackContent(hash string) {
+	recentFeedbackHashesMutex.Lock()
+	defer recentFeedbackHashesMutex.Unlock()
+	delete(recentFeedbackHashes, hash)
+}
+
+func recordFeedbackAccepted() {
+	feedbackStatsMutex.Lock()
+	defer feedbackStatsMutex.Unlock()
+	feedbackStats.Accepted++
+}
+
+func recordFeedbackDropped(reason string) {
+	feedbackStatsMutex.Lock()
+	defer feedbackStatsMutex.Unlock()
+	feedbackStats.Dropped++
+	feedbackStats.DroppedByReason[reason]++
+}
+
+func feedbackSubmissionStats() FeedbackSubmissionStats {
+	feedbackStatsMutex.Lock()
+	defer feedbackStatsMutex.Unlock()
+	stats := feedbackStats
+	stats.DroppedByReason = make(map[string]int, len(feedbackStats.DroppedByReason))
+	for reason, count := range feedbackStats.DroppedByReason {
+		stats.DroppedByReason[reason] = count
+	}
+	return stats
+}
@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"EngPal/entities"
+	"EngPal/internal/config"
+	"EngPal/repository"
+	"EngPal/utils"
+)
+
+type SendFeedbackRequest struct {
+	UserName     string `json:"user_name"`
+	UserFeedback string `json:"user_feedback"`
+	Rating       *int   `json:"rating,omitempty"`   // 1-5, optional
+	Category     string `json:"category,omitempty"` // bug, content_quality, feature_request, other; optional
+}
+
+type FeedbackListResponse struct {
+	Items  []entities.Feedback `json:"items"`
+	Total  int                 `json:"total"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+}
+
+const (
+	MAX_FEEDBACK_USER_NAME_LEN = 100
+	MAX_FEEDBACK_LEN           = 2000
+	DEFAULT_FEEDBACK_LIMIT     = 50
+	MAX_FEEDBACK_LIMIT         = 200
+
+	MIN_FEEDBACK_RATING           = 1
+	MAX_FEEDBACK_RATING           = 5
+	LOW_FEEDBACK_RATING           = 2 // Ratings at or below this are listed in the summary
+	FEEDBACK_SUMMARY_RECENT       = 5
+	DEFAULT_FEEDBACK_SUMMARY_DAYS = 7
+)
+
+var feedbackCategories = []string{"bug", "content_quality", "feature_request", "other"}
+
+// Windows the feedback summary can cover, in days
+var feedbackSummaryWindows = []int{7, 30}
+
+type FeedbackSummaryResponse struct {
+	WindowDays int `json:"window_days"`
+	entities.FeedbackSummary
+	Submissions FeedbackSubmissionStats `json:"submissions"` // Since the server started, not over the window
+}
+
+// Where feedback is stored, set by SetFeedbackRepo at startup
+var feedbackRepo repository.FeedbackRepo
+
+// SetFeedbackRepo sets the repository feedback is stored in.
+func SetFeedbackRepo(repo repository.FeedbackRepo) {
+	feedbackRepo = repo
+}
+
+// POST /api/feedback - stores a user's feedback about the app. The endpoint is open,
+// so submissions are rate limited per IP and repeats of a recent text are dropped.
+func SendFeedback(w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r)
+	if allowed, retryAfter := allowFeedbackFrom(ip); !allowed {
+		recordFeedbackDropped(FEEDBACK_DROP_RATE_LIMITED)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "bạn gửi góp ý quá nhanh, vui lòng thử lại sau", http.StatusTooManyRequests)
+		return
+	}
+
+	var request SendFeedbackRequest
+	r.Body = http.MaxBytesReader(w, r.Body, config.FeedbackMaxBodyBytes())
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			recordFeedbackDropped(FEEDBACK_DROP_TOO_LARGE)
+			http.Error(w, "nội dung góp ý quá lớn", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	feedback, err := validateFeedback(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if feedbackRepo == nil {
+		http.Error(w, "chưa cấu hình nơi lưu góp ý", http.StatusServiceUnavailable)
+		return
+	}
+
+	// A repeat is dropped silently so the sender cannot tell it apart from success
+	contentHash := feedbackContentHash(feedback.UserFeedback)
+	if !claimFeedbackContent(contentHash) {
+		recordFeedbackDropped(FEEDBACK_DROP_DUPLICATE)
+		logf(r, "Dropped repeated feedback from %s", ip)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	feedback.ClientIP = ip
+	feedback.UserAgent = r.UserAgent()
+	feedback.CreatedAt = time.Now().UTC()
+	forward := config.FeedbackWebhookURL() != ""
+	if forward {
+		feedback.WebhookStatus = entities.WebhookPending
+	}
+	if err := feedbackRepo.Create(feedback); err != nil {
+		logf(r, "Error storing feedback: %v", err)
+		releaseFeedbackContent(contentHash)
+		http.Error(w, "không lưu được góp ý", http.StatusInternalServerError)
+		return
+	}
+	recordFeedbackAccepted()
+	if forward {
+		forwardFeedback(*feedback)
+	}
+
+	logf(r, "Stored feedback %d from %s", feedback.ID, feedback.ClientIP)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Check the feedback lengths after removing control characters and masking profanity
+func validateFeedback(request SendFeedbackRequest) (*entities.Feedback, error) {
+	userName := utils.MaskProfanity(strings.TrimSpace(stripControlCharacters(request.UserName, false)))
+	userFeedback := utils.MaskProfanity(strings.TrimSpace(stripControlCharacters(request.UserFeedback, true)))
+
+	if utf8.RuneCountInString(userName) > MAX_FEEDBACK_USER_NAME_LEN {
+		return nil, fmt.Errorf("tên người dùng không được dài hơn %d ký tự", MAX_FEEDBACK_USER_NAME_LEN)
+	}
+	if userFeedback == "" {
+		return nil, errors.New("nội dung góp ý không được để trống")
+	}
+	if utf8.RuneCountInString(userFeedback) > MAX_FEEDBACK_LEN {
+		return nil, fmt.Errorf("nội dung góp ý không được dài hơn %d ký tự", MAX_FEEDBACK_LEN)
+	}
+
+	// Rating and category are optional so older clients keep working
+	rating := 0
+	if request.Rating != nil {
+		rating = *request.Rating
+		if rating < MIN_FEEDBACK_RATING || rating > MAX_FEEDBACK_RATING {
+			return nil, fmt.Errorf("đánh giá phải nằm trong khoảng %d đến %d", MIN_FEEDBACK_RATING, MAX_FEEDBACK_RATING)
+		}
+	}
+	category := strings.ToLower(strings.TrimSpace(request.Category))
+	if category != "" && !contains(feedbackCategories, category) {
+		return nil, fmt.Errorf("loại góp ý không hợp lệ (%s)", strings.Join(feedbackCategories, ", "))
+	}
+
+	return &entities.Feedback{UserName: userName, UserFeedback: userFeedback, Rating: rating, Category: category}, nil
+}
+
+// Remove control characters, keeping line breaks and tabs when multiline
+func stripControlCharacters(text string, multiline bool) string {
+	return strings.Map(func(r rune) rune {
+		if multiline && (r == '\n' || r == '\t') {
+			return r
+		}
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(text, "\r\n", "\n"))
+}
+
+// The client's address: the peer, or, when the peer is one of TRUSTED_PROXIES, the
+// right-most X-Forwarded-For entry that is not. Entries left of that were sent by
+// the client and could be anything.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	hop, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(hop) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && isTrustedProxy(hop); i-- {
+		previous, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break // Not an address, so the nearest trusted hop stands in for the client
+		}
+		hop = previous
+	}
+	return hop.Unmap().String()
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, proxy := range config.TrustedProxies() {
+		if proxy.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /api/feedback?limit=&offset=&from=&to= - stored feedback, newest first (admin only)
+func ListFeedback(w http.ResponseWriter, r *http.Request) {
+	if status, ok := requireJWTClaim(r, ADMIN_CLAIM); !ok {
+		writeJWTClaimError(w, status, "chỉ quản trị viên mới xem được góp ý")
+		return
+	}
+
+	filter, err := parseFeedbackFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if feedbackRepo == nil {
+		http.Error(w, "chưa cấu hình nơi lưu góp ý", http.StatusServiceUnavailable)
+		return
+	}
+
+	items, total, err := feedbackRepo.List(filter)
+	if err != nil {
+		logf(r, "Error listing feedback: %v", err)
+		http.Error(w, "không đọc được góp ý", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FeedbackListResponse{Items: items, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// Parse the paging and date range of the feedback list. Dates are RFC 3339 times
+// or YYYY-MM-DD days; a day in "to" includes the whole day.
+func parseFeedbackFilter(r *http.Request) (repository.FeedbackFilter, error) {
+	query := r.URL.Query()
+	filter := repository.FeedbackFilter{Limit: DEFAULT_FEEDBACK_LIMIT}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MAX_FEEDBACK_LIMIT {
+			return filter, fmt.Errorf("limit phải nằm trong khoảng 1 đến %d", MAX_FEEDBACK_LIMIT)
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, errors.New("offset phải là số không âm")
+		}
+		filter.Offset = offset
+	}
+
+	var err error
+	if filter.From, err = parseFeedbackDate(query.Get("from"), false); err != nil {
+		return filter, errors.New("from phải có dạng YYYY-MM-DD hoặc RFC 3339")
+	}
+	if filter.To, err = parseFeedbackDate(query.Get("to"), true); err != nil {
+		return filter, errors.New("to phải có dạng YYYY-MM-DD hoặc RFC 3339")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, errors.New("to không được trước from")
+	}
+	return filter, nil
+}
+
+func parseFeedbackDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			return day.Add(24*time.Hour - time.Nanosecond), nil
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// GET /api/feedback/summary?days=7|30 - feedback counts per category, average rating
+// and the latest low-rated feedback over the window (admin only)
+func GetFeedbackSummary(w http.ResponseWriter, r *http.Request) {
+	if status, ok := requireJWTClaim(r, ADMIN_CLAIM); !ok {
+		writeJWTClaimError(w, status, "chỉ quản trị viên mới xem được góp ý")
+		return
+	}
+
+	days := DEFAULT_FEEDBACK_SUMMARY_DAYS
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || !slices.Contains(feedbackSummaryWindows, parsed) {
+			http.Error(w, "days phải là 7 hoặc 30", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+	if feedbackRepo == nil {
+		http.Error(w, "chưa cấu hình nơi lưu góp ý", http.StatusServiceUnavailable)
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	summary, err := feedbackRepo.Summary(since, LOW_FEEDBACK_RATING, FEEDBACK_SUMMARY_RECENT)
+	if err != nil {
+		logf(r, "Error summarizing feedback: %v", err)
+		http.Error(w, "không đọc được góp ý", http.StatusInternalServerError)
+		return
+	}
+	for _, category := range feedbackCategories {
+		if _, counted := summary.CategoryCounts[category]; !counted {
+			summary.CategoryCounts[category] = 0 // List every category, even without feedback
+		}
+	}
+	summary.AverageRating = roundTo(summary.AverageRating, 2)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FeedbackSummaryResponse{WindowDays: days, FeedbackSummary: *summary, Submissions: feedbackSubmissionStats()})
+}
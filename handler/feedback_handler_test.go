@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"EngPal/entities"
+	"EngPal/internal/config"
+	"EngPal/repository"
+	"EngPal/repository/repo_impl"
+)
+
+// Store feedback in a fresh file for the test, with empty rate limits and dedup
+// history and no webhook
+func useFeedbackRepo(t *testing.T, rateLimit int) *repo_impl.FeedbackRepoImpl {
+	t.Helper()
+	repo, err := repo_impl.NewFeedbackRepoImpl(filepath.Join(t.TempDir(), "feedback.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := config.Load()
+	cfg.FeedbackRateLimit = rateLimit
+	cfg.FeedbackWebhookURL = ""
+	config.Use(cfg)
+
+	clearFeedbackGuards := func() {
+		feedbackSubmissionsMutex.Lock()
+		clear(feedbackSubmissions)
+		feedbackSubmissionsMutex.Unlock()
+		recentFeedbackHashesMutex.Lock()
+		clear(recentFeedbackHashes)
+		recentFeedbackHashesMutex.Unlock()
+	}
+	clearFeedbackGuards()
+	SetFeedbackRepo(repo)
+	t.Cleanup(func() {
+		SetFeedbackRepo(nil)
+		repo.Close()
+		clearFeedbackGuards()
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+	return repo
+}
+
+func sendFeedback(body, ip string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/feedback", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "EngPal-Test")
+	request.RemoteAddr = ip + ":1234"
+	SendFeedback(recorder, request)
+	return recorder
+}
+
+func TestSendFeedbackStoresFeedback(t *testing.T) {
+	repo := useFeedbackRepo(t, 5)
+
+	recorder := sendFeedback(`{"user_name": " Lan\u0007 ", "user_feedback": "The quizzes\r\nare great", "rating": 5, "category": " Feature_Request "}`, "203.0.113.7")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusNoContent, recorder.Body)
+	}
+
+	items, total, err := repo.List(repository.FeedbackFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("stored %d items, want 1", total)
+	}
+	stored := items[0]
+	if stored.ID != 1 || stored.UserName != "Lan" || stored.UserFeedback != "The quizzes\nare great" || stored.Rating != 5 || stored.Category != "feature_request" {
+		t.Errorf("stored %+v", stored)
+	}
+	if stored.ClientIP != "203.0.113.7" || stored.UserAgent != "EngPal-Test" || time.Since(stored.CreatedAt) > time.Minute || stored.WebhookStatus != "" {
+		t.Errorf("stored request details %+v", stored)
+	}
+}
+
+func TestSendFeedbackDropsRepeatsAndLimitsRate(t *testing.T) {
+	repo := useFeedbackRepo(t, 2)
+
+	// The repeat differs only in case and spacing
+	for _, body := range []string{`{"user_feedback": "Please add more listening tests"}`, `{"user_feedback": "please add  more listening TESTS"}`} {
+		if recorder := sendFeedback(body, "203.0.113.8"); recorder.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusNoContent, recorder.Body)
+		}
+	}
+	if _, total, _ := repo.List(repository.FeedbackFilter{Limit: 10}); total != 1 {
+		t.Errorf("stored %d items, want the repeat dropped", total)
+	}
+
+	recorder := sendFeedback(`{"user_feedback": "A third message"}`, "203.0.113.8")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("third submission in a minute: status %d, Retry-After %q, want %d with Retry-After", recorder.Code, recorder.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if recorder := sendFeedback(`{"user_feedback": "From another address"}`, "203.0.113.9"); recorder.Code != http.StatusNoContent {
+		t.Errorf("another IP: status = %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
+
+func TestSendFeedbackRejectsInvalidFeedback(t *testing.T) {
+	useFeedbackRepo(t, 100)
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"malformed JSON", `{"user_feedback": `, http.StatusBadRequest},
+		{"empty feedback", `{"user_feedback": "  \u0000 "}`, http.StatusBadRequest},
+		{"feedback too long", `{"user_feedback": "` + strings.Repeat("a", MAX_FEEDBACK_LEN+1) + `"}`, http.StatusBadRequest},
+		{"user name too long", `{"user_name": "` + strings.Repeat("a", MAX_FEEDBACK_USER_NAME_LEN+1) + `", "user_feedback": "ok"}`, http.StatusBadRequest},
+		{"rating too low", `{"user_feedback": "ok", "rating": 0}`, http.StatusBadRequest},
+		{"rating too high", `{"user_feedback": "ok", "rating": 6}`, http.StatusBadRequest},
+		{"unknown category", `{"user_feedback": "ok", "category": "praise"}`, http.StatusBadRequest},
+		{"body too large", `{"user_feedback": "` + strings.Repeat("a", 20<<10) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := sendFeedback(test.body, "203.0.113.10"); recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestSendFeedbackWithoutRepo(t *testing.T) {
+	useFeedbackRepo(t, 5)
+	SetFeedbackRepo(nil)
+	if recorder := sendFeedback(`{"user_feedback": "Hello"}`, "203.0.113.11"); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg, _ := config.Load()
+	cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::1/128")}
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"forwarded by an untrusted peer", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"behind a trusted proxy", "10.0.0.2:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entry on the left", "10.0.0.2:1234", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"through two trusted proxies", "10.0.0.2:1234", []string{"1.2.3.4, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"across header lines", "10.0.0.2:1234", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"only trusted entries", "10.0.0.2:1234", []string{"10.0.0.4, 10.0.0.3"}, "10.0.0.4"},
+		{"trusted proxy without the header", "10.0.0.2:1234", nil, "10.0.0.2"},
+		{"not an address", "10.0.0.2:1234", []string{"198.51.100.1, unknown"}, "10.0.0.2"},
+		{"IPv6 proxy", "[2001:db8::1]:1234", []string{"2001:db8::99"}, "2001:db8::99"},
+		{"IPv4-mapped proxy", "[::ffff:10.0.0.2]:1234", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/feedback", nil)
+			request.RemoteAddr = test.remoteAddr
+			for _, value := range test.forwarded {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIP(request); got != test.want {
+				t.Errorf("clientIP = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSendFeedbackIgnoresSpoofedForwardedFor(t *testing.T) {
+	useFeedbackRepo(t, 1)
+	for i, forwarded := range []string{"198.51.100.1", "198.51.100.2"} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/feedback", strings.NewReader(`{"user_feedback": "Message `+forwarded+`"}`))
+		request.RemoteAddr = "203.0.113.12:1234"
+		request.Header.Set("X-Forwarded-For", forwarded)
+		SendFeedback(recorder, request)
+		if want := []int{http.StatusNoContent, http.StatusTooManyRequests}[i]; recorder.Code != want {
+			t.Errorf("submission %d: status = %d, want %d", i+1, recorder.Code, want)
+		}
+	}
+}
+
+func TestParseFeedbackFilter(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		query   string
+		want    repository.FeedbackFilter
+		wantErr bool
+	}{
+		{"", repository.FeedbackFilter{Limit: DEFAULT_FEEDBACK_LIMIT}, false},
+		{"limit=10&offset=20", repository.FeedbackFilter{Limit: 10, Offset: 20}, false},
+		{"from=2026-03-01&to=2026-03-02", repository.FeedbackFilter{Limit: DEFAULT_FEEDBACK_LIMIT, From: day(1), To: day(3).Add(-time.Nanosecond)}, false},
+		{"from=2026-03-01T08:00:00Z", repository.FeedbackFilter{Limit: DEFAULT_FEEDBACK_LIMIT, From: day(1).Add(8 * time.Hour)}, false},
+		{"limit=0", repository.FeedbackFilter{}, true},
+		{"limit=201", repository.FeedbackFilter{}, true},
+		{"limit=ten", repository.FeedbackFilter{}, true},
+		{"offset=-1", repository.FeedbackFilter{}, true},
+		{"from=03/01/2026", repository.FeedbackFilter{}, true},
+		{"to=yesterday", repository.FeedbackFilter{}, true},
+		{"from=2026-03-02&to=2026-03-01", repository.FeedbackFilter{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			filter, err := parseFeedbackFilter(httptest.NewRequest(http.MethodGet, "/api/feedback?"+test.query, nil))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && (filter.Limit != test.want.Limit || filter.Offset != test.want.Offset || !filter.From.Equal(test.want.From) || !filter.To.Equal(test.want.To)) {
+				t.Errorf("filter = %+v, want %+v", filter, test.want)
+			}
+		})
+	}
+}
+
+func TestListFeedback(t *testing.T) {
+	repo := useFeedbackRepo(t, 5)
+	for d := 1; d <= 3; d++ {
+		if err := repo.Create(&entities.Feedback{UserFeedback: "feedback", CreatedAt: time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin := signTestJWT(t, map[string]interface{}{"sub": "lan", "admin": true, "exp": time.Now().Add(time.Hour).Unix()})
+	learner := signTestJWT(t, map[string]interface{}{"sub": "minh", "exp": time.Now().Add(time.Hour).Unix()})
+
+	tests := []struct {
+		name       string
+		token      string
+		query      string
+		wantStatus int
+		wantIDs    []int64
+		wantTotal  int
+	}{
+		{"no token", "", "", http.StatusUnauthorized, nil, 0},
+		{"invalid token", "not-a-jwt", "", http.StatusUnauthorized, nil, 0},
+		{"not an admin", learner, "", http.StatusForbidden, nil, 0},
+		{"admin", admin, "", http.StatusOK, []int64{3, 2, 1}, 3},
+		{"page", admin, "?limit=1&offset=1", http.StatusOK, []int64{2}, 3},
+		{"date range", admin, "?from=2026-03-02&to=2026-03-02", http.StatusOK, []int64{2}, 1},
+		{"bad filter", admin, "?limit=0", http.StatusBadRequest, nil, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/api/feedback"+test.query, nil)
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			ListFeedback(recorder, request)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			var list FeedbackListResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			ids := []int64{}
+			for _, item := range list.Items {
+				ids = append(ids, item.ID)
+			}
+			if list.Total != test.wantTotal || !reflect.DeepEqual(ids, test.wantIDs) {
+				t.Errorf("got IDs %v of %d, want %v of %d", ids, list.Total, test.wantIDs, test.wantTotal)
+			}
+		})
+	}
+}
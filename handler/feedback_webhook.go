@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"EngPal/entities"
+	"EngPal/internal/config"
+)
+
+const (
+	FEEDBACK_WEBHOOK_TIMEOUT     = 5 * time.Second
+	FEEDBACK_WEBHOOK_ATTEMPTS    = 2
+	FEEDBACK_WEBHOOK_RETRY_DELAY = 2 * time.Second
+	FEEDBACK_WEBHOOK_QUEUE_SIZE  = 100
+	MAX_WEBHOOK_FEEDBACK_LEN     = 500 // Characters of the feedback text put in the message
+
+	// Consecutive failed deliveries that open the circuit, and how long it stays open
+	FEEDBACK_WEBHOOK_FAILURE_THRESHOLD = 3
+	FEEDBACK_WEBHOOK_OPEN_DURATION     = 5 * time.Minute
+)
+
+var (
+	errWebhookCircuitOpen = errors.New("webhook circuit open after repeated failures")
+	errWebhookQueueFull   = errors.New("webhook queue full")
+)
+
+// Feedback waiting to be forwarded, delivered one at a time by a single worker so a
+// slow webhook never holds up SendFeedback
+var (
+	feedbackWebhookQueue  = make(chan entities.Feedback, FEEDBACK_WEBHOOK_QUEUE_SIZE)
+	feedbackWebhookClient = &http.Client{Timeout: FEEDBACK_WEBHOOK_TIMEOUT}
+)
+
+// Circuit breaker state of the webhook
+var (
+	feedbackWebhookFailures  int
+	feedbackWebhookOpenUntil time.Time
+	feedbackWebhookMutex     sync.Mutex
+)
+
+// Queue stored feedback for the webhook. The feedback must have been stored with
+// WebhookStatus pending.
+func forwardFeedback(feedback entities.Feedback) {
+	select {
+	case feedbackWebhookQueue <- feedback:
+	default:
+		recordWebhookResult(feedback.ID, errWebhookQueueFull)
+	}
+}
+
+// StartFeedbackWebhookWorker forwards queued feedback in the background until ctx is
+// cancelled, finishing the delivery in progress. Feedback still queued then keeps
+// its pending status. The returned channel is closed once the worker has stopped.
+func StartFeedbackWebhookWorker(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Checked before every wait, as select picks at random once both are ready
+		for ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case feedback := <-feedbackWebhookQueue:
+				recordWebhookResult(feedback.ID, deliverFeedback(feedback))
+			}
+		}
+		if pending := len(feedbackWebhookQueue); pending > 0 {
+			log.Printf("Stopped forwarding feedback with %d left pending", pending)
+		}
+	}()
+	return done
+}
+
+// Post the feedback to the webhook, retrying once, unless the circuit is open
+func deliverFeedback(feedback entities.Feedback) error {
+	webhookURL := config.FeedbackWebhookURL()
+	if webhookURL == "" {
+		return errors.New("webhook no longer configured")
+	}
+
+	feedbackWebhookMutex.Lock()
+	open := time.Now().Before(feedbackWebhookOpenUntil)
+	feedbackWebhookMutex.Unlock()
+	if open {
+		return errWebhookCircuitOpen
+	}
+
+	body, err := json.Marshal(webhookPayload(webhookURL, formatFeedbackMessage(feedback)))
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(webhookURL, body)
+		if err == nil || attempt == FEEDBACK_WEBHOOK_ATTEMPTS {
+			break
+		}
+		time.Sleep(FEEDBACK_WEBHOOK_RETRY_DELAY)
+	}
+
+	feedbackWebhookMutex.Lock()
+	defer feedbackWebhookMutex.Unlock()
+	if err == nil {
+		feedbackWebhookFailures = 0
+		return nil
+	}
+	feedbackWebhookFailures++
+	if feedbackWebhookFailures >= FEEDBACK_WEBHOOK_FAILURE_THRESHOLD {
+		feedbackWebhookOpenUntil = time.Now().Add(FEEDBACK_WEBHOOK_OPEN_DURATION)
+		feedbackWebhookFailures = 0
+		log.Printf("Feedback webhook failed %d times in a row, pausing it for %s", FEEDBACK_WEBHOOK_FAILURE_THRESHOLD, FEEDBACK_WEBHOOK_OPEN_DURATION)
+	}
+	return err
+}
+
+func postWebhook(webhookURL string, body []byte) error {
+	resp, err := feedbackWebhookClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL holds the webhook's secret, so it is left out of the stored error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Discord expects the message in "content", Slack in "text"
+func webhookPayload(webhookURL, message string) map[string]string {
+	if parsed, err := url.Parse(webhookURL); err == nil {
+		host := strings.ToLower(parsed.Hostname())
+		if host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com") {
+			return map[string]string{"content": message}
+		}
+	}
+	return map[string]string{"text": message}
+}
+
+// e.g. "New feedback from Lan ★★★★☆ [bug]" followed by the quoted text
+func formatFeedbackMessage(feedback entities.Feedback) string {
+	userName := feedback.UserName
+	if userName == "" {
+		userName = "anonymous"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("New feedback from " + userName)
+	if feedback.Rating > 0 {
+		sb.WriteString(" " + strings.Repeat("★", feedback.Rating) + strings.Repeat("☆", MAX_FEEDBACK_RATING-feedback.Rating))
+	}
+	if feedback.Category != "" {
+		sb.WriteString(" [" + feedback.Category + "]")
+	}
+
+	text := feedback.UserFeedback
+	if utf8.RuneCountInString(text) > MAX_WEBHOOK_FEEDBACK_LEN {
+		text = string([]rune(text)[:MAX_WEBHOOK_FEEDBACK_LEN]) + "…"
+	}
+	for _, line := range strings.Split(text, "\n") {
+		sb.WriteString("\n> " + line)
+	}
+	return sb.String()
+}
+
+// Store the delivery outcome on the feedback
+func recordWebhookResult(feedbackID int64, deliveryErr error) {
+	status, message := entities.WebhookDelivered, ""
+	if deliveryErr != nil {
+		status, message = entities.WebhookFailed, deliveryErr.Error()
+		log.Printf("Could not forward feedback %d to the webhook: %v", feedbackID, deliveryErr)
+	}
+	if err := feedbackRepo.UpdateWebhookStatus(feedbackID, status, message); err != nil {
+		log.Printf("Error recording webhook status of feedback %d: %v", feedbackID, err)
+	}
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"EngPal/entities"
+	"EngPal/internal/config"
+	"EngPal/repository"
+	"EngPal/repository/repo_impl"
+)
+
+// A webhook stand-in recording the payloads it is sent
+type fakeWebhook struct {
+	mutex    sync.Mutex
+	payloads []map[string]string
+	status   int
+}
+
+func (fake *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]string
+	json.NewDecoder(r.Body).Decode(&payload)
+	fake.mutex.Lock()
+	fake.payloads = append(fake.payloads, payload)
+	status := fake.status
+	fake.mutex.Unlock()
+	w.WriteHeader(status)
+}
+
+func (fake *fakeWebhook) received() []map[string]string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return append([]map[string]string{}, fake.payloads...)
+}
+
+// Store feedback in a fresh file and forward it to a webhook answering with status,
+// starting with a closed circuit and an empty queue
+func useFeedbackWebhook(t *testing.T, status int) (*repo_impl.FeedbackRepoImpl, *fakeWebhook, *httptest.Server) {
+	t.Helper()
+	repo := useFeedbackRepo(t, 100)
+	fake := &fakeWebhook{status: status}
+	server := httptest.NewServer(fake)
+	cfg, _ := config.Load()
+	cfg.FeedbackWebhookURL = server.URL
+	config.Use(cfg)
+
+	resetWebhook := func() {
+		feedbackWebhookMutex.Lock()
+		feedbackWebhookFailures, feedbackWebhookOpenUntil = 0, time.Time{}
+		feedbackWebhookMutex.Unlock()
+		for len(feedbackWebhookQueue) > 0 {
+			<-feedbackWebhookQueue
+		}
+	}
+	resetWebhook()
+	t.Cleanup(func() {
+		resetWebhook()
+		server.Close()
+	})
+	return repo, fake, server
+}
+
+// Run the webhook worker until the test ends
+func runFeedbackWebhookWorker(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := StartFeedbackWebhookWorker(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// Wait for the stored feedback to leave the pending webhook status
+func waitForWebhookStatus(t *testing.T, repo *repo_impl.FeedbackRepoImpl) entities.Feedback {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		items, _, _ := repo.List(repository.FeedbackFilter{Limit: 1})
+		if len(items) == 1 && items[0].WebhookStatus != entities.WebhookPending {
+			return items[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the feedback is still pending: %+v", items)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSendFeedbackForwardsToWebhook(t *testing.T) {
+	repo, webhook, _ := useFeedbackWebhook(t, http.StatusNoContent)
+	runFeedbackWebhookWorker(t)
+
+	recorder := sendFeedback(`{"user_name": "Lan", "user_feedback": "The app crashes on the quiz page", "rating": 2, "category": "bug"}`, "203.0.113.20")
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusNoContent, recorder.Body)
+	}
+	stored := waitForWebhookStatus(t, repo)
+	if stored.WebhookStatus != entities.WebhookDelivered || stored.WebhookError != "" {
+		t.Errorf("webhook status = %q (%q), want delivered", stored.WebhookStatus, stored.WebhookError)
+	}
+	want := []map[string]string{{"text": "New feedback from Lan ★★☆☆☆ [bug]\n> The app crashes on the quiz page"}}
+	if payloads := webhook.received(); len(payloads) != 1 || payloads[0]["text"] != want[0]["text"] {
+		t.Errorf("webhook received %v, want %v", payloads, want)
+	}
+}
+
+func TestFailedWebhookDeliveryOpensCircuit(t *testing.T) {
+	repo, webhook, _ := useFeedbackWebhook(t, http.StatusInternalServerError)
+	runFeedbackWebhookWorker(t)
+	// One more failure opens the circuit
+	feedbackWebhookMutex.Lock()
+	feedbackWebhookFailures = FEEDBACK_WEBHOOK_FAILURE_THRESHOLD - 1
+	feedbackWebhookMutex.Unlock()
+
+	sendFeedback(`{"user_feedback": "Please add a dark mode"}`, "203.0.113.21")
+	stored := waitForWebhookStatus(t, repo)
+	if stored.WebhookStatus != entities.WebhookFailed || stored.WebhookError != "webhook returned 500 Internal Server Error" {
+		t.Errorf("webhook status = %q (%q), want failed with the response status", stored.WebhookStatus, stored.WebhookError)
+	}
+	if attempts := len(webhook.received()); attempts != FEEDBACK_WEBHOOK_ATTEMPTS {
+		t.Errorf("webhook was called %d times, want %d", attempts, FEEDBACK_WEBHOOK_ATTEMPTS)
+	}
+
+	if err := deliverFeedback(stored); !errors.Is(err, errWebhookCircuitOpen) {
+		t.Errorf("delivering with the circuit open: err = %v, want %v", err, errWebhookCircuitOpen)
+	}
+	if attempts := len(webhook.received()); attempts != FEEDBACK_WEBHOOK_ATTEMPTS {
+		t.Errorf("the webhook was called with the circuit open")
+	}
+}
+
+func TestWebhookErrorHidesURL(t *testing.T) {
+	_, _, server := useFeedbackWebhook(t, http.StatusNoContent)
+	server.Close() // Connections are refused from now on
+
+	err := postWebhook(server.URL+"/secret-token", []byte(`{}`))
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("err = %v, want an error without the URL", err)
+	}
+}
+
+func TestWebhookWorkerStopsWithFeedbackPending(t *testing.T) {
+	repo, _, _ := useFeedbackWebhook(t, http.StatusNoContent)
+	for _, text := range []string{"First", "Second"} {
+		feedback := &entities.Feedback{UserFeedback: text, WebhookStatus: entities.WebhookPending, CreatedAt: time.Now()}
+		if err := repo.Create(feedback); err != nil {
+			t.Fatal(err)
+		}
+		forwardFeedback(*feedback)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	<-StartFeedbackWebhookWorker(ctx)
+
+	items, _, _ := repo.List(repository.FeedbackFilter{Limit: 10})
+	for _, item := range items {
+		if item.WebhookStatus != entities.WebhookPending {
+			t.Errorf("feedback %q is %s after the worker stopped, want pending", item.UserFeedback, item.WebhookStatus)
+		}
+	}
+	if queued := len(feedbackWebhookQueue); queued != 2 {
+		t.Errorf("%d feedback items left queued, want 2", queued)
+	}
+}
+
+func TestForwardFeedbackWithFullQueue(t *testing.T) {
+	repo, _, _ := useFeedbackWebhook(t, http.StatusNoContent)
+	for range FEEDBACK_WEBHOOK_QUEUE_SIZE {
+		feedbackWebhookQueue <- entities.Feedback{}
+	}
+	feedback := &entities.Feedback{UserFeedback: "One too many", WebhookStatus: entities.WebhookPending, CreatedAt: time.Now()}
+	if err := repo.Create(feedback); err != nil {
+		t.Fatal(err)
+	}
+	forwardFeedback(*feedback)
+
+	items, _, _ := repo.List(repository.FeedbackFilter{Limit: 1})
+	if items[0].WebhookStatus != entities.WebhookFailed || items[0].WebhookError != errWebhookQueueFull.Error() {
+		t.Errorf("webhook status = %q (%q), want failed with a full queue", items[0].WebhookStatus, items[0].WebhookError)
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantKey string
+	}{
+		{"https://discord.com/api/webhooks/1/abc", "content"},
+		{"https://DiscordApp.com/api/webhooks/1/abc", "content"},
+		{"https://canary.discord.com/api/webhooks/1/abc", "content"},
+		{"https://hooks.slack.com/services/T0/B0/abc", "text"},
+		{"https://notdiscord.com/hook", "text"},
+		{"https://example.com/hook", "text"},
+	}
+	for _, test := range tests {
+		payload := webhookPayload(test.url, "hello")
+		if len(payload) != 1 || payload[test.wantKey] != "hello" {
+			t.Errorf("webhookPayload(%q) = %v, want the message in %q", test.url, payload, test.wantKey)
+		}
+	}
+}
+
+func TestFormatFeedbackMessage(t *testing.T) {
+	long := strings.Repeat("ă", MAX_WEBHOOK_FEEDBACK_LEN+10)
+	tests := []struct {
+		name     string
+		feedback entities.Feedback
+		want     string
+	}{
+		{"anonymous", entities.Feedback{UserFeedback: "Nice"}, "New feedback from anonymous\n> Nice"},
+		{"rated with category", entities.Feedback{UserName: "Lan", UserFeedback: "Nice", Rating: 4, Category: "other"}, "New feedback from Lan ★★★★☆ [other]\n> Nice"},
+		{"multiline", entities.Feedback{UserName: "Lan", UserFeedback: "Line one\nLine two"}, "New feedback from Lan\n> Line one\n> Line two"},
+		{"truncated", entities.Feedback{UserName: "Lan", UserFeedback: long}, "New feedback from Lan\n> " + long[:2*MAX_WEBHOOK_FEEDBACK_LEN] + "…"},
+	}
+	for _, test := range tests {
+		if got := formatFeedbackMessage(test.feedback); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"EngPal/security"
+)
+
+type HandwrittenReviewRequest struct {
+	OCRBatchRequest        // The pages, in order, as "images"
+	UserLevel       string `json:"user_level"`
+	Requirement     string `json:"requirement"`
+	Category        string `json:"category,omitempty"`
+}
+
+type HandwrittenReviewResponse struct {
+	Pages        []OCRBatchResult        `json:"pages"`         // Transcription of each page, in order
+	StitchedText string                  `json:"stitched_text"` // The pages joined into the reviewed essay
+	Review       *ReviewResponse         `json:"review"`
+	Timings      HandwrittenReviewTiming `json:"timings"`
+}
+
+type HandwrittenReviewTiming struct {
+	OCRMs    int64 `json:"ocr_ms"`
+	ReviewMs int64 `json:"review_ms"`
+	TotalMs  int64 `json:"total_ms"`
+}
+
+// Deadline for the OCR and review stages together
+const HANDWRITTEN_PIPELINE_TIMEOUT = 90 * time.Second
+
+// POST /api/pipeline/handwritten-review - transcribes the pages of a handwritten essay
+// in order, joins them and reviews the result. Nothing is reviewed if a page fails.
+func GenerateHandwrittenReview(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var request HandwrittenReviewRequest
+	images, err := readOCRBatch(w, r, &request, &request.OCRBatchRequest)
+	if err != nil {
+		writeOCRBatchError(w, request.Language, err)
+		return
+	}
+	if r.MultipartForm != nil {
+		request.UserLevel = r.FormValue("user_level")
+		request.Requirement = r.FormValue("requirement")
+		request.Category = r.FormValue("category")
+	}
+
+	// Validate what can be checked before the pages are read
+	request.LanguageHint = strings.TrimSpace(request.LanguageHint)
+	if utf8.RuneCountInString(request.LanguageHint) > MAX_LANGUAGE_HINT_LENGTH {
+		http.Error(w, fmt.Sprintf("gợi ý ngôn ngữ không được dài hơn %d ký tự", MAX_LANGUAGE_HINT_LENGTH), http.StatusBadRequest)
+		return
+	}
+	if request.UserLevel != "" {
+		if _, exists := reviewEnglishLevels[strings.ToUpper(request.UserLevel)]; !exists {
+			http.Error(w, "trình độ tiếng Anh không hợp lệ (A1, A2, B1, B2, C1, C2)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), HANDWRITTEN_PIPELINE_TIMEOUT)
+	defer cancel()
+
+	// Stage 1: OCR of every page
+	pages := extractOCRBatch(ctx, images, request.LanguageHint, request.Language)
+	var response HandwrittenReviewResponse
+	response.Pages = pages
+	response.Timings.OCRMs = time.Since(startTime).Milliseconds()
+	for _, page := range pages {
+		if page.Success {
+			continue
+		}
+		logf(r, "Handwritten review stopped at page %d of %d for key %s: %s", page.Page, len(pages), security.Fingerprint(AccessKey(r)), page.Error)
+		status := http.StatusUnprocessableEntity // The page itself could not be read
+		if page.Error == "text_extraction_failed" {
+			status = http.StatusServiceUnavailable
+		}
+		writeLocalizedError(w, status, "page_extraction_failed", request.Language, PERSONA_TEACHER, map[string]interface{}{
+			"failed_page": page.Page,
+			"page_error":  page.Error,
+			"pages":       pages,
+		})
+		return
+	}
+	response.StitchedText = stitchPages(pages)
+
+	// Stage 2: review of the joined text, with what is left of the deadline
+	reviewRequest := GenerateCommentRequest{
+		Content:     response.StitchedText,
+		UserLevel:   request.UserLevel,
+		Requirement: request.Requirement,
+		Category:    request.Category,
+		Language:    request.Language,
+	}
+	if err := validateReviewRequest(&reviewRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reviewStart := time.Now()
+	cacheKey := generateReviewCacheKey(reviewRequest)
+	if cached, found := cachedReview(cacheKey, reviewStart); found {
+		response.Review = withSubmittedContent(cached, reviewRequest)
+	} else {
+		response.Review, err = generateReviewWithFallback(ctx, reviewRequest, reviewStart)
+		if err != nil {
+			logf(r, "Error reviewing handwritten essay: %v", err)
+			code := "review_service_unavailable"
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				code = "pipeline_timeout"
+			}
+			writeLocalizedError(w, http.StatusServiceUnavailable, code, request.Language, PERSONA_TEACHER, map[string]interface{}{
+				"pages":         pages,
+				"stitched_text": response.StitchedText,
+			})
+			return
+		}
+		cacheReview(cacheKey, response.Review, reviewStart)
+		recordScoreDistribution(response.Review)
+	}
+	response.Timings.ReviewMs = time.Since(reviewStart).Milliseconds()
+	response.Timings.TotalMs = time.Since(startTime).Milliseconds()
+
+	logf(r, "Reviewed handwritten essay of %d pages and %d words, OCR %dms, review %dms",
+		len(pages), response.Review.WordCount, response.Timings.OCRMs, response.Timings.ReviewMs)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Join the page transcriptions into one text. A page ending mid-sentence runs on
+// into the next one; otherwise the next page starts a new paragraph.
+func stitchPages(pages []OCRBatchResult) string {
+	var sb strings.Builder
+	for _, page := range pages {
+		text := strings.TrimSpace(page.Result.FullText)
+		if text == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			if last, _ := utf8.DecodeLastRuneInString(sb.String()); strings.ContainsRune(`.!?"”:`, last) {
+				sb.WriteString("\n\n")
+			} else {
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
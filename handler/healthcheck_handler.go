@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"EngPal/internal/buildinfo"
+	"EngPal/repository"
+	"EngPal/security"
+	"EngPal/stats"
+
+	"google.golang.org/genai"
+)
+
+type HealthcheckResponse struct {
+	Valid       bool     `json:"valid"`
+	ModelAccess []string `json:"model_access"` // Models this server uses that the key can reach
+	LatencyMs   int64    `json:"latency_ms"`
+}
+
+// Result of probing one dependency
+type DependencyStatus struct {
+	Status    string `json:"status"` // ok, degraded, down
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ProcessInfo struct {
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	Goroutines    int    `json:"goroutines"`
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	BuildTime     string `json:"build_time"`
+	GoVersion     string `json:"go_version"`
+}
+
+type DeepHealthcheckResponse struct {
+	Status       string                      `json:"status"` // ok when every critical dependency is ok
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+	Process      ProcessInfo                 `json:"process"`
+}
+
+type HealthcheckMetricsResponse struct {
+	WindowSeconds int64                             `json:"window_seconds"`
+	Dependencies  map[string]stats.DependencyHealth `json:"dependencies"` // Probes by name, plus gemini_calls
+	Panics        int64                             `json:"panics"`       // Recovered since the server started
+}
+
+// Dependency statuses
+const (
+	DEPENDENCY_OK       = "ok"
+	DEPENDENCY_DEGRADED = "degraded"
+	DEPENDENCY_DOWN     = "down"
+)
+
+const (
+	HEALTHCHECK_TIMEOUT      = 5 * time.Second // Longest wait for Gemini when validating a key
+	DEEP_HEALTHCHECK_TIMEOUT = 2 * time.Second // Deadline for all dependency probes together
+	SLOW_GEMINI_LATENCY      = time.Second     // Gemini answering slower than this is degraded
+)
+
+// Components /readyz waits for
+const (
+	READINESS_CONFIG               = "config"
+	READINESS_GEMINI_CLIENT        = "gemini_client"
+	READINESS_CHAT_SESSION_SWEEPER = "chat_session_sweeper"
+	READINESS_CHAT_MESSAGE_SWEEPER = "chat_message_sweeper"
+)
+
+// Readiness of each registered component, and whether the server is shutting down
+var (
+	readiness      = make(map[string]bool)
+	shuttingDown   bool
+	readinessMutex sync.Mutex
+)
+
+// RegisterReadiness adds components that must be marked ready before /readyz passes.
+func RegisterReadiness(components ...string) {
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+	for _, component := range components {
+		if _, exists := readiness[component]; !exists {
+			readiness[component] = false
+		}
+	}
+}
+
+// MarkReady records that a registered component has started.
+func MarkReady(component string) {
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+	readiness[component] = true
+}
+
+// BeginShutdown makes /livez and /readyz fail so no new traffic is routed here
+// while open connections drain.
+func BeginShutdown() {
+	readinessMutex.Lock()
+	defer readinessMutex.Unlock()
+	shuttingDown = true
+}
+
+// A dependency check run by the deep healthcheck
+type dependencyProbe struct {
+	Name     string
+	Critical bool
+	Check    func(ctx context.Context) (status string, err error)
+}
+
+// HealthcheckHandler serves the healthchecks, reaching its dependencies through
+// the injected repository.
+type HealthcheckHandler struct {
+	repo         repository.HealthcheckRepo
+	geminiAPIKey string // Checked when a request sends no key of its own
+}
+
+func NewHealthcheckHandler(repo repository.HealthcheckRepo, geminiAPIKey string) *HealthcheckHandler {
+	return &HealthcheckHandler{repo: repo, geminiAPIKey: geminiAPIKey}
+}
+
+// The dependencies the deep healthcheck probes
+func (h *HealthcheckHandler) dependencyProbes() []dependencyProbe {
+	return []dependencyProbe{
+		{Name: "gemini", Critical: true, Check: h.probeGemini},
+		{Name: "cache", Critical: true, Check: probeCache},
+		{Name: "store", Critical: false, Check: h.probeStore},
+	}
+}
+
+// GET /api/healthcheck - validates the key sent in the Authorization or
+// X-Access-Key header, or the server's own key without one, with a real call to Gemini
+func (h *HealthcheckHandler) Healthcheck(w http.ResponseWriter, r *http.Request) {
+	language := r.URL.Query().Get("language")
+	apiKey, err := accessKeyFromHeaders(r)
+	if errors.Is(err, errMissingAccessKey) {
+		apiKey = h.geminiAPIKey
+	} else if err != nil {
+		writeAccessKeyError(w, r, err)
+		return
+	}
+	if apiKey == "" {
+		writeLocalizedError(w, http.StatusUnauthorized, "invalid_api_key", language, PERSONA_TEACHER, nil)
+		return
+	}
+	fingerprint := security.Fingerprint(apiKey)
+
+	ctx, cancel := context.WithTimeout(r.Context(), HEALTHCHECK_TIMEOUT)
+	defer cancel()
+	startTime := time.Now()
+	modelAccess, err := h.repo.CheckAPIKey(ctx, apiKey, GeminiModels())
+	latency := time.Since(startTime).Milliseconds()
+	if err != nil {
+		logf(r, "Healthcheck failed for key %s after %dms: %v", fingerprint, latency, err)
+		var apiErr genai.APIError
+		if errors.As(err, &apiErr) && apiErr.Code >= 400 && apiErr.Code < 500 && apiErr.Code != http.StatusTooManyRequests {
+			writeLocalizedError(w, http.StatusUnauthorized, "invalid_api_key", language, PERSONA_TEACHER, nil)
+			return
+		}
+		writeLocalizedError(w, http.StatusServiceUnavailable, "api_key_check_failed", language, PERSONA_TEACHER, nil)
+		return
+	}
+
+	logf(r, "Healthcheck passed for key %s in %dms", fingerprint, latency)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthcheckResponse{Valid: true, ModelAccess: modelAccess, LatencyMs: latency})
+}
+
+// GET /api/healthcheck/deep - probes every dependency; 200 only when all critical ones are ok
+func (h *HealthcheckHandler) DeepHealthcheck(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), DEEP_HEALTHCHECK_TIMEOUT)
+	defer cancel()
+
+	dependencyProbes := h.dependencyProbes()
+
+	type probeResult struct {
+		Name   string
+		Status DependencyStatus
+	}
+	results := make(chan probeResult, len(dependencyProbes))
+	for _, probe := range dependencyProbes {
+		go func() {
+			startTime := time.Now()
+			status, err := probe.Check(ctx)
+			result := DependencyStatus{Status: status, Critical: probe.Critical, LatencyMs: time.Since(startTime).Milliseconds()}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results <- probeResult{Name: probe.Name, Status: result}
+		}()
+	}
+
+	// Probes still running at the deadline are reported down
+	response := DeepHealthcheckResponse{Status: DEPENDENCY_OK, Dependencies: make(map[string]DependencyStatus)}
+	for range dependencyProbes {
+		select {
+		case result := <-results:
+			response.Dependencies[result.Name] = result.Status
+		case <-ctx.Done():
+		}
+	}
+	for _, probe := range dependencyProbes {
+		if _, finished := response.Dependencies[probe.Name]; !finished {
+			response.Dependencies[probe.Name] = DependencyStatus{
+				Status:    DEPENDENCY_DOWN,
+				Critical:  probe.Critical,
+				LatencyMs: DEEP_HEALTHCHECK_TIMEOUT.Milliseconds(),
+				Error:     "timeout",
+			}
+		}
+		dependency := response.Dependencies[probe.Name]
+		if dependency.Critical && dependency.Status != DEPENDENCY_OK {
+			response.Status = DEPENDENCY_DOWN
+		}
+		recordProbeHealth(probe.Name, dependency)
+	}
+
+	build := buildinfo.Get()
+	processStats := h.repo.Stats()
+	response.Process = ProcessInfo{
+		UptimeSeconds: processStats.UptimeSeconds,
+		Goroutines:    processStats.Goroutines,
+		Version:       build.Version,
+		Commit:        build.Commit,
+		BuildTime:     build.BuildTime,
+		GoVersion:     build.GoVersion,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status != DEPENDENCY_OK {
+		logf(r, "Deep healthcheck failed: %+v", response.Dependencies)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Add a probe result to the health history; degraded dependencies still count as up
+func recordProbeHealth(name string, dependency DependencyStatus) {
+	errorType := ""
+	switch {
+	case dependency.Status != DEPENDENCY_DOWN:
+	case dependency.Error == "timeout":
+		errorType = "timeout"
+	default:
+		errorType = "error"
+	}
+	stats.RecordHealth(name, dependency.Status != DEPENDENCY_DOWN, time.Duration(dependency.LatencyMs)*time.Millisecond, errorType)
+}
+
+// GET /api/healthcheck/metrics - success rates, latency percentiles and recent
+// failures of the deep healthcheck probes and Gemini calls over the last hour (admin only)
+func GetHealthcheckMetrics(w http.ResponseWriter, r *http.Request) {
+	if status, ok := requireJWTClaim(r, ADMIN_CLAIM); !ok {
+		writeJWTClaimError(w, status, "chỉ quản trị viên mới xem được số liệu healthcheck")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthcheckMetricsResponse{
+		WindowSeconds: int64(stats.HealthWindow.Seconds()),
+		Dependencies:  stats.HealthSummary(),
+		Panics:        panicCount.Load(),
+	})
+}
+
+// Make a cheap call with the server's Gemini client
+func (h *HealthcheckHandler) probeGemini(ctx context.Context) (string, error) {
+	latency, err := h.repo.PingGemini(ctx)
+	if err != nil {
+		return DEPENDENCY_DOWN, err
+	}
+	if latency > SLOW_GEMINI_LATENCY {
+		return DEPENDENCY_DEGRADED, nil
+	}
+	return DEPENDENCY_OK, nil
+}
+
+// Check the feedback store can still be written
+func (h *HealthcheckHandler) probeStore(ctx context.Context) (string, error) {
+	if err := h.repo.PingStore(ctx); err != nil {
+		return DEPENDENCY_DOWN, err
+	}
+	return DEPENDENCY_OK, nil
+}
+
+// Write a sentinel to the quiz cache and read it back
+func probeCache(ctx context.Context) (string, error) {
+	const sentinelKey = "__healthcheck__"
+	sentinel := time.Now().UnixNano()
+	cache[sentinelKey] = cacheItem{Data: sentinel, ExpiresAt: time.Now().Add(DEEP_HEALTHCHECK_TIMEOUT)}
+	item, found := cache[sentinelKey]
+	delete(cache, sentinelKey)
+	if !found || item.Data != sentinel {
+		return DEPENDENCY_DOWN, errors.New("sentinel not read back")
+	}
+	return DEPENDENCY_OK, nil
+}
+
+// GET /livez - 200 while the process is up and not shutting down
+func Livez(w http.ResponseWriter, r *http.Request) {
+	readinessMutex.Lock()
+	stopping := shuttingDown
+	readinessMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if stopping {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "shutting_down"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// GET /readyz - 200 once every registered component is ready, 503 before that
+// and during shutdown
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	readinessMutex.Lock()
+	components := make(map[string]bool, len(readiness))
+	ready := !shuttingDown
+	for component, componentReady := range readiness {
+		components[component] = componentReady
+		ready = ready && componentReady
+	}
+	stopping := shuttingDown
+	readinessMutex.Unlock()
+
+	status := "ready"
+	switch {
+	case stopping:
+		status = "shutting_down"
+	case !ready:
+		status = "not_ready"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     status,
+		"components": components,
+	})
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"EngPal/repository"
+	"EngPal/security"
+)
+
+// Start the test with an empty readiness registry, not shutting down
+func useEmptyReadiness(t *testing.T) {
+	t.Helper()
+	readinessMutex.Lock()
+	components, stopping := readiness, shuttingDown
+	readiness, shuttingDown = make(map[string]bool), false
+	readinessMutex.Unlock()
+	t.Cleanup(func() {
+		readinessMutex.Lock()
+		readiness, shuttingDown = components, stopping
+		readinessMutex.Unlock()
+	})
+}
+
+type probeResponse struct {
+	Status     string          `json:"status"`
+	Components map[string]bool `json:"components"`
+}
+
+func serveProbe(t *testing.T, handler http.HandlerFunc, path string) (int, probeResponse) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	var response probeResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding %s response: %v", path, err)
+	}
+	return recorder.Code, response
+}
+
+func TestReadinessFlipsDuringShutdown(t *testing.T) {
+	useEmptyReadiness(t)
+	RegisterReadiness(READINESS_CONFIG, READINESS_GEMINI_CLIENT)
+
+	steps := []struct {
+		name       string
+		action     func()
+		wantLivez  int
+		wantReadyz int
+		wantStatus string
+	}{
+		{"starting", func() {}, http.StatusOK, http.StatusServiceUnavailable, "not_ready"},
+		{"partly ready", func() { MarkReady(READINESS_CONFIG) }, http.StatusOK, http.StatusServiceUnavailable, "not_ready"},
+		{"ready", func() { MarkReady(READINESS_GEMINI_CLIENT) }, http.StatusOK, http.StatusOK, "ready"},
+		{"registering again keeps readiness", func() { RegisterReadiness(READINESS_CONFIG) }, http.StatusOK, http.StatusOK, "ready"},
+		{"new component", func() { RegisterReadiness(READINESS_CHAT_SESSION_SWEEPER) }, http.StatusOK, http.StatusServiceUnavailable, "not_ready"},
+		{"ready again", func() { MarkReady(READINESS_CHAT_SESSION_SWEEPER) }, http.StatusOK, http.StatusOK, "ready"},
+		{"shutting down", BeginShutdown, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "shutting_down"},
+	}
+	for _, step := range steps {
+		step.action()
+		if code, _ := serveProbe(t, Livez, "/livez"); code != step.wantLivez {
+			t.Errorf("%s: /livez status = %d, want %d", step.name, code, step.wantLivez)
+		}
+		code, response := serveProbe(t, Readyz, "/readyz")
+		if code != step.wantReadyz || response.Status != step.wantStatus {
+			t.Errorf("%s: /readyz = %d %q, want %d %q", step.name, code, response.Status, step.wantReadyz, step.wantStatus)
+		}
+	}
+
+	_, response := serveProbe(t, Readyz, "/readyz")
+	for _, component := range []string{READINESS_CONFIG, READINESS_GEMINI_CLIENT, READINESS_CHAT_SESSION_SWEEPER} {
+		if !response.Components[component] {
+			t.Errorf("/readyz does not report %s as ready: %+v", component, response.Components)
+		}
+	}
+}
+
+func TestChatSessionSweeperMarksReady(t *testing.T) {
+	useEmptyReadiness(t)
+	RegisterReadiness(READINESS_CHAT_SESSION_SWEEPER)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	StartChatSessionSweeper(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if code, _ := serveProbe(t, Readyz, "/readyz"); code == http.StatusOK {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("/readyz did not pass after the sweeper started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A healthcheck repository whose key check fails with an error naming the key, as
+// a failed request URL would
+type failingKeyCheckRepo struct{}
+
+func (failingKeyCheckRepo) PingGemini(ctx context.Context) (time.Duration, error) { return 0, nil }
+func (failingKeyCheckRepo) PingStore(ctx context.Context) error                   { return nil }
+func (failingKeyCheckRepo) Stats() repository.HealthStats                         { return repository.HealthStats{} }
+func (failingKeyCheckRepo) CheckAPIKey(ctx context.Context, apiKey string, models []string) ([]string, error) {
+	return nil, fmt.Errorf("GET https://generativelanguage.googleapis.com/v1beta/models?key=%s: connection reset", apiKey)
+}
+
+// Capture log output for the test through the redacting writer main installs
+func captureRedactedLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var output bytes.Buffer
+	original := log.Writer()
+	log.SetOutput(security.NewRedactingWriter(&output))
+	t.Cleanup(func() { log.SetOutput(original) })
+	return &output
+}
+
+func TestHandlersNeverLogSecrets(t *testing.T) {
+	const serverKey = "server-gemini-key-0123456789"
+	security.RegisterSecret(serverKey)
+	requestKey := "AIza" + strings.Repeat("k", 31) + "7d2e"
+	useEmptyTopicCache(t)
+	useFakeGemini(t, answerGemini(`{"topic": "english_learning", "answer": "Yes, it is.", "suggested_followups": []}`))
+	handler := NewHealthcheckHandler(failingKeyCheckRepo{}, serverKey)
+
+	tests := []struct {
+		name    string
+		secret  string
+		request func()
+	}{
+		{"server key in a healthcheck error", serverKey, func() {
+			handler.Healthcheck(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/healthcheck", nil))
+		}},
+		{"request key in a healthcheck error", requestKey, func() {
+			request := httptest.NewRequest(http.MethodGet, "/api/healthcheck", nil)
+			request.Header.Set("Authorization", "Bearer "+requestKey)
+			RequestLogger(http.HandlerFunc(handler.Healthcheck)).ServeHTTP(httptest.NewRecorder(), request)
+		}},
+		{"token in a chatbot question", "tok_live_5f9a8b7c", func() {
+			body := `{"question": "Is this sentence right? My token: tok_live_5f9a8b7c", "persona": "teacher"}`
+			GenerateAnswer(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/chatbot/generate-answer", strings.NewReader(body)))
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := captureRedactedLog(t)
+			test.request()
+			if output.Len() == 0 {
+				t.Fatal("nothing was logged")
+			}
+			if strings.Contains(output.String(), test.secret) {
+				t.Errorf("the secret was logged: %s", output)
+			}
+			if fingerprint := "[REDACTED" + security.Fingerprint(test.secret) + "]"; !strings.Contains(output.String(), fingerprint) {
+				t.Errorf("log output lacks the fingerprint %s: %s", fingerprint, output)
+			}
+		})
+	}
+}
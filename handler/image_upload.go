@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"EngPal/internal/config"
+	"EngPal/utils"
+)
+
+// ImageUpload is the part of a request shared by the endpoints that read an image.
+// The image is sent as base64 or an https URL in a JSON body, or as the "image"
+// file of a multipart/form-data body with the other fields as form values.
+type ImageUpload struct {
+	Image    string `json:"image,omitempty"`     // Base64 JPEG/PNG/WebP (or data URI), JSON bodies only
+	ImageURL string `json:"image_url,omitempty"` // Fetched by the server instead; not with image
+	Language string `json:"language,omitempty"`  // en, vi for error messages
+}
+
+// Room for the form fields and multipart framing around an uploaded image
+const IMAGE_FORM_OVERHEAD_BYTES = 64 << 10
+
+var (
+	errUnsupportedContentType = errors.New("content type must be application/json or multipart/form-data")
+	errMalformedImageRequest  = errors.New("malformed image request")
+	errImageSourceConflict    = errors.New("image and image_url are mutually exclusive")
+)
+
+// Read the image of a JSON or multipart request and return its validated bytes and
+// MIME type. A JSON body is decoded into request, which embeds upload; for a
+// multipart body only the ImageUpload fields are filled, and callers read any
+// other fields with r.FormValue.
+func readImageUpload(w http.ResponseWriter, r *http.Request, request interface{}, upload *ImageUpload) ([]byte, string, error) {
+	mediaType := "application/json" // Default for clients that send no Content-Type
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, "", errUnsupportedContentType
+		}
+	}
+
+	switch mediaType {
+	case "application/json":
+		// The base64 image plus the other fields
+		r.Body = http.MaxBytesReader(w, r.Body, int64(config.ImageMaxEncodedBytes()+IMAGE_FORM_OVERHEAD_BYTES))
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			return nil, "", imageBodyError(err)
+		}
+		hasImage, hasURL := strings.TrimSpace(upload.Image) != "", strings.TrimSpace(upload.ImageURL) != ""
+		switch {
+		case hasImage && hasURL:
+			return nil, "", errImageSourceConflict
+		case hasURL:
+			return utils.FetchImage(upload.ImageURL)
+		}
+		return utils.DecodeBase64Image(upload.Image)
+
+	case "multipart/form-data":
+		limit := int64(config.ImageMaxBytes() + IMAGE_FORM_OVERHEAD_BYTES)
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		if err := r.ParseMultipartForm(limit); err != nil {
+			return nil, "", imageBodyError(err)
+		}
+		upload.Language = strings.ToLower(strings.TrimSpace(r.FormValue("language")))
+
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			return nil, "", utils.ErrInvalidImage
+		}
+		defer file.Close()
+		return utils.ReadImage(file)
+	}
+	return nil, "", errUnsupportedContentType
+}
+
+// Tell a body over the size limit apart from one that could not be parsed
+func imageBodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return utils.ErrImageTooLarge
+	}
+	return errMalformedImageRequest
+}
+
+// Write the structured error for an image rejected by readImageUpload.
+func writeImageUploadError(w http.ResponseWriter, language string, err error) {
+	switch {
+	case errors.Is(err, errUnsupportedContentType):
+		writeLocalizedError(w, http.StatusUnsupportedMediaType, "unsupported_content_type", language, PERSONA_TEACHER, nil)
+	case errors.Is(err, errMalformedImageRequest):
+		http.Error(w, "Invalid image request", http.StatusBadRequest)
+	case errors.Is(err, errImageSourceConflict):
+		writeLocalizedError(w, http.StatusBadRequest, "image_source_conflict", language, PERSONA_TEACHER, nil)
+	case errors.Is(err, utils.ErrImageURLNotAllowed):
+		writeLocalizedError(w, http.StatusBadRequest, "image_url_not_allowed", language, PERSONA_TEACHER, nil)
+	case errors.Is(err, utils.ErrImageFetchFailed):
+		writeLocalizedError(w, http.StatusBadGateway, "image_fetch_failed", language, PERSONA_TEACHER, nil)
+	case errors.Is(err, utils.ErrNotAnImage):
+		writeLocalizedError(w, http.StatusUnsupportedMediaType, "image_url_not_image", language, PERSONA_TEACHER, nil)
+	case errors.Is(err, utils.ErrImageTooLarge):
+		writeLocalizedError(w, http.StatusRequestEntityTooLarge, "image_too_large", language, PERSONA_TEACHER,
+			map[string]interface{}{"limit": imageSizeLimitMB()})
+	case errors.Is(err, utils.ErrImageDimensions):
+		writeLocalizedError(w, http.StatusRequestEntityTooLarge, "image_dimensions_too_large", language, PERSONA_TEACHER,
+			map[string]interface{}{"limit": config.ImageMaxDimension()})
+	case errors.Is(err, utils.ErrUnsupportedImageType):
+		writeLocalizedError(w, http.StatusUnsupportedMediaType, "unsupported_image_format", language, PERSONA_TEACHER, nil)
+	default:
+		writeLocalizedError(w, http.StatusBadRequest, "invalid_image", language, PERSONA_TEACHER,
+			map[string]interface{}{"limit": imageSizeLimitMB()})
+	}
+}
+
+// The image size limit in whole megabytes, for error messages
+func imageSizeLimitMB() int {
+	return max(1, config.ImageMaxBytes()>>20)
+}
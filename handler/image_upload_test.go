@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"EngPal/internal/config"
+	"EngPal/utils"
+)
+
+// A GIF, which is never an allowed image type
+var gifImage = []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+
+// A multipart/form-data request with the image as its "image" file
+func multipartImageRequest(t *testing.T, data []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	file, err := writer.CreateFormFile("image", "photo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(data)
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/api/text/extract-from-image", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+func jsonImageRequest(body string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/api/text/extract-from-image", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	return request
+}
+
+func TestReadImageUpload(t *testing.T) {
+	useImageLimits(t, 4<<10, 64)
+	photo := sampleImage(t, "image/png", 8, 8, 1)
+	encodedPhoto := base64.StdEncoding.EncodeToString(photo)
+	oversized := append(sampleImage(t, "image/png", 8, 8, 2), make([]byte, 5<<10)...)
+	tooWide := sampleImage(t, "image/png", 128, 8, 3)
+
+	textRequest := httptest.NewRequest(http.MethodPost, "/api/text/extract-from-image", strings.NewReader(encodedPhoto))
+	textRequest.Header.Set("Content-Type", "text/plain")
+
+	tests := []struct {
+		name         string
+		request      *http.Request
+		wantErr      error
+		wantLanguage string
+	}{
+		{"JSON photo", jsonImageRequest(`{"image": "` + encodedPhoto + `", "language": "en"}`), nil, "en"},
+		{"JSON data URI", jsonImageRequest(`{"image": "data:image/png;base64,` + encodedPhoto + `"}`), nil, ""},
+		{"multipart photo", multipartImageRequest(t, photo, map[string]string{"language": " VI "}), nil, "vi"},
+		{"JSON GIF", jsonImageRequest(`{"image": "` + base64.StdEncoding.EncodeToString(gifImage) + `"}`), utils.ErrUnsupportedImageType, ""},
+		{"multipart GIF", multipartImageRequest(t, gifImage, nil), utils.ErrUnsupportedImageType, ""},
+		{"JSON oversized", jsonImageRequest(`{"image": "` + base64.StdEncoding.EncodeToString(oversized) + `"}`), utils.ErrImageTooLarge, ""},
+		{"multipart oversized", multipartImageRequest(t, oversized, nil), utils.ErrImageTooLarge, ""},
+		{"too wide", multipartImageRequest(t, tooWide, nil), utils.ErrImageDimensions, ""},
+		{"multipart without image", multipartImageRequest(t, nil, nil), utils.ErrInvalidImage, ""},
+		{"image and URL", jsonImageRequest(`{"image": "` + encodedPhoto + `", "image_url": "https://example.com/a.png"}`), errImageSourceConflict, ""},
+		{"http URL", jsonImageRequest(`{"image_url": "http://example.com/a.png"}`), utils.ErrImageURLNotAllowed, ""},
+		{"malformed JSON", jsonImageRequest(`{"image": `), errMalformedImageRequest, ""},
+		{"plain text body", textRequest, errUnsupportedContentType, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request ExtractTextFromImageRequest
+			data, mimeType, err := readImageUpload(httptest.NewRecorder(), test.request, &request, &request.ImageUpload)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			if !bytes.Equal(data, photo) || mimeType != "image/png" {
+				t.Errorf("read %d bytes of %s, want the %d-byte PNG", len(data), mimeType, len(photo))
+			}
+			if request.Language != test.wantLanguage {
+				t.Errorf("language = %q, want %q", request.Language, test.wantLanguage)
+			}
+		})
+	}
+}
+
+func TestWriteImageUploadError(t *testing.T) {
+	useImageLimits(t, 4<<20, 8192)
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{errUnsupportedContentType, http.StatusUnsupportedMediaType, "unsupported_content_type"},
+		{errImageSourceConflict, http.StatusBadRequest, "image_source_conflict"},
+		{utils.ErrImageURLNotAllowed, http.StatusBadRequest, "image_url_not_allowed"},
+		{utils.ErrImageFetchFailed, http.StatusBadGateway, "image_fetch_failed"},
+		{utils.ErrNotAnImage, http.StatusUnsupportedMediaType, "image_url_not_image"},
+		{utils.ErrImageTooLarge, http.StatusRequestEntityTooLarge, "image_too_large"},
+		{utils.ErrImageDimensions, http.StatusRequestEntityTooLarge, "image_dimensions_too_large"},
+		{utils.ErrUnsupportedImageType, http.StatusUnsupportedMediaType, "unsupported_image_format"},
+		{utils.ErrInvalidImage, http.StatusBadRequest, "invalid_image"},
+	}
+	for _, test := range tests {
+		t.Run(test.wantCode, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writeImageUploadError(recorder, "en", test.err)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+			if code := errorCodeOf(t, recorder); code != test.wantCode {
+				t.Errorf("error = %q, want %q", code, test.wantCode)
+			}
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	writeImageUploadError(recorder, "en", errMalformedImageRequest)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("malformed request: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestExtractTextFromImageDownscalesLargePhotos(t *testing.T) {
+	useEmptyOCRCache(t)
+	cfg, _ := config.Load()
+	cfg.ImageDownscaleDimension = 16
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+	gemini := useFakeGemini(t, answerGemini(`{"blocks": [{"text": "STOP", "language": "en"}], "confidence": "high"}`))
+
+	for _, test := range []struct {
+		name           string
+		width, height  int
+		wantDownscaled bool
+		wantWidth      int
+		wantHeight     int
+	}{
+		{"normal photo", 16, 8, false, 16, 8},
+		{"large photo", 64, 32, true, 16, 8},
+	} {
+		body, _ := json.Marshal(map[string]string{"image": base64.StdEncoding.EncodeToString(sampleImage(t, "image/jpeg", test.width, test.height, 5))})
+		var extracted ExtractTextFromImageResponse
+		if err := json.NewDecoder(extractTextFromImage(string(body)).Body).Decode(&extracted); err != nil {
+			t.Fatalf("%s: decoding response: %v", test.name, err)
+		}
+		if extracted.FullText != "STOP" || extracted.Downscaled != test.wantDownscaled {
+			t.Errorf("%s: got %+v, want STOP with downscaled %v", test.name, extracted, test.wantDownscaled)
+		}
+
+		calls := gemini.received()
+		sent := calls[len(calls)-1].Contents[0].Parts[1].InlineData
+		dimensions, _, err := image.DecodeConfig(bytes.NewReader(sent.Data))
+		if err != nil {
+			t.Fatalf("%s: decoding the image sent to Gemini: %v", test.name, err)
+		}
+		if dimensions.Width != test.wantWidth || dimensions.Height != test.wantHeight || sent.MIMEType != "image/jpeg" {
+			t.Errorf("%s: Gemini was sent a %dx%d %s, want %dx%d image/jpeg", test.name, dimensions.Width, dimensions.Height, sent.MIMEType, test.wantWidth, test.wantHeight)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Personas the chatbot can speak with
+const (
+	PERSONA_ENGPAL  = "engpal"  // Playful big-brother tutor (default)
+	PERSONA_TEACHER = "teacher" // Polite, formal teacher
+)
+
+// User-facing messages keyed by message code, language and persona.
+// Placeholders like {limit} are filled in by localizedMessage.
+var messageCatalog = map[string]map[string]map[string]string{
+	"empty_question": {
+		"vi": {
+			PERSONA_ENGPAL:  "Gửi vội vậy bé yêu! Chưa nhập câu hỏi kìa.",
+			PERSONA_TEACHER: "Bạn chưa nhập câu hỏi. Hãy nhập câu hỏi rồi gửi lại nhé.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Whoa, slow down! You forgot to type your question. 😄",
+			PERSONA_TEACHER: "Please enter a question before sending.",
+		},
+	},
+	"question_too_long": {
+		"vi": {
+			PERSONA_ENGPAL:  "Hỏi ngắn thôi bé yêu, bộ mắc hỏi quá hay gì 💢\nHỏi câu nào dưới {limit} từ thôi, để thời gian cho anh suy nghĩ với chứ.",
+			PERSONA_TEACHER: "Câu hỏi quá dài. Vui lòng giới hạn câu hỏi trong {limit} từ.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Too long! 💢 Keep it under {limit} words so I have time to think.",
+			PERSONA_TEACHER: "Your question is too long. Please keep it under {limit} words.",
+		},
+	},
+	"empty_translation": {
+		"vi": {
+			PERSONA_ENGPAL:  "Muốn dịch câu nào thì gõ vào sau /translate nha bé yêu.",
+			PERSONA_TEACHER: "Vui lòng nhập nội dung cần dịch sau lệnh /translate.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Type what you want translated after /translate! 😉",
+			PERSONA_TEACHER: "Please enter the text to translate after /translate.",
+		},
+	},
+	"invalid_phrase": {
+		"vi": {
+			PERSONA_ENGPAL:  "Gõ một từ hoặc cụm từ tối đa {limit} từ sau /define nha bé yêu.",
+			PERSONA_TEACHER: "Vui lòng nhập một từ hoặc cụm từ (tối đa {limit} từ) sau lệnh /define.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Type a word or phrase of up to {limit} words after /define! 📖",
+			PERSONA_TEACHER: "Please enter a word or phrase of up to {limit} words after /define.",
+		},
+	},
+	"invalid_sentence": {
+		"vi": {
+			PERSONA_ENGPAL:  "Gửi một câu tối đa {limit} từ để anh kiểm tra ngữ pháp nha bé yêu.",
+			PERSONA_TEACHER: "Vui lòng gửi một câu (tối đa {limit} từ) để kiểm tra ngữ pháp.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Send me one sentence of up to {limit} words and I'll check it! ✏️",
+			PERSONA_TEACHER: "Please send one sentence of up to {limit} words to check.",
+		},
+	},
+	"invalid_word": {
+		"vi": {
+			PERSONA_ENGPAL:  "Gõ tối đa {limit} từ tiếng Anh (chỉ gồm chữ cái) sau /pronounce nha bé yêu.",
+			PERSONA_TEACHER: "Vui lòng nhập tối đa {limit} từ tiếng Anh, chỉ gồm chữ cái, sau lệnh /pronounce.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Type up to {limit} English words (letters only) after /pronounce! 🔊",
+			PERSONA_TEACHER: "Please enter up to {limit} English words, letters only, after /pronounce.",
+		},
+	},
+	"invalid_image": {
+		"vi": {
+			PERSONA_ENGPAL:  "Ảnh này anh không mở được bé yêu ơi. Gửi ảnh JPEG, PNG hoặc WebP tối đa {limit} MB nha.",
+			PERSONA_TEACHER: "Không đọc được ảnh. Vui lòng gửi ảnh JPEG, PNG hoặc WebP có dung lượng tối đa {limit} MB.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I can't open that image! Send a JPEG, PNG or WebP of up to {limit} MB. 🖼️",
+			PERSONA_TEACHER: "The image could not be read. Please send a JPEG, PNG or WebP image of up to {limit} MB.",
+		},
+	},
+	"percentile_description": {
+		"vi": {
+			PERSONA_ENGPAL:  "Bé viết tốt hơn {percentile}% học viên {level} dùng EngPal tuần này đó!",
+			PERSONA_TEACHER: "Tốt hơn {percentile}% học viên trình độ {level} sử dụng EngPal trong tuần này",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "You beat {percentile}% of {level} learners on EngPal this week!",
+			PERSONA_TEACHER: "Better than {percentile}% of {level} learners who used EngPal this week",
+		},
+	},
+	"missing_citations": {
+		"vi": {
+			PERSONA_ENGPAL:  "Bài chưa trích dẫn nguồn nào nè bé. Thêm trích dẫn như (Smith, 2020) cho thông tin lấy từ nguồn khác nha.",
+			PERSONA_TEACHER: "Bài viết chưa trích dẫn nguồn nào. Hãy trích dẫn nguồn cho các thông tin và ý kiến lấy từ tài liệu khác, ví dụ (Smith, 2020).",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "No sources cited yet! Add citations like (Smith, 2020) for ideas from other sources.",
+			PERSONA_TEACHER: "The writing does not cite any sources. Cite the sources of facts and ideas taken from other work, e.g. (Smith, 2020).",
+		},
+	},
+	"image_too_large": {
+		"vi": {
+			PERSONA_ENGPAL:  "Ảnh nặng quá bé yêu ơi. Gửi ảnh tối đa {limit} MB thôi nha.",
+			PERSONA_TEACHER: "Ảnh quá lớn. Vui lòng gửi ảnh có dung lượng tối đa {limit} MB.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That image is too big! Keep it under {limit} MB. 🖼️",
+			PERSONA_TEACHER: "The image is too large. Please send an image of up to {limit} MB.",
+		},
+	},
+	"unsupported_image_format": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh chỉ đọc được ảnh JPEG, PNG hoặc WebP thôi bé yêu.",
+			PERSONA_TEACHER: "Định dạng ảnh không được hỗ trợ. Vui lòng gửi ảnh JPEG, PNG hoặc WebP.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I can only read JPEG, PNG or WebP images!",
+			PERSONA_TEACHER: "Unsupported image format. Please send a JPEG, PNG or WebP image.",
+		},
+	},
+	"image_dimensions_too_large": {
+		"vi": {
+			PERSONA_ENGPAL:  "Ảnh to quá bé yêu ơi. Chiều rộng và chiều cao tối đa {limit} pixel thôi nha.",
+			PERSONA_TEACHER: "Kích thước ảnh quá lớn. Chiều rộng và chiều cao tối đa là {limit} pixel.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That image is huge! Keep it within {limit} pixels wide and tall.",
+			PERSONA_TEACHER: "The image is too large. Its width and height must be at most {limit} pixels.",
+		},
+	},
+	"unsupported_content_type": {
+		"vi": {
+			PERSONA_ENGPAL:  "Bé gửi ảnh dạng JSON (base64) hoặc multipart/form-data nha.",
+			PERSONA_TEACHER: "Kiểu nội dung không được hỗ trợ. Vui lòng gửi JSON (ảnh base64) hoặc multipart/form-data.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Send the image as JSON (base64) or multipart/form-data!",
+			PERSONA_TEACHER: "Unsupported content type. Please send JSON with a base64 image or multipart/form-data.",
+		},
+	},
+	"image_source_conflict": {
+		"vi": {
+			PERSONA_ENGPAL:  "Bé gửi ảnh base64 hoặc đường dẫn ảnh thôi, đừng gửi cả hai nha.",
+			PERSONA_TEACHER: "Vui lòng chỉ gửi một trong hai: ảnh base64 (image) hoặc đường dẫn ảnh (image_url).",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Send either the image or its URL, not both!",
+			PERSONA_TEACHER: "Please send either a base64 image (image) or an image URL (image_url), not both.",
+		},
+	},
+	"image_url_not_allowed": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh chỉ mở được đường dẫn ảnh https công khai thôi bé yêu.",
+			PERSONA_TEACHER: "Đường dẫn ảnh không được phép. Vui lòng dùng đường dẫn https tới một địa chỉ công khai.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I can only open public https image links!",
+			PERSONA_TEACHER: "This image URL is not allowed. Please use an https URL on a public address.",
+		},
+	},
+	"image_fetch_failed": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh không tải được ảnh từ đường dẫn này. Bé kiểm tra lại link nha!",
+			PERSONA_TEACHER: "Không thể tải ảnh từ đường dẫn. Vui lòng kiểm tra lại đường dẫn và thử lại.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I couldn't download the image from that link. Check it and try again!",
+			PERSONA_TEACHER: "The image could not be downloaded from the URL. Please check it and try again.",
+		},
+	},
+	"image_url_not_image": {
+		"vi": {
+			PERSONA_ENGPAL:  "Đường dẫn này không phải là ảnh bé yêu ơi.",
+			PERSONA_TEACHER: "Đường dẫn không trả về một ảnh. Vui lòng gửi đường dẫn trực tiếp tới ảnh.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That link isn't an image!",
+			PERSONA_TEACHER: "The URL did not return an image. Please send a direct link to the image.",
+		},
+	},
+	"text_extraction_failed": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh đang bận chút nên chưa đọc được chữ trong ảnh. Bé thử lại sau một phút nha!",
+			PERSONA_TEACHER: "Không thể trích xuất văn bản từ ảnh lúc này. Vui lòng thử lại sau.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I couldn't read the text in that image right now. Try again in a minute!",
+			PERSONA_TEACHER: "Text could not be extracted from the image right now. Please try again later.",
+		},
+	},
+	"too_many_images": {
+		"vi": {
+			PERSONA_ENGPAL:  "Nhiều ảnh quá bé yêu ơi. Gửi tối đa {limit} ảnh một lần thôi nha.",
+			PERSONA_TEACHER: "Có quá nhiều ảnh. Vui lòng gửi tối đa {limit} ảnh mỗi lần.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That's a lot of photos! Send at most {limit} at a time.",
+			PERSONA_TEACHER: "Too many images. Please send at most {limit} images at a time.",
+		},
+	},
+	"image_batch_too_large": {
+		"vi": {
+			PERSONA_ENGPAL:  "Mấy ảnh này nặng quá bé yêu ơi. Tổng dung lượng tối đa {limit} MB thôi nha.",
+			PERSONA_TEACHER: "Tổng dung lượng các ảnh quá lớn. Vui lòng gửi tổng cộng tối đa {limit} MB.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Those photos are too big together! Keep them under {limit} MB in total.",
+			PERSONA_TEACHER: "The images are too large in total. Please send at most {limit} MB altogether.",
+		},
+	},
+	"no_images": {
+		"vi": {
+			PERSONA_ENGPAL:  "Bé chưa gửi ảnh nào hết á.",
+			PERSONA_TEACHER: "Chưa có ảnh nào được gửi. Vui lòng gửi ít nhất một ảnh.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "You didn't send any photos!",
+			PERSONA_TEACHER: "No images were sent. Please send at least one image.",
+		},
+	},
+	"page_extraction_failed": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh chưa đọc được trang {failed_page} bé yêu ơi. Chụp lại trang đó rồi gửi lại nha.",
+			PERSONA_TEACHER: "Không đọc được trang {failed_page}, nên bài viết chưa được nhận xét. Vui lòng chụp lại trang này và gửi lại.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I couldn't read page {failed_page}! Retake that photo and send it again.",
+			PERSONA_TEACHER: "Page {failed_page} could not be read, so the essay was not reviewed. Please retake that page and try again.",
+		},
+	},
+	"pipeline_timeout": {
+		"vi": {
+			PERSONA_ENGPAL:  "Bài dài quá nên anh chấm không kịp rồi. Bé thử lại sau chút nha!",
+			PERSONA_TEACHER: "Không kịp nhận xét bài viết trong thời gian cho phép. Vui lòng thử lại sau.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That took too long for me to finish! Try again in a bit.",
+			PERSONA_TEACHER: "The essay could not be reviewed in time. Please try again later.",
+		},
+	},
+	"image_not_supported": {
+		"vi": {
+			PERSONA_ENGPAL:  "Ảnh chỉ dùng được khi trò chuyện bình thường thôi bé yêu, bỏ lệnh đi rồi gửi lại nha.",
+			PERSONA_TEACHER: "Ảnh chỉ được hỗ trợ ở chế độ trò chuyện thông thường. Vui lòng bỏ lệnh và gửi lại.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Images only work in normal chat! Drop the command and send it again. 😉",
+			PERSONA_TEACHER: "Images are only supported in normal chat mode. Please remove the command and try again.",
+		},
+	},
+	"invalid_audio": {
+		"vi": {
+			PERSONA_ENGPAL:  "File ghi âm này anh không mở được bé yêu ơi. Gửi file WAV, MP3 hoặc M4A tối đa {limit} MB nha.",
+			PERSONA_TEACHER: "Không đọc được file ghi âm. Vui lòng gửi file WAV, MP3 hoặc M4A có dung lượng tối đa {limit} MB.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I can't open that recording! Send a WAV, MP3 or M4A of up to {limit} MB. 🎙️",
+			PERSONA_TEACHER: "The recording could not be read. Please send a WAV, MP3 or M4A file of up to {limit} MB.",
+		},
+	},
+	"unsupported_audio_format": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh chỉ nghe được file WAV, MP3 hoặc M4A thôi bé yêu.",
+			PERSONA_TEACHER: "Định dạng âm thanh không được hỗ trợ. Vui lòng gửi file WAV, MP3 hoặc M4A.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I can only listen to WAV, MP3 or M4A files! 🎧",
+			PERSONA_TEACHER: "This audio format is not supported. Please send a WAV, MP3 or M4A file.",
+		},
+	},
+	"audio_too_long": {
+		"vi": {
+			PERSONA_ENGPAL:  "Nói dài quá bé yêu ơi 💢 Ghi âm dưới {limit} giây thôi nha.",
+			PERSONA_TEACHER: "File ghi âm quá dài. Vui lòng giới hạn trong {limit} giây.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That's a long one! 💢 Keep recordings under {limit} seconds.",
+			PERSONA_TEACHER: "Your recording is too long. Please keep it under {limit} seconds.",
+		},
+	},
+	"audio_not_understood": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh chưa nghe rõ bé nói gì. Bé ghi âm lại ở chỗ yên tĩnh hơn nha! 🎙️",
+			PERSONA_TEACHER: "Không nhận diện được lời nói trong file ghi âm. Vui lòng ghi âm lại ở nơi yên tĩnh hơn.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I couldn't catch what you said. Try recording again somewhere quieter! 🎙️",
+			PERSONA_TEACHER: "No speech could be recognized in the recording. Please record again somewhere quieter.",
+		},
+	},
+	"session_expired": {
+		"vi": {
+			PERSONA_ENGPAL:  "Cuộc trò chuyện này hết hạn rồi bé yêu. Mở cuộc trò chuyện mới rồi hỏi lại anh nha!",
+			PERSONA_TEACHER: "Phiên trò chuyện đã hết hạn. Vui lòng bắt đầu phiên mới.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "This chat has expired. Start a new one and ask me again!",
+			PERSONA_TEACHER: "This chat session has expired. Please start a new session.",
+		},
+	},
+	"session_forbidden": {
+		"vi": {
+			PERSONA_ENGPAL:  "Cuộc trò chuyện này không phải của bé rồi. Mở cuộc trò chuyện mới với anh nha!",
+			PERSONA_TEACHER: "Bạn không có quyền truy cập phiên trò chuyện này. Vui lòng bắt đầu phiên mới.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "This chat isn't yours. Start a new one with me!",
+			PERSONA_TEACHER: "You do not have access to this chat session. Please start a new session.",
+		},
+	},
+	"chat_rate_limited": {
+		"vi": {
+			PERSONA_ENGPAL:  "Từ từ thôi bé yêu, hỏi nhanh quá anh trả lời không kịp! Mỗi phút chỉ được {limit} tin nhắn thôi nha.",
+			PERSONA_TEACHER: "Bạn gửi tin nhắn quá nhanh. Mỗi phút chỉ được gửi tối đa {limit} tin nhắn, vui lòng thử lại sau.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Easy there! 😅 You can send up to {limit} messages a minute. Try again in a moment.",
+			PERSONA_TEACHER: "You are sending messages too quickly. The limit is {limit} messages per minute; please try again shortly.",
+		},
+	},
+	"chat_quota_exceeded": {
+		"vi": {
+			PERSONA_ENGPAL:  "Hôm nay bé yêu hỏi đủ {limit} câu rồi, nghỉ ngơi chút đi, mai anh trả lời tiếp nha!",
+			PERSONA_TEACHER: "Bạn đã dùng hết {limit} tin nhắn của hôm nay. Vui lòng quay lại vào ngày mai.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That's all {limit} messages for today! Take a break and come back tomorrow. 😴",
+			PERSONA_TEACHER: "You have used all {limit} of today's messages. Please come back tomorrow.",
+		},
+	},
+	"invalid_response_length": {
+		"vi": {
+			PERSONA_ENGPAL:  "Độ dài câu trả lời chỉ có thể là short, medium hoặc detailed nha bé yêu.",
+			PERSONA_TEACHER: "Độ dài câu trả lời phải là short, medium hoặc detailed.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "response_length can only be short, medium or detailed! 😉",
+			PERSONA_TEACHER: "response_length must be short, medium or detailed.",
+		},
+	},
+	"invalid_output_format": {
+		"vi": {
+			PERSONA_ENGPAL:  "Định dạng câu trả lời chỉ có thể là markdown hoặc plain nha bé yêu.",
+			PERSONA_TEACHER: "Định dạng câu trả lời phải là markdown hoặc plain.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "output_format can only be markdown or plain! 😉",
+			PERSONA_TEACHER: "output_format must be markdown or plain.",
+		},
+	},
+	"off_topic_question": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh chỉ giúp bé học tiếng Anh thôi nha. Hỏi anh về từ vựng, ngữ pháp hay phát âm đi!",
+			PERSONA_TEACHER: "Tôi chỉ có thể trả lời các câu hỏi về việc học tiếng Anh. Bạn hãy hỏi về từ vựng, ngữ pháp, phát âm hoặc kỹ năng viết nhé.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I can only help with learning English! Ask me about words, grammar or pronunciation.",
+			PERSONA_TEACHER: "I can only answer questions about learning English. Please ask about vocabulary, grammar, pronunciation or writing.",
+		},
+	},
+	"off_topic_redirect": {
+		"vi": {
+			PERSONA_ENGPAL:  "Câu này hơi xa chuyện học tiếng Anh rồi bé yêu ơi 😄 Mình quay lại với tiếng Anh nha: bé muốn học từ mới, luyện ngữ pháp hay nhờ anh sửa một câu văn?",
+			PERSONA_TEACHER: "Câu hỏi này nằm ngoài phạm vi học tiếng Anh. Bạn có muốn học từ vựng mới, ôn ngữ pháp hay nhờ tôi sửa một câu văn không?",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "That's a bit far from learning English! 😄 Want to learn new words, practise grammar or have me check a sentence?",
+			PERSONA_TEACHER: "That question is outside English learning. Would you like to learn new vocabulary, review grammar or have a sentence checked?",
+		},
+	},
+	"outside_learning_scope": {
+		"vi": {
+			PERSONA_ENGPAL:  "Câu hỏi này nằm ngoài phạm vi học tiếng Anh.",
+			PERSONA_TEACHER: "Câu hỏi này nằm ngoài phạm vi học tiếng Anh.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "This is outside English learning scope.",
+			PERSONA_TEACHER: "This is outside English learning scope.",
+		},
+	},
+	"inappropriate_content": {
+		"vi": {
+			PERSONA_ENGPAL:  "Mình nói chuyện lịch sự với nhau nha bé yêu. Bé hỏi lại bằng từ ngữ khác giúp anh nhé! 🙏",
+			PERSONA_TEACHER: "Vui lòng sử dụng ngôn từ lịch sự và đặt lại câu hỏi.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Let's keep it polite! Try asking again with different words. 🙏",
+			PERSONA_TEACHER: "Please use polite language and ask again.",
+		},
+	},
+	"prompt_injection_detected": {
+		"vi": {
+			PERSONA_ENGPAL:  "Anh chỉ giúp bé học tiếng Anh thôi nên không làm theo yêu cầu này được. Bé hỏi anh câu khác nha! 🙏",
+			PERSONA_TEACHER: "Tôi chỉ hỗ trợ các câu hỏi về học tiếng Anh nên không thể thực hiện yêu cầu này.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "I'm only here to help you learn English, so I can't do that. Ask me something else! 🙏",
+			PERSONA_TEACHER: "I can only help with learning English, so I cannot follow this request.",
+		},
+	},
+	"response_blocked": {
+		"vi": {
+			PERSONA_ENGPAL:  "Xin lỗi bé yêu, câu trả lời này không phù hợp nên anh không gửi được. Mình hỏi chuyện khác về tiếng Anh nha! 🙏",
+			PERSONA_TEACHER: "Xin lỗi, câu trả lời không phù hợp nên không thể hiển thị. Bạn hãy hỏi câu khác về tiếng Anh nhé.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Sorry, that answer wasn't appropriate so I can't send it. Let's talk about something else in English! 🙏",
+			PERSONA_TEACHER: "Sorry, the answer was withheld because it was not appropriate. Please ask another question.",
+		},
+	},
+	"service_unavailable": {
+		"vi": {
+			PERSONA_ENGPAL:  "Nhắn từ từ thôi bé yêu, bộ mắc đi đẻ quá hay gì 💢\nNgồi đợi 1 phút cho anh đi uống ly cà phê đã. Sau 1 phút mà vẫn lỗi thì xóa lịch sử trò chuyện rồi thử lại nha!",
+			PERSONA_TEACHER: "Hệ thống đang bận. Vui lòng thử lại sau 1 phút; nếu vẫn lỗi, hãy xóa lịch sử trò chuyện rồi thử lại.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "Slow down! 💢 Give me a minute to grab a coffee. If it still fails after a minute, clear the chat history and try again!",
+			PERSONA_TEACHER: "The service is busy. Please try again in a minute; if the problem persists, clear the chat history and retry.",
+		},
+	},
+	"invalid_api_key": {
+		"vi": {
+			PERSONA_ENGPAL:  "API key không hợp lệ hoặc không có quyền truy cập Gemini.",
+			PERSONA_TEACHER: "API key không hợp lệ hoặc không có quyền truy cập Gemini.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "The API key is invalid or has no access to Gemini.",
+			PERSONA_TEACHER: "The API key is invalid or has no access to Gemini.",
+		},
+	},
+	"missing_access_key": {
+		"vi": {
+			PERSONA_ENGPAL:  "Thiếu access key. Gửi kèm header Authorization: Bearer <key> hoặc X-Access-Key.",
+			PERSONA_TEACHER: "Thiếu access key. Vui lòng gửi kèm header Authorization: Bearer <key> hoặc X-Access-Key.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "The access key is missing. Send it in an Authorization: Bearer <key> or X-Access-Key header.",
+			PERSONA_TEACHER: "The access key is missing. Please send it in an Authorization: Bearer <key> or X-Access-Key header.",
+		},
+	},
+	"invalid_access_key": {
+		"vi": {
+			PERSONA_ENGPAL:  "Access key không đúng định dạng.",
+			PERSONA_TEACHER: "Access key không đúng định dạng.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "The access key is not in a valid format.",
+			PERSONA_TEACHER: "The access key is not in a valid format.",
+		},
+	},
+	"api_key_check_failed": {
+		"vi": {
+			PERSONA_ENGPAL:  "Không kiểm tra được API key vì Gemini không phản hồi. Vui lòng thử lại sau.",
+			PERSONA_TEACHER: "Không kiểm tra được API key vì Gemini không phản hồi. Vui lòng thử lại sau.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "The API key could not be checked because Gemini did not respond. Please try again later.",
+			PERSONA_TEACHER: "The API key could not be checked because Gemini did not respond. Please try again later.",
+		},
+	},
+	"review_service_unavailable": {
+		"vi": {
+			PERSONA_ENGPAL:  "## CẢNH BÁO\nEngPal đang bận đi pha cà phê nên tạm thời vắng mặt. bé yêu vui lòng ngồi chơi 3 phút rồi gửi lại cho EngPal nhận xét nha.\nYêu bé yêu nhiều lắm luôn á!",
+			PERSONA_TEACHER: "## CẢNH BÁO\nHệ thống nhận xét đang bận. Vui lòng thử lại sau 3 phút.",
+		},
+		"en": {
+			PERSONA_ENGPAL:  "## WARNING\nEngPal is off making coffee right now. Please wait 3 minutes and send it again for feedback.\nLove you lots!",
+			PERSONA_TEACHER: "## WARNING\nThe review service is busy. Please try again in 3 minutes.",
+		},
+	},
+}
+
+// Look up a message, falling back to English for other languages, Vietnamese when no
+// language is given, and the EngPal persona for unknown personas.
+func localizedMessage(code, language, persona string, details map[string]interface{}) string {
+	languages := messageCatalog[code]
+	if languages == nil {
+		return code
+	}
+
+	personas, exists := languages[language]
+	if !exists {
+		if language == "" {
+			personas = languages["vi"]
+		} else {
+			personas = languages["en"]
+		}
+	}
+	message, exists := personas[persona]
+	if !exists {
+		message = personas[PERSONA_ENGPAL]
+	}
+
+	for key, value := range details {
+		message = strings.ReplaceAll(message, "{"+key+"}", fmt.Sprint(value))
+	}
+	return message
+}
+
+// Normalize a persona name, defaulting to EngPal
+func normalizePersona(persona string) string {
+	persona = strings.ToLower(strings.TrimSpace(persona))
+	if persona == PERSONA_TEACHER {
+		return persona
+	}
+	return PERSONA_ENGPAL
+}
+
+// Write a structured {error, message} response, adding any details to the body
+func writeLocalizedError(w http.ResponseWriter, status int, code, language, persona string, details map[string]interface{}) {
+	body := map[string]interface{}{
+		"error":   code,
+		"message": localizedMessage(code, language, persona, details),
+	}
+	for key, value := range details {
+		body[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
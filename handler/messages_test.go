@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"EngPal/internal/config"
+)
+
+var catalogLanguages = []string{"vi", "en"}
+
+var catalogPersonas = []string{PERSONA_ENGPAL, PERSONA_TEACHER}
+
+func TestMessageCatalogIsComplete(t *testing.T) {
+	for code, languages := range messageCatalog {
+		for _, language := range catalogLanguages {
+			for _, persona := range catalogPersonas {
+				if strings.TrimSpace(languages[language][persona]) == "" {
+					t.Errorf("%s has no %s message for the %s persona", code, language, persona)
+				}
+			}
+		}
+	}
+}
+
+func TestLocalizedMessageFallbacks(t *testing.T) {
+	tests := []struct {
+		name              string
+		language, persona string
+		want              string
+	}{
+		{"exact", "en", PERSONA_TEACHER, messageCatalog["empty_question"]["en"][PERSONA_TEACHER]},
+		{"no language is Vietnamese", "", PERSONA_TEACHER, messageCatalog["empty_question"]["vi"][PERSONA_TEACHER]},
+		{"other language is English", "fr", PERSONA_ENGPAL, messageCatalog["empty_question"]["en"][PERSONA_ENGPAL]},
+		{"unknown persona is EngPal", "vi", "pirate", messageCatalog["empty_question"]["vi"][PERSONA_ENGPAL]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := localizedMessage("empty_question", test.language, test.persona, nil); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if got := localizedMessage("no_such_code", "en", PERSONA_ENGPAL, nil); got != "no_such_code" {
+		t.Errorf("unknown code gave %q, want the code itself", got)
+	}
+	if got := localizedMessage("question_too_long", "en", PERSONA_TEACHER, map[string]interface{}{"limit": 42}); !strings.Contains(got, "42") || strings.Contains(got, "{limit}") {
+		t.Errorf("placeholder not filled in: %q", got)
+	}
+}
+
+// POST a question to GenerateAnswer and decode the JSON body
+func postChatQuestion(t *testing.T, query string, request Conversation) (int, map[string]interface{}) {
+	t.Helper()
+	body, _ := json.Marshal(request)
+	recorder := httptest.NewRecorder()
+	GenerateAnswer(recorder, httptest.NewRequest(http.MethodPost, "/api/chatbot/generate-answer"+query, strings.NewReader(string(body))))
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return recorder.Code, response
+}
+
+func TestChatValidationErrorsAreLocalized(t *testing.T) {
+	limit := config.ChatWordLimit(CHAT_MODE_CHAT)
+	longQuestion := strings.Repeat("word ", limit+1)
+	questions := []struct {
+		code     string
+		question string
+		details  map[string]interface{}
+	}{
+		{"empty_question", "   ", nil},
+		{"question_too_long", longQuestion, map[string]interface{}{"limit": limit}},
+	}
+
+	for _, question := range questions {
+		for _, language := range catalogLanguages {
+			for _, persona := range catalogPersonas {
+				t.Run(question.code+"/"+language+"/"+persona, func(t *testing.T) {
+					status, response := postChatQuestion(t, "", Conversation{Question: question.question, Language: language, Persona: persona})
+					if status != http.StatusBadRequest {
+						t.Errorf("status = %d, want %d", status, http.StatusBadRequest)
+					}
+					if response["error"] != question.code {
+						t.Errorf("error = %v, want %s", response["error"], question.code)
+					}
+					if want := localizedMessage(question.code, language, persona, question.details); response["message"] != want {
+						t.Errorf("message = %v, want %q", response["message"], want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestLegacyChatErrors(t *testing.T) {
+	status, response := postChatQuestion(t, "?legacy_errors=true", Conversation{Question: "", Language: "en"})
+	if status != http.StatusOK {
+		t.Errorf("status = %d, want %d", status, http.StatusOK)
+	}
+	if _, exists := response["error"]; exists {
+		t.Errorf("legacy response has an error code: %v", response)
+	}
+	if response["message"] != localizedMessage("empty_question", "en", PERSONA_ENGPAL, nil) {
+		t.Errorf("message = %v", response["message"])
+	}
+
+	// Codes added after the legacy shape keep their status code
+	status, _ = postChatQuestion(t, "?legacy_errors=true", Conversation{Question: "hi", ResponseLength: "huge"})
+	if status != http.StatusBadRequest {
+		t.Errorf("invalid_response_length status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"EngPal/internal"
+	"EngPal/utils"
+
+	"google.golang.org/genai"
+)
+
+// A memory aid for a word from the student's writing
+type Mnemonic struct {
+	Word         string `json:"word"`
+	Context      string `json:"context"` // The sentence the word appeared in
+	CorrectUsage string `json:"correct_usage"`
+	Mnemonic     string `json:"mnemonic"`
+	MemoryTip    string `json:"memory_tip"`
+}
+
+const (
+	MAX_MNEMONICS           = 3
+	MNEMONIC_CACHE_DURATION = 6 * time.Hour
+	MNEMONIC_TIMEOUT        = 15 * time.Second
+	MNEMONIC_MODEL          = "gemini-2.0-flash"
+)
+
+// Mnemonics by word, sentence and language, shared by all students
+var (
+	mnemonicCache      = make(map[string]cacheItem)
+	mnemonicCacheMutex sync.Mutex
+)
+
+// Prompt section asking the review for the words to build mnemonics for
+func buildMnemonicSection(req GenerateCommentRequest) (section, fields string) {
+	if !req.GenerateMnemonic {
+		return "", ""
+	}
+	return fmt.Sprintf(`
+
+MNEMONICS:
+List in "mnemonic_words" the %d most advanced or misused vocabulary items in the writing sample, exactly as they are written in it.`, MAX_MNEMONICS),
+		"\n- \"mnemonic_words\" (mảng tối đa " + fmt.Sprint(MAX_MNEMONICS) + " từ)"
+}
+
+// Mnemonics for the words the review picked, each with the first sentence of the
+// content it appears in. Words not found in the content are skipped, and cached
+// mnemonics are reused; the rest come from one Gemini call. On error the cached
+// ones are returned.
+func generateMnemonics(words []string, req GenerateCommentRequest) []Mnemonic {
+	sentences := utils.SplitSentences(req.Content)
+	mnemonics := []Mnemonic{}
+	var missing []int // Positions in mnemonics still to be generated
+	seen := make(map[string]bool)
+
+	mnemonicCacheMutex.Lock()
+	now := time.Now()
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		key := strings.ToLower(word)
+		if word == "" || seen[key] || len(mnemonics) == MAX_MNEMONICS {
+			continue
+		}
+		sentence := sentenceContaining(sentences, word)
+		if sentence == "" {
+			continue
+		}
+		seen[key] = true
+
+		if item, found := mnemonicCache[mnemonicCacheKey(word, sentence, req.Language)]; found && item.ExpiresAt.After(now) {
+			mnemonics = append(mnemonics, item.Data.(Mnemonic))
+			continue
+		}
+		missing = append(missing, len(mnemonics))
+		mnemonics = append(mnemonics, Mnemonic{Word: word, Context: sentence})
+	}
+	mnemonicCacheMutex.Unlock()
+
+	if len(missing) == 0 {
+		return mnemonics
+	}
+	pending := make([]Mnemonic, len(missing))
+	for i, position := range missing {
+		pending[i] = mnemonics[position]
+	}
+	generated, err := callGeminiForMnemonics(pending, req.Language)
+	if err != nil {
+		log.Printf("Error generating mnemonics: %v", err)
+	}
+
+	mnemonicCacheMutex.Lock()
+	defer mnemonicCacheMutex.Unlock()
+	for i, position := range missing {
+		if i < len(generated) && generated[i].Mnemonic != "" {
+			mnemonic := mnemonics[position]
+			mnemonic.CorrectUsage = strings.TrimSpace(generated[i].CorrectUsage)
+			mnemonic.Mnemonic = strings.TrimSpace(generated[i].Mnemonic)
+			mnemonic.MemoryTip = strings.TrimSpace(generated[i].MemoryTip)
+			mnemonics[position] = mnemonic
+			mnemonicCache[mnemonicCacheKey(mnemonic.Word, mnemonic.Context, req.Language)] = cacheItem{Data: mnemonic, ExpiresAt: time.Now().Add(MNEMONIC_CACHE_DURATION)}
+		}
+	}
+
+	// Drop the words Gemini did not give a mnemonic for
+	complete := []Mnemonic{}
+	for _, mnemonic := range mnemonics {
+		if mnemonic.Mnemonic != "" {
+			complete = append(complete, mnemonic)
+		}
+	}
+	return complete
+}
+
+// Ask Gemini for the usage, mnemonic and tip of each word, in order
+func callGeminiForMnemonics(items []Mnemonic, language string) ([]Mnemonic, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return nil, errors.New("Gemini client not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), MNEMONIC_TIMEOUT)
+	defer cancel()
+
+	var list strings.Builder
+	for i, item := range items {
+		list.WriteString(fmt.Sprintf("%d. \"%s\" in: \"%s\"\n", i+1, item.Word, item.Context))
+	}
+	prompt := fmt.Sprintf(`You are an English teacher helping a learner remember vocabulary. For each word below, taken from the learner's sentence:
+- "correct_usage": a short, correct example sentence using the word as intended
+- "mnemonic": a vivid, memorable mnemonic device for its meaning or spelling
+- "memory_tip": one short practical tip for remembering or using it
+
+%s
+Return one item per word, in the same order, each with its "word". Write everything except the words and example sentences in %s.`, list.String(), responseLanguageName(language))
+
+	itemSchema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"word":          {Type: genai.TypeString},
+			"correct_usage": {Type: genai.TypeString},
+			"mnemonic":      {Type: genai.TypeString},
+			"memory_tip":    {Type: genai.TypeString},
+		},
+		Required: []string{"word", "correct_usage", "mnemonic", "memory_tip"},
+	}
+	result, err := client.Models.GenerateContent(ctx, MNEMONIC_MODEL, genai.Text(prompt), &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   &genai.Schema{Type: genai.TypeArray, Items: itemSchema},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var generated []Mnemonic
+	if err := json.Unmarshal([]byte(result.Text()), &generated); err != nil {
+		return nil, fmt.Errorf("failed to parse mnemonics JSON: %w", err)
+	}
+	return generated, nil
+}
+
+// The first sentence containing the word as a whole word, ignoring case
+func sentenceContaining(sentences []string, word string) string {
+	pattern, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(word) + `\b`)
+	if err != nil {
+		return ""
+	}
+	for _, sentence := range sentences {
+		if pattern.MatchString(sentence) {
+			return sentence
+		}
+	}
+	return ""
+}
+
+func mnemonicCacheKey(word, context, language string) string {
+	key := strings.ToLower(word) + "|" + utils.NormalizeContent(context) + "|" + language
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"EngPal/internal/config"
+	"EngPal/security"
+	"EngPal/utils"
+
+	"google.golang.org/genai"
+)
+
+type OCRBatchRequest struct {
+	Images       []string `json:"images"`                  // Base64 JPEG/PNG/WebP (or data URIs), one per page
+	LanguageHint string   `json:"language_hint,omitempty"` // Expected languages, e.g. "Vietnamese and English"
+	Language     string   `json:"language,omitempty"`      // en, vi for error messages
+}
+
+// The extraction of one image of the batch, in input order
+type OCRBatchResult struct {
+	Page    int                           `json:"page"` // 1-based position in the request
+	Success bool                          `json:"success"`
+	Result  *ExtractTextFromImageResponse `json:"result,omitempty"`
+	Error   string                        `json:"error,omitempty"`   // Error code when the image failed
+	Message string                        `json:"message,omitempty"` // Localized description of the error
+}
+
+type OCRBatchResponse struct {
+	Results   []OCRBatchResult `json:"results"`
+	FullText  string           `json:"full_text"` // Text of the successful pages, with page separators
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
+
+const (
+	MAX_OCR_BATCH_IMAGES = 10
+	OCR_BATCH_WORKERS    = 3 // Images extracted at the same time
+	OCR_PAGE_SEPARATOR   = "\n\n--- Page %d ---\n\n"
+)
+
+var (
+	errNoImages           = errors.New("no images")
+	errTooManyImages      = errors.New("too many images")
+	errImageBatchTooLarge = errors.New("image batch too large")
+)
+
+// An image of the batch, either read or rejected on its own
+type ocrBatchImage struct {
+	Data     []byte
+	MimeType string
+	Err      error
+}
+
+// POST /api/ocr/batch - reads the text of up to MAX_OCR_BATCH_IMAGES photos, such as
+// the pages of a handwritten essay. A bad image fails on its own, not the batch.
+func ExtractTextFromImageBatch(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var request OCRBatchRequest
+	images, err := readOCRBatch(w, r, &request, &request)
+	if err != nil {
+		writeOCRBatchError(w, request.Language, err)
+		return
+	}
+	request.LanguageHint = strings.TrimSpace(request.LanguageHint)
+	if utf8.RuneCountInString(request.LanguageHint) > MAX_LANGUAGE_HINT_LENGTH {
+		http.Error(w, fmt.Sprintf("gợi ý ngôn ngữ không được dài hơn %d ký tự", MAX_LANGUAGE_HINT_LENGTH), http.StatusBadRequest)
+		return
+	}
+
+	results := extractOCRBatch(r.Context(), images, request.LanguageHint, request.Language)
+	response := OCRBatchResponse{Results: results}
+	var pages []string
+	for _, result := range results {
+		if !result.Success {
+			response.Failed++
+			continue
+		}
+		response.Succeeded++
+		pages = append(pages, fmt.Sprintf(OCR_PAGE_SEPARATOR, result.Page)+result.Result.FullText)
+	}
+	response.FullText = strings.TrimSpace(strings.Join(pages, ""))
+
+	logf(r, "Extracted text from %d/%d images for key %s, processing time: %dms",
+		response.Succeeded, len(results), security.Fingerprint(AccessKey(r)), time.Since(startTime).Milliseconds())
+	if response.Succeeded == 0 {
+		writeLocalizedError(w, http.StatusServiceUnavailable, "text_extraction_failed", request.Language, PERSONA_TEACHER,
+			map[string]interface{}{"results": results})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Read the images of a JSON or multipart batch within the combined size budget.
+// Images that cannot be read are returned with their error; only a request that
+// is malformed, has no or too many images, or is over the budget fails as a whole.
+// A JSON body is decoded into request, which embeds batch; for a multipart body
+// only the OCRBatchRequest fields are filled, and callers read any other fields
+// with r.FormValue.
+func readOCRBatch(w http.ResponseWriter, r *http.Request, request interface{}, batch *OCRBatchRequest) ([]ocrBatchImage, error) {
+	mediaType := "application/json" // Default for clients that send no Content-Type
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, errUnsupportedContentType
+		}
+	}
+
+	budget := config.OCRBatchMaxBytes()
+	overhead := MAX_OCR_BATCH_IMAGES * IMAGE_FORM_OVERHEAD_BYTES
+	var images []ocrBatchImage
+	switch mediaType {
+	case "application/json":
+		r.Body = http.MaxBytesReader(w, r.Body, int64((budget+2)/3*4+overhead))
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			return nil, imageBatchBodyError(err)
+		}
+		batch.Language = strings.ToLower(strings.TrimSpace(batch.Language))
+		if err := checkOCRBatchCount(len(batch.Images)); err != nil {
+			return nil, err
+		}
+		for _, encoded := range batch.Images {
+			data, mimeType, err := utils.DecodeBase64Image(encoded)
+			images = append(images, ocrBatchImage{Data: data, MimeType: mimeType, Err: err})
+		}
+
+	case "multipart/form-data":
+		limit := int64(budget + overhead)
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		if err := r.ParseMultipartForm(limit); err != nil {
+			return nil, imageBatchBodyError(err)
+		}
+		batch.Language = strings.ToLower(strings.TrimSpace(r.FormValue("language")))
+		batch.LanguageHint = r.FormValue("language_hint")
+		files := r.MultipartForm.File["images"]
+		if err := checkOCRBatchCount(len(files)); err != nil {
+			return nil, err
+		}
+		for _, header := range files {
+			file, err := header.Open()
+			if err != nil {
+				images = append(images, ocrBatchImage{Err: utils.ErrInvalidImage})
+				continue
+			}
+			data, mimeType, err := utils.ReadImage(file)
+			file.Close()
+			images = append(images, ocrBatchImage{Data: data, MimeType: mimeType, Err: err})
+		}
+
+	default:
+		return nil, errUnsupportedContentType
+	}
+
+	total := 0
+	for _, image := range images {
+		total += len(image.Data)
+	}
+	if total > budget {
+		return nil, errImageBatchTooLarge
+	}
+	return images, nil
+}
+
+func checkOCRBatchCount(count int) error {
+	if count == 0 {
+		return errNoImages
+	}
+	if count > MAX_OCR_BATCH_IMAGES {
+		return errTooManyImages
+	}
+	return nil
+}
+
+// A batch body over the budget is reported as such rather than as one large image
+func imageBatchBodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errImageBatchTooLarge
+	}
+	return errMalformedImageRequest
+}
+
+// Extract the text of the readable images with a bounded pool of workers, stopping
+// when the request is cancelled. Results are in input order.
+func extractOCRBatch(ctx context.Context, images []ocrBatchImage, languageHint, language string) []OCRBatchResult {
+	results := make([]OCRBatchResult, len(images))
+	var pending []int
+	for i, image := range images {
+		results[i].Page = i + 1
+		if image.Err != nil {
+			setOCRBatchError(&results[i], ocrImageErrorCode(image.Err), language)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(OCR_BATCH_WORKERS, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				extracted, err := extractOCRBatchImage(ctx, images[i], languageHint)
+				if err != nil {
+					log.Printf("Error extracting text from batch page %d: %v", i+1, err)
+					setOCRBatchError(&results[i], "text_extraction_failed", language)
+					continue
+				}
+				results[i].Success = true
+				results[i].Result = extracted
+			}
+		}()
+	}
+	for _, i := range pending {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func extractOCRBatchImage(ctx context.Context, image ocrBatchImage, languageHint string) (*ExtractTextFromImageResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cacheKey := ocrCacheKey(image.Data, languageHint)
+	if extracted, found := cachedExtraction(cacheKey); found {
+		return extracted, nil
+	}
+	data, downscaled, err := utils.DownscaleImage(image.Data, image.MimeType, config.ImageDownscaleDimension())
+	if err != nil {
+		return nil, err
+	}
+	extracted, err := extractTextWithGemini(ctx, genai.NewPartFromBytes(data, image.MimeType), languageHint)
+	if err != nil {
+		return nil, err
+	}
+	extracted.Downscaled = downscaled
+	storeExtraction(cacheKey, extracted)
+	return extracted, nil
+}
+
+func setOCRBatchError(result *OCRBatchResult, code, language string) {
+	limit := imageSizeLimitMB()
+	if code == "image_dimensions_too_large" {
+		limit = config.ImageMaxDimension()
+	}
+	result.Error = code
+	result.Message = localizedMessage(code, language, PERSONA_TEACHER, map[string]interface{}{"limit": limit})
+}
+
+// The error code of an image rejected while reading the batch
+func ocrImageErrorCode(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrImageTooLarge):
+		return "image_too_large"
+	case errors.Is(err, utils.ErrImageDimensions):
+		return "image_dimensions_too_large"
+	case errors.Is(err, utils.ErrUnsupportedImageType):
+		return "unsupported_image_format"
+	}
+	return "invalid_image"
+}
+
+// Write the structured error for a batch rejected as a whole.
+func writeOCRBatchError(w http.ResponseWriter, language string, err error) {
+	switch {
+	case errors.Is(err, errNoImages):
+		writeLocalizedError(w, http.StatusBadRequest, "no_images", language, PERSONA_TEACHER, nil)
+	case errors.Is(err, errTooManyImages):
+		writeLocalizedError(w, http.StatusBadRequest, "too_many_images", language, PERSONA_TEACHER,
+			map[string]interface{}{"limit": MAX_OCR_BATCH_IMAGES})
+	case errors.Is(err, errImageBatchTooLarge):
+		writeLocalizedError(w, http.StatusRequestEntityTooLarge, "image_batch_too_large", language, PERSONA_TEACHER,
+			map[string]interface{}{"limit": max(1, config.OCRBatchMaxBytes()>>20)})
+	default:
+		writeImageUploadError(w, language, err)
+	}
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"EngPal/internal/config"
+)
+
+// Answer OCR calls with the text for the image sent, failing for images without one
+func answerOCRByImage(texts map[string]string) func(fakeGeminiCall) (int, string) {
+	return func(call fakeGeminiCall) (int, string) {
+		sent := call.Contents[0].Parts[1].InlineData.Data
+		text, found := texts[string(sent)]
+		if !found {
+			return http.StatusInternalServerError, "internal error"
+		}
+		return http.StatusOK, `{"blocks": [{"text": "` + text + `", "language": "en"}], "confidence": "high"}`
+	}
+}
+
+func extractTextFromImageBatch(request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ExtractTextFromImageBatch(recorder, request)
+	return recorder
+}
+
+func jsonOCRBatchRequest(images ...[]byte) *http.Request {
+	var batch OCRBatchRequest
+	for _, image := range images {
+		batch.Images = append(batch.Images, base64.StdEncoding.EncodeToString(image))
+	}
+	body, _ := json.Marshal(batch)
+	request := httptest.NewRequest(http.MethodPost, "/api/ocr/batch", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	return request
+}
+
+func TestExtractTextFromImageBatchKeepsOrderOnPartialFailure(t *testing.T) {
+	useEmptyOCRCache(t)
+	pages := [][]byte{
+		sampleImage(t, "image/png", 8, 8, 11),
+		gifImage,
+		sampleImage(t, "image/png", 8, 8, 12), // Gemini fails for this page
+		sampleImage(t, "image/jpeg", 8, 8, 13),
+		sampleImage(t, "image/png", 8, 8, 14),
+	}
+	useFakeGemini(t, answerOCRByImage(map[string]string{
+		string(pages[0]): "First page",
+		string(pages[3]): "Fourth page",
+		string(pages[4]): "Fifth page",
+	}))
+
+	recorder := extractTextFromImageBatch(jsonOCRBatchRequest(pages...))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	var response OCRBatchResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	wantResults := []struct {
+		success bool
+		text    string
+		error   string
+	}{
+		{true, "First page", ""},
+		{false, "", "unsupported_image_format"},
+		{false, "", "text_extraction_failed"},
+		{true, "Fourth page", ""},
+		{true, "Fifth page", ""},
+	}
+	if len(response.Results) != len(wantResults) {
+		t.Fatalf("got %d results, want %d", len(response.Results), len(wantResults))
+	}
+	for i, want := range wantResults {
+		result := response.Results[i]
+		if result.Page != i+1 || result.Success != want.success || result.Error != want.error {
+			t.Errorf("result %d = %+v, want page %d, success %v, error %q", i, result, i+1, want.success, want.error)
+		}
+		if want.success && (result.Result == nil || result.Result.FullText != want.text) {
+			t.Errorf("result %d = %+v, want text %q", i, result.Result, want.text)
+		}
+		if !want.success && result.Message == "" {
+			t.Errorf("result %d has no error message", i)
+		}
+	}
+	if response.Succeeded != 3 || response.Failed != 2 {
+		t.Errorf("succeeded %d, failed %d, want 3 and 2", response.Succeeded, response.Failed)
+	}
+	wantFullText := "--- Page 1 ---\n\nFirst page\n\n--- Page 4 ---\n\nFourth page\n\n--- Page 5 ---\n\nFifth page"
+	if response.FullText != wantFullText {
+		t.Errorf("full text = %q, want %q", response.FullText, wantFullText)
+	}
+}
+
+func TestExtractTextFromImageBatchMultipart(t *testing.T) {
+	useEmptyOCRCache(t)
+	first, second := sampleImage(t, "image/png", 8, 8, 21), sampleImage(t, "image/png", 8, 8, 22)
+	gemini := useFakeGemini(t, answerOCRByImage(map[string]string{string(first): "One", string(second): "Two"}))
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("language_hint", "English")
+	for _, image := range [][]byte{first, second} {
+		file, _ := writer.CreateFormFile("images", "page")
+		file.Write(image)
+	}
+	writer.Close()
+	request := httptest.NewRequest(http.MethodPost, "/api/ocr/batch", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	recorder := extractTextFromImageBatch(request)
+	var response OCRBatchResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if response.Succeeded != 2 || response.FullText != "--- Page 1 ---\n\nOne\n\n--- Page 2 ---\n\nTwo" {
+		t.Errorf("got %+v", response)
+	}
+	for _, call := range gemini.received() {
+		if !strings.Contains(call.Contents[0].Parts[0].Text, "English") {
+			t.Errorf("the language hint was not sent to Gemini: %q", call.Contents[0].Parts[0].Text)
+		}
+	}
+}
+
+func TestExtractTextFromImageBatchAllFailed(t *testing.T) {
+	useEmptyOCRCache(t)
+	useFakeGemini(t, answerOCRByImage(nil))
+
+	recorder := extractTextFromImageBatch(jsonOCRBatchRequest(sampleImage(t, "image/png", 8, 8, 31), gifImage))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+	var body struct {
+		Error   string           `json:"error"`
+		Results []OCRBatchResult `json:"results"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if body.Error != "text_extraction_failed" || len(body.Results) != 2 || body.Results[1].Error != "unsupported_image_format" {
+		t.Errorf("got %+v", body)
+	}
+}
+
+func TestExtractTextFromImageBatchErrors(t *testing.T) {
+	useEmptyOCRCache(t)
+	useFakeGemini(t, answerOCRByImage(nil))
+	cfg, _ := config.Load()
+	cfg.OCRBatchMaxBytes = 8 << 10
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+
+	photo := sampleImage(t, "image/png", 8, 8, 41)
+	large := append(sampleImage(t, "image/png", 8, 8, 42), make([]byte, 3<<10)...)
+	tooMany := make([][]byte, MAX_OCR_BATCH_IMAGES+1)
+	for i := range tooMany {
+		tooMany[i] = photo
+	}
+	textRequest := httptest.NewRequest(http.MethodPost, "/api/ocr/batch", strings.NewReader("images"))
+	textRequest.Header.Set("Content-Type", "text/plain")
+	malformedRequest := httptest.NewRequest(http.MethodPost, "/api/ocr/batch", strings.NewReader(`{"images": [`))
+
+	tests := []struct {
+		name       string
+		request    *http.Request
+		wantStatus int
+		wantCode   string
+	}{
+		{"no images", jsonOCRBatchRequest(), http.StatusBadRequest, "no_images"},
+		{"too many images", jsonOCRBatchRequest(tooMany...), http.StatusBadRequest, "too_many_images"},
+		{"over the combined budget", jsonOCRBatchRequest(large, large, large), http.StatusRequestEntityTooLarge, "image_batch_too_large"},
+		{"plain text body", textRequest, http.StatusUnsupportedMediaType, "unsupported_content_type"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := extractTextFromImageBatch(test.request)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if code := errorCodeOf(t, recorder); code != test.wantCode {
+				t.Errorf("error = %q, want %q", code, test.wantCode)
+			}
+		})
+	}
+
+	if recorder := extractTextFromImageBatch(malformedRequest); recorder.Code != http.StatusBadRequest {
+		t.Errorf("malformed JSON: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
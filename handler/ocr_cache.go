@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"EngPal/internal/config"
+)
+
+// Text extracted from images, keyed by the SHA-256 of the uploaded bytes and the
+// language hint. Shared by the single and batch OCR endpoints, whose batch workers
+// read and write it at the same time.
+var (
+	ocrCache      = make(map[string]cacheItem)
+	ocrCacheMutex sync.Mutex
+)
+
+// Cache key of an image before it is downscaled, so the same photo is found
+// whatever the downscale setting
+func ocrCacheKey(data []byte, languageHint string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + "-" + languageHint
+}
+
+// A copy of the cached extraction, marked as cached
+func cachedExtraction(key string) (*ExtractTextFromImageResponse, bool) {
+	ocrCacheMutex.Lock()
+	defer ocrCacheMutex.Unlock()
+	item, found := ocrCache[key]
+	if !found || !item.ExpiresAt.After(time.Now()) {
+		return nil, false
+	}
+	extracted := *item.Data.(*ExtractTextFromImageResponse)
+	extracted.Cached = true
+	return &extracted, true
+}
+
+// Cache an extraction, dropping expired entries and then the oldest one when the
+// cache is full
+func storeExtraction(key string, extracted *ExtractTextFromImageResponse) {
+	stored := *extracted
+	stored.Cached = false
+	now := time.Now()
+
+	ocrCacheMutex.Lock()
+	defer ocrCacheMutex.Unlock()
+	if _, exists := ocrCache[key]; !exists && len(ocrCache) >= config.OCRCacheMaxEntries() {
+		oldestKey := ""
+		for cacheKey, item := range ocrCache {
+			if !item.ExpiresAt.After(now) {
+				delete(ocrCache, cacheKey)
+			} else if oldestKey == "" || item.ExpiresAt.Before(ocrCache[oldestKey].ExpiresAt) {
+				oldestKey = cacheKey
+			}
+		}
+		if len(ocrCache) >= config.OCRCacheMaxEntries() {
+			delete(ocrCache, oldestKey)
+		}
+	}
+	ocrCache[key] = cacheItem{Data: &stored, ExpiresAt: now.Add(config.OCRCacheTTL())}
+}
+
+func clearOCRCache() {
+	ocrCacheMutex.Lock()
+	defer ocrCacheMutex.Unlock()
+	clear(ocrCache)
+}
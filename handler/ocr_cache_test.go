@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"EngPal/internal/config"
+)
+
+func useOCRCacheLimits(t *testing.T, ttl time.Duration, maxEntries int) {
+	t.Helper()
+	useEmptyOCRCache(t)
+	cfg, _ := config.Load()
+	cfg.OCRCacheTTL = ttl
+	cfg.OCRCacheMaxEntries = maxEntries
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+}
+
+func TestOCRCacheKey(t *testing.T) {
+	photo := []byte("photo bytes")
+	key := ocrCacheKey(photo, "")
+	if key != ocrCacheKey([]byte("photo bytes"), "") {
+		t.Error("the same image got different keys")
+	}
+	if key == ocrCacheKey([]byte("other photo"), "") {
+		t.Error("different images got the same key")
+	}
+	if key == ocrCacheKey(photo, "Vietnamese") {
+		t.Error("different language hints got the same key")
+	}
+}
+
+func TestCachedExtractionIsACopy(t *testing.T) {
+	useOCRCacheLimits(t, time.Hour, 10)
+	extracted := &ExtractTextFromImageResponse{FullText: "Hello", Cached: true}
+	storeExtraction("page", extracted)
+	extracted.FullText = "changed after storing"
+
+	first, found := cachedExtraction("page")
+	if !found || first.FullText != "Hello" || !first.Cached {
+		t.Fatalf("cached = %+v, %v, want Hello marked cached", first, found)
+	}
+	first.FullText = "changed by a caller"
+	if second, _ := cachedExtraction("page"); second.FullText != "Hello" {
+		t.Errorf("a caller changed the cached extraction to %q", second.FullText)
+	}
+	if _, found := cachedExtraction("missing"); found {
+		t.Error("found an extraction that was never stored")
+	}
+}
+
+func TestCachedExtractionExpires(t *testing.T) {
+	useOCRCacheLimits(t, time.Nanosecond, 10)
+	storeExtraction("page", &ExtractTextFromImageResponse{FullText: "Hello"})
+	time.Sleep(time.Millisecond)
+	if _, found := cachedExtraction("page"); found {
+		t.Error("found an expired extraction")
+	}
+}
+
+func TestStoreExtractionEvictsOldest(t *testing.T) {
+	useOCRCacheLimits(t, time.Hour, 2)
+	for _, key := range []string{"first", "second"} {
+		storeExtraction(key, &ExtractTextFromImageResponse{FullText: key})
+		time.Sleep(time.Millisecond) // Distinct expiry times
+	}
+	storeExtraction("second", &ExtractTextFromImageResponse{FullText: "second again"}) // Replacing evicts nothing
+	if _, found := cachedExtraction("first"); !found {
+		t.Fatal("replacing an entry evicted another one")
+	}
+	storeExtraction("third", &ExtractTextFromImageResponse{FullText: "third"})
+
+	for key, wantFound := range map[string]bool{"first": false, "second": true, "third": true} {
+		if _, found := cachedExtraction(key); found != wantFound {
+			t.Errorf("%s: found = %v, want %v", key, found, wantFound)
+		}
+	}
+	if len(ocrCache) != 2 {
+		t.Errorf("cache holds %d entries, want 2", len(ocrCache))
+	}
+}
+
+func TestClearReviewCacheClearsOCRCache(t *testing.T) {
+	useOCRCacheLimits(t, time.Hour, 10)
+	storeExtraction("page", &ExtractTextFromImageResponse{FullText: "Hello"})
+
+	anonymous, learner, admin := requestAsEachCaller(t, ClearReviewCache, http.MethodDelete, "/api/review/cache")
+	if anonymous != http.StatusUnauthorized || learner != http.StatusForbidden || admin.Code != http.StatusOK {
+		t.Fatalf("statuses = %d, %d, %d, want %d, %d, %d", anonymous, learner, admin.Code, http.StatusUnauthorized, http.StatusForbidden, http.StatusOK)
+	}
+	if _, found := cachedExtraction("page"); found {
+		t.Error("the OCR cache was not cleared")
+	}
+}
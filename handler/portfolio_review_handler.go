@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type GeneratePortfolioReviewRequest struct {
+	UserLevel   string            `json:"user_level"`
+	Requirement string            `json:"requirement"`
+	Language    string            `json:"language,omitempty"`
+	Samples     []PortfolioSample `json:"samples"`
+}
+
+type PortfolioSample struct {
+	ID       string `json:"id"` // Defaults to the sample's position (1, 2, ...)
+	Content  string `json:"content"`
+	Category string `json:"category,omitempty"`
+}
+
+type PortfolioResult struct {
+	ID     string          `json:"id"`
+	Review *ReviewResponse `json:"review,omitempty"`
+	Error  string          `json:"error,omitempty"` // Set when this sample could not be reviewed
+}
+
+type PortfolioReviewResponse struct {
+	Samples          []PortfolioResult `json:"samples"`
+	AverageScores    ReviewCriteria    `json:"average_scores"`
+	ConsistencyScore float64           `json:"consistency_score"` // 0-10, 10 when all samples score alike
+	ProcessingTime   float64           `json:"processing_time_ms"`
+}
+
+const (
+	MAX_PORTFOLIO_SAMPLES        = 5
+	PORTFOLIO_REVIEW_WORKERS     = 3   // Samples reviewed at the same time
+	MAX_SCORE_STANDARD_DEVIATION = 5.0 // Of scores on a 0-10 scale
+)
+
+// POST /api/review/portfolio - reviews several writing samples and compares them
+func GeneratePortfolioReview(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var request GeneratePortfolioReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	sampleRequests, err := buildPortfolioSampleRequests(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Cached samples are served from the cache; the rest go to the workers
+	results := make([]PortfolioResult, len(sampleRequests))
+	cacheKeys := make([]string, len(sampleRequests))
+	var pending []int
+	now := time.Now()
+	for i, sampleRequest := range sampleRequests {
+		results[i].ID = request.Samples[i].ID
+		cacheKeys[i] = generateReviewCacheKey(sampleRequest)
+		if cached, found := cachedReview(cacheKeys[i], now); found {
+			results[i].Review = withSubmittedContent(cached, sampleRequest)
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(PORTFOLIO_REVIEW_WORKERS, len(pending)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				review, err := generateReviewWithGemini(sampleRequests[i], startTime)
+				if err != nil {
+					logf(r, "Error reviewing portfolio sample %s: %v", results[i].ID, err)
+					results[i].Error = "service_unavailable"
+					continue
+				}
+				results[i].Review = review
+			}
+		}()
+	}
+	for _, i := range pending {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Cache the new reviews and record their scores
+	var reviews []*ReviewResponse
+	for _, i := range pending {
+		if results[i].Review != nil {
+			cacheReview(cacheKeys[i], results[i].Review, now)
+			recordScoreDistribution(results[i].Review)
+		}
+	}
+	for _, result := range results {
+		if result.Review != nil {
+			reviews = append(reviews, result.Review)
+		}
+	}
+	if len(reviews) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "service_unavailable",
+			"message": localizedMessage("review_service_unavailable", request.Language, PERSONA_ENGPAL, nil),
+		})
+		return
+	}
+
+	response := PortfolioReviewResponse{
+		Samples:          results,
+		AverageScores:    averageReviewScores(reviews),
+		ConsistencyScore: portfolioConsistency(reviews),
+		ProcessingTime:   float64(time.Since(startTime).Nanoseconds()) / 1e6,
+	}
+
+	logf(r, "Generated portfolio review of %d samples (%d failed), processing time: %.2fms",
+		len(results), len(results)-len(reviews), response.ProcessingTime)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Validate the portfolio and build one review request per sample
+func buildPortfolioSampleRequests(request GeneratePortfolioReviewRequest) ([]GenerateCommentRequest, error) {
+	if len(request.Samples) == 0 {
+		return nil, errors.New("phải có ít nhất một bài viết")
+	}
+	if len(request.Samples) > MAX_PORTFOLIO_SAMPLES {
+		return nil, fmt.Errorf("không được gửi quá %d bài viết", MAX_PORTFOLIO_SAMPLES)
+	}
+
+	seen := make(map[string]bool)
+	sampleRequests := make([]GenerateCommentRequest, len(request.Samples))
+	for i := range request.Samples {
+		sample := &request.Samples[i]
+		sample.ID = strings.TrimSpace(sample.ID)
+		if sample.ID == "" {
+			sample.ID = strconv.Itoa(i + 1)
+		}
+		if seen[sample.ID] {
+			return nil, fmt.Errorf("id bài viết \"%s\" bị trùng", sample.ID)
+		}
+		seen[sample.ID] = true
+
+		sampleRequests[i] = GenerateCommentRequest{
+			Content:     sample.Content,
+			UserLevel:   request.UserLevel,
+			Requirement: request.Requirement,
+			Category:    sample.Category,
+			Language:    request.Language,
+		}
+		if err := validateReviewRequest(&sampleRequests[i]); err != nil {
+			return nil, fmt.Errorf("bài viết \"%s\": %w", sample.ID, err)
+		}
+	}
+	return sampleRequests, nil
+}
+
+// Mean of each criterion over the reviews
+func averageReviewScores(reviews []*ReviewResponse) ReviewCriteria {
+	var average ReviewCriteria
+	for _, review := range reviews {
+		average.Grammar += review.Scores.Grammar
+		average.Vocabulary += review.Scores.Vocabulary
+		average.Coherence += review.Scores.Coherence
+		average.TaskResponse += review.Scores.TaskResponse
+		average.Overall += review.Scores.Overall
+		average.PronounReferenceScore += review.Scores.PronounReferenceScore
+	}
+	count := float64(len(reviews))
+	average.Grammar = roundTo(average.Grammar/count, 1)
+	average.Vocabulary = roundTo(average.Vocabulary/count, 1)
+	average.Coherence = roundTo(average.Coherence/count, 1)
+	average.TaskResponse = roundTo(average.TaskResponse/count, 1)
+	average.Overall = roundTo(average.Overall/count, 1)
+	average.PronounReferenceScore = roundTo(average.PronounReferenceScore/count, 1)
+	return average
+}
+
+// 10 minus the mean standard deviation of the criterion scores, scaled so the
+// largest possible spread (0 and 10) gives 0
+func portfolioConsistency(reviews []*ReviewResponse) float64 {
+	criteria := []func(ReviewCriteria) float64{
+		func(c ReviewCriteria) float64 { return c.Grammar },
+		func(c ReviewCriteria) float64 { return c.Vocabulary },
+		func(c ReviewCriteria) float64 { return c.Coherence },
+		func(c ReviewCriteria) float64 { return c.TaskResponse },
+		func(c ReviewCriteria) float64 { return c.Overall },
+	}
+
+	totalDeviation := 0.0
+	for _, score := range criteria {
+		mean, variance := 0.0, 0.0
+		for _, review := range reviews {
+			mean += score(review.Scores)
+		}
+		mean /= float64(len(reviews))
+		for _, review := range reviews {
+			variance += math.Pow(score(review.Scores)-mean, 2)
+		}
+		totalDeviation += math.Sqrt(variance / float64(len(reviews)))
+	}
+	meanDeviation := totalDeviation / float64(len(criteria))
+	return clampScore(10 * (1 - meanDeviation/MAX_SCORE_STANDARD_DEVIATION))
+}
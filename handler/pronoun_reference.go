@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"EngPal/internal"
+	"EngPal/utils"
+
+	"google.golang.org/genai"
+)
+
+const (
+	PRONOUN_CONFIRM_TIMEOUT = 10 * time.Second
+	PRONOUN_CONFIRM_MODEL   = "gemini-2.0-flash"
+)
+
+// Pronouns with an unclear antecedent and the pronoun reference score: the share of
+// checked pronouns without an issue, out of 10. Ambiguous cases found by the local
+// heuristic are kept only when Gemini confirms them within ctx; if it cannot be
+// asked, or ctx is already done, they are dropped rather than reported unconfirmed.
+func checkPronounReferences(ctx context.Context, content string) ([]utils.PronounIssue, float64) {
+	candidates, checked := utils.CheckPronounReferences(content)
+
+	var ambiguous []utils.PronounIssue
+	for _, issue := range candidates {
+		if issue.Issue == utils.PRONOUN_AMBIGUOUS_ANTECEDENT {
+			ambiguous = append(ambiguous, issue)
+		}
+	}
+	confirmed := make([]bool, len(ambiguous))
+	if len(ambiguous) > 0 && ctx.Err() == nil {
+		var err error
+		if confirmed, err = confirmAmbiguousPronouns(ctx, ambiguous); err != nil {
+			log.Printf("Error confirming ambiguous pronouns: %v", err)
+			confirmed = make([]bool, len(ambiguous))
+		}
+	}
+
+	issues := []utils.PronounIssue{}
+	next := 0 // Position in ambiguous
+	for _, issue := range candidates {
+		if issue.Issue == utils.PRONOUN_AMBIGUOUS_ANTECEDENT {
+			next++
+			if !confirmed[next-1] {
+				continue
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	if checked == 0 {
+		return issues, 10
+	}
+	return issues, clampScore(10 * float64(checked-len(issues)) / float64(checked))
+}
+
+// Ask Gemini whether a reader could take each pronoun to mean more than one of its
+// candidate antecedents, in the order given
+func confirmAmbiguousPronouns(ctx context.Context, issues []utils.PronounIssue) ([]bool, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return nil, errors.New("Gemini client not initialized")
+	}
+	ctx, cancel := context.WithTimeout(ctx, PRONOUN_CONFIRM_TIMEOUT)
+	defer cancel()
+
+	var list strings.Builder
+	for i, issue := range issues {
+		list.WriteString(fmt.Sprintf("%d. Pronoun \"%s\" in: \"%s\"\n", i+1, issue.Pronoun, strings.TrimSpace(issue.Context+" "+issue.Sentence)))
+		list.WriteString(fmt.Sprintf("   Candidates: %s\n", strings.Join(issue.Antecedents, "; ")))
+	}
+	prompt := fmt.Sprintf(`You are an English teacher checking pronoun references in a student's writing. For each pronoun below, decide whether a careful reader could reasonably take it to refer to more than one of the candidates, given the meaning of the sentences.
+Answer "ambiguous": false when the meaning makes one candidate clearly intended.
+
+%s
+Return one item per pronoun, in the same order, each with its "index" (from 1) and "ambiguous".`, list.String())
+
+	itemSchema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"index":     {Type: genai.TypeInteger},
+			"ambiguous": {Type: genai.TypeBoolean},
+		},
+		Required: []string{"index", "ambiguous"},
+	}
+	result, err := client.Models.GenerateContent(ctx, PRONOUN_CONFIRM_MODEL, genai.Text(prompt), &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   &genai.Schema{Type: genai.TypeArray, Items: itemSchema},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var answers []struct {
+		Index     int  `json:"index"`
+		Ambiguous bool `json:"ambiguous"`
+	}
+	if err := json.Unmarshal([]byte(result.Text()), &answers); err != nil {
+		return nil, fmt.Errorf("failed to parse pronoun confirmation JSON: %w", err)
+	}
+	confirmed := make([]bool, len(issues))
+	for _, answer := range answers {
+		if answer.Index >= 1 && answer.Index <= len(issues) {
+			confirmed[answer.Index-1] = answer.Ambiguous
+		}
+	}
+	return confirmed, nil
+}
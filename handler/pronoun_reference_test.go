@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckPronounReferencesWithinContext(t *testing.T) {
+	const content = "The dog chased the cat. It was fast."
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		wantIssues int
+		wantCalls  int
+	}{
+		{"confirmed by Gemini", context.Background(), 1, 1},
+		{"context already done", expired, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gemini := useFakeGemini(t, answerGemini(`[{"index": 1, "ambiguous": true}]`))
+			issues, _ := checkPronounReferences(test.ctx, content)
+			if len(issues) != test.wantIssues {
+				t.Errorf("issues = %+v, want %d", issues, test.wantIssues)
+			}
+			if calls := len(gemini.received()); calls != test.wantCalls {
+				t.Errorf("made %d Gemini calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Panics recovered since the server started, reported by /api/healthcheck/metrics
+var panicCount atomic.Int64
+
+// Recoverer turns a panic while serving a request into a 500 with
+// {"error": {"code": "internal_error", "request_id": ...}} and logs its stack trace.
+// It wraps RequestLogger so panics there are caught too, and reads the request ID
+// back from the response header RequestLogger sets. When the handler has already
+// started its response nothing more can be written, so the panic is only logged.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered) // The server closes the connection without logging
+			}
+			panicCount.Add(1)
+
+			requestID := w.Header().Get(REQUEST_ID_HEADER)
+			if requestID == "" {
+				requestID = newRequestID()
+				w.Header().Set(REQUEST_ID_HEADER, requestID)
+			}
+			log.Printf("[%s] panic serving %s %s: %v\n%s", requestID, r.Method, r.URL.Path, recovered, debug.Stack())
+
+			if recorder.status != 0 {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{
+					"code":       "internal_error",
+					"request_id": requestID,
+				},
+			})
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
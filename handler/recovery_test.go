@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// The middleware chain main serves, with a route that panics before writing and one
+// that panics after starting its response
+func panickingRouter() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var commit map[string]interface{}
+		_ = commit["sha"].(string) // An unchecked type assertion on a missing field
+	})
+	router.HandleFunc("/panic-after-write", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "partial")
+		panic("failed halfway")
+	})
+	return Recoverer(RequestLogger(router))
+}
+
+type internalErrorBody struct {
+	Error struct {
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	} `json:"error"`
+}
+
+func TestRecovererReturnsStructured500(t *testing.T) {
+	captureRedactedLog(t)
+	tests := []struct {
+		name          string
+		requestID     string
+		wantRequestID string
+	}{
+		{"client request ID", "req-123", "req-123"},
+		{"generated request ID", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			panicsBefore := panicCount.Load()
+			request := httptest.NewRequest(http.MethodGet, "/panic", nil)
+			if test.requestID != "" {
+				request.Header.Set(REQUEST_ID_HEADER, test.requestID)
+			}
+			recorder := httptest.NewRecorder()
+			panickingRouter().ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("status %d, content type %q, want a JSON 500", recorder.Code, recorder.Header().Get("Content-Type"))
+			}
+			var body internalErrorBody
+			if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			headerID := recorder.Header().Get(REQUEST_ID_HEADER)
+			if body.Error.Code != "internal_error" || body.Error.RequestID == "" || body.Error.RequestID != headerID {
+				t.Errorf("body %+v with request ID header %q, want internal_error and the header's ID", body, headerID)
+			}
+			if test.wantRequestID != "" && body.Error.RequestID != test.wantRequestID {
+				t.Errorf("request ID = %q, want the client's %q", body.Error.RequestID, test.wantRequestID)
+			}
+			if panics := panicCount.Load() - panicsBefore; panics != 1 {
+				t.Errorf("panic count grew by %d, want 1", panics)
+			}
+		})
+	}
+}
+
+func TestRecovererKeepsStartedResponse(t *testing.T) {
+	captureRedactedLog(t)
+	recorder := httptest.NewRecorder()
+	panickingRouter().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic-after-write", nil))
+	if recorder.Code != http.StatusAccepted || recorder.Body.String() != "partial" {
+		t.Errorf("got %d %q, want the handler's 202 partial response untouched", recorder.Code, recorder.Body)
+	}
+}
+
+func TestRecovererCatchesMiddlewarePanics(t *testing.T) {
+	captureRedactedLog(t)
+	panickingMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("middleware bug") })
+	}
+	recorder := httptest.NewRecorder()
+	Recoverer(panickingMiddleware(http.NotFoundHandler())).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var body internalErrorBody
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if recorder.Code != http.StatusInternalServerError || body.Error.Code != "internal_error" || body.Error.RequestID != recorder.Header().Get(REQUEST_ID_HEADER) {
+		t.Errorf("got %d %+v", recorder.Code, body)
+	}
+}
+
+func TestRecovererPassesAbortHandlerOn(t *testing.T) {
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", recovered)
+		}
+	}()
+	aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+	Recoverer(aborting).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestHealthcheckMetricsReportsPanics(t *testing.T) {
+	captureRedactedLog(t)
+	panickingRouter().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	request := httptest.NewRequest(http.MethodGet, "/api/healthcheck/metrics", nil)
+	request.Header.Set("Authorization", "Bearer "+signTestJWT(t, map[string]interface{}{"sub": "lan", "admin": true, "exp": time.Now().Add(time.Hour).Unix()}))
+	recorder := httptest.NewRecorder()
+	GetHealthcheckMetrics(recorder, request)
+
+	var metrics HealthcheckMetricsResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&metrics); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if metrics.Panics != panicCount.Load() || metrics.Panics == 0 {
+		t.Errorf("metrics report %d panics, want %d", metrics.Panics, panicCount.Load())
+	}
+}
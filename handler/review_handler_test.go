@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cacheKeyTestEssay = "Hello world. My name is Lan and I like writing short essays in English."
+
+func TestGenerateReviewCacheKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		sameKeys bool
+	}{
+		{"trailing space", cacheKeyTestEssay, cacheKeyTestEssay + " ", true},
+		{"surrounding newlines", cacheKeyTestEssay, "\n" + cacheKeyTestEssay + "\r\n", true},
+		{"inner spacing", cacheKeyTestEssay, strings.Replace(cacheKeyTestEssay, "Hello world.", "Hello \t world.", 1), true},
+		{"line endings", "Hello world.\nMy name is Lan.", "Hello world.\r\n\r\nMy name is Lan.", true},
+		{"capitalization", cacheKeyTestEssay, strings.ToUpper(cacheKeyTestEssay), true},
+		{"punctuation", cacheKeyTestEssay, strings.TrimSuffix(cacheKeyTestEssay, "."), false},
+		{"different words", cacheKeyTestEssay, strings.Replace(cacheKeyTestEssay, "Lan", "Minh", 1), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := generateReviewCacheKey(GenerateCommentRequest{Content: test.a})
+			b := generateReviewCacheKey(GenerateCommentRequest{Content: test.b})
+			if (a == b) != test.sameKeys {
+				t.Errorf("same keys = %v, want %v", a == b, test.sameKeys)
+			}
+		})
+	}
+}
+
+func TestGenerateReviewCacheHitKeepsSubmittedContent(t *testing.T) {
+	cached := GenerateCommentRequest{Content: cacheKeyTestEssay}
+	if err := validateReviewRequest(&cached); err != nil {
+		t.Fatal(err)
+	}
+	cacheKey := generateReviewCacheKey(cached)
+	cacheReview(cacheKey, &ReviewResponse{Content: cacheKeyTestEssay, OverallFeedback: "cached"}, time.Now())
+	defer func() {
+		reviewCacheMutex.Lock()
+		delete(reviewCache, cacheKey)
+		reviewCacheMutex.Unlock()
+	}()
+
+	submitted := cacheKeyTestEssay + " "
+	body, _ := json.Marshal(GenerateCommentRequest{Content: submitted})
+	recorder := httptest.NewRecorder()
+	GenerateReview(recorder, httptest.NewRequest(http.MethodPost, "/api/review/generate", strings.NewReader(string(body))))
+
+	var review ReviewResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&review); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if review.OverallFeedback != "cached" {
+		t.Fatalf("expected a cache hit, got %+v", review)
+	}
+	if review.Content != submitted {
+		t.Errorf("content = %q, want the submitted %q", review.Content, submitted)
+	}
+}
+
+func TestCriterionWeightsSumToOne(t *testing.T) {
+	categories := []string{"", "unknown"}
+	for category := range writingCategories {
+		categories = append(categories, category)
+	}
+	multipliers := []*ReviewCriterionWeights{nil, {Grammar: 2}, {Vocabulary: 0.5, TaskResponse: 3}}
+
+	for _, category := range categories {
+		for _, multiplier := range multipliers {
+			weights := getCriterionWeights(category, multiplier)
+			total := weights.Grammar + weights.Vocabulary + weights.Coherence + weights.TaskResponse
+			if math.Abs(total-1) > 0.002 {
+				t.Errorf("weights of %q with multipliers %+v sum to %g, want 1", category, multiplier, total)
+			}
+		}
+	}
+}
+
+func TestCriterionWeightsByCategory(t *testing.T) {
+	tests := []struct {
+		category string
+		heavier  func(ReviewCriterionWeights) bool
+	}{
+		{"essay", func(w ReviewCriterionWeights) bool { return w.Coherence > w.Vocabulary && w.TaskResponse > w.Grammar }},
+		{"story", func(w ReviewCriterionWeights) bool { return w.Vocabulary > w.Grammar && w.Vocabulary > w.TaskResponse }},
+		{" Essay ", func(w ReviewCriterionWeights) bool { return w == categoryCriterionWeights["essay"] }},
+		{"unknown", func(w ReviewCriterionWeights) bool { return w == defaultCriterionWeights }},
+	}
+	for _, test := range tests {
+		if weights := getCriterionWeights(test.category, nil); !test.heavier(weights) {
+			t.Errorf("unexpected weights for %q: %+v", test.category, weights)
+		}
+	}
+}
+
+func TestComputeWeightedOverall(t *testing.T) {
+	scores := ReviewCriteria{Grammar: 6, Vocabulary: 8, Coherence: 7, TaskResponse: 5}
+	tests := []struct {
+		category string
+		want     float64
+	}{
+		{"", 6.5},
+		{"essay", 6.4},
+		{"story", 6.9},
+	}
+	for _, test := range tests {
+		if got := computeWeightedOverall(scores, getCriterionWeights(test.category, nil)); got != test.want {
+			t.Errorf("weighted overall for %q = %g, want %g", test.category, got, test.want)
+		}
+	}
+}
+
+func TestGrammarErrorDensity(t *testing.T) {
+	tests := []struct {
+		name      string
+		breakdown GrammarCategories
+		wordCount int
+		want      float64
+	}{
+		{"long essay", GrammarCategories{TenseErrors: 2, SpellingErrors: 1}, 300, 1},
+		{"short essay", GrammarCategories{TenseErrors: 2, SpellingErrors: 1}, 50, 6},
+		{"rounded", GrammarCategories{ArticleErrors: 1}, 300, 0.33},
+		{"no errors", GrammarCategories{}, 120, 0},
+		{"no words", GrammarCategories{PunctuationErrors: 4}, 0, 0},
+	}
+	for _, test := range tests {
+		if got := grammarErrorDensity(test.breakdown, test.wordCount); got != test.want {
+			t.Errorf("%s: density = %g, want %g", test.name, got, test.want)
+		}
+	}
+}
+
+func TestErrorDensityRating(t *testing.T) {
+	tests := []struct {
+		density float64
+		want    string
+	}{
+		{0, "excellent"},
+		{0.49, "excellent"},
+		{EXCELLENT_ERROR_DENSITY, "good"},
+		{0.99, "good"},
+		{GOOD_ERROR_DENSITY, "fair"},
+		{1.99, "fair"},
+		{FAIR_ERROR_DENSITY, "poor"},
+		{6, "poor"},
+	}
+	for _, test := range tests {
+		if got := errorDensityRating(test.density); got != test.want {
+			t.Errorf("errorDensityRating(%g) = %q, want %q", test.density, got, test.want)
+		}
+	}
+}
+
+func TestParseExcludeFields(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"corrected_version", []string{"corrected_version"}, false},
+		{" Suggestions , strength_points,,", []string{"suggestions", "strength_points"}, false},
+		{"corrected_version,scores", nil, true},
+		{"content", nil, true},
+	}
+	for _, test := range tests {
+		fields, err := parseExcludeFields(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseExcludeFields(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if len(fields) != len(test.want) {
+			t.Errorf("parseExcludeFields(%q) = %v, want %v", test.value, fields, test.want)
+		}
+		for _, field := range test.want {
+			if !fields[field] {
+				t.Errorf("parseExcludeFields(%q) is missing %s", test.value, field)
+			}
+		}
+	}
+}
+
+// A review of a 300-word essay, shaped like the ones Gemini returns
+func typicalReview() *ReviewResponse {
+	sentence := "Last summer my family and I goed to the beach near our city and we stayed there for three days. "
+	correctedSentence := "Last summer, my family and I went to the beach near our city, and we stayed there for three days. "
+	review := &ReviewResponse{
+		Content:          strings.Repeat(sentence, 15),
+		CorrectedVersion: strings.Repeat(correctedSentence, 15),
+		WordCount:        300,
+		EstimatedLevel:   "B1",
+		Scores:           ReviewCriteria{Grammar: 6, Vocabulary: 6.5, Coherence: 7, TaskResponse: 7, Overall: 6.5},
+		OverallFeedback:  "A clear and well organised story. Watch your past tense forms and use commas after introductory phrases.",
+		StrengthPoints:   []string{"Clear chronological order", "Good range of everyday vocabulary", "Relevant personal details"},
+		ImprovementAreas: []string{"Irregular past tense verbs", "Commas after introductory phrases", "More varied linking words"},
+	}
+	for i := 0; i < 5; i++ {
+		review.Suggestions = append(review.Suggestions, ReviewSuggestion{
+			Category:   "Grammar",
+			Issue:      "\"goed\" is not the past tense of \"go\"; irregular verbs have their own past forms.",
+			Suggestion: "Use \"went\" as the past tense of \"go\".",
+			Example:    correctedSentence,
+			Priority:   "High",
+		})
+	}
+	return review
+}
+
+func TestExcludeReviewFieldsSavesBytes(t *testing.T) {
+	review := typicalReview()
+	full, _ := json.Marshal(review)
+
+	withoutCorrected, _ := json.Marshal(excludeReviewFields(review, map[string]bool{"corrected_version": true}))
+	if saved := len(full) - len(withoutCorrected); saved < len(review.CorrectedVersion) {
+		t.Errorf("excluding corrected_version saved %d bytes, want at least %d", saved, len(review.CorrectedVersion))
+	}
+
+	all, _ := parseExcludeFields(strings.Join(excludableReviewFields, ","))
+	trimmed, _ := json.Marshal(excludeReviewFields(review, all))
+	if saving := 1 - float64(len(trimmed))/float64(len(full)); saving <= 0.5 {
+		t.Errorf("excluding %v saved %.0f%% of %d bytes, want more than 50%%", excludableReviewFields, saving*100, len(full))
+	}
+
+	if review.CorrectedVersion == "" || len(review.Suggestions) == 0 {
+		t.Error("excluding fields changed the cached review")
+	}
+}
+
+func TestCachedReviewExpires(t *testing.T) {
+	const cacheKey = "test-expiring-review"
+	now := time.Now()
+	cacheReview(cacheKey, &ReviewResponse{OverallFeedback: "cached"}, now)
+	defer func() {
+		reviewCacheMutex.Lock()
+		delete(reviewCache, cacheKey)
+		reviewCacheMutex.Unlock()
+	}()
+
+	if review, found := cachedReview(cacheKey, now.Add(CACHE_DURATION-time.Second)); !found || review.OverallFeedback != "cached" {
+		t.Errorf("before expiry: got %+v, %v, want the cached review", review, found)
+	}
+	if _, found := cachedReview(cacheKey, now.Add(CACHE_DURATION)); found {
+		t.Error("the review is still served after it expired")
+	}
+	if _, found := cachedReview("test-missing-review", now); found {
+		t.Error("found a review that was never cached")
+	}
+}
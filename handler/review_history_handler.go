@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The parts of a review used to personalize the chatbot
+type reviewHistoryEntry struct {
+	EstimatedLevel   string
+	ImprovementAreas []string
+	GrammarErrors    GrammarCategories
+	ReviewedAt       time.Time
+}
+
+const (
+	MAX_REVIEW_HISTORY             = 3   // Reviews kept per user
+	MAX_LEARNER_SUMMARY_WORDS      = 150 // Cap on the summary added to the chatbot prompt
+	MAX_SUMMARY_IMPROVEMENT_AREAS  = 3
+	MAX_SUMMARY_GRAMMAR_ERROR_TAGS = 3
+)
+
+// Most recent reviews per user ID, newest last
+var (
+	reviewHistory      = make(map[string][]reviewHistoryEntry)
+	reviewHistoryMutex sync.Mutex
+)
+
+// Keep a finished review for the user, dropping the oldest beyond MAX_REVIEW_HISTORY.
+func recordReviewHistory(userID string, review *ReviewResponse) {
+	if userID == "" || review == nil || review.Partial {
+		return
+	}
+
+	reviewHistoryMutex.Lock()
+	defer reviewHistoryMutex.Unlock()
+
+	entries := append(reviewHistory[userID], reviewHistoryEntry{
+		EstimatedLevel:   review.EstimatedLevel,
+		ImprovementAreas: review.ImprovementAreas,
+		GrammarErrors:    review.GrammarErrorBreakdown,
+		ReviewedAt:       review.GeneratedAt,
+	})
+	if len(entries) > MAX_REVIEW_HISTORY {
+		entries = entries[len(entries)-MAX_REVIEW_HISTORY:]
+	}
+	reviewHistory[userID] = entries
+}
+
+// A compact summary of the user's recent reviews for the chatbot system prompt,
+// or "" when the user has none. It is built from the current history on every
+// call, so new reviews are reflected straight away.
+func learnerReviewSummary(userID string) string {
+	reviewHistoryMutex.Lock()
+	entries := append([]reviewHistoryEntry(nil), reviewHistory[userID]...)
+	reviewHistoryMutex.Unlock()
+	if len(entries) == 0 {
+		return ""
+	}
+
+	levels := make([]string, len(entries))
+	var errorTotals GrammarCategories
+	areaCounts := make(map[string]int)
+	areaLatest := make(map[string]int)
+	var areas []string
+	for i, entry := range entries {
+		levels[i] = entry.EstimatedLevel
+		for j, count := range entry.GrammarErrors.counts() {
+			*errorTotals.fields()[j] += count
+		}
+		for _, area := range entry.ImprovementAreas {
+			area = strings.TrimSpace(area)
+			key := strings.ToLower(area)
+			if key == "" {
+				continue
+			}
+			if areaCounts[key] == 0 {
+				areas = append(areas, area)
+			}
+			areaCounts[key]++
+			areaLatest[key] = i
+		}
+	}
+
+	// Recurring areas first, then the most recent
+	sort.SliceStable(areas, func(i, j int) bool {
+		a, b := strings.ToLower(areas[i]), strings.ToLower(areas[j])
+		if areaCounts[a] != areaCounts[b] {
+			return areaCounts[a] > areaCounts[b]
+		}
+		return areaLatest[a] > areaLatest[b]
+	})
+	if len(areas) > MAX_SUMMARY_IMPROVEMENT_AREAS {
+		areas = areas[:MAX_SUMMARY_IMPROVEMENT_AREAS]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Estimated level in the last %d essay reviews (oldest first): %s.", len(entries), strings.Join(levels, ", ")))
+	if len(areas) > 0 {
+		sb.WriteString(" Areas to improve: " + strings.Join(areas, "; ") + ".")
+	}
+	if tags := frequentGrammarErrors(errorTotals); len(tags) > 0 {
+		sb.WriteString(" Frequent grammar errors: " + strings.Join(tags, ", ") + ".")
+	}
+
+	words := strings.Fields(sb.String())
+	if len(words) > MAX_LEARNER_SUMMARY_WORDS {
+		return strings.Join(words[:MAX_LEARNER_SUMMARY_WORDS], " ") + "…"
+	}
+	return strings.Join(words, " ")
+}
+
+// The most frequent grammar error types with their counts, e.g. "Tense (4)"
+func frequentGrammarErrors(totals GrammarCategories) []string {
+	counts := totals.counts()
+	order := make([]int, len(counts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return counts[order[i]] > counts[order[j]] })
+
+	var tags []string
+	for _, i := range order {
+		if counts[i] == 0 || len(tags) == MAX_SUMMARY_GRAMMAR_ERROR_TAGS {
+			break
+		}
+		tags = append(tags, fmt.Sprintf("%s (%d)", grammarErrorTypes[i].Name, counts[i]))
+	}
+	return tags
+}
@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"EngPal/internal"
+	"EngPal/utils"
+
+	"google.golang.org/genai"
+)
+
+// Data of a review stream event
+type ReviewStreamEvent struct {
+	Field          string          `json:"field"` // A ReviewResponse field, "done" or "error"
+	Value          json.RawMessage `json:"value,omitempty"`
+	ProcessingTime float64         `json:"processing_time_ms,omitempty"` // Only on "done"
+	Error          string          `json:"error,omitempty"`
+	Message        string          `json:"message,omitempty"`
+}
+
+// Review stream event names besides ReviewResponse fields
+const (
+	REVIEW_STREAM_DONE  = "done"
+	REVIEW_STREAM_ERROR = "error"
+)
+
+// Milliseconds a client should wait before reconnecting
+const REVIEW_STREAM_RETRY_MS = 3000
+
+// Fields that need local post-processing, so they are only sent from the final response
+var deferredReviewStreamFields = map[string]bool{
+	"suggestions":      true, // Filtered by priority and count
+	"cefr_descriptors": true, // Limited to known descriptor IDs
+
+	"sentence_grammar_annotations": true, // Checked against the content's sentences
+	"mnemonic_words":               true, // Only used to build "mnemonics"
+}
+
+// Fields only sent with ShowAlternativeVersions
+var alternativeVersionFields = map[string]bool{"enhanced_version": true, "native_version": true, "version_comparison": true}
+
+// A sent event, kept so a reconnecting client can resume after its Last-Event-ID
+type sentReviewStreamEvent struct {
+	ID   int
+	Data []byte
+}
+
+// The events of a finished stream, kept for CACHE_DURATION
+type reviewStreamEventsItem struct {
+	Events    []sentReviewStreamEvent
+	ExpiresAt time.Time
+}
+
+var (
+	reviewStreamEventsCache      = make(map[string]reviewStreamEventsItem)
+	reviewStreamEventsCacheMutex sync.RWMutex
+)
+
+// Writes review fields as Server-Sent Events, each with an increasing id
+type reviewEventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	req     GenerateCommentRequest
+	exclude map[string]bool
+	sent    map[string]bool
+	events  []sentReviewStreamEvent
+}
+
+// POST /api/review/generate-stream - streams review fields as they are generated
+func GenerateReviewStream(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var request GenerateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if request.ExtendedMode {
+		http.Error(w, "chế độ mở rộng không hỗ trợ phản hồi dạng stream, hãy dùng /api/review/generate", http.StatusBadRequest)
+		return
+	}
+	if err := validateReviewRequest(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if getTotalWords(request.Content) > MAX_SINGLE_REVIEW_WORDS {
+		http.Error(w, fmt.Sprintf("bài viết dài hơn %d từ không hỗ trợ phản hồi dạng stream, hãy dùng /api/review/generate", MAX_SINGLE_REVIEW_WORDS), http.StatusBadRequest)
+		return
+	}
+
+	excludeFields, err := parseExcludeFields(r.URL.Query().Get("exclude_fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", REVIEW_STREAM_RETRY_MS)
+	flusher.Flush()
+
+	stream := &reviewEventStream{w: w, flusher: flusher, req: request, exclude: excludeFields, sent: make(map[string]bool)}
+	cacheKey := generateReviewCacheKey(request)
+	eventsKey := reviewStreamEventsKey(cacheKey, request, excludeFields)
+	now := time.Now()
+
+	// Resume a finished stream after the client's last received event
+	if lastEventID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		reviewStreamEventsCacheMutex.RLock()
+		item, found := reviewStreamEventsCache[eventsKey]
+		reviewStreamEventsCacheMutex.RUnlock()
+		if found && item.ExpiresAt.After(now) {
+			logf(r, "Resuming review stream after event %d", lastEventID)
+			stream.replay(item.Events, lastEventID)
+			return
+		}
+	}
+
+	if cached, found := cachedReview(cacheKey, now); found {
+		logf(r, "Streaming cached review for content hash: %s", cacheKey[:10])
+		review := excludeReviewFields(restoreAnonymizedReview(withSubmittedContent(cached, request), request), excludeFields)
+		stream.sendReview(review)
+		stream.send(ReviewStreamEvent{Field: REVIEW_STREAM_DONE, ProcessingTime: float64(time.Since(startTime).Nanoseconds()) / 1e6})
+		cacheReviewStreamEvents(eventsKey, stream.events, now)
+		return
+	}
+
+	reviewResponse, err := streamReviewWithGemini(stream, startTime)
+	if err != nil {
+		logf(r, "Error streaming review: %v", err)
+		stream.send(ReviewStreamEvent{
+			Field:   REVIEW_STREAM_ERROR,
+			Error:   "service_unavailable",
+			Message: localizedMessage("review_service_unavailable", request.Language, PERSONA_ENGPAL, nil),
+		})
+		return
+	}
+
+	cacheReview(cacheKey, reviewResponse, now)
+	recordReviewHistory(request.UserID, reviewResponse)
+	recordScoreDistribution(reviewResponse)
+
+	// Send the fields that were deferred or computed locally
+	stream.sendReview(excludeReviewFields(restoreAnonymizedReview(reviewResponse, request), excludeFields))
+	stream.send(ReviewStreamEvent{Field: REVIEW_STREAM_DONE, ProcessingTime: float64(time.Since(startTime).Nanoseconds()) / 1e6})
+	cacheReviewStreamEvents(eventsKey, stream.events, now)
+
+	logf(r, "Streamed review for %d words, processing time: %.2fms",
+		reviewResponse.WordCount, reviewResponse.ProcessingTime)
+}
+
+// Stream the review from Gemini, sending each top-level field as soon as it is complete
+func streamReviewWithGemini(stream *reviewEventStream, startTime time.Time) (*ReviewResponse, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return nil, errors.New("Gemini client not initialized")
+	}
+
+	ctx := context.Background()
+	chunks := client.Models.GenerateContentStream(
+		ctx,
+		REVIEW_MODEL,
+		genai.Text(buildReviewPrompt(stream.req)),
+		&genai.GenerateContentConfig{ResponseMIMEType: "application/json"},
+	)
+
+	parser := &utils.PartialJSONParser{}
+	var fullText strings.Builder
+	for chunk, err := range chunks {
+		if err != nil {
+			return nil, fmt.Errorf("gemini API call failed: %w", err)
+		}
+		text := chunk.Text()
+		fullText.WriteString(text)
+		for _, field := range parser.Feed(text) {
+			stream.sendField(field, true)
+		}
+	}
+
+	return buildReviewResponse(ctx, fullText.String(), stream.req, startTime)
+}
+
+// Send a field unless it was already sent, excluded, or (for raw Gemini output) deferred
+func (s *reviewEventStream) sendField(field utils.JSONField, raw bool) {
+	if s.sent[field.Name] || s.exclude[field.Name] || (raw && deferredReviewStreamFields[field.Name]) {
+		return
+	}
+	if raw {
+		if !s.req.ContextualVocabularyCheck && field.Name == "contextual_vocabulary_issues" {
+			return
+		}
+		if !s.req.ShowAlternativeVersions && alternativeVersionFields[field.Name] {
+			return
+		}
+		field.Value = s.cleanRawValue(field)
+	}
+	s.sent[field.Name] = true
+	s.send(ReviewStreamEvent{Field: field.Name, Value: field.Value})
+}
+
+// Sanitize and de-anonymize a value straight from Gemini, as the final response would be
+func (s *reviewEventStream) cleanRawValue(field utils.JSONField) json.RawMessage {
+	value := string(field.Value)
+	if s.req.AnonymousMode && s.req.RestoreAfterAnonymization && len(s.req.anonymizedEntities) > 0 {
+		value = utils.RestoreText(value, s.req.anonymizedEntities)
+	}
+	if field.Name == "overall_feedback" || field.Name == "focused_feedback" {
+		var feedback string
+		if err := json.Unmarshal([]byte(value), &feedback); err == nil {
+			sanitized, _ := json.Marshal(utils.SanitizeMarkdown(feedback))
+			value = string(sanitized)
+		}
+	}
+	return json.RawMessage(value)
+}
+
+// Send every field of the review that has not been sent yet, in response order
+func (s *reviewEventStream) sendReview(review *ReviewResponse) {
+	body, err := json.Marshal(review)
+	if err != nil {
+		log.Printf("Error encoding streamed review: %v", err)
+		return
+	}
+	parser := &utils.PartialJSONParser{}
+	for _, field := range parser.Feed(string(body)) {
+		s.sendField(field, false)
+	}
+}
+
+// Write one event and remember it for reconnecting clients
+func (s *reviewEventStream) send(event ReviewStreamEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding review stream event: %v", err)
+		return
+	}
+	id := len(s.events) + 1
+	s.events = append(s.events, sentReviewStreamEvent{ID: id, Data: data})
+	fmt.Fprintf(s.w, "id: %d\ndata: %s\n\n", id, data)
+	s.flusher.Flush()
+}
+
+// Resend the recorded events after lastEventID
+func (s *reviewEventStream) replay(events []sentReviewStreamEvent, lastEventID int) {
+	for _, event := range events {
+		if event.ID > lastEventID {
+			fmt.Fprintf(s.w, "id: %d\ndata: %s\n\n", event.ID, event.Data)
+		}
+	}
+	s.flusher.Flush()
+}
+
+// Keep a finished stream's events so reconnecting clients can resume it
+func cacheReviewStreamEvents(eventsKey string, events []sentReviewStreamEvent, now time.Time) {
+	reviewStreamEventsCacheMutex.Lock()
+	reviewStreamEventsCache[eventsKey] = reviewStreamEventsItem{Events: events, ExpiresAt: now.Add(CACHE_DURATION)}
+	reviewStreamEventsCacheMutex.Unlock()
+}
+
+// Cache key of the recorded events, which depend on the excluded fields and name restoring too
+func reviewStreamEventsKey(cacheKey string, req GenerateCommentRequest, exclude map[string]bool) string {
+	fields := make([]string, 0, len(exclude))
+	for field := range exclude {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "stream-" + cacheKey + "-" + strings.Join(fields, ",") + "-" + strconv.FormatBool(req.RestoreAfterAnonymization)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateReviewStreamResumesAfterLastEvent(t *testing.T) {
+	request := GenerateCommentRequest{Content: cacheKeyTestEssay}
+	if err := validateReviewRequest(&request); err != nil {
+		t.Fatal(err)
+	}
+	eventsKey := reviewStreamEventsKey(generateReviewCacheKey(request), request, map[string]bool{})
+	cacheReviewStreamEvents(eventsKey, []sentReviewStreamEvent{
+		{ID: 1, Data: []byte(`{"field":"overall_feedback"}`)},
+		{ID: 2, Data: []byte(`{"field":"band_score"}`)},
+		{ID: 3, Data: []byte(`{"field":"done"}`)},
+	}, time.Now())
+	defer func() {
+		reviewStreamEventsCacheMutex.Lock()
+		delete(reviewStreamEventsCache, eventsKey)
+		reviewStreamEventsCacheMutex.Unlock()
+	}()
+
+	body, _ := json.Marshal(request)
+	httpRequest := httptest.NewRequest(http.MethodPost, "/api/review/generate-stream", strings.NewReader(string(body)))
+	httpRequest.Header.Set("Last-Event-ID", "1")
+	recorder := httptest.NewRecorder()
+	GenerateReviewStream(recorder, httpRequest)
+
+	stream := recorder.Body.String()
+	if strings.Contains(stream, "id: 1\n") {
+		t.Errorf("the stream resent an event the client already had:\n%s", stream)
+	}
+	if !strings.Contains(stream, "id: 2\ndata: {\"field\":\"band_score\"}\n\n") || !strings.Contains(stream, "id: 3\n") {
+		t.Errorf("the stream did not resume after event 1:\n%s", stream)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"EngPal/data"
+)
+
+// A built-in scoring rubric from data/rubrics
+type ScoringRubric struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Text        string `json:"-"` // Scoring instructions added to the review prompt
+}
+
+const (
+	CUSTOM_RUBRIC            = "custom"
+	MAX_CUSTOM_RUBRIC_LENGTH = 500 // Characters
+)
+
+// Built-in rubrics by name, loaded from the embedded files at startup
+var rubricStore = loadRubrics()
+
+func loadRubrics() map[string]ScoringRubric {
+	files, err := fs.Glob(data.Rubrics, "rubrics/*.txt")
+	if err != nil {
+		log.Fatalf("Failed to list scoring rubrics: %v", err)
+	}
+
+	rubrics := make(map[string]ScoringRubric)
+	for _, file := range files {
+		content, err := fs.ReadFile(data.Rubrics, file)
+		if err != nil {
+			log.Fatalf("Failed to load scoring rubric %s: %v", file, err)
+		}
+		description, text, _ := strings.Cut(strings.TrimSpace(string(content)), "\n")
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+		rubrics[name] = ScoringRubric{
+			Name:        name,
+			Description: strings.TrimSpace(description),
+			Text:        strings.TrimSpace(text),
+		}
+	}
+	return rubrics
+}
+
+// Names of the built-in rubrics in alphabetical order
+func rubricNames() []string {
+	names := make([]string, 0, len(rubricStore))
+	for name := range rubricStore {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Scoring instructions for the request's rubric, or "" for the default scoring
+func activeRubricText(req GenerateCommentRequest) string {
+	if req.ScoringRubric == CUSTOM_RUBRIC {
+		return req.CustomRubric
+	}
+	return rubricStore[req.ScoringRubric].Text
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"strings"
+
+	"EngPal/utils"
+)
+
+// A point an examiner checks, with the question the student should have asked
+// themselves before submitting
+type ChecklistItem struct {
+	Criterion        string `json:"criterion"` // grammar, vocabulary, coherence, task_response
+	Question         string `json:"question"`  // What the examiner looks for
+	StudentShouldAsk string `json:"student_should_ask"`
+	WasAchieved      bool   `json:"was_achieved"` // Judged from the review
+}
+
+const (
+	// Criterion score from which a checklist point counts as achieved
+	CHECKLIST_ACHIEVED_SCORE = 7.0
+	// Introduction, body and conclusion
+	CHECKLIST_MIN_PARAGRAPHS = 3
+)
+
+type checklistCheck struct {
+	ChecklistItem
+	achieved func(review *ReviewResponse) bool
+}
+
+// Checklist points by ID; WasAchieved is filled in from the review
+var checklistChecks = map[string]checklistCheck{
+	"task_parts": {
+		ChecklistItem{Criterion: "task_response", Question: "Are all parts of the task addressed?", StudentShouldAsk: "Did I address all parts of the task?"},
+		func(review *ReviewResponse) bool { return review.Scores.TaskResponse >= CHECKLIST_ACHIEVED_SCORE },
+	},
+	"clear_position": {
+		ChecklistItem{Criterion: "task_response", Question: "Is the writer's position clear throughout?", StudentShouldAsk: "Did I state my opinion in the introduction and keep to it until the conclusion?"},
+		func(review *ReviewResponse) bool { return review.Scores.TaskResponse >= CHECKLIST_ACHIEVED_SCORE },
+	},
+	"evidence": {
+		ChecklistItem{Criterion: "task_response", Question: "Are the main ideas supported with examples or evidence?", StudentShouldAsk: "Did I support each main idea with an example or a source?"},
+		func(review *ReviewResponse) bool {
+			if review.CitationAnalysis != nil && review.CitationAnalysis.MissingCitations {
+				return false
+			}
+			return review.Scores.TaskResponse >= CHECKLIST_ACHIEVED_SCORE
+		},
+	},
+	"letter_purpose": {
+		ChecklistItem{Criterion: "task_response", Question: "Is the reason for writing clear from the start?", StudentShouldAsk: "Did I say why I am writing in the first paragraph?"},
+		func(review *ReviewResponse) bool { return review.Scores.TaskResponse >= CHECKLIST_ACHIEVED_SCORE },
+	},
+	"register": {
+		ChecklistItem{Criterion: "task_response", Question: "Is the tone right for the reader?", StudentShouldAsk: "Did I use the right level of formality for the person I am writing to?"},
+		func(review *ReviewResponse) bool {
+			return len(review.ContextualVocabularyIssues) == 0 && review.Scores.TaskResponse >= CHECKLIST_ACHIEVED_SCORE
+		},
+	},
+	"paragraphing": {
+		ChecklistItem{Criterion: "coherence", Question: "Is the text organised into paragraphs?", StudentShouldAsk: "Did I divide my writing into an introduction, body paragraphs and a conclusion?"},
+		func(review *ReviewResponse) bool {
+			return len(utils.SplitParagraphs(review.Content)) >= CHECKLIST_MIN_PARAGRAPHS
+		},
+	},
+	"topic_sentences": {
+		ChecklistItem{Criterion: "coherence", Question: "Does each paragraph have one clear central idea?", StudentShouldAsk: "Did I start each paragraph with a topic sentence?"},
+		func(review *ReviewResponse) bool { return review.Scores.Coherence >= CHECKLIST_ACHIEVED_SCORE },
+	},
+	"linking": {
+		ChecklistItem{Criterion: "coherence", Question: "Are ideas linked with a range of cohesive devices and clear references?", StudentShouldAsk: "Did I connect my ideas with linking words other than \"and\" and \"but\", and is it clear who \"he\", \"she\" and \"it\" refer to?"},
+		func(review *ReviewResponse) bool {
+			return review.Scores.Coherence >= CHECKLIST_ACHIEVED_SCORE && review.Scores.PronounReferenceScore >= CHECKLIST_ACHIEVED_SCORE
+		},
+	},
+	"vocabulary_range": {
+		ChecklistItem{Criterion: "vocabulary", Question: "Is a wide range of vocabulary used precisely?", StudentShouldAsk: "Did I use precise words instead of repeating the same simple ones?"},
+		func(review *ReviewResponse) bool { return review.Scores.Vocabulary >= CHECKLIST_ACHIEVED_SCORE },
+	},
+	"vivid_detail": {
+		ChecklistItem{Criterion: "vocabulary", Question: "Are events and places described vividly?", StudentShouldAsk: "Did I use descriptive words that help the reader picture the scene?"},
+		func(review *ReviewResponse) bool { return review.Scores.Vocabulary >= CHECKLIST_ACHIEVED_SCORE },
+	},
+	"collocations": {
+		ChecklistItem{Criterion: "vocabulary", Question: "Do words combine naturally?", StudentShouldAsk: "Did I use natural word combinations, such as \"make a decision\" rather than \"do a decision\"?"},
+		func(review *ReviewResponse) bool { return len(review.CollocationErrors) == 0 },
+	},
+	"grammar_accuracy": {
+		ChecklistItem{Criterion: "grammar", Question: "Are most sentences free of errors?", StudentShouldAsk: "Did I check every sentence for tense, article and subject-verb agreement errors?"},
+		func(review *ReviewResponse) bool {
+			return review.ErrorDensityRating == "excellent" || review.ErrorDensityRating == "good"
+		},
+	},
+	"sentence_variety": {
+		ChecklistItem{Criterion: "grammar", Question: "Is there a mix of simple and complex sentences?", StudentShouldAsk: "Did I mix short sentences with longer ones joined by words like \"because\", \"although\" or \"which\"?"},
+		func(review *ReviewResponse) bool { return review.SentenceVarietyScore >= CHECKLIST_ACHIEVED_SCORE },
+	},
+	"spelling_punctuation": {
+		ChecklistItem{Criterion: "grammar", Question: "Are spelling and punctuation accurate?", StudentShouldAsk: "Did I proofread my spelling and punctuation before submitting?"},
+		func(review *ReviewResponse) bool {
+			return review.GrammarErrorBreakdown.SpellingErrors+review.GrammarErrorBreakdown.PunctuationErrors == 0
+		},
+	},
+}
+
+var essayChecklist = []string{
+	"task_parts", "clear_position", "evidence", "paragraphing", "topic_sentences",
+	"linking", "vocabulary_range", "collocations", "grammar_accuracy", "sentence_variety",
+}
+
+var letterChecklist = []string{
+	"letter_purpose", "task_parts", "register", "paragraphing", "linking",
+	"vocabulary_range", "collocations", "grammar_accuracy", "spelling_punctuation",
+}
+
+var narrativeChecklist = []string{
+	"task_parts", "vivid_detail", "paragraphing", "linking", "vocabulary_range",
+	"collocations", "sentence_variety", "grammar_accuracy",
+}
+
+// Checklist points per writing category, in order
+var categoryChecklists = map[string][]string{
+	"essay":   essayChecklist,
+	"opinion": essayChecklist,
+	"report": {
+		"task_parts", "evidence", "paragraphing", "topic_sentences", "linking",
+		"vocabulary_range", "grammar_accuracy", "spelling_punctuation",
+	},
+	"letter":      letterChecklist,
+	"email":       letterChecklist,
+	"story":       narrativeChecklist,
+	"description": narrativeChecklist,
+	"article":     narrativeChecklist,
+}
+
+// For general writing and unknown categories
+var defaultChecklist = []string{
+	"task_parts", "paragraphing", "linking", "vocabulary_range",
+	"collocations", "grammar_accuracy", "sentence_variety", "spelling_punctuation",
+}
+
+// The self-assessment checklist for the writing category, each point marked as
+// achieved or not from the rest of the review
+func buildSelfAssessmentChecklist(category string, review *ReviewResponse) []ChecklistItem {
+	ids, exists := categoryChecklists[strings.ToLower(strings.TrimSpace(category))]
+	if !exists {
+		ids = defaultChecklist
+	}
+
+	checklist := make([]ChecklistItem, len(ids))
+	for i, id := range ids {
+		check := checklistChecks[id]
+		checklist[i] = check.ChecklistItem
+		checklist[i].WasAchieved = check.achieved(review)
+	}
+	return checklist
+}
@@ -0,0 +1,1013 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"EngPal/data"
+	"EngPal/internal"
+	"EngPal/internal/config"
+	"EngPal/security"
+	"EngPal/utils"
+
+	"google.golang.org/genai"
+)
+
+// Request/Response types
+type PassageDifficultyRequest struct {
+	Passage     string `json:"passage"`
+	TargetLevel string `json:"target_level"`
+}
+
+type PassageMetrics struct {
+	SentenceCount           int     `json:"sentence_count"`
+	WordCount               int     `json:"word_count"`
+	AverageWordsPerSentence float64 `json:"average_words_per_sentence"`
+	OffListPercent          float64 `json:"off_list_percent"` // Words outside the GSL
+	AverageSyllablesPerWord float64 `json:"average_syllables_per_word"`
+	FleschKincaidGrade      float64 `json:"flesch_kincaid_grade"`
+	FleschReadingEase       float64 `json:"flesch_reading_ease"`
+}
+
+type PassageDifficultyResponse struct {
+	TargetLevel               string         `json:"target_level"`
+	Metrics                   PassageMetrics `json:"metrics"`
+	CEFRLevel                 string         `json:"cefr_level"`
+	SuitableForTarget         bool           `json:"suitable_for_target"`
+	SimplificationSuggestions []string       `json:"simplification_suggestions"`
+	VocabularyChallenges      []string       `json:"vocabulary_challenges"`
+	SentenceComplexityIssues  []string       `json:"sentence_complexity_issues"`
+}
+
+type CountDiscourseMarkersRequest struct {
+	Text string `json:"text"`
+}
+
+type CountDiscourseMarkersResponse struct {
+	TotalCount         int            `json:"total_count"`
+	ByFunction         map[string]int `json:"by_function"`   // additive, adversative, causal, ...
+	MarkersFound       []string       `json:"markers_found"` // Distinct markers in order of appearance
+	DensityPer100Words float64        `json:"density_per_100_words"`
+}
+
+type DetectCommaSplicesRequest struct {
+	Text string `json:"text"`
+}
+
+type DetectCommaSplicesResponse struct {
+	CommaSplices []utils.CommaSplice `json:"comma_splices"`
+	Count        int                 `json:"count"`
+}
+
+type ExtractTextFromImageRequest struct {
+	ImageUpload
+	LanguageHint string `json:"language_hint,omitempty"` // Expected languages, e.g. "Vietnamese and English"
+}
+
+type ExtractTextFromImageResponse struct {
+	FullText          string      `json:"full_text"`            // The blocks separated by blank lines
+	DetectedLanguages []string    `json:"detected_languages"`   // ISO 639-1 codes, most text first
+	Blocks            []TextBlock `json:"blocks"`               // Paragraph-level text in reading order
+	Confidence        string      `json:"confidence"`           // high, medium, low
+	Downscaled        bool        `json:"downscaled,omitempty"` // The image was shrunk before extraction
+	Cached            bool        `json:"cached,omitempty"`     // Served from an earlier upload of the same image
+}
+
+type TextBlock struct {
+	Text     string `json:"text"`
+	Language string `json:"language"` // ISO 639-1, e.g. "vi"
+}
+
+// Response of ?raw=true, the text extraction shape before blocks were added
+type RawExtractedTextResponse struct {
+	Text       string `json:"text"`
+	Language   string `json:"language"`
+	Downscaled bool   `json:"downscaled,omitempty"`
+}
+
+// How legible Gemini found the text of an image
+const (
+	OCR_CONFIDENCE_HIGH   = "high"
+	OCR_CONFIDENCE_MEDIUM = "medium"
+	OCR_CONFIDENCE_LOW    = "low"
+)
+
+const MAX_LANGUAGE_HINT_LENGTH = 50
+
+// Models tried in order for text extraction while the earlier ones are overloaded
+var ocrModels = []string{"gemini-2.0-flash", "gemini-2.0-flash-lite"}
+
+type GenerateCohesiveDeviceQuizRequest struct {
+	Level      string `json:"level"`
+	DeviceType string `json:"device_type,omitempty"` // additive, adversative, causal, temporal or all (default)
+	Count      int    `json:"count,omitempty"`       // 1-MAX_COHESIVE_QUIZ_COUNT (default 5)
+}
+
+// Gemini's sentence for one target device
+type GeminiCohesiveSentence struct {
+	Device      string `json:"device"`
+	Sentence    string `json:"sentence"` // With COHESIVE_DEVICE_BLANK where the device goes
+	Explanation string `json:"explanation"`
+}
+
+const (
+	COHESIVE_DEVICE_QUIZ_TYPE        = "Cohesive Device"
+	COHESIVE_DEVICE_BLANK            = "_____"
+	COHESIVE_DEVICE_OPTIONS          = 4
+	DEFAULT_COHESIVE_QUIZ_COUNT      = 5
+	MAX_COHESIVE_QUIZ_COUNT          = 10
+	DEFAULT_COHESIVE_DEVICE_TYPE     = "all"
+	COHESIVE_DEVICE_QUIZ_TIMEOUT     = 30 * time.Second
+	COHESIVE_DEVICE_QUIZ_TOPIC       = "Cohesive devices"
+	COHESIVE_DEVICE_QUIZ_TEMPERATURE = 0.8
+)
+
+// Discourse functions practised by the cohesive device quiz
+var cohesiveDeviceTypes = []string{"additive", "adversative", "causal", "temporal"}
+
+type AnalyzeReadabilityRequest struct {
+	Text string `json:"text"`
+}
+
+type AnalyzeReadabilityResponse struct {
+	FleschKincaidGrade float64 `json:"flesch_kincaid_grade"`
+	FleschReadingEase  float64 `json:"flesch_reading_ease"` // 0-100, higher is easier
+	GunningFog         float64 `json:"gunning_fog"`
+	SMOG               float64 `json:"smog"`
+	LinsearWrite       float64 `json:"linsear_write"`
+	ColemanLiau        float64 `json:"coleman_liau"`
+
+	// Consensus over the grade-level metrics (all but reading ease, which has another scale)
+	MinScore     float64 `json:"min_score"`
+	MaxScore     float64 `json:"max_score"`
+	AverageScore float64 `json:"average_score"`
+}
+
+type AnalyzePassiveVoiceRequest struct {
+	Text        string `json:"text"`
+	WritingType string `json:"writing_type,omitempty"` // exam, academic, professional, personal, creative (default academic)
+}
+
+type AnalyzePassiveVoiceResponse struct {
+	PassiveCount      int                     `json:"passive_count"`
+	PassivePercentage float64                 `json:"passive_percentage"` // Share of sentences with a passive
+	Instances         []utils.PassiveInstance `json:"instances"`
+	Verdict           string                  `json:"verdict"` // appropriate, overused, underused
+}
+
+// Gemini API structures for passage analysis
+type GeminiPassageData struct {
+	CEFRLevel                 string   `json:"cefr_level"`
+	SuitableForTarget         bool     `json:"suitable_for_target"`
+	SimplificationSuggestions []string `json:"simplification_suggestions"`
+	VocabularyChallenges      []string `json:"vocabulary_challenges"`
+	SentenceComplexityIssues  []string `json:"sentence_complexity_issues"`
+}
+
+// Constants
+const (
+	MAX_PASSAGE_WORDS     = 2000
+	DEFAULT_GSL_LIST_SIZE = 100
+)
+
+// Acceptable share of passive sentences (%) by writing type
+var passiveVoiceRanges = map[string][2]float64{
+	"academic":     {10, 20},
+	"exam":         {5, 15},
+	"professional": {5, 15},
+	"personal":     {0, 10},
+	"creative":     {0, 10},
+}
+
+const DEFAULT_PASSIVE_WRITING_TYPE = "academic"
+
+// General Service List loaded from the embedded data file
+var gslWords, gslSet = loadGSL()
+
+func loadGSL() ([]string, map[string]bool) {
+	var words []string
+	set := make(map[string]bool)
+	for _, line := range strings.Split(data.GSL, "\n") {
+		word := strings.ToLower(strings.TrimSpace(line))
+		if word == "" || set[word] {
+			continue
+		}
+		words = append(words, word)
+		set[word] = true
+	}
+	return words, set
+}
+
+// Discourse markers loaded from the embedded data file
+var discourseMarkersByFunction, discourseMarkerFunctions, discourseMarkerPattern = loadDiscourseMarkers()
+
+func loadDiscourseMarkers() (map[string][]string, map[string]string, *regexp.Regexp) {
+	var byFunction map[string][]string
+	if err := json.Unmarshal(data.DiscourseMarkers, &byFunction); err != nil {
+		log.Fatalf("Failed to load discourse markers: %v", err)
+	}
+
+	functions := make(map[string]string)
+	var markers []string
+	for function, list := range byFunction {
+		for _, marker := range list {
+			functions[marker] = function
+			markers = append(markers, marker)
+		}
+	}
+
+	// Longest markers first so "even though" wins over "though"
+	sort.Slice(markers, func(i, j int) bool {
+		if len(markers[i]) != len(markers[j]) {
+			return len(markers[i]) > len(markers[j])
+		}
+		return markers[i] < markers[j]
+	})
+	alternatives := make([]string, len(markers))
+	for i, marker := range markers {
+		alternatives[i] = strings.ReplaceAll(regexp.QuoteMeta(marker), " ", `\s+`)
+	}
+	return byFunction, functions, regexp.MustCompile(`(?i)\b(?:` + strings.Join(alternatives, "|") + `)\b`)
+}
+
+// --- MAIN HANDLER ---
+
+func AnalysePassageDifficulty(w http.ResponseWriter, r *http.Request) {
+	var request PassageDifficultyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if err := validatePassageRequest(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Compute local signals before asking Gemini
+	metrics := computePassageMetrics(request.Passage)
+
+	analysis, err := analysePassageWithGemini(request, metrics)
+	if err != nil {
+		logf(r, "Error analysing passage: %v", err)
+		http.Error(w, "Failed to analyse passage", http.StatusInternalServerError)
+		return
+	}
+
+	response := PassageDifficultyResponse{
+		TargetLevel:               request.TargetLevel,
+		Metrics:                   metrics,
+		CEFRLevel:                 analysis.CEFRLevel,
+		SuitableForTarget:         analysis.SuitableForTarget,
+		SimplificationSuggestions: analysis.SimplificationSuggestions,
+		VocabularyChallenges:      analysis.VocabularyChallenges,
+		SentenceComplexityIssues:  analysis.SentenceComplexityIssues,
+	}
+
+	logf(r, "Analysed passage of %d words: %s (target %s)", metrics.WordCount, response.CEFRLevel, request.TargetLevel)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Validate passage request
+func validatePassageRequest(request *PassageDifficultyRequest) error {
+	request.Passage = strings.TrimSpace(request.Passage)
+	if request.Passage == "" {
+		return errors.New("đoạn văn không được để trống")
+	}
+	if utils.GetTotalWords(request.Passage) > MAX_PASSAGE_WORDS {
+		return fmt.Errorf("đoạn văn không được dài hơn %d từ", MAX_PASSAGE_WORDS)
+	}
+
+	request.TargetLevel = strings.ToUpper(strings.TrimSpace(request.TargetLevel))
+	if _, exists := reviewEnglishLevels[request.TargetLevel]; !exists {
+		return errors.New("trình độ mục tiêu không hợp lệ (A1, A2, B1, B2, C1, C2)")
+	}
+	return nil
+}
+
+// Compute readability signals locally
+func computePassageMetrics(passage string) PassageMetrics {
+	sentences := utils.SplitSentences(passage)
+	words := utils.ExtractWords(passage)
+
+	metrics := PassageMetrics{
+		SentenceCount: len(sentences),
+		WordCount:     len(words),
+	}
+	if len(sentences) > 0 {
+		metrics.AverageWordsPerSentence = roundTo(float64(len(words))/float64(len(sentences)), 2)
+	}
+
+	offList := 0
+	counted := 0
+	for _, word := range words {
+		if _, err := strconv.ParseFloat(word, 64); err == nil {
+			continue // Numbers are not vocabulary
+		}
+		counted++
+		if !isGSLWord(word) {
+			offList++
+		}
+	}
+	if counted > 0 {
+		metrics.OffListPercent = roundTo(float64(offList)/float64(counted)*100, 2)
+	}
+
+	grade, ease := computeFleschKincaid(passage)
+	metrics.AverageSyllablesPerWord = roundTo(utils.AverageSyllablesPerWord(passage), 2)
+	metrics.FleschKincaidGrade = roundTo(grade, 2)
+	metrics.FleschReadingEase = roundTo(ease, 2)
+
+	return metrics
+}
+
+// Compute the Flesch-Kincaid grade level and reading ease for a passage
+func computeFleschKincaid(passage string) (grade float64, readingEase float64) {
+	return utils.FleschKincaidGrade(passage), utils.FleschReadingEase(passage)
+}
+
+// Check a word against the GSL, allowing common inflections of a headword
+func isGSLWord(word string) bool {
+	word = strings.ToLower(word)
+	if gslSet[word] {
+		return true
+	}
+
+	candidates := []string{}
+	if strings.HasSuffix(word, "ies") {
+		candidates = append(candidates, strings.TrimSuffix(word, "ies")+"y")
+	}
+	if strings.HasSuffix(word, "ied") {
+		candidates = append(candidates, strings.TrimSuffix(word, "ied")+"y")
+	}
+	for _, suffix := range []string{"s", "es", "ed", "d", "ing", "ly", "er", "est", "'s"} {
+		if strings.HasSuffix(word, suffix) && len(word) > len(suffix)+2 {
+			stem := strings.TrimSuffix(word, suffix)
+			candidates = append(candidates, stem, stem+"e")
+			// Doubled consonant: "stopped" -> "stop"
+			if len(stem) > 2 && stem[len(stem)-1] == stem[len(stem)-2] {
+				candidates = append(candidates, stem[:len(stem)-1])
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		if gslSet[candidate] {
+			return true
+		}
+	}
+	return false
+}
+
+// Ask Gemini for a CEFR judgement based on the passage and local signals
+func analysePassageWithGemini(req PassageDifficultyRequest, metrics PassageMetrics) (*GeminiPassageData, error) {
+	prompt := buildPassagePrompt(req, metrics)
+
+	geminiResp, err := callGeminiForText(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("gemini API call failed: %w", err)
+	}
+
+	// Clean the response
+	geminiResp = strings.TrimSpace(geminiResp)
+	geminiResp = strings.TrimPrefix(geminiResp, "```json")
+	geminiResp = strings.TrimSuffix(geminiResp, "```")
+	geminiResp = strings.TrimSpace(geminiResp)
+
+	var passageData GeminiPassageData
+	if err := json.Unmarshal([]byte(geminiResp), &passageData); err != nil {
+		log.Printf("Failed to parse passage JSON response: %s", geminiResp)
+		return nil, fmt.Errorf("failed to parse passage JSON: %w", err)
+	}
+	if passageData.CEFRLevel == "" {
+		return nil, errors.New("missing cefr_level in API response")
+	}
+
+	return &passageData, nil
+}
+
+// Build passage difficulty prompt for Gemini
+func buildPassagePrompt(req PassageDifficultyRequest, metrics PassageMetrics) string {
+	return fmt.Sprintf(`You are an experienced English teacher who grades reading materials against the CEFR scale.
+
+READING PASSAGE:
+"%s"
+
+TARGET CLASS LEVEL: %s
+
+PRE-COMPUTED SIGNALS:
+- Sentences: %d
+- Words: %d
+- Average words per sentence: %.2f
+- Words outside the General Service List: %.2f%%
+- Average syllables per word: %.2f
+- Flesch-Kincaid grade level: %.2f
+- Flesch reading ease: %.2f
+
+TASK:
+1. Estimate the CEFR level of the passage (A1, A2, B1, B2, C1 or C2), using the signals above together with your own reading
+2. Decide whether the passage is suitable for a %s class
+3. List concrete suggestions to simplify the passage for the target level
+4. List the words or phrases likely to challenge the target students
+5. List the sentences or structures that are too complex for the target level
+
+FORMATTING REQUIREMENTS:
+Return ONLY valid JSON without markdown formatting, using this exact structure:
+{
+  "cefr_level": "B2",
+  "suitable_for_target": false,
+  "simplification_suggestions": ["..."],
+  "vocabulary_challenges": ["..."],
+  "sentence_complexity_issues": ["..."]
+}`, req.Passage, req.TargetLevel, metrics.SentenceCount, metrics.WordCount, metrics.AverageWordsPerSentence,
+		metrics.OffListPercent, metrics.AverageSyllablesPerWord, metrics.FleschKincaidGrade, metrics.FleschReadingEase,
+		req.TargetLevel)
+}
+
+// Call Gemini API for text analysis
+func callGeminiForText(prompt string) (string, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return "", errors.New("Gemini client not initialized")
+	}
+
+	ctx := context.Background()
+	result, err := client.Models.GenerateContent(
+		ctx,
+		"gemini-2.0-flash",
+		genai.Text(prompt),
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	return result.Text(), nil
+}
+
+// Round a value to the given number of decimal places
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+// --- ADDITIONAL ENDPOINTS ---
+
+// POST /api/text/discourse-markers
+func CountDiscourseMarkers(w http.ResponseWriter, r *http.Request) {
+	var request CountDiscourseMarkersRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if strings.TrimSpace(request.Text) == "" {
+		http.Error(w, "văn bản không được để trống", http.StatusBadRequest)
+		return
+	}
+	if utils.GetTotalWords(request.Text) > MAX_PASSAGE_WORDS {
+		http.Error(w, fmt.Sprintf("văn bản không được dài hơn %d từ", MAX_PASSAGE_WORDS), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countDiscourseMarkers(request.Text))
+}
+
+// POST /api/text/comma-splice
+func DetectCommaSplices(w http.ResponseWriter, r *http.Request) {
+	var request DetectCommaSplicesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if strings.TrimSpace(request.Text) == "" {
+		http.Error(w, "văn bản không được để trống", http.StatusBadRequest)
+		return
+	}
+	if utils.GetTotalWords(request.Text) > MAX_PASSAGE_WORDS {
+		http.Error(w, fmt.Sprintf("văn bản không được dài hơn %d từ", MAX_PASSAGE_WORDS), http.StatusBadRequest)
+		return
+	}
+
+	splices := utils.FindCommaSplices(request.Text)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DetectCommaSplicesResponse{CommaSplices: splices, Count: len(splices)})
+}
+
+// POST /api/text/extract-from-image - reads the text in a photo with Gemini vision
+func ExtractTextFromImage(w http.ResponseWriter, r *http.Request) {
+	var request ExtractTextFromImageRequest
+	data, mimeType, err := readImageUpload(w, r, &request, &request.ImageUpload)
+	if err != nil {
+		writeImageUploadError(w, request.Language, err)
+		return
+	}
+	if r.MultipartForm != nil {
+		request.LanguageHint = r.FormValue("language_hint")
+	}
+	request.LanguageHint = strings.TrimSpace(request.LanguageHint)
+	if utf8.RuneCountInString(request.LanguageHint) > MAX_LANGUAGE_HINT_LENGTH {
+		http.Error(w, fmt.Sprintf("gợi ý ngôn ngữ không được dài hơn %d ký tự", MAX_LANGUAGE_HINT_LENGTH), http.StatusBadRequest)
+		return
+	}
+
+	// The same photo is often uploaded again, by retries or by several students
+	cacheKey := ocrCacheKey(data, request.LanguageHint)
+	extracted, found := cachedExtraction(cacheKey)
+	if !found {
+		// Large photos cost more tokens and time without reading any better
+		downscaledData, downscaled, err := utils.DownscaleImage(data, mimeType, config.ImageDownscaleDimension())
+		if err != nil {
+			writeImageUploadError(w, request.Language, err)
+			return
+		}
+
+		extracted, err = extractTextWithGemini(r.Context(), genai.NewPartFromBytes(downscaledData, mimeType), request.LanguageHint)
+		if err != nil {
+			logf(r, "Error extracting text from image for key %s: %v", security.Fingerprint(AccessKey(r)), err)
+			writeLocalizedError(w, http.StatusServiceUnavailable, "text_extraction_failed", request.Language, PERSONA_TEACHER, nil)
+			return
+		}
+		extracted.Downscaled = downscaled
+		storeExtraction(cacheKey, extracted)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("raw") == "true" {
+		// Deprecated: the plain text shape, kept for one release
+		language := ""
+		if len(extracted.DetectedLanguages) > 0 {
+			language = extracted.DetectedLanguages[0]
+		}
+		json.NewEncoder(w).Encode(RawExtractedTextResponse{Text: extracted.FullText, Language: language, Downscaled: extracted.Downscaled})
+		return
+	}
+	json.NewEncoder(w).Encode(extracted)
+}
+
+// Ask Gemini for the text blocks of an image in reading order, their languages and
+// how legible the text was. The full text is joined from the blocks locally.
+func extractTextWithGemini(ctx context.Context, image *genai.Part, languageHint string) (*ExtractTextFromImageResponse, error) {
+	prompt := `Extract all the text in this image exactly as written.
+- "blocks": one item per paragraph (or heading, caption, list item) in reading order, with "text" (keeping its line breaks) and "language" (ISO 639-1 code)
+- "confidence": "high" if all text is clearly legible, "medium" if some words had to be guessed, "low" if much of it is unclear
+Do not describe the image, translate, correct or summarize the text. If there is no text, return no blocks.`
+	if languageHint != "" {
+		prompt += fmt.Sprintf(`
+The document is expected to contain: "%s". Use this to read ambiguous words and diacritics (such as Vietnamese tone marks) correctly, but report the languages actually present.`, languageHint)
+	}
+	contents := []*genai.Content{genai.NewContentFromParts([]*genai.Part{genai.NewPartFromText(prompt), image}, genai.RoleUser)}
+	generateConfig := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"blocks": {
+					Type: genai.TypeArray,
+					Items: &genai.Schema{
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							"text":     {Type: genai.TypeString},
+							"language": {Type: genai.TypeString},
+						},
+						Required: []string{"text", "language"},
+					},
+				},
+				"confidence": {Type: genai.TypeString, Enum: []string{OCR_CONFIDENCE_HIGH, OCR_CONFIDENCE_MEDIUM, OCR_CONFIDENCE_LOW}},
+			},
+			Required: []string{"blocks", "confidence"},
+		},
+	}
+
+	result, _, err := internal.GenerateWithFallback(ctx, ocrModels, contents, generateConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var extracted ExtractTextFromImageResponse
+	if err := json.Unmarshal([]byte(result.Text()), &extracted); err != nil {
+		return nil, fmt.Errorf("failed to parse extraction JSON: %w", err)
+	}
+
+	// Drop empty blocks and list each language once, most common first
+	blocks := []TextBlock{}
+	texts := []string{}
+	languageWords := make(map[string]int)
+	languages := []string{}
+	for _, block := range extracted.Blocks {
+		block.Text = strings.TrimSpace(block.Text)
+		block.Language = strings.ToLower(strings.TrimSpace(block.Language))
+		if block.Text == "" {
+			continue
+		}
+		blocks = append(blocks, block)
+		texts = append(texts, block.Text)
+		if block.Language != "" {
+			if languageWords[block.Language] == 0 {
+				languages = append(languages, block.Language)
+			}
+			languageWords[block.Language] += utils.GetTotalWords(block.Text)
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool { return languageWords[languages[i]] > languageWords[languages[j]] })
+
+	extracted.Blocks = blocks
+	extracted.FullText = strings.Join(texts, "\n\n")
+	extracted.DetectedLanguages = languages
+	if len(blocks) == 0 {
+		extracted.Confidence = OCR_CONFIDENCE_HIGH // Nothing to misread
+	}
+	return &extracted, nil
+}
+
+// POST /api/text/readability
+func AnalyzeReadability(w http.ResponseWriter, r *http.Request) {
+	var request AnalyzeReadabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if strings.TrimSpace(request.Text) == "" {
+		http.Error(w, "văn bản không được để trống", http.StatusBadRequest)
+		return
+	}
+	if utils.GetTotalWords(request.Text) > MAX_PASSAGE_WORDS {
+		http.Error(w, fmt.Sprintf("văn bản không được dài hơn %d từ", MAX_PASSAGE_WORDS), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyzeReadability(request.Text))
+}
+
+// Compute every readability metric and their consensus
+func analyzeReadability(text string) AnalyzeReadabilityResponse {
+	response := AnalyzeReadabilityResponse{
+		FleschKincaidGrade: roundTo(utils.FleschKincaidGrade(text), 2),
+		FleschReadingEase:  roundTo(utils.FleschReadingEase(text), 2),
+		GunningFog:         roundTo(utils.GunningFog(text), 2),
+		SMOG:               roundTo(utils.SMOG(text), 2),
+		LinsearWrite:       roundTo(utils.LinsearWrite(text), 2),
+		ColemanLiau:        roundTo(utils.ColemanLiau(text), 2),
+	}
+
+	grades := []float64{response.FleschKincaidGrade, response.GunningFog, response.SMOG, response.LinsearWrite, response.ColemanLiau}
+	response.MinScore, response.MaxScore = grades[0], grades[0]
+	total := 0.0
+	for _, grade := range grades {
+		response.MinScore = math.Min(response.MinScore, grade)
+		response.MaxScore = math.Max(response.MaxScore, grade)
+		total += grade
+	}
+	response.AverageScore = roundTo(total/float64(len(grades)), 2)
+	return response
+}
+
+// POST /api/text/passive-voice
+func AnalyzePassiveVoice(w http.ResponseWriter, r *http.Request) {
+	var request AnalyzePassiveVoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if strings.TrimSpace(request.Text) == "" {
+		http.Error(w, "văn bản không được để trống", http.StatusBadRequest)
+		return
+	}
+	if utils.GetTotalWords(request.Text) > MAX_PASSAGE_WORDS {
+		http.Error(w, fmt.Sprintf("văn bản không được dài hơn %d từ", MAX_PASSAGE_WORDS), http.StatusBadRequest)
+		return
+	}
+	if request.WritingType == "" {
+		request.WritingType = DEFAULT_PASSIVE_WRITING_TYPE
+	}
+	passiveRange, exists := passiveVoiceRanges[request.WritingType]
+	if !exists {
+		http.Error(w, "loại bài viết không hợp lệ (exam, academic, professional, personal, creative)", http.StatusBadRequest)
+		return
+	}
+
+	instances := utils.FindPassiveVoice(request.Text)
+	response := AnalyzePassiveVoiceResponse{PassiveCount: len(instances), Instances: instances}
+
+	// A sentence with two passives counts once
+	passiveSentences := make(map[string]bool)
+	for _, instance := range instances {
+		passiveSentences[instance.Sentence] = true
+	}
+	if sentenceCount := len(utils.SplitSentences(request.Text)); sentenceCount > 0 {
+		response.PassivePercentage = roundTo(float64(len(passiveSentences))/float64(sentenceCount)*100, 1)
+	}
+
+	switch {
+	case response.PassivePercentage > passiveRange[1]:
+		response.Verdict = "overused"
+	case response.PassivePercentage < passiveRange[0]:
+		response.Verdict = "underused"
+	default:
+		response.Verdict = "appropriate"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Count discourse markers by function using whole-word matching
+func countDiscourseMarkers(text string) CountDiscourseMarkersResponse {
+	response := CountDiscourseMarkersResponse{
+		ByFunction:   make(map[string]int),
+		MarkersFound: []string{},
+	}
+	for _, function := range discourseMarkerFunctions {
+		response.ByFunction[function] = 0
+	}
+
+	seen := make(map[string]bool)
+	for _, match := range discourseMarkerPattern.FindAllString(text, -1) {
+		marker := strings.ToLower(strings.Join(strings.Fields(match), " "))
+		response.TotalCount++
+		response.ByFunction[discourseMarkerFunctions[marker]]++
+		if !seen[marker] {
+			seen[marker] = true
+			response.MarkersFound = append(response.MarkersFound, marker)
+		}
+	}
+
+	if wordCount := len(utils.ExtractWords(text)); wordCount > 0 {
+		response.DensityPer100Words = roundTo(float64(response.TotalCount)/float64(wordCount)*100, 2)
+	}
+	return response
+}
+
+// POST /api/text/cohesive-device-quiz - gap-fill questions on choosing a cohesive
+// device, with the options taken from the discourse marker list
+func GenerateCohesiveDeviceQuiz(w http.ResponseWriter, r *http.Request) {
+	var request GenerateCohesiveDeviceQuizRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if err := validateCohesiveDeviceQuizRequest(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The devices are picked locally so the answers always come from the list
+	targets := pickCohesiveDevices(request.DeviceType, request.Count)
+	sentences, err := generateCohesiveSentencesWithGemini(request.Level, targets)
+	if err != nil {
+		logf(r, "Error generating cohesive device quiz: %v", err)
+		http.Error(w, "Failed to generate quiz", http.StatusInternalServerError)
+		return
+	}
+
+	quizzes := []Quiz{}
+	for i, target := range targets {
+		if i >= len(sentences) {
+			break
+		}
+		quiz, ok := buildCohesiveDeviceQuiz(target, sentences[i], request.Level)
+		if !ok {
+			continue
+		}
+		quiz.ID = len(quizzes) + 1
+		quizzes = append(quizzes, quiz)
+	}
+	if len(quizzes) == 0 {
+		http.Error(w, "Failed to generate quiz", http.StatusInternalServerError)
+		return
+	}
+
+	response := QuizResponse{
+		Topic:                     COHESIVE_DEVICE_QUIZ_TOPIC,
+		Level:                     request.Level,
+		Total:                     request.Count,
+		Generated:                 len(quizzes),
+		Quizzes:                   quizzes,
+		TotalEstimatedTimeMinutes: totalEstimatedMinutes(quizzes),
+	}
+
+	logf(r, "Generated %d/%d cohesive device questions (%s, %s)", len(quizzes), request.Count, request.DeviceType, request.Level)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func validateCohesiveDeviceQuizRequest(request *GenerateCohesiveDeviceQuizRequest) error {
+	request.Level = strings.ToUpper(strings.TrimSpace(request.Level))
+	if _, exists := reviewEnglishLevels[request.Level]; !exists {
+		return errors.New("trình độ không hợp lệ (A1, A2, B1, B2, C1, C2)")
+	}
+
+	request.DeviceType = strings.ToLower(strings.TrimSpace(request.DeviceType))
+	if request.DeviceType == "" {
+		request.DeviceType = DEFAULT_COHESIVE_DEVICE_TYPE
+	}
+	if request.DeviceType != DEFAULT_COHESIVE_DEVICE_TYPE && !contains(cohesiveDeviceTypes, request.DeviceType) {
+		return fmt.Errorf("loại liên từ không hợp lệ (%s, %s)", strings.Join(cohesiveDeviceTypes, ", "), DEFAULT_COHESIVE_DEVICE_TYPE)
+	}
+
+	if request.Count == 0 {
+		request.Count = DEFAULT_COHESIVE_QUIZ_COUNT
+	}
+	if request.Count < 1 || request.Count > MAX_COHESIVE_QUIZ_COUNT {
+		return fmt.Errorf("số câu hỏi phải từ 1 đến %d", MAX_COHESIVE_QUIZ_COUNT)
+	}
+	return nil
+}
+
+// A cohesive device to build a question around, with the function it belongs to
+type cohesiveDeviceTarget struct {
+	Type   string
+	Device string
+}
+
+// Pick count distinct devices of the type, taking the types in turn for "all"
+func pickCohesiveDevices(deviceType string, count int) []cohesiveDeviceTarget {
+	types := []string{deviceType}
+	if deviceType == DEFAULT_COHESIVE_DEVICE_TYPE {
+		types = append([]string(nil), cohesiveDeviceTypes...)
+		rand.Shuffle(len(types), func(i, j int) { types[i], types[j] = types[j], types[i] })
+	}
+
+	pools := make(map[string][]string)
+	for _, t := range types {
+		pools[t] = append([]string(nil), discourseMarkersByFunction[t]...)
+		rand.Shuffle(len(pools[t]), func(i, j int) { pools[t][i], pools[t][j] = pools[t][j], pools[t][i] })
+	}
+
+	targets := make([]cohesiveDeviceTarget, 0, count)
+	for i := 0; len(targets) < count; i++ {
+		t := types[i%len(types)]
+		if len(pools[t]) == 0 {
+			break
+		}
+		targets = append(targets, cohesiveDeviceTarget{Type: t, Device: pools[t][0]})
+		pools[t] = pools[t][1:]
+	}
+	return targets
+}
+
+// Ask Gemini for one sentence per device, in the same order, with the device blanked out
+func generateCohesiveSentencesWithGemini(level string, targets []cohesiveDeviceTarget) ([]GeminiCohesiveSentence, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return nil, errors.New("Gemini client not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), COHESIVE_DEVICE_QUIZ_TIMEOUT)
+	defer cancel()
+
+	var devices strings.Builder
+	for i, target := range targets {
+		devices.WriteString(fmt.Sprintf("%d. \"%s\" (%s)\n", i+1, target.Device, target.Type))
+	}
+	prompt := fmt.Sprintf(`You are an English teacher writing gap-fill exercises on cohesive devices for CEFR %s students.
+
+For each cohesive device below, in the same order, write one or two natural sentences at the students' level in which
+only that device fits, replacing it with %s. The surrounding sentence must make the device's function (additive,
+adversative, causal or temporal) clear. Use the device exactly once and do not write it anywhere else.
+Add a one-sentence explanation, in English, of why the device fits.
+
+DEVICES:
+%s
+Respond JSON: {"sentences": [{"device": "...", "sentence": "...", "explanation": "..."}]}`, level, COHESIVE_DEVICE_BLANK, devices.String())
+
+	result, err := client.Models.GenerateContent(ctx, "gemini-2.0-flash", genai.Text(prompt), &genai.GenerateContentConfig{
+		Temperature:      genai.Ptr[float32](COHESIVE_DEVICE_QUIZ_TEMPERATURE),
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"sentences": {Type: genai.TypeArray, Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"device":      {Type: genai.TypeString},
+						"sentence":    {Type: genai.TypeString},
+						"explanation": {Type: genai.TypeString},
+					},
+					Required: []string{"device", "sentence", "explanation"},
+				}},
+			},
+			Required: []string{"sentences"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gemini API call failed: %w", err)
+	}
+
+	var generated struct {
+		Sentences []GeminiCohesiveSentence `json:"sentences"`
+	}
+	if err := json.Unmarshal([]byte(result.Text()), &generated); err != nil {
+		return nil, fmt.Errorf("failed to parse cohesive device JSON: %w", err)
+	}
+	return generated.Sentences, nil
+}
+
+// Turn Gemini's sentence into a question with the device and distractors from the
+// other functions. Sentences without exactly one blank, or for another device, are dropped.
+func buildCohesiveDeviceQuiz(target cohesiveDeviceTarget, sentence GeminiCohesiveSentence, level string) (Quiz, bool) {
+	text := strings.TrimSpace(sentence.Sentence)
+	if strings.Count(text, COHESIVE_DEVICE_BLANK) != 1 || !strings.EqualFold(strings.TrimSpace(sentence.Device), target.Device) {
+		return Quiz{}, false
+	}
+
+	var otherTypes []string
+	for _, t := range cohesiveDeviceTypes {
+		if t != target.Type {
+			otherTypes = append(otherTypes, t)
+		}
+	}
+	rand.Shuffle(len(otherTypes), func(i, j int) { otherTypes[i], otherTypes[j] = otherTypes[j], otherTypes[i] })
+
+	options := []string{target.Device}
+	for _, t := range otherTypes[:COHESIVE_DEVICE_OPTIONS-1] {
+		markers := discourseMarkersByFunction[t]
+		options = append(options, markers[rand.Intn(len(markers))])
+	}
+	rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+
+	return Quiz{
+		Type:                 COHESIVE_DEVICE_QUIZ_TYPE,
+		Question:             "Choose the best word or phrase to complete the sentence: " + text,
+		Answer:               target.Device,
+		Options:              options,
+		CorrectIndex:         slices.Index(options, target.Device),
+		Explanation:          utils.SanitizeMarkdown(sentence.Explanation),
+		CustomFields:         map[string]interface{}{"device_type": target.Type},
+		EstimatedTimeMinutes: estimateQuizMinutes(COHESIVE_DEVICE_QUIZ_TYPE, level),
+	}, true
+}
+
+// GET /api/text/discourse-marker-list?type=adversative - the markers of one
+// function, or of all of them without a type
+func GetDiscourseMarkerList(w http.ResponseWriter, r *http.Request) {
+	markerType := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("type")))
+	if markerType == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(discourseMarkersByFunction)
+		return
+	}
+
+	markers, exists := discourseMarkersByFunction[markerType]
+	if !exists {
+		types := make([]string, 0, len(discourseMarkersByFunction))
+		for t := range discourseMarkersByFunction {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		http.Error(w, fmt.Sprintf("loại liên từ không hợp lệ (%s)", strings.Join(types, ", ")), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":    markerType,
+		"total":   len(markers),
+		"markers": markers,
+	})
+}
+
+// GET /api/text/gsl-list?limit=100
+func GetGSLList(w http.ResponseWriter, r *http.Request) {
+	limit := DEFAULT_GSL_LIST_SIZE
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "limit phải là số nguyên dương", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > len(gslWords) {
+		limit = len(gslWords)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total": len(gslWords),
+		"words": gslWords[:limit],
+	})
+}
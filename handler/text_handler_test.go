@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"EngPal/internal/config"
+)
+
+// Configure the image size and dimension limits for the test
+func useImageLimits(t *testing.T, maxBytes, maxDimension int) {
+	t.Helper()
+	cfg, _ := config.Load()
+	cfg.ImageMaxBytes = maxBytes
+	cfg.ImageMaxEncodedBytes = (maxBytes + 2) / 3 * 4
+	cfg.ImageMaxDimension = maxDimension
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+}
+
+// Start and finish the test with an empty OCR cache
+func useEmptyOCRCache(t *testing.T) {
+	t.Helper()
+	clearOCRCache()
+	t.Cleanup(clearOCRCache)
+}
+
+func extractTextFromImage(body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/text/extract-from-image", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	ExtractTextFromImage(recorder, request)
+	return recorder
+}
+
+// The "error" code of a structured error response
+func errorCodeOf(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	return body.Error
+}
+
+func TestExtractTextFromImage(t *testing.T) {
+	useEmptyOCRCache(t)
+	gemini := useFakeGemini(t, answerGemini(`{"blocks": [
+		{"text": " Xin chào các bạn ", "language": "VI"},
+		{"text": "", "language": "en"},
+		{"text": "Hello everyone, welcome to the class", "language": "en"}
+	], "confidence": "medium"}`))
+
+	photo := sampleImage(t, "image/png", 8, 8, 1)
+	body, _ := json.Marshal(ExtractTextFromImageRequest{ImageUpload: ImageUpload{Image: base64.StdEncoding.EncodeToString(photo)}})
+	recorder := extractTextFromImage(string(body))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	var extracted ExtractTextFromImageResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&extracted); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	want := ExtractTextFromImageResponse{
+		FullText:          "Xin chào các bạn\n\nHello everyone, welcome to the class",
+		DetectedLanguages: []string{"en", "vi"}, // Most words first
+		Blocks:            []TextBlock{{Text: "Xin chào các bạn", Language: "vi"}, {Text: "Hello everyone, welcome to the class", Language: "en"}},
+		Confidence:        OCR_CONFIDENCE_MEDIUM,
+	}
+	if !reflect.DeepEqual(extracted, want) {
+		t.Errorf("extracted %+v, want %+v", extracted, want)
+	}
+
+	calls := gemini.received()
+	if len(calls) != 1 {
+		t.Fatalf("Gemini was called %d times, want once", len(calls))
+	}
+	if calls[0].Model != ocrModels[0] {
+		t.Errorf("model = %q, want %q", calls[0].Model, ocrModels[0])
+	}
+	parts := calls[0].Contents[0].Parts
+	if len(parts) != 2 || parts[1].InlineData == nil || parts[1].InlineData.MIMEType != "image/png" || !reflect.DeepEqual(parts[1].InlineData.Data, photo) {
+		t.Errorf("Gemini was not sent the PNG photo: %+v", parts)
+	}
+}
+
+func TestExtractTextFromImageIsCached(t *testing.T) {
+	useEmptyOCRCache(t)
+	gemini := useFakeGemini(t, answerGemini(`{"blocks": [{"text": "EXIT", "language": "en"}], "confidence": "high"}`))
+
+	body := `{"image": "data:image/jpeg;base64,` + base64.StdEncoding.EncodeToString(sampleImage(t, "image/jpeg", 8, 8, 2)) + `"}`
+	for attempt, wantCached := range []bool{false, true} {
+		var extracted ExtractTextFromImageResponse
+		if err := json.NewDecoder(extractTextFromImage(body).Body).Decode(&extracted); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if extracted.FullText != "EXIT" || extracted.Cached != wantCached {
+			t.Errorf("attempt %d: got %+v, want EXIT with cached %v", attempt+1, extracted, wantCached)
+		}
+	}
+	if calls := len(gemini.received()); calls != 1 {
+		t.Errorf("Gemini was called %d times, want once", calls)
+	}
+}
+
+func TestExtractTextFromImageErrors(t *testing.T) {
+	useEmptyOCRCache(t)
+	useImageLimits(t, 4<<10, 16)
+	useFakeGemini(t, func(fakeGeminiCall) (int, string) { return http.StatusInternalServerError, "internal error" })
+
+	encode := func(data []byte) string {
+		body, _ := json.Marshal(map[string]string{"image": base64.StdEncoding.EncodeToString(data)})
+		return string(body)
+	}
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"malformed base64", `{"image": "not base64!"}`, http.StatusBadRequest, "invalid_image"},
+		{"no image", `{}`, http.StatusBadRequest, "invalid_image"},
+		{"unsupported format", encode(gifImage), http.StatusUnsupportedMediaType, "unsupported_image_format"},
+		{"too many bytes", encode(make([]byte, 5<<10)), http.StatusRequestEntityTooLarge, "image_too_large"},
+		{"too many pixels", encode(sampleImage(t, "image/png", 32, 8, 3)), http.StatusRequestEntityTooLarge, "image_dimensions_too_large"},
+		{"upstream failure", encode(sampleImage(t, "image/png", 8, 8, 4)), http.StatusServiceUnavailable, "text_extraction_failed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := extractTextFromImage(test.body)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if code := errorCodeOf(t, recorder); code != test.wantCode {
+				t.Errorf("error = %q, want %q", code, test.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"EngPal/internal/buildinfo"
+	"EngPal/repository"
+)
+
+type VersionResponse struct {
+	buildinfo.Info
+	GeminiModels []string `json:"gemini_models"`
+}
+
+// Where commits are read from, set by SetGitHubRepo at startup
+var githubRepo repository.GitHubRepo
+
+// SetGitHubRepo sets the repository the latest commit is read from.
+func SetGitHubRepo(repo repository.GitHubRepo) {
+	githubRepo = repo
+}
+
+// GeminiModels returns the Gemini models the server uses, without duplicates.
+func GeminiModels() []string {
+	var models []string
+	for _, model := range slices.Concat([]string{REVIEW_MODEL, FAST_REVIEW_MODEL, EXTENDED_REVIEW_MODEL}, chatbotModels, ocrModels) {
+		if !slices.Contains(models, model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// GET /api/version - the running build and the Gemini models it uses
+func GetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionResponse{Info: buildinfo.Get(), GeminiModels: GeminiModels()})
+}
+
+// GET /api/version/latest-commit - the latest commit on the configured GitHub branch
+func GetLatestGithubCommit(w http.ResponseWriter, r *http.Request) {
+	if githubRepo == nil {
+		http.Error(w, "GitHub repository not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	commit, err := githubRepo.LatestCommit()
+	if err != nil {
+		logf(r, "Error fetching latest GitHub commit: %v", err)
+		body := map[string]interface{}{
+			"error":   "github_unavailable",
+			"message": "Could not get the latest commit from GitHub",
+		}
+		var githubErr *repository.GitHubError
+		if errors.As(err, &githubErr) {
+			body["details"] = githubErr.Message
+			if githubErr.StatusCode != 0 {
+				body["github_status"] = githubErr.StatusCode
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commit)
+}
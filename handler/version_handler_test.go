@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"EngPal/internal/buildinfo"
+)
+
+func TestGetVersionServesBuildInfo(t *testing.T) {
+	original := []string{buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime}
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = "1.4.0", "3a5f068c0ffee", "2026-10-16T12:00:00Z"
+	t.Cleanup(func() {
+		buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = original[0], original[1], original[2]
+	})
+
+	recorder := httptest.NewRecorder()
+	GetVersion(recorder, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	var version VersionResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&version); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	want := VersionResponse{Info: buildinfo.Get(), GeminiModels: GeminiModels()}
+	if !reflect.DeepEqual(version, want) {
+		t.Errorf("served %+v, want %+v", version, want)
+	}
+	if version.Version != "1.4.0" || version.Commit != "3a5f068c0ffee" {
+		t.Errorf("served build %s at %s, want the injected 1.4.0 at 3a5f068c0ffee", version.Version, version.Commit)
+	}
+}
+
+func TestGeminiModelsHasNoDuplicates(t *testing.T) {
+	models := GeminiModels()
+	seen := make(map[string]bool)
+	for _, model := range models {
+		if seen[model] {
+			t.Errorf("%s is listed twice in %v", model, models)
+		}
+		seen[model] = true
+	}
+	if !seen[REVIEW_MODEL] || !seen[ocrModels[0]] {
+		t.Errorf("models %v are missing the review or OCR model", models)
+	}
+}
@@ -0,0 +1,929 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"EngPal/data"
+	"EngPal/internal"
+	"EngPal/utils"
+
+	"google.golang.org/genai"
+)
+
+// Request/Response types
+type GenerateExamplesRequest struct {
+	Word      string `json:"word"`
+	Count     int    `json:"count"`      // 1-10, default 5
+	UserLevel string `json:"user_level"` // A1-C2, default B1
+	Context   string `json:"context"`    // academic, business, casual, ...
+	Language  string `json:"language"`   // en, vi (vi adds a Vietnamese translation)
+}
+
+type ExampleSentence struct {
+	Sentence    string `json:"sentence"`
+	Type        string `json:"type"`        // simple, compound, complex
+	ContextTag  string `json:"context_tag"` // academic, business, casual
+	Translation string `json:"translation,omitempty"`
+}
+
+type GenerateExamplesResponse struct {
+	Word     string            `json:"word"`
+	Examples []ExampleSentence `json:"examples"`
+}
+
+// A chatbot message in a transcript sent by the client
+type ChatTranscriptMessage struct {
+	Role    string `json:"role"` // user, assistant
+	Content string `json:"content"`
+}
+
+type ChatVocabularyItem struct {
+	Word          string `json:"word"`
+	Lemma         string `json:"lemma"`
+	Definition    string `json:"definition"`
+	CEFRLevel     string `json:"cefr_level"`
+	FirstSentence string `json:"first_sentence"` // Sentence the word first appeared in
+}
+
+type ChatVocabularyResponse struct {
+	Items []ChatVocabularyItem `json:"items"`
+}
+
+type PronunciationRequest struct {
+	Word    string `json:"word"`
+	Dialect string `json:"dialect"` // american, british (default american)
+}
+
+type PronunciationResponse struct {
+	Word                    string   `json:"word"`
+	Dialect                 string   `json:"dialect"`
+	IPA                     string   `json:"ipa"` // Transcription in the requested dialect
+	IPAAmerican             string   `json:"ipa_american"`
+	IPABritish              string   `json:"ipa_british"`
+	Syllables               string   `json:"syllables"`      // par-tic-u-lar-ly
+	StressPattern           string   `json:"stress_pattern"` // O stressed, o unstressed
+	CommonMispronunciations []string `json:"common_mispronunciations"`
+	Source                  string   `json:"source"` // dictionary, gemini
+}
+
+type WordNetworkRequest struct {
+	Word     string `json:"word"`
+	Depth    int    `json:"depth"`     // 1-2 steps from the word, default 1
+	MaxNodes int    `json:"max_nodes"` // 5-30, default 20
+	Language string `json:"language"`  // en, vi (vi adds a Vietnamese translation)
+}
+
+type WordNetworkNode struct {
+	ID          string `json:"id"`    // The word, lowercase
+	Level       string `json:"level"` // A1-C2, "" if unknown
+	POS         string `json:"pos"`   // noun, verb, adj, adv, ...
+	Translation string `json:"translation,omitempty"`
+}
+
+type WordNetworkEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"` // synonym, antonym, hypernym, hyponym, collocation, derivative
+}
+
+// A graph of related words for force-directed rendering; the word is the first node
+type WordNetworkResponse struct {
+	Word  string            `json:"word"`
+	Depth int               `json:"depth"`
+	Nodes []WordNetworkNode `json:"nodes"`
+	Edges []WordNetworkEdge `json:"edges"`
+}
+
+// Constants
+const (
+	DEFAULT_EXAMPLE_COUNT   = 5
+	MAX_EXAMPLE_COUNT       = 10
+	MAX_VOCABULARY_WORDS    = 4 // Single words or short phrases
+	MAX_EXAMPLE_CONTEXT_LEN = 100
+	EXAMPLES_CACHE_DURATION = 2 * time.Hour
+
+	MAX_CHAT_VOCABULARY_ITEMS    = 30
+	MIN_CHAT_VOCABULARY_WORDS    = 20 // Shorter sessions return an empty list
+	MAX_CHAT_TRANSCRIPT_WORDS    = 3000
+	MAX_CHAT_TRANSCRIPT_MESSAGES = 100
+
+	MAX_PRONUNCIATION_WORD_LEN         = 45
+	PRONUNCIATION_GUIDE_CACHE_DURATION = 24 * time.Hour
+
+	DEFAULT_WORD_NETWORK_DEPTH  = 1
+	MAX_WORD_NETWORK_DEPTH      = 2
+	DEFAULT_WORD_NETWORK_NODES  = 20
+	MIN_WORD_NETWORK_NODES      = 5
+	MAX_WORD_NETWORK_NODES      = 30
+	WORD_NETWORK_CACHE_DURATION = 12 * time.Hour
+)
+
+// Word list export formats
+const (
+	WORD_LIST_FORMAT_JSON = "json"
+	WORD_LIST_FORMAT_CSV  = "csv"
+	WORD_LIST_FORMAT_ANKI = "anki" // Tab-separated, for Anki's "Import File"
+)
+
+// Relations between words in a word network
+var wordNetworkRelations = []string{"synonym", "antonym", "hypernym", "hyponym", "collocation", "derivative"}
+
+// Sentence structures Gemini may tag an example with
+var exampleSentenceTypes = []string{"simple", "compound", "complex"}
+
+// Context tags Gemini may tag an example with
+var exampleContextTags = []string{"academic", "business", "casual"}
+
+var (
+	examplesCache      = make(map[string]cacheItem)
+	examplesCacheMutex sync.RWMutex
+)
+
+var (
+	pronunciationGuideCache      = make(map[string]cacheItem)
+	pronunciationGuideCacheMutex sync.RWMutex
+)
+
+var (
+	wordNetworkCache      = make(map[string]cacheItem)
+	wordNetworkCacheMutex sync.RWMutex
+)
+
+// CMU Pronouncing Dictionary loaded from the embedded data file
+var cmuDict = parseCMUDict(data.CMUDict)
+
+// Parse either CMU dictionary release: cmudict 0.7b ("WORD  PHONEMES", ";;;" comment
+// lines) or cmudict.dict ("word PHONEMES", "#" comments at the end of a line).
+func parseCMUDict(text string) map[string][]string {
+	dict := make(map[string][]string)
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, ";;;") {
+			continue
+		}
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// Keep the first pronunciation; variants are listed as WORD(1), WORD(2), ...
+		word := strings.ToLower(fields[0])
+		if _, exists := dict[word]; exists || strings.HasSuffix(word, ")") {
+			continue
+		}
+		dict[word] = fields[1:]
+	}
+	return dict
+}
+
+// --- MAIN HANDLER ---
+
+func GenerateExamples(w http.ResponseWriter, r *http.Request) {
+	var request GenerateExamplesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if err := validateExamplesRequest(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check cache
+	cacheKey := strings.ToLower(request.Word) + "-" + strconv.Itoa(request.Count) + "-" + request.UserLevel +
+		"-" + strings.ToLower(request.Context) + "-" + request.Language
+	now := time.Now()
+	examplesCacheMutex.RLock()
+	item, found := examplesCache[cacheKey]
+	examplesCacheMutex.RUnlock()
+	if found && item.ExpiresAt.After(now) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item.Data)
+		return
+	}
+
+	examples, err := generateExamplesWithGemini(request)
+	if err != nil {
+		logf(r, "Error generating examples: %v", err)
+		http.Error(w, "Failed to generate example sentences", http.StatusInternalServerError)
+		return
+	}
+
+	response := GenerateExamplesResponse{
+		Word:     request.Word,
+		Examples: examples,
+	}
+
+	// Cache for 2 hours
+	examplesCacheMutex.Lock()
+	examplesCache[cacheKey] = cacheItem{Data: response, ExpiresAt: now.Add(EXAMPLES_CACHE_DURATION)}
+	examplesCacheMutex.Unlock()
+
+	logf(r, "Generated %d examples for %q (%s, %s)", len(examples), request.Word, request.UserLevel, request.Context)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Validate example sentence request and fill in defaults
+func validateExamplesRequest(request *GenerateExamplesRequest) error {
+	request.Word = strings.Join(strings.Fields(request.Word), " ")
+	if request.Word == "" {
+		return errors.New("từ vựng không được để trống")
+	}
+	if utils.GetTotalWords(request.Word) > MAX_VOCABULARY_WORDS {
+		return fmt.Errorf("từ vựng chỉ được tối đa %d từ", MAX_VOCABULARY_WORDS)
+	}
+
+	if request.Count == 0 {
+		request.Count = DEFAULT_EXAMPLE_COUNT
+	}
+	if request.Count < 1 || request.Count > MAX_EXAMPLE_COUNT {
+		return fmt.Errorf("số lượng câu ví dụ phải nằm trong khoảng 1 đến %d", MAX_EXAMPLE_COUNT)
+	}
+
+	request.UserLevel = strings.ToUpper(strings.TrimSpace(request.UserLevel))
+	if request.UserLevel == "" {
+		request.UserLevel = "B1"
+	}
+	if _, exists := reviewEnglishLevels[request.UserLevel]; !exists {
+		return errors.New("trình độ tiếng Anh không hợp lệ (A1, A2, B1, B2, C1, C2)")
+	}
+
+	request.Context = strings.TrimSpace(request.Context)
+	if request.Context == "" {
+		request.Context = "casual"
+	}
+	if len(request.Context) > MAX_EXAMPLE_CONTEXT_LEN {
+		return fmt.Errorf("ngữ cảnh không được dài hơn %d ký tự", MAX_EXAMPLE_CONTEXT_LEN)
+	}
+
+	request.Language = strings.ToLower(strings.TrimSpace(request.Language))
+	if request.Language == "" {
+		request.Language = "en"
+	}
+	if request.Language != "en" && request.Language != "vi" {
+		return errors.New("ngôn ngữ không hợp lệ (en, vi)")
+	}
+	return nil
+}
+
+// Ask Gemini for contextualised example sentences
+func generateExamplesWithGemini(req GenerateExamplesRequest) ([]ExampleSentence, error) {
+	translationInstruction := ""
+	if req.Language == "vi" {
+		translationInstruction = "\n- \"translation\": a natural Vietnamese translation of the sentence"
+	}
+
+	prompt := fmt.Sprintf(`You are an experienced English teacher writing example sentences for a learner.
+
+TARGET WORD OR PHRASE: "%s"
+LEARNER LEVEL: %s
+CONTEXT: %s
+
+REQUIREMENTS:
+- Write exactly %d unique example sentences that use "%s" naturally
+- Keep vocabulary and grammar appropriate for a %s learner, apart from the target word itself
+- Vary the sentence structures between simple, compound and complex sentences
+- Every sentence must fit the context "%s"
+- "type": the sentence structure (simple, compound or complex)
+- "context_tag": the closest register (academic, business or casual)%s`,
+		req.Word, reviewEnglishLevels[req.UserLevel], req.Context, req.Count, req.Word,
+		reviewEnglishLevels[req.UserLevel], req.Context, translationInstruction)
+
+	exampleProperties := map[string]*genai.Schema{
+		"sentence":    {Type: genai.TypeString},
+		"type":        {Type: genai.TypeString, Enum: exampleSentenceTypes},
+		"context_tag": {Type: genai.TypeString, Enum: exampleContextTags},
+	}
+	required := []string{"sentence", "type", "context_tag"}
+	if req.Language == "vi" {
+		exampleProperties["translation"] = &genai.Schema{Type: genai.TypeString}
+		required = append(required, "translation")
+	}
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"examples": {
+				Type:  genai.TypeArray,
+				Items: &genai.Schema{Type: genai.TypeObject, Properties: exampleProperties, Required: required},
+			},
+		},
+		Required: []string{"examples"},
+	}
+
+	response, err := callGeminiForVocabulary(prompt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("gemini API call failed: %w", err)
+	}
+
+	var examplesData struct {
+		Examples []ExampleSentence `json:"examples"`
+	}
+	if err := json.Unmarshal([]byte(response), &examplesData); err != nil {
+		log.Printf("Failed to parse examples JSON response: %s", response)
+		return nil, fmt.Errorf("failed to parse examples JSON: %w", err)
+	}
+
+	// Drop blank and duplicate sentences, then enforce the requested count
+	seen := make(map[string]bool)
+	examples := []ExampleSentence{}
+	for _, example := range examplesData.Examples {
+		example.Sentence = strings.TrimSpace(example.Sentence)
+		key := strings.ToLower(example.Sentence)
+		if example.Sentence == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		examples = append(examples, example)
+	}
+	if len(examples) == 0 {
+		return nil, errors.New("no example sentences in API response")
+	}
+	if len(examples) > req.Count {
+		examples = examples[:req.Count]
+	}
+	return examples, nil
+}
+
+// POST /api/chatbot/sessions/{id}/vocabulary?format=json|csv|anki - the notable words
+// the tutor introduced or corrected in a session, as a word list to save
+func ExtractChatSessionVocabulary(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format == "" {
+		format = WORD_LIST_FORMAT_JSON
+	}
+	if format != WORD_LIST_FORMAT_JSON && format != WORD_LIST_FORMAT_CSV && format != WORD_LIST_FORMAT_ANKI {
+		http.Error(w, "định dạng không hợp lệ (json, csv, anki)", http.StatusBadRequest)
+		return
+	}
+
+	session, ok := chatSessionForRequest(w, r)
+	if !ok {
+		return
+	}
+	englishLevel := session.EnglishLevel
+	if _, exists := reviewEnglishLevels[englishLevel]; !exists {
+		englishLevel = "B1"
+	}
+
+	// The earliest messages, since each word is listed with its first sentence
+	transcript, _, err := buildChatTranscript(session.transcript(MAX_CHAT_TRANSCRIPT_WORDS))
+	if err != nil {
+		logf(r, "Error building chat transcript: %v", err)
+		http.Error(w, "Failed to extract vocabulary", http.StatusInternalServerError)
+		return
+	}
+
+	items := []ChatVocabularyItem{}
+	wordCount := utils.GetTotalWords(transcript)
+	if wordCount >= MIN_CHAT_VOCABULARY_WORDS {
+		if items, err = extractChatVocabularyWithGemini(transcript, englishLevel); err != nil {
+			logf(r, "Error extracting chat vocabulary: %v", err)
+			http.Error(w, "Failed to extract vocabulary", http.StatusInternalServerError)
+			return
+		}
+		logf(r, "Extracted %d vocabulary items from a %d-word chat (%s)", len(items), wordCount, englishLevel)
+	}
+
+	writeChatVocabulary(w, format, "vocabulary-"+session.ID, items)
+}
+
+// Write a word list as JSON, CSV with a header row, or tab-separated Anki notes
+// (front: word, back: definition and example, tagged with the CEFR level).
+func writeChatVocabulary(w http.ResponseWriter, format, filename string, items []ChatVocabularyItem) {
+	switch format {
+	case WORD_LIST_FORMAT_CSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"word", "lemma", "definition", "cefr_level", "first_sentence"})
+		for _, item := range items {
+			writer.Write([]string{item.Word, item.Lemma, item.Definition, item.CEFRLevel, item.FirstSentence})
+		}
+		writer.Flush()
+	case WORD_LIST_FORMAT_ANKI:
+		w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.txt"`, filename))
+		fmt.Fprint(w, "#separator:tab\n#html:true\n#tags column:3\n")
+		for _, item := range items {
+			back := html.EscapeString(ankiField(item.Definition))
+			if item.FirstSentence != "" {
+				back += "<br><i>" + html.EscapeString(ankiField(item.FirstSentence)) + "</i>"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", html.EscapeString(ankiField(item.Word)), back, "cefr::"+item.CEFRLevel)
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatVocabularyResponse{Items: items})
+	}
+}
+
+// Tabs and line breaks would split an Anki note, so they become spaces.
+func ankiField(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// Format chat messages as "USER: ..." / "ASSISTANT: ..." lines, skipping blank ones,
+// and count the user's messages.
+func buildChatTranscript(messages []ChatTranscriptMessage) (string, int, error) {
+	var transcript strings.Builder
+	userMessages := 0
+	for _, message := range messages {
+		role := strings.ToLower(strings.TrimSpace(message.Role))
+		if role != "user" && role != "assistant" {
+			return "", 0, errors.New("vai trò tin nhắn không hợp lệ (user, assistant)")
+		}
+		if content := strings.TrimSpace(message.Content); content != "" {
+			fmt.Fprintf(&transcript, "%s: %s\n", strings.ToUpper(role), content)
+			if role == "user" {
+				userMessages++
+			}
+		}
+	}
+	return transcript.String(), userMessages, nil
+}
+
+// Ask Gemini for the words the assistant introduced or corrected, then filter them.
+func extractChatVocabularyWithGemini(transcript, englishLevel string) ([]ChatVocabularyItem, error) {
+	prompt := fmt.Sprintf(`You are an English teacher reviewing a chat between a learner (USER) and a tutor (ASSISTANT).
+
+LEARNER LEVEL: %s
+
+TRANSCRIPT:
+"""
+%s"""
+
+List up to %d notable English words or phrases that the ASSISTANT introduced or that the learner was corrected on.
+- "word": the word or phrase as it appeared in the chat
+- "lemma": its dictionary form (e.g. "went" -> "go")
+- "definition": a simple English definition suited to the learner's level
+- "cefr_level": the CEFR level of the word (A1-C2)
+- "first_sentence": the sentence from the transcript where it first appeared, copied exactly
+Skip names, greetings and words the learner obviously already knows.`,
+		reviewEnglishLevels[englishLevel], transcript, MAX_CHAT_VOCABULARY_ITEMS)
+
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"items": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"word":           {Type: genai.TypeString},
+						"lemma":          {Type: genai.TypeString},
+						"definition":     {Type: genai.TypeString},
+						"cefr_level":     {Type: genai.TypeString, Enum: cefrLevelOrder},
+						"first_sentence": {Type: genai.TypeString},
+					},
+					Required: []string{"word", "lemma", "definition", "cefr_level", "first_sentence"},
+				},
+			},
+		},
+		Required: []string{"items"},
+	}
+
+	response, err := callGeminiForVocabulary(prompt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("gemini API call failed: %w", err)
+	}
+
+	var vocabularyData ChatVocabularyResponse
+	if err := json.Unmarshal([]byte(response), &vocabularyData); err != nil {
+		log.Printf("Failed to parse chat vocabulary JSON response: %s", response)
+		return nil, fmt.Errorf("failed to parse chat vocabulary JSON: %w", err)
+	}
+	return filterChatVocabulary(vocabularyData.Items, englishLevel), nil
+}
+
+// Dedupe words by lemma, drop the ones at or below one band under the learner's level
+// and keep at most MAX_CHAT_VOCABULARY_ITEMS.
+func filterChatVocabulary(candidates []ChatVocabularyItem, englishLevel string) []ChatVocabularyItem {
+	// Words at or below this index are too easy for the learner
+	easyLimit := cefrLevelIndex(englishLevel) - 1
+
+	seen := make(map[string]bool)
+	items := []ChatVocabularyItem{}
+	for _, item := range candidates {
+		item.Word = strings.TrimSpace(item.Word)
+		item.Lemma = strings.ToLower(strings.TrimSpace(item.Lemma))
+		if item.Lemma == "" {
+			item.Lemma = strings.ToLower(item.Word)
+		}
+		level := normalizeCEFRLevel(item.CEFRLevel)
+		if item.Word == "" || seen[item.Lemma] || level == "" || cefrLevelIndex(level) <= easyLimit {
+			continue
+		}
+		seen[item.Lemma] = true
+		item.CEFRLevel = level
+		items = append(items, item)
+		if len(items) == MAX_CHAT_VOCABULARY_ITEMS {
+			break
+		}
+	}
+	return items
+}
+
+// POST /api/vocabulary/pronunciation-guide - IPA, syllables and stress for a word
+func GetPronunciation(w http.ResponseWriter, r *http.Request) {
+	var request PronunciationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	request.Word = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(request.Word, "’", "'")))
+	if request.Word == "" {
+		http.Error(w, "từ vựng không được để trống", http.StatusBadRequest)
+		return
+	}
+	if len(request.Word) > MAX_PRONUNCIATION_WORD_LEN || !pronounceWordPattern.MatchString(request.Word) {
+		http.Error(w, "từ vựng phải là một từ tiếng Anh duy nhất", http.StatusBadRequest)
+		return
+	}
+	request.Dialect = strings.ToLower(strings.TrimSpace(request.Dialect))
+	if request.Dialect == "" {
+		request.Dialect = "american"
+	}
+	if request.Dialect != "american" && request.Dialect != "british" {
+		http.Error(w, "phương ngữ không hợp lệ (american, british)", http.StatusBadRequest)
+		return
+	}
+
+	// Check cache
+	cacheKey := request.Word + "-" + request.Dialect
+	now := time.Now()
+	pronunciationGuideCacheMutex.RLock()
+	item, found := pronunciationGuideCache[cacheKey]
+	pronunciationGuideCacheMutex.RUnlock()
+	if found && item.ExpiresAt.After(now) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item.Data)
+		return
+	}
+
+	var response *PronunciationResponse
+	if phonemes, found := cmuDict[request.Word]; found {
+		response = pronunciationFromDictionary(request.Word, phonemes)
+	} else {
+		var err error
+		response, err = generatePronunciationWithGemini(request.Word)
+		if err != nil {
+			logf(r, "Error generating pronunciation: %v", err)
+			http.Error(w, "Failed to generate pronunciation guide", http.StatusInternalServerError)
+			return
+		}
+	}
+	response.Dialect = request.Dialect
+	response.IPA = response.IPAAmerican
+	if request.Dialect == "british" {
+		response.IPA = response.IPABritish
+	}
+
+	// Cache for 24 hours
+	pronunciationGuideCacheMutex.Lock()
+	pronunciationGuideCache[cacheKey] = cacheItem{Data: response, ExpiresAt: now.Add(PRONUNCIATION_GUIDE_CACHE_DURATION)}
+	pronunciationGuideCacheMutex.Unlock()
+
+	logf(r, "Pronunciation guide for %q (%s, %s)", request.Word, request.Dialect, response.Source)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Build a pronunciation guide from a CMU dictionary transcription. British IPA is
+// derived from the American one by rule (non-rhotic r, BATH and LOT vowels, /əʊ/).
+func pronunciationFromDictionary(word string, phonemes []string) *PronunciationResponse {
+	syllables := utils.SyllabifyArpabet(phonemes)
+	return &PronunciationResponse{
+		Word:                    word,
+		IPAAmerican:             utils.ArpabetToIPA(word, phonemes, false),
+		IPABritish:              utils.ArpabetToIPA(word, phonemes, true),
+		Syllables:               utils.HyphenateWord(word, len(syllables)),
+		StressPattern:           utils.StressPattern(syllables),
+		CommonMispronunciations: append([]string{}, utils.PronunciationPitfalls(word, phonemes)...),
+		Source:                  "dictionary",
+	}
+}
+
+// Ask Gemini for the pronunciation of a word missing from the dictionary
+func generatePronunciationWithGemini(word string) (*PronunciationResponse, error) {
+	prompt := fmt.Sprintf(`You are an English pronunciation teacher for Vietnamese learners.
+
+WORD: "%s"
+
+Give its pronunciation:
+- "ipa_american": General American IPA between slashes, with ˈ and ˌ stress marks (e.g. /pərˈtɪkjələrli/)
+- "ipa_british": Received Pronunciation IPA between slashes (e.g. /pəˈtɪkjələli/)
+- "syllables": the written word split into syllables with hyphens (e.g. par-tic-u-lar-ly)
+- "stress_pattern": one letter per spoken syllable, "O" for the primary stress and "o" otherwise (e.g. oOooo)
+- "common_mispronunciations": up to %d short tips on mistakes Vietnamese learners make with this word`,
+		word, utils.MaxPronunciationPitfalls)
+
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"ipa_american":             {Type: genai.TypeString},
+			"ipa_british":              {Type: genai.TypeString},
+			"syllables":                {Type: genai.TypeString},
+			"stress_pattern":           {Type: genai.TypeString},
+			"common_mispronunciations": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		},
+		Required: []string{"ipa_american", "ipa_british", "syllables", "stress_pattern", "common_mispronunciations"},
+	}
+
+	response, err := callGeminiForVocabulary(prompt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("gemini API call failed: %w", err)
+	}
+
+	var pronunciation PronunciationResponse
+	if err := json.Unmarshal([]byte(response), &pronunciation); err != nil {
+		log.Printf("Failed to parse pronunciation JSON response: %s", response)
+		return nil, fmt.Errorf("failed to parse pronunciation JSON: %w", err)
+	}
+	if pronunciation.IPAAmerican == "" || pronunciation.IPABritish == "" {
+		return nil, errors.New("no IPA in API response")
+	}
+
+	pronunciation.Word = word
+	pronunciation.IPAAmerican = "/" + strings.Trim(strings.TrimSpace(pronunciation.IPAAmerican), "/") + "/"
+	pronunciation.IPABritish = "/" + strings.Trim(strings.TrimSpace(pronunciation.IPABritish), "/") + "/"
+	pronunciation.StressPattern = strings.Map(func(r rune) rune {
+		if r == 'O' || r == 'o' {
+			return r
+		}
+		return -1
+	}, pronunciation.StressPattern)
+	if pronunciation.CommonMispronunciations == nil {
+		pronunciation.CommonMispronunciations = []string{}
+	}
+	if len(pronunciation.CommonMispronunciations) > utils.MaxPronunciationPitfalls {
+		pronunciation.CommonMispronunciations = pronunciation.CommonMispronunciations[:utils.MaxPronunciationPitfalls]
+	}
+	pronunciation.Source = "gemini"
+	return &pronunciation, nil
+}
+
+// POST /api/vocabulary/word-network - a graph of the words related to a word
+func GetWordNetwork(w http.ResponseWriter, r *http.Request) {
+	var request WordNetworkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	// Validation
+	if err := validateWordNetworkRequest(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check cache
+	cacheKey := request.Word + "-" + strconv.Itoa(request.Depth) + "-" + strconv.Itoa(request.MaxNodes) + "-" + request.Language
+	now := time.Now()
+	wordNetworkCacheMutex.RLock()
+	item, found := wordNetworkCache[cacheKey]
+	wordNetworkCacheMutex.RUnlock()
+	if found && item.ExpiresAt.After(now) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item.Data)
+		return
+	}
+
+	response, err := generateWordNetworkWithGemini(request)
+	if err != nil {
+		logf(r, "Error generating word network: %v", err)
+		http.Error(w, "Failed to generate word network", http.StatusInternalServerError)
+		return
+	}
+
+	// Cache for 12 hours
+	wordNetworkCacheMutex.Lock()
+	wordNetworkCache[cacheKey] = cacheItem{Data: response, ExpiresAt: now.Add(WORD_NETWORK_CACHE_DURATION)}
+	wordNetworkCacheMutex.Unlock()
+
+	logf(r, "Word network for %q (depth %d): %d nodes, %d edges", request.Word, request.Depth, len(response.Nodes), len(response.Edges))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Validate word network request and fill in defaults
+func validateWordNetworkRequest(request *WordNetworkRequest) error {
+	request.Word = strings.ToLower(strings.Join(strings.Fields(request.Word), " "))
+	if request.Word == "" {
+		return errors.New("từ vựng không được để trống")
+	}
+	if utils.GetTotalWords(request.Word) > MAX_VOCABULARY_WORDS {
+		return fmt.Errorf("từ vựng chỉ được tối đa %d từ", MAX_VOCABULARY_WORDS)
+	}
+
+	if request.Depth == 0 {
+		request.Depth = DEFAULT_WORD_NETWORK_DEPTH
+	}
+	if request.Depth < 1 || request.Depth > MAX_WORD_NETWORK_DEPTH {
+		return fmt.Errorf("độ sâu phải nằm trong khoảng 1 đến %d", MAX_WORD_NETWORK_DEPTH)
+	}
+
+	if request.MaxNodes == 0 {
+		request.MaxNodes = DEFAULT_WORD_NETWORK_NODES
+	}
+	if request.MaxNodes < MIN_WORD_NETWORK_NODES || request.MaxNodes > MAX_WORD_NETWORK_NODES {
+		return fmt.Errorf("số từ tối đa phải nằm trong khoảng %d đến %d", MIN_WORD_NETWORK_NODES, MAX_WORD_NETWORK_NODES)
+	}
+
+	request.Language = strings.ToLower(strings.TrimSpace(request.Language))
+	if request.Language == "" {
+		request.Language = "en"
+	}
+	if request.Language != "en" && request.Language != "vi" {
+		return errors.New("ngôn ngữ không hợp lệ (en, vi)")
+	}
+	return nil
+}
+
+// Ask Gemini for the words related to the requested one
+func generateWordNetworkWithGemini(req WordNetworkRequest) (*WordNetworkResponse, error) {
+	depthInstruction := "- Only connect words directly to the target word"
+	if req.Depth > 1 {
+		depthInstruction = "- Connect words to the target word, and also related words of those words (at most 2 steps from the target word)"
+	}
+	translationInstruction := ""
+	if req.Language == "vi" {
+		translationInstruction = "\n- \"translation\": the Vietnamese meaning of the word in this network"
+	}
+
+	prompt := fmt.Sprintf(`You are an English vocabulary teacher helping a student build a word network for exam preparation.
+
+TARGET WORD: "%s"
+
+Build a graph of words semantically related to it:
+- At most %d nodes, including the target word itself as "%s"
+%s
+- Each edge has a "relation": synonym, antonym, hypernym (a more general word), hyponym (a more specific word), collocation (a word often used with it) or derivative (the same word family)
+- Prefer words useful at exam level and cover several relation types
+- Nodes: "id" (the word in lowercase), "level" (its CEFR level, A1-C2) and "pos" (noun, verb, adj, adv, phrase)%s
+- Edges: "from" and "to" are node ids`,
+		req.Word, req.MaxNodes, req.Word, depthInstruction, translationInstruction)
+
+	nodeProperties := map[string]*genai.Schema{
+		"id":    {Type: genai.TypeString},
+		"level": {Type: genai.TypeString, Enum: cefrLevelOrder},
+		"pos":   {Type: genai.TypeString},
+	}
+	nodeRequired := []string{"id", "level", "pos"}
+	if req.Language == "vi" {
+		nodeProperties["translation"] = &genai.Schema{Type: genai.TypeString}
+		nodeRequired = append(nodeRequired, "translation")
+	}
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"nodes": {
+				Type:  genai.TypeArray,
+				Items: &genai.Schema{Type: genai.TypeObject, Properties: nodeProperties, Required: nodeRequired},
+			},
+			"edges": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"from":     {Type: genai.TypeString},
+						"to":       {Type: genai.TypeString},
+						"relation": {Type: genai.TypeString, Enum: wordNetworkRelations},
+					},
+					Required: []string{"from", "to", "relation"},
+				},
+			},
+		},
+		Required: []string{"nodes", "edges"},
+	}
+
+	response, err := callGeminiForVocabulary(prompt, schema)
+	if err != nil {
+		return nil, fmt.Errorf("gemini API call failed: %w", err)
+	}
+
+	var graph struct {
+		Nodes []WordNetworkNode `json:"nodes"`
+		Edges []WordNetworkEdge `json:"edges"`
+	}
+	if err := json.Unmarshal([]byte(response), &graph); err != nil {
+		log.Printf("Failed to parse word network JSON response: %s", response)
+		return nil, fmt.Errorf("failed to parse word network JSON: %w", err)
+	}
+
+	network := buildWordNetwork(req, graph.Nodes, graph.Edges)
+	if len(network.Edges) == 0 {
+		return nil, errors.New("no related words in API response")
+	}
+	return network, nil
+}
+
+// Clean up the graph from Gemini: the target word comes first, nodes are unique and
+// at most req.MaxNodes within req.Depth steps of it, and edges join two different
+// kept nodes with a known relation, once each
+func buildWordNetwork(req WordNetworkRequest, nodes []WordNetworkNode, edges []WordNetworkEdge) *WordNetworkResponse {
+	normalize := func(word string) string { return strings.ToLower(strings.Join(strings.Fields(word), " ")) }
+
+	byID := map[string]WordNetworkNode{req.Word: {ID: req.Word}}
+	for _, node := range nodes {
+		node.ID = normalize(node.ID)
+		if _, seen := byID[node.ID]; node.ID == "" || seen && node.ID != req.Word {
+			continue
+		}
+		node.Level = normalizeCEFRLevel(node.Level)
+		node.POS = strings.ToLower(strings.TrimSpace(node.POS))
+		node.Translation = strings.TrimSpace(node.Translation)
+		byID[node.ID] = node
+	}
+
+	var candidates []WordNetworkEdge
+	seenEdges := make(map[string]bool)
+	neighbors := make(map[string][]string)
+	for _, edge := range edges {
+		edge.From, edge.To = normalize(edge.From), normalize(edge.To)
+		edge.Relation = strings.ToLower(strings.TrimSpace(edge.Relation))
+		_, fromKnown := byID[edge.From]
+		_, toKnown := byID[edge.To]
+		key := edge.From + "|" + edge.To + "|" + edge.Relation
+		if !fromKnown || !toKnown || edge.From == edge.To || !contains(wordNetworkRelations, edge.Relation) || seenEdges[key] {
+			continue
+		}
+		seenEdges[key] = true
+		candidates = append(candidates, edge)
+		neighbors[edge.From] = append(neighbors[edge.From], edge.To)
+		neighbors[edge.To] = append(neighbors[edge.To], edge.From)
+	}
+
+	// Keep the closest words first, up to the node limit
+	kept := map[string]bool{req.Word: true}
+	network := &WordNetworkResponse{Word: req.Word, Depth: req.Depth, Nodes: []WordNetworkNode{byID[req.Word]}, Edges: []WordNetworkEdge{}}
+	frontier := []string{req.Word}
+	for step := 0; step < req.Depth && len(network.Nodes) < req.MaxNodes; step++ {
+		var next []string
+		for _, id := range frontier {
+			for _, neighbor := range neighbors[id] {
+				if kept[neighbor] || len(network.Nodes) == req.MaxNodes {
+					continue
+				}
+				kept[neighbor] = true
+				network.Nodes = append(network.Nodes, byID[neighbor])
+				next = append(next, neighbor)
+			}
+		}
+		frontier = next
+	}
+	for _, edge := range candidates {
+		if kept[edge.From] && kept[edge.To] {
+			network.Edges = append(network.Edges, edge)
+		}
+	}
+	return network
+}
+
+// Position of a CEFR level in cefrLevelOrder, or -1 if unknown
+func cefrLevelIndex(level string) int {
+	for i, l := range cefrLevelOrder {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// Call Gemini API for vocabulary content
+func callGeminiForVocabulary(prompt string, schema *genai.Schema) (string, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return "", errors.New("Gemini client not initialized")
+	}
+
+	ctx := context.Background()
+	result, err := client.Models.GenerateContent(
+		ctx,
+		"gemini-2.0-flash",
+		genai.Text(prompt),
+		&genai.GenerateContentConfig{
+			ResponseMIMEType: "application/json",
+			ResponseSchema:   schema,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	return result.Text(), nil
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestFilterChatVocabulary(t *testing.T) {
+	tests := []struct {
+		name         string
+		englishLevel string
+		candidates   []ChatVocabularyItem
+		wantLemmas   []string
+	}{
+		{
+			name:         "drops words at or below one band under the level",
+			englishLevel: "B1",
+			candidates: []ChatVocabularyItem{
+				{Word: "cat", CEFRLevel: "A1"},
+				{Word: "journey", CEFRLevel: "A2"},
+				{Word: "reluctant", CEFRLevel: "B1"},
+				{Word: "ubiquitous", CEFRLevel: "C1"},
+			},
+			wantLemmas: []string{"reluctant", "ubiquitous"},
+		},
+		{
+			name:         "A1 learners keep everything",
+			englishLevel: "A1",
+			candidates:   []ChatVocabularyItem{{Word: "cat", CEFRLevel: "A1"}},
+			wantLemmas:   []string{"cat"},
+		},
+		{
+			name:         "dedupes by lemma",
+			englishLevel: "B1",
+			candidates: []ChatVocabularyItem{
+				{Word: "went through", Lemma: "Go Through", CEFRLevel: "B2"},
+				{Word: "goes through", Lemma: "go through", CEFRLevel: "B2"},
+				{Word: "Ubiquitous", CEFRLevel: "C1"},
+				{Word: "ubiquitous", CEFRLevel: "C1"},
+			},
+			wantLemmas: []string{"go through", "ubiquitous"},
+		},
+		{
+			name:         "skips blank words and unknown levels",
+			englishLevel: "B1",
+			candidates: []ChatVocabularyItem{
+				{Word: " ", CEFRLevel: "B2"},
+				{Word: "meticulous", CEFRLevel: "D1"},
+				{Word: "meticulous", CEFRLevel: "c2 (proficient)"},
+			},
+			wantLemmas: []string{"meticulous"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lemmas []string
+			for _, item := range filterChatVocabulary(test.candidates, test.englishLevel) {
+				lemmas = append(lemmas, item.Lemma)
+			}
+			if !reflect.DeepEqual(lemmas, test.wantLemmas) {
+				t.Errorf("kept %v, want %v", lemmas, test.wantLemmas)
+			}
+		})
+	}
+}
+
+func TestFilterChatVocabularyCapsItems(t *testing.T) {
+	var candidates []ChatVocabularyItem
+	for i := 0; i < MAX_CHAT_VOCABULARY_ITEMS+10; i++ {
+		candidates = append(candidates, ChatVocabularyItem{Word: fmt.Sprintf("word%d", i), CEFRLevel: "C1"})
+	}
+	if items := filterChatVocabulary(candidates, "B1"); len(items) != MAX_CHAT_VOCABULARY_ITEMS {
+		t.Errorf("kept %d items, want %d", len(items), MAX_CHAT_VOCABULARY_ITEMS)
+	}
+}
+
+var testChatVocabulary = []ChatVocabularyItem{
+	{Word: "ubiquitous", Lemma: "ubiquitous", Definition: "found everywhere", CEFRLevel: "C1", FirstSentence: "Phones are ubiquitous, \"everywhere\"."},
+	{Word: "went through", Lemma: "go through", Definition: "to experience\tsomething hard", CEFRLevel: "B2", FirstSentence: "She went through\na lot."},
+}
+
+func TestWriteChatVocabularyCSV(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeChatVocabulary(recorder, WORD_LIST_FORMAT_CSV, "vocabulary-test", testChatVocabulary)
+
+	if disposition := recorder.Header().Get("Content-Disposition"); !strings.Contains(disposition, "vocabulary-test.csv") {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %v", err)
+	}
+	want := [][]string{
+		{"word", "lemma", "definition", "cefr_level", "first_sentence"},
+		{"ubiquitous", "ubiquitous", "found everywhere", "C1", "Phones are ubiquitous, \"everywhere\"."},
+		{"went through", "go through", "to experience\tsomething hard", "B2", "She went through\na lot."},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV records = %q, want %q", records, want)
+	}
+}
+
+func TestWriteChatVocabularyAnki(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeChatVocabulary(recorder, WORD_LIST_FORMAT_ANKI, "vocabulary-test", testChatVocabulary)
+
+	lines := strings.Split(strings.TrimSuffix(recorder.Body.String(), "\n"), "\n")
+	want := []string{
+		"#separator:tab",
+		"#html:true",
+		"#tags column:3",
+		"ubiquitous\tfound everywhere<br><i>Phones are ubiquitous, &#34;everywhere&#34;.</i>\tcefr::C1",
+		"went through\tto experience something hard<br><i>She went through a lot.</i>\tcefr::B2",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Anki lines = %q, want %q", lines, want)
+	}
+}
+
+func TestChatSessionVocabularyOfShortSessionIsEmpty(t *testing.T) {
+	sessionID := "test-short-vocabulary-session"
+	defer deleteChatSession(sessionID)
+	secret, err := beginChatSessionMessage(sessionID, chatSessionCaller{EnglishLevel: "B1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endChatSessionMessage(sessionID, ChatSessionMessage{Question: "Hi!", Answer: "Hello! How can I help?"})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/chatbot/sessions/{id}/vocabulary", ExtractChatSessionVocabulary).Methods("POST")
+	for _, format := range []string{WORD_LIST_FORMAT_JSON, WORD_LIST_FORMAT_CSV, WORD_LIST_FORMAT_ANKI} {
+		request := httptest.NewRequest(http.MethodPost, "/api/chatbot/sessions/"+sessionID+"/vocabulary?format="+format, nil)
+		request.Header.Set(CHAT_SESSION_SECRET_HEADER, secret)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", format, recorder.Code, http.StatusOK)
+			continue
+		}
+
+		if format == WORD_LIST_FORMAT_JSON {
+			var response ChatVocabularyResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || response.Items == nil || len(response.Items) != 0 {
+				t.Errorf("json: got %+v (%v), want an empty list", response, err)
+			}
+		} else if strings.Count(recorder.Body.String(), "\n") > 3 {
+			t.Errorf("%s: got words from a short session:\n%s", format, recorder.Body.String())
+		}
+	}
+}
+
+func TestParseCMUDict(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string][]string
+	}{
+		{
+			name: "cmudict 0.7b",
+			text: ";;; comment\nREAD  R IY1 D\nREAD(1)  R EH1 D\nTOMATO  T AH0 M EY1 T OW2\n",
+			want: map[string][]string{"read": {"R", "IY1", "D"}, "tomato": {"T", "AH0", "M", "EY1", "T", "OW2"}},
+		},
+		{
+			name: "cmudict.dict",
+			text: "read R IY1 D\nread(2) R EH1 D\naachen AA1 K AH0 N # place, german\n",
+			want: map[string][]string{"read": {"R", "IY1", "D"}, "aachen": {"AA1", "K", "AH0", "N"}},
+		},
+		{
+			name: "blank and incomplete lines",
+			text: "\n   \nLONELY\n",
+			want: map[string][]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseCMUDict(test.text); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseCMUDict() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetPronunciationFromDictionary(t *testing.T) {
+	for _, dialect := range []string{"american", "british"} {
+		body := fmt.Sprintf(`{"word": " Particularly ", "dialect": %q}`, dialect)
+		recorder := httptest.NewRecorder()
+		GetPronunciation(recorder, httptest.NewRequest(http.MethodPost, "/api/vocabulary/pronunciation-guide", strings.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", dialect, recorder.Code, http.StatusOK, recorder.Body)
+		}
+
+		var response PronunciationResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if response.Word != "particularly" || response.Dialect != dialect || response.Source != "dictionary" || response.IPAAmerican == "" || response.IPABritish == "" {
+			t.Errorf("%s: got %+v", dialect, response)
+		}
+		if want := map[string]string{"american": response.IPAAmerican, "british": response.IPABritish}[dialect]; response.IPA != want {
+			t.Errorf("%s: ipa = %q, want %q", dialect, response.IPA, want)
+		}
+	}
+}
+
+func TestGetWordNetworkIsCachedUnderConcurrentRequests(t *testing.T) {
+	gemini := useFakeGemini(t, answerGemini(`{"nodes": [{"id": "happy", "level": "A1", "pos": "adj"}, {"id": "glad", "level": "A2", "pos": "adj"}],
+		"edges": [{"from": "happy", "to": "glad", "relation": "synonym"}]}`))
+	t.Cleanup(func() {
+		wordNetworkCacheMutex.Lock()
+		clear(wordNetworkCache)
+		wordNetworkCacheMutex.Unlock()
+	})
+	getWordNetwork := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		GetWordNetwork(recorder, httptest.NewRequest(http.MethodPost, "/api/vocabulary/word-network", strings.NewReader(`{"word": "Happy"}`)))
+		return recorder
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if recorder := getWordNetwork(); recorder.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	calls := len(gemini.received())
+	var network WordNetworkResponse
+	if err := json.NewDecoder(getWordNetwork().Body).Decode(&network); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(network.Edges) != 1 || network.Nodes[0].ID != "happy" {
+		t.Errorf("cached network = %+v", network)
+	}
+	if after := len(gemini.received()); after != calls {
+		t.Errorf("Gemini was called again for a cached word network")
+	}
+}
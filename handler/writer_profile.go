@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// What the reviewer knows about the student beyond their level
+type WriterProfile struct {
+	NativeLanguage     string   `json:"native_language,omitempty"` // ISO 639-1 code (vi, ja, ...) or language name
+	LearningGoal       string   `json:"learning_goal,omitempty"`   // ielts7, academic, business, general
+	WeakAreas          []string `json:"weak_areas,omitempty"`
+	StudyDurationWeeks int      `json:"study_duration_weeks,omitempty"`
+}
+
+const (
+	MAX_WEAK_AREAS           = 5
+	MAX_WEAK_AREA_LENGTH     = 50
+	MAX_STUDY_DURATION_WEEKS = 1040 // 20 years
+)
+
+// Learning goals and how they are described to Gemini
+var learningGoals = map[string]string{
+	"ielts7":   "reaching IELTS band 7",
+	"academic": "academic writing at university",
+	"business": "professional communication at work",
+	"general":  "general everyday English",
+}
+
+// English names of common native languages, by ISO 639-1 code
+var nativeLanguageNames = map[string]string{
+	"vi": "Vietnamese", "en": "English", "ja": "Japanese", "ko": "Korean", "zh": "Chinese",
+	"fr": "French", "de": "German", "es": "Spanish", "th": "Thai", "id": "Indonesian",
+	"ru": "Russian", "pt": "Portuguese", "ar": "Arabic", "hi": "Hindi",
+}
+
+// Errors learners typically carry over from their native language
+var l1TransferErrors = map[string]string{
+	"vi": "articles (a/an/the, which Vietnamese does not have) and tense consistency (Vietnamese verbs do not change for tense)",
+}
+
+// Language names given instead of a code
+var languageNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z ]{1,29}$`)
+
+// Normalize the profile in place, rejecting invalid values
+func validateWriterProfile(profile *WriterProfile) error {
+	profile.NativeLanguage = strings.TrimSpace(profile.NativeLanguage)
+	if code := strings.ToLower(profile.NativeLanguage); nativeLanguageNames[code] != "" {
+		profile.NativeLanguage = code
+	} else if profile.NativeLanguage != "" && !languageNamePattern.MatchString(profile.NativeLanguage) {
+		return errors.New("tiếng mẹ đẻ phải là mã ISO 639-1 (vi, ja, ...) hoặc tên ngôn ngữ")
+	}
+
+	profile.LearningGoal = strings.ToLower(strings.TrimSpace(profile.LearningGoal))
+	if _, exists := learningGoals[profile.LearningGoal]; profile.LearningGoal != "" && !exists {
+		return errors.New("mục tiêu học không hợp lệ (ielts7, academic, business, general)")
+	}
+
+	if len(profile.WeakAreas) > MAX_WEAK_AREAS {
+		return fmt.Errorf("không được nêu quá %d điểm yếu", MAX_WEAK_AREAS)
+	}
+	weakAreas := []string{}
+	for _, area := range profile.WeakAreas {
+		area = strings.TrimSpace(stripControlCharacters(area, false))
+		if area == "" {
+			continue
+		}
+		if utf8.RuneCountInString(area) > MAX_WEAK_AREA_LENGTH {
+			return fmt.Errorf("mỗi điểm yếu không được dài hơn %d ký tự", MAX_WEAK_AREA_LENGTH)
+		}
+		weakAreas = append(weakAreas, area)
+	}
+	profile.WeakAreas = weakAreas
+
+	if profile.StudyDurationWeeks < 0 || profile.StudyDurationWeeks > MAX_STUDY_DURATION_WEEKS {
+		return fmt.Errorf("thời gian học phải nằm trong khoảng 0 đến %d tuần", MAX_STUDY_DURATION_WEEKS)
+	}
+	return nil
+}
+
+// Prompt section describing the student, or "" without a profile
+func buildWriterProfileSection(profile *WriterProfile) string {
+	if profile == nil {
+		return ""
+	}
+
+	var sentences []string
+	if profile.NativeLanguage != "" {
+		language := profile.NativeLanguage
+		if name, known := nativeLanguageNames[language]; known {
+			language = name
+		}
+		sentences = append(sentences, fmt.Sprintf("The student is a %s speaker.", language))
+	}
+	if profile.StudyDurationWeeks > 0 {
+		sentences = append(sentences, fmt.Sprintf("They have been studying English for %d weeks.", profile.StudyDurationWeeks))
+	}
+	if len(profile.WeakAreas) > 0 {
+		sentences = append(sentences, fmt.Sprintf("They struggle with %s.", strings.Join(profile.WeakAreas, ", ")))
+	}
+	if goal, exists := learningGoals[profile.LearningGoal]; exists {
+		sentences = append(sentences, fmt.Sprintf("Their goal is %s.", goal))
+	}
+	if transfer, exists := l1TransferErrors[profile.NativeLanguage]; exists {
+		sentences = append(sentences, fmt.Sprintf("Speakers of their language commonly make errors with %s; check for these in particular.", transfer))
+	}
+	if len(sentences) == 0 {
+		return ""
+	}
+	return "\n\nSTUDENT PROFILE:\n" + strings.Join(sentences, " ") + "\nTailor the feedback and suggestions to this student."
+}
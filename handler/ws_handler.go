@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"EngPal/internal"
+	"EngPal/internal/config"
+	"EngPal/utils"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/genai"
+)
+
+// Frames sent by the client
+type ChatbotStreamRequest struct {
+	Question      string `json:"question"`
+	SessionID     string `json:"session_id,omitempty"`
+	SessionSecret string `json:"session_secret,omitempty"` // Not needed with the session owner's JWT
+
+	newSessionSecret string // Sent in the done frame when the question started the session
+	messageID        string // Of the answer, sent in the done frame
+	scopeNote        string // Appended to answers to general knowledge questions
+}
+
+// Frames sent by the server
+type ChatbotStreamFrame struct {
+	Type      string `json:"type"` // token, done, error
+	Text      string `json:"text,omitempty"`
+	FullText  string `json:"full_text,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Model     string `json:"model,omitempty"`      // Only on done
+	MessageID string `json:"message_id,omitempty"` // Only on done, for POST /api/chatbot/messages/{id}/feedback
+	SessionID string `json:"session_id,omitempty"`
+
+	SessionSecret string `json:"session_secret,omitempty"` // Only on done, when the question started the session
+}
+
+// Stream frame types
+const (
+	STREAM_FRAME_TOKEN = "token"
+	STREAM_FRAME_DONE  = "done"
+	STREAM_FRAME_ERROR = "error"
+)
+
+// Largest client frame accepted, in bytes
+const MAX_WS_MESSAGE_SIZE = 4096
+
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: isAllowedOrigin,
+}
+
+// Check the Origin header against the comma-separated ALLOWED_ORIGINS.
+// Without ALLOWED_ORIGINS only same-host browser connections are accepted.
+func isAllowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Not a browser
+	}
+
+	allowed := config.AllowedOrigins()
+	if len(allowed) == 0 {
+		parsed, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(parsed.Host, r.Host)
+	}
+	for _, candidate := range allowed {
+		if candidate == "*" || strings.EqualFold(strings.TrimSuffix(candidate, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /api/ws/chatbot - streams chatbot answers token by token
+func ChatbotWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logf(r, "WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(MAX_WS_MESSAGE_SIZE)
+
+	username := r.URL.Query().Get("username")
+	gender := r.URL.Query().Get("gender")
+	age := r.URL.Query().Get("age")
+	englishLevel := r.URL.Query().Get("english_level")
+	persona := normalizePersona(r.URL.Query().Get("persona"))
+	personalize := r.URL.Query().Get("personalize") == "true"
+	userID := r.URL.Query().Get("user_id")
+
+	// Frames are read in the background so a disconnect cancels the answer being streamed.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	requests := make(chan ChatbotStreamRequest)
+	go func() {
+		defer cancel()
+		defer close(requests)
+		for {
+			var request ChatbotStreamRequest
+			if err := conn.ReadJSON(&request); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					logf(r, "WebSocket read failed: %v", err)
+				}
+				return
+			}
+			select {
+			case requests <- request:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for request := range requests {
+		// Validate the question.
+		request.Question = strings.TrimSpace(request.Question)
+		if request.Question == "" {
+			conn.WriteJSON(ChatbotStreamFrame{
+				Type:      STREAM_FRAME_ERROR,
+				Error:     "empty_question",
+				Message:   localizedMessage("empty_question", "", persona, nil),
+				SessionID: request.SessionID,
+			})
+			continue
+		}
+		if blocked, category := utils.CheckModeration(request.Question); blocked {
+			logf(r, "Moderation: blocked question from %s (category: %s)", username, category)
+			conn.WriteJSON(ChatbotStreamFrame{
+				Type:      STREAM_FRAME_ERROR,
+				Error:     moderationErrorCodes[category],
+				Message:   localizedMessage(moderationErrorCodes[category], "", persona, nil),
+				SessionID: request.SessionID,
+			})
+			continue
+		}
+		if limit := config.ChatWordLimit(CHAT_MODE_CHAT); utils.GetTotalWords(request.Question) > limit {
+			conn.WriteJSON(ChatbotStreamFrame{
+				Type:      STREAM_FRAME_ERROR,
+				Error:     "question_too_long",
+				Message:   localizedMessage("question_too_long", "", persona, map[string]interface{}{"limit": limit}),
+				SessionID: request.SessionID,
+			})
+			continue
+		}
+
+		if quota, allowed := consumeChatQuota(r); !allowed {
+			code, limit, _ := chatQuotaError(quota)
+			conn.WriteJSON(ChatbotStreamFrame{
+				Type:      STREAM_FRAME_ERROR,
+				Error:     code,
+				Message:   localizedMessage(code, "", persona, map[string]interface{}{"limit": limit}),
+				SessionID: request.SessionID,
+			})
+			continue
+		}
+
+		topic, errorCode := checkChatTopic(r, username, request.Question)
+		if errorCode != "" {
+			conn.WriteJSON(ChatbotStreamFrame{
+				Type:      STREAM_FRAME_ERROR,
+				Error:     errorCode,
+				Message:   localizedMessage(errorCode, "", persona, nil),
+				SessionID: request.SessionID,
+			})
+			continue
+		}
+		if topic == TOPIC_UNRELATED {
+			conn.WriteJSON(ChatbotStreamFrame{
+				Type:      STREAM_FRAME_DONE,
+				FullText:  localizedMessage("off_topic_redirect", "vi", persona, nil),
+				SessionID: request.SessionID,
+			})
+			continue
+		}
+		if topic == TOPIC_GENERAL_KNOWLEDGE {
+			request.scopeNote = "\n\n_" + localizedMessage("outside_learning_scope", "", persona, nil) + "_"
+		}
+
+		caller := chatSessionCaller{Subject: jwtSubject(r), Secret: request.SessionSecret, Persona: persona, EnglishLevel: englishLevel}
+		newSessionSecret, err := beginChatSessionMessage(request.SessionID, caller)
+		if err != nil {
+			code := "session_expired"
+			if errors.Is(err, errChatSessionForbidden) {
+				code = "session_forbidden"
+			}
+			conn.WriteJSON(ChatbotStreamFrame{
+				Type:      STREAM_FRAME_ERROR,
+				Error:     code,
+				Message:   localizedMessage(code, "", persona, nil),
+				SessionID: request.SessionID,
+			})
+			continue
+		}
+		request.newSessionSecret = newSessionSecret
+
+		systemPrompt := buildChatSystemPrompt(persona, username, gender, age, englishLevel,
+			responseLengths[RESPONSE_LENGTH_MEDIUM].Instruction, false)
+		if personalize {
+			systemPrompt += buildLearnerHistoryPrompt(userID)
+		}
+		contents := chatSessionContents(request.SessionID, genai.NewPartFromText(request.Question))
+		request.messageID = newChatMessageID()
+		answer, model, usage, err := streamChatbotAnswer(ctx, conn, request, systemPrompt, contents)
+		if answer != "" {
+			recordChatMessage(request.messageID,
+				Conversation{Question: request.Question, Mode: CHAT_MODE_CHAT, Persona: persona, SessionID: request.SessionID, username: username},
+				ChatResponse{MessageInMarkdown: answer, Model: model})
+		}
+		endChatSessionMessage(request.SessionID, ChatSessionMessage{MessageID: request.messageID, Question: request.Question, Answer: answer,
+			Model: model, PromptTokens: usage.PromptTokens, OutputTokens: usage.OutputTokens})
+		if err != nil {
+			logf(r, "Error streaming answer: %v", err)
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "answer generation failed"))
+			return
+		}
+
+		logf(r, "%s asked over WebSocket: %s", username, request.Question)
+	}
+}
+
+// Stream a Gemini answer to the connection as token frames followed by a done frame,
+// moving down chatbotModels while a model is overloaded before its first token.
+// Returns the full answer, the model that gave it and its token usage once the done
+// frame is sent.
+func streamChatbotAnswer(ctx context.Context, conn *websocket.Conn, request ChatbotStreamRequest, systemPrompt string, contents []*genai.Content) (string, string, internal.TokenUsage, error) {
+	if internal.GeminiClient == nil {
+		return "", "", internal.TokenUsage{}, errors.New("Gemini client not initialized")
+	}
+
+	var err error
+	for _, model := range internal.AvailableModels(chatbotModels) {
+		var answer string
+		var started bool
+		var usage internal.TokenUsage
+		answer, started, usage, err = streamChatbotAnswerWith(ctx, conn, request, systemPrompt, model, contents)
+		if err == nil {
+			return answer, model, usage, nil
+		}
+		if started || !internal.IsOverloaded(err) {
+			return "", model, usage, err
+		}
+		internal.MarkOverloaded(model)
+	}
+	return "", "", internal.TokenUsage{}, err
+}
+
+// Stream an answer from one model. started reports whether any token frame was sent.
+func streamChatbotAnswerWith(ctx context.Context, conn *websocket.Conn, request ChatbotStreamRequest, systemPrompt, model string, contents []*genai.Content) (answer string, started bool, usage internal.TokenUsage, err error) {
+	stream := internal.GeminiClient.Models.GenerateContentStream(
+		ctx,
+		model,
+		contents,
+		&genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText(systemPrompt, genai.RoleUser),
+			SafetySettings:    chatbotSafetySettings(),
+		},
+	)
+
+	// Usage metadata is cumulative, so only the last chunk's numbers are recorded
+	var fullText strings.Builder
+	defer func() { recordChatbotUsage(usage) }()
+
+	for chunk, err := range stream {
+		if err != nil {
+			return "", started, usage, err
+		}
+		if chunkUsage := internal.UsageOf(chunk); chunkUsage.PromptTokens > 0 || chunkUsage.OutputTokens > 0 {
+			usage = chunkUsage
+		}
+		if category, blocked := blockedCategory(chunk); blocked {
+			log.Printf("Moderation: blocked model output (category: %s)", category)
+			return "", started, usage, errResponseBlocked
+		}
+
+		text := chunk.Text()
+		if text == "" {
+			continue
+		}
+		fullText.WriteString(text)
+		started = true
+		if err := conn.WriteJSON(ChatbotStreamFrame{Type: STREAM_FRAME_TOKEN, Text: text, SessionID: request.SessionID}); err != nil {
+			return "", started, usage, err
+		}
+	}
+	if request.scopeNote != "" {
+		fullText.WriteString(request.scopeNote)
+		if err := conn.WriteJSON(ChatbotStreamFrame{Type: STREAM_FRAME_TOKEN, Text: request.scopeNote, SessionID: request.SessionID}); err != nil {
+			return "", started, usage, err
+		}
+	}
+
+	answer = utils.SanitizeMarkdown(fullText.String())
+	if err := conn.WriteJSON(ChatbotStreamFrame{
+		Type:      STREAM_FRAME_DONE,
+		FullText:  answer,
+		Model:     model,
+		MessageID: request.messageID,
+		SessionID: request.SessionID,
+
+		SessionSecret: request.newSessionSecret,
+	}); err != nil {
+		return "", started, usage, err
+	}
+	return answer, started, usage, nil
+}
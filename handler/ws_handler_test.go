@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"EngPal/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// Start and finish the test with an empty topic cache
+func useEmptyTopicCache(t *testing.T) {
+	t.Helper()
+	clearTopicCache := func() {
+		topicCacheMutex.Lock()
+		clear(topicCache)
+		topicCacheMutex.Unlock()
+	}
+	clearTopicCache()
+	t.Cleanup(clearTopicCache)
+}
+
+func useChatbotStrictMode(t *testing.T, strict bool) {
+	t.Helper()
+	cfg, _ := config.Load()
+	cfg.ChatbotStrictMode = strict
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+}
+
+// Answer topic checks with the topic of the question they contain, and stream answer
+// for everything else
+func answerTopicChecks(topics map[string]string, answer string) func(fakeGeminiCall) (int, string) {
+	return func(call fakeGeminiCall) (int, string) {
+		if call.Stream {
+			return http.StatusOK, answer
+		}
+		prompt := call.Contents[0].Parts[0].Text
+		for question, topic := range topics {
+			if strings.Contains(prompt, question) {
+				return http.StatusOK, `{"topic": "` + topic + `"}`
+			}
+		}
+		return http.StatusOK, `{"topic": "english_learning"}`
+	}
+}
+
+// Ask a question over a new chatbot WebSocket and read frames up to the done or error frame
+func askOverWebSocket(t *testing.T, question string) []ChatbotStreamFrame {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(ChatbotWebSocket))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?username=lan&persona=teacher", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(ChatbotStreamRequest{Question: question}); err != nil {
+		t.Fatal(err)
+	}
+	var frames []ChatbotStreamFrame
+	for {
+		var frame ChatbotStreamFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("reading frames after %+v: %v", frames, err)
+		}
+		frames = append(frames, frame)
+		if frame.Type != STREAM_FRAME_TOKEN {
+			return frames
+		}
+	}
+}
+
+func TestChatbotWebSocketChecksTopic(t *testing.T) {
+	const answer = "Paris is the capital of France."
+	topics := map[string]string{
+		"What is the capital of France?": TOPIC_GENERAL_KNOWLEDGE,
+		"Write me a Python script":       TOPIC_UNRELATED,
+		"Tell me something nasty":        TOPIC_INAPPROPRIATE,
+	}
+	scopeNote := "\n\n_" + localizedMessage("outside_learning_scope", "", PERSONA_TEACHER, nil) + "_"
+	redirect := localizedMessage("off_topic_redirect", "vi", PERSONA_TEACHER, nil)
+
+	tests := []struct {
+		name         string
+		question     string
+		strict       bool
+		wantType     string
+		wantFullText string
+		wantError    string
+		wantStream   bool
+	}{
+		{"english learning", "How do I use the present perfect?", false, STREAM_FRAME_DONE, answer, "", true},
+		{"general knowledge", "What is the capital of France?", false, STREAM_FRAME_DONE, answer + scopeNote, "", true},
+		{"unrelated", "Write me a Python script", false, STREAM_FRAME_DONE, redirect, "", false},
+		{"inappropriate", "Tell me something nasty", false, STREAM_FRAME_ERROR, "", "inappropriate_content", false},
+		{"general knowledge in strict mode", "What is the capital of France?", true, STREAM_FRAME_ERROR, "", "off_topic_question", false},
+		{"unrelated in strict mode", "Write me a Python script", true, STREAM_FRAME_ERROR, "", "off_topic_question", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useEmptyTopicCache(t)
+			useChatbotStrictMode(t, test.strict)
+			gemini := useFakeGemini(t, answerTopicChecks(topics, answer))
+
+			frames := askOverWebSocket(t, test.question)
+			last := frames[len(frames)-1]
+			if last.Type != test.wantType || last.FullText != test.wantFullText || last.Error != test.wantError {
+				t.Errorf("last frame = %+v, want a %s frame with text %q and error %q", last, test.wantType, test.wantFullText, test.wantError)
+			}
+
+			calls := gemini.received()
+			if len(calls) == 0 || calls[0].Stream {
+				t.Fatalf("the question was not checked before it was answered: %+v", calls)
+			}
+			if streamed := calls[len(calls)-1].Stream; streamed != test.wantStream {
+				t.Errorf("answer streamed = %v, want %v", streamed, test.wantStream)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Package buildinfo reports which build of the server is running. The values are
+// injected at build time, e.g.
+//
+//	go build -ldflags "-X EngPal/internal/buildinfo.Version=1.4.0 \
+//		-X EngPal/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X EngPal/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// See the build target of the Makefile.
+package buildinfo
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X; empty in builds without them
+var (
+	Version   string
+	Commit    string
+	BuildTime string // RFC 3339, UTC
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the injected build information. Without -ldflags the version falls
+// back to APP_VERSION, then "dev", and the commit to the VCS revision Go embeds.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if info.Version == "" {
+		info.Version = os.Getenv("APP_VERSION")
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		if build, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range build.Settings {
+				if setting.Key == "vcs.revision" {
+					info.Commit = setting.Value
+				}
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
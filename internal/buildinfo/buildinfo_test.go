@@ -0,0 +1,46 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+// Set the -ldflags variables for the test
+func useBuild(t *testing.T, version, commit, buildTime string) {
+	t.Helper()
+	original := []string{Version, Commit, BuildTime}
+	Version, Commit, BuildTime = version, commit, buildTime
+	t.Cleanup(func() { Version, Commit, BuildTime = original[0], original[1], original[2] })
+}
+
+func TestGetReportsInjectedValues(t *testing.T) {
+	useBuild(t, "1.4.0", "3a5f068c0ffee", "2026-10-16T12:00:00Z")
+	t.Setenv("APP_VERSION", "9.9.9")
+
+	want := Info{Version: "1.4.0", Commit: "3a5f068c0ffee", BuildTime: "2026-10-16T12:00:00Z", GoVersion: runtime.Version()}
+	if got := Get(); got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetFallbacks(t *testing.T) {
+	useBuild(t, "", "", "")
+	tests := []struct {
+		appVersion  string
+		wantVersion string
+	}{
+		{"2.0.0-rc1", "2.0.0-rc1"},
+		{"", "dev"},
+	}
+	for _, test := range tests {
+		t.Setenv("APP_VERSION", test.appVersion)
+		info := Get()
+		if info.Version != test.wantVersion {
+			t.Errorf("APP_VERSION %q: version = %q, want %q", test.appVersion, info.Version, test.wantVersion)
+		}
+		// Test binaries carry no VCS revision, so the commit is unknown
+		if info.Commit == "" || info.BuildTime != "unknown" || info.GoVersion != runtime.Version() {
+			t.Errorf("APP_VERSION %q: got %+v, want a commit, an unknown build time and Go %s", test.appVersion, info, runtime.Version())
+		}
+	}
+}
@@ -1,22 +1,506 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// Config is the server configuration, read from the environment and validated once
+// at startup by Load. Every setting other than GEMINI_API_KEY has a default.
 type Config struct {
-	Port string
+	Port            string         // PORT (default 8080)
+	GeminiAPIKey    string         // GEMINI_API_KEY, required
+	ShutdownTimeout time.Duration  // SHUTDOWN_TIMEOUT (default 30s)
+	AllowedOrigins  []string       // Comma-separated ALLOWED_ORIGINS; without it only same-host browsers connect
+	JWTSecret       string         // JWT_SECRET; endpoints that need a token are unavailable without it
+	TrustedProxies  []netip.Prefix // Comma-separated TRUSTED_PROXIES, IPs or CIDR ranges; X-Forwarded-For is ignored without it
+
+	ChatWordLimits         map[string]int    // CHAT_MAX_WORDS_<MODE>
+	ChatbotStrictMode      bool              // CHATBOT_STRICT_MODE
+	ChatbotSafety          map[string]string // CHATBOT_SAFETY_<CATEGORY> and CHATBOT_SAFETY_THRESHOLD, by suffix
+	ChatSessionIdleTimeout time.Duration     // CHAT_SESSION_IDLE_TIMEOUT (default 24h)
+	ChatSessionRetention   time.Duration     // CHAT_SESSION_RETENTION (default 30 days)
+	ChatHistoryTurns       int               // CHAT_HISTORY_TURNS, session turns always sent verbatim (default 6)
+	ChatHistoryTokenBudget int               // CHAT_HISTORY_TOKEN_BUDGET, tokens of session history per prompt (default 6000)
+	QuizDedupThreshold     float64           // QUIZ_DEDUP_THRESHOLD, 0-1 (default 0.5)
+	ChatRateLimit          int               // CHAT_RATE_LIMIT, messages per user per minute (default 10)
+	ChatDailyQuota         int               // CHAT_DAILY_QUOTA, messages per user per UTC day (default 200)
+	ChatMessageFile        string            // CHAT_MESSAGE_FILE, the store of answers kept for feedback (default chat_messages.jsonl)
+
+	FeedbackFile         string        // FEEDBACK_FILE, the feedback store (default feedback.jsonl)
+	FeedbackRateLimit    int           // FEEDBACK_RATE_LIMIT, per IP per minute (default 5)
+	FeedbackMaxBodyBytes int64         // FEEDBACK_MAX_BODY_BYTES (default 16 KB)
+	FeedbackDedupeWindow time.Duration // FEEDBACK_DEDUPE_WINDOW (default 10 minutes)
+	FeedbackWebhookURL   string        // FEEDBACK_WEBHOOK_URL, Discord or Slack; feedback is not forwarded without it
+
+	GitHubOwner               string        // GITHUB_OWNER (default Etorium0)
+	GitHubRepo                string        // GITHUB_REPO (default EngPal_BE)
+	GitHubBranch              string        // GITHUB_BRANCH (default main)
+	GitHubToken               string        // GITHUB_TOKEN, optional, for a higher rate limit
+	GitHubCommitCacheDuration time.Duration // GITHUB_COMMIT_CACHE_DURATION (default 10 minutes)
+
+	ScoreDistributionFile string // SCORE_DISTRIBUTION_FILE (default score_distribution.json)
+
+	ImageMaxBytes           int      // IMAGE_MAX_BYTES, decoded (default 4 MB)
+	ImageMaxEncodedBytes    int      // IMAGE_MAX_ENCODED_BYTES, base64 (default: the base64 length of ImageMaxBytes)
+	ImageMaxDimension       int      // IMAGE_MAX_DIMENSION, pixels (default 8192)
+	ImageAllowedTypes       []string // Comma-separated IMAGE_ALLOWED_TYPES (default all supported)
+	ImageDownscaleDimension int      // IMAGE_DOWNSCALE_DIMENSION, pixels (default 2048)
+
+	OCRBatchMaxBytes   int           // OCR_BATCH_MAX_BYTES (default 20 MB)
+	OCRCacheTTL        time.Duration // OCR_CACHE_TTL (default 24h)
+	OCRCacheMaxEntries int           // OCR_CACHE_MAX_ENTRIES (default 500)
+}
+
+// Default chatbot question word limits per mode
+var defaultChatWordLimits = map[string]int{
+	"chat":          30,
+	"reasoning":     60,
+	"translate":     150,
+	"define":        4,
+	"grammar_check": 60,
+	"pronounce":     3,
 }
 
-func LoadConfig() *Config {
-	return &Config{
-		Port: getEnv("PORT", "8080"),
+// Image types Gemini accepts and the server can check
+var supportedImageTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// Gemini safety thresholds accepted in CHATBOT_SAFETY_*
+var safetyThresholds = []string{"BLOCK_LOW_AND_ABOVE", "BLOCK_MEDIUM_AND_ABOVE", "BLOCK_ONLY_HIGH", "BLOCK_NONE"}
+
+const chatbotSafetyPrefix = "CHATBOT_SAFETY_"
+
+// Load reads the configuration from the environment. Unset settings take their
+// default; a missing GEMINI_API_KEY or a value that cannot be used is reported, all
+// of them in one error, and replaced by the default in the returned Config.
+func Load() (*Config, error) {
+	r := &envReader{}
+	cfg := &Config{
+		Port:            r.string("PORT", "8080"),
+		GeminiAPIKey:    r.string("GEMINI_API_KEY", ""),
+		ShutdownTimeout: r.duration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		AllowedOrigins:  r.list("ALLOWED_ORIGINS"),
+		JWTSecret:       r.string("JWT_SECRET", ""),
+
+		ChatWordLimits:         make(map[string]int, len(defaultChatWordLimits)),
+		ChatbotStrictMode:      r.bool("CHATBOT_STRICT_MODE", false),
+		ChatbotSafety:          make(map[string]string),
+		ChatSessionIdleTimeout: r.duration("CHAT_SESSION_IDLE_TIMEOUT", 24*time.Hour),
+		ChatSessionRetention:   r.duration("CHAT_SESSION_RETENTION", 30*24*time.Hour),
+		ChatHistoryTurns:       r.int("CHAT_HISTORY_TURNS", 6),
+		ChatHistoryTokenBudget: r.int("CHAT_HISTORY_TOKEN_BUDGET", 6000),
+		QuizDedupThreshold:     r.fraction("QUIZ_DEDUP_THRESHOLD", 0.5),
+		ChatRateLimit:          r.int("CHAT_RATE_LIMIT", 10),
+		ChatDailyQuota:         r.int("CHAT_DAILY_QUOTA", 200),
+		ChatMessageFile:        r.string("CHAT_MESSAGE_FILE", "chat_messages.jsonl"),
+
+		FeedbackFile:         r.string("FEEDBACK_FILE", "feedback.jsonl"),
+		FeedbackRateLimit:    r.int("FEEDBACK_RATE_LIMIT", 5),
+		FeedbackMaxBodyBytes: int64(r.int("FEEDBACK_MAX_BODY_BYTES", 16<<10)),
+		FeedbackDedupeWindow: r.duration("FEEDBACK_DEDUPE_WINDOW", 10*time.Minute),
+		FeedbackWebhookURL:   r.string("FEEDBACK_WEBHOOK_URL", ""),
+
+		GitHubOwner:               r.string("GITHUB_OWNER", "Etorium0"),
+		GitHubRepo:                r.string("GITHUB_REPO", "EngPal_BE"),
+		GitHubBranch:              r.string("GITHUB_BRANCH", "main"),
+		GitHubToken:               r.string("GITHUB_TOKEN", ""),
+		GitHubCommitCacheDuration: r.duration("GITHUB_COMMIT_CACHE_DURATION", 10*time.Minute),
+
+		ScoreDistributionFile: r.string("SCORE_DISTRIBUTION_FILE", "score_distribution.json"),
+
+		ImageMaxBytes:           r.int("IMAGE_MAX_BYTES", 4<<20),
+		ImageMaxDimension:       r.int("IMAGE_MAX_DIMENSION", 8192),
+		ImageDownscaleDimension: r.int("IMAGE_DOWNSCALE_DIMENSION", 2048),
+
+		OCRBatchMaxBytes:   r.int("OCR_BATCH_MAX_BYTES", 20<<20),
+		OCRCacheTTL:        r.duration("OCR_CACHE_TTL", 24*time.Hour),
+		OCRCacheMaxEntries: r.int("OCR_CACHE_MAX_ENTRIES", 500),
 	}
+	cfg.ImageMaxEncodedBytes = r.int("IMAGE_MAX_ENCODED_BYTES", (cfg.ImageMaxBytes+2)/3*4)
+
+	for mode, limit := range defaultChatWordLimits {
+		cfg.ChatWordLimits[mode] = r.int("CHAT_MAX_WORDS_"+strings.ToUpper(mode), limit)
+	}
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if name, found := strings.CutPrefix(key, chatbotSafetyPrefix); found && value != "" {
+			if value = strings.ToUpper(strings.TrimSpace(value)); contains(safetyThresholds, value) {
+				cfg.ChatbotSafety[name] = value
+			} else {
+				r.invalid(key, "must be one of "+strings.Join(safetyThresholds, ", "))
+			}
+		}
+	}
+	for _, mimeType := range r.list("IMAGE_ALLOWED_TYPES") {
+		if mimeType = strings.ToLower(mimeType); contains(supportedImageTypes, mimeType) {
+			cfg.ImageAllowedTypes = append(cfg.ImageAllowedTypes, mimeType)
+		} else {
+			r.invalid("IMAGE_ALLOWED_TYPES", "only "+strings.Join(supportedImageTypes, ", ")+" are supported")
+		}
+	}
+	if len(cfg.ImageAllowedTypes) == 0 {
+		cfg.ImageAllowedTypes = supportedImageTypes
+	}
+	for _, proxy := range r.list("TRUSTED_PROXIES") {
+		if prefix, err := parseProxy(proxy); err == nil {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, prefix)
+		} else {
+			r.invalid("TRUSTED_PROXIES", "must be IP addresses or CIDR ranges, not "+proxy)
+		}
+	}
+
+	if cfg.GeminiAPIKey == "" {
+		r.errs = append(r.errs, errors.New("GEMINI_API_KEY is required"))
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		r.invalid("PORT", "must be a port number")
+		cfg.Port = "8080"
+	}
+	if cfg.FeedbackWebhookURL != "" {
+		if parsed, err := url.Parse(cfg.FeedbackWebhookURL); err != nil || parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" {
+			r.invalid("FEEDBACK_WEBHOOK_URL", "must be an http(s) URL")
+			cfg.FeedbackWebhookURL = ""
+		}
+	}
+	return cfg, errors.Join(r.errs...)
+}
+
+// Reads environment variables, collecting the values that cannot be used
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) invalid(key, reason string) {
+	r.errs = append(r.errs, fmt.Errorf("%s %s", key, reason))
 }
 
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+func (r *envReader) string(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists && strings.TrimSpace(value) != "" {
+		return strings.TrimSpace(value)
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// A positive integer
+func (r *envReader) int(key string, defaultValue int) int {
+	raw := r.string(key, "")
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		r.invalid(key, "must be a positive integer")
+		return defaultValue
+	}
+	return value
+}
+
+// A number above 0 and at most 1
+func (r *envReader) fraction(key string, defaultValue float64) float64 {
+	raw := r.string(key, "")
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value <= 0 || value > 1 {
+		r.invalid(key, "must be a number above 0 and at most 1")
+		return defaultValue
+	}
+	return value
+}
+
+// A positive duration such as 30s or 1h
+func (r *envReader) duration(key string, defaultValue time.Duration) time.Duration {
+	raw := r.string(key, "")
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		r.invalid(key, "must be a positive duration such as 30s or 1h")
+		return defaultValue
+	}
+	return value
+}
+
+func (r *envReader) bool(key string, defaultValue bool) bool {
+	raw := r.string(key, "")
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		r.invalid(key, "must be true or false")
+		return defaultValue
+	}
+	return value
+}
+
+// Comma-separated values, trimmed and without empty ones
+func (r *envReader) list(key string) []string {
+	var values []string
+	for _, value := range strings.Split(r.string(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// An IP address, as a range of one, or a CIDR range
+func parseProxy(value string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	return prefix.Masked(), err
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// The configuration the functions below return
+var current atomic.Pointer[Config]
+
+// Use makes cfg the configuration every package reads. main calls it with the
+// result of Load before serving.
+func Use(cfg *Config) {
+	current.Store(cfg)
+}
+
+// The configuration given to Use or, before it is called (in tools and tests), one
+// loaded from the environment with defaults for unusable values
+func get() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	cfg, _ := Load()
+	current.CompareAndSwap(nil, cfg)
+	return current.Load()
+}
+
+// ChatWordLimit returns the question word limit for a chatbot mode,
+// overridable with CHAT_MAX_WORDS_<MODE> (e.g. CHAT_MAX_WORDS_GRAMMAR_CHECK=80).
+func ChatWordLimit(mode string) int {
+	limits := get().ChatWordLimits
+	if limit, exists := limits[mode]; exists {
+		return limit
+	}
+	return limits["chat"]
+}
+
+// ChatbotSafetyThreshold returns the Gemini safety threshold set for a harm category
+// with CHATBOT_SAFETY_<CATEGORY>, else the one set with CHATBOT_SAFETY_THRESHOLD, or
+// "" for the default.
+func ChatbotSafetyThreshold(category string) string {
+	safety := get().ChatbotSafety
+	if threshold, exists := safety[category]; exists {
+		return threshold
+	}
+	return safety["THRESHOLD"]
+}
+
+// QuizDedupThreshold returns the bigram similarity above which two generated quiz
+// questions count as duplicates, overridable with QUIZ_DEDUP_THRESHOLD (0-1, default 0.5).
+func QuizDedupThreshold() float64 {
+	return get().QuizDedupThreshold
+}
+
+// ChatbotStrictMode reports whether the chatbot refuses every question that is not
+// about learning English, set with CHATBOT_STRICT_MODE=true.
+func ChatbotStrictMode() bool {
+	return get().ChatbotStrictMode
+}
+
+// AllowedOrigins returns the browser origins WebSocket connections are accepted
+// from (ALLOWED_ORIGINS), or nil for the server's own host only.
+func AllowedOrigins() []string {
+	return get().AllowedOrigins
+}
+
+// TrustedProxies returns the proxies whose X-Forwarded-For header is trusted
+// (TRUSTED_PROXIES), or nil to use the peer address of every request.
+func TrustedProxies() []netip.Prefix {
+	return get().TrustedProxies
+}
+
+// JWTSecret returns the HS256 secret access tokens are signed with (JWT_SECRET).
+// Endpoints that need a token are unavailable while it is empty.
+func JWTSecret() string {
+	return get().JWTSecret
+}
+
+// ChatMessageFile returns the JSON Lines file chatbot answers and the feedback on them
+// are stored in, overridable with CHAT_MESSAGE_FILE.
+func ChatMessageFile() string {
+	return get().ChatMessageFile
+}
+
+// FeedbackFile returns the JSON Lines file user feedback is stored in, overridable
+// with FEEDBACK_FILE.
+func FeedbackFile() string {
+	return get().FeedbackFile
+}
+
+// FeedbackRateLimit returns how many feedback submissions one IP may send per
+// minute, overridable with FEEDBACK_RATE_LIMIT (default 5).
+func FeedbackRateLimit() int {
+	return get().FeedbackRateLimit
+}
+
+// FeedbackMaxBodyBytes returns the largest feedback request body accepted,
+// overridable with FEEDBACK_MAX_BODY_BYTES (default 16 KB).
+func FeedbackMaxBodyBytes() int64 {
+	return get().FeedbackMaxBodyBytes
+}
+
+// FeedbackDedupeWindow returns how long an identical feedback text is dropped as a
+// repeat, overridable with FEEDBACK_DEDUPE_WINDOW (e.g. 1h, default 10 minutes).
+func FeedbackDedupeWindow() time.Duration {
+	return get().FeedbackDedupeWindow
+}
+
+// FeedbackWebhookURL returns the Discord or Slack incoming webhook new feedback is
+// forwarded to (FEEDBACK_WEBHOOK_URL). Feedback is not forwarded while it is empty.
+func FeedbackWebhookURL() string {
+	return get().FeedbackWebhookURL
+}
+
+// GitHubOwner, GitHubRepo and GitHubBranch name the branch whose latest commit is
+// reported, overridable with GITHUB_OWNER, GITHUB_REPO and GITHUB_BRANCH.
+func GitHubOwner() string {
+	return get().GitHubOwner
+}
+
+func GitHubRepo() string {
+	return get().GitHubRepo
+}
+
+func GitHubBranch() string {
+	return get().GitHubBranch
+}
+
+// GitHubToken returns the optional token sent to the GitHub API for a higher rate
+// limit (GITHUB_TOKEN).
+func GitHubToken() string {
+	return get().GitHubToken
+}
+
+// GitHubCommitCacheDuration returns how long the latest commit is served from the
+// cache before GitHub is asked again, overridable with GITHUB_COMMIT_CACHE_DURATION
+// (e.g. 30m, default 10 minutes).
+func GitHubCommitCacheDuration() time.Duration {
+	return get().GitHubCommitCacheDuration
+}
+
+// ScoreDistributionFile returns where the peer comparison score distribution is kept
+// between restarts, overridable with SCORE_DISTRIBUTION_FILE.
+func ScoreDistributionFile() string {
+	return get().ScoreDistributionFile
+}
+
+// ShutdownTimeout returns how long in-flight requests may take to finish on
+// shutdown, overridable with SHUTDOWN_TIMEOUT (e.g. 60s, default 30s).
+func ShutdownTimeout() time.Duration {
+	return get().ShutdownTimeout
+}
+
+// ChatSessionIdleTimeout returns how long a chatbot session may go without a message
+// before it expires, overridable with CHAT_SESSION_IDLE_TIMEOUT (e.g. 12h, default 24h).
+func ChatSessionIdleTimeout() time.Duration {
+	return get().ChatSessionIdleTimeout
+}
+
+// ChatSessionRetention returns how long a chatbot session is kept at most, however
+// active, overridable with CHAT_SESSION_RETENTION (e.g. 240h, default 30 days).
+func ChatSessionRetention() time.Duration {
+	return get().ChatSessionRetention
+}
+
+// ChatHistoryTurns returns how many of a session's latest turns are always sent to
+// Gemini verbatim, overridable with CHAT_HISTORY_TURNS (default 6).
+func ChatHistoryTurns() int {
+	return get().ChatHistoryTurns
+}
+
+// ChatHistoryTokenBudget returns how many tokens of session history a chat prompt may
+// carry before older turns are summarized, overridable with CHAT_HISTORY_TOKEN_BUDGET
+// (default 6000).
+func ChatHistoryTokenBudget() int {
+	return get().ChatHistoryTokenBudget
+}
+
+// ChatRateLimit returns how many chatbot messages one user may send per minute,
+// overridable with CHAT_RATE_LIMIT (default 10).
+func ChatRateLimit() int {
+	return get().ChatRateLimit
+}
+
+// ChatDailyQuota returns how many chatbot messages one user may send per UTC day,
+// overridable with CHAT_DAILY_QUOTA (default 200).
+func ChatDailyQuota() int {
+	return get().ChatDailyQuota
+}
+
+// ImageMaxBytes returns the largest decoded image accepted, overridable with
+// IMAGE_MAX_BYTES (default 4 MB).
+func ImageMaxBytes() int {
+	return get().ImageMaxBytes
+}
+
+// ImageMaxEncodedBytes returns the longest base64 image accepted, overridable with
+// IMAGE_MAX_ENCODED_BYTES (default: the base64 length of ImageMaxBytes).
+func ImageMaxEncodedBytes() int {
+	return get().ImageMaxEncodedBytes
+}
+
+// ImageMaxDimension returns the largest image width or height accepted in pixels,
+// overridable with IMAGE_MAX_DIMENSION (default 8192).
+func ImageMaxDimension() int {
+	return get().ImageMaxDimension
+}
+
+// ImageAllowedTypes returns the accepted image MIME types, overridable with a
+// comma-separated IMAGE_ALLOWED_TYPES limited to image/jpeg, image/png and image/webp.
+func ImageAllowedTypes() []string {
+	return get().ImageAllowedTypes
+}
+
+// ImageDownscaleDimension returns the width or height above which images are
+// downscaled before being sent to Gemini, overridable with IMAGE_DOWNSCALE_DIMENSION
+// (default 2048).
+func ImageDownscaleDimension() int {
+	return get().ImageDownscaleDimension
+}
+
+// OCRBatchMaxBytes returns the combined size of the decoded images accepted in one
+// OCR batch, overridable with OCR_BATCH_MAX_BYTES (default 20 MB).
+func OCRBatchMaxBytes() int {
+	return get().OCRBatchMaxBytes
+}
+
+// OCRCacheTTL returns how long text extracted from an image is reused for the same
+// image, overridable with OCR_CACHE_TTL (e.g. 6h, default 24h).
+func OCRCacheTTL() time.Duration {
+	return get().OCRCacheTTL
+}
+
+// OCRCacheMaxEntries returns how many extracted images are cached at most,
+// overridable with OCR_CACHE_MAX_ENTRIES (default 500).
+func OCRCacheMaxEntries() int {
+	return get().OCRCacheMaxEntries
+}
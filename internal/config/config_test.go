@@ -0,0 +1,188 @@
+package config
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Variables the tests set, cleared first so the environment running the tests
+// cannot change the outcome
+var testedVariables = []string{
+	"PORT", "GEMINI_API_KEY", "SHUTDOWN_TIMEOUT", "ALLOWED_ORIGINS", "CHATBOT_STRICT_MODE",
+	"QUIZ_DEDUP_THRESHOLD", "CHAT_RATE_LIMIT", "CHAT_MAX_WORDS_CHAT", "CHAT_MAX_WORDS_GRAMMAR_CHECK",
+	"CHATBOT_SAFETY_THRESHOLD", "CHATBOT_SAFETY_HARASSMENT", "FEEDBACK_WEBHOOK_URL",
+	"IMAGE_MAX_BYTES", "IMAGE_MAX_ENCODED_BYTES", "IMAGE_ALLOWED_TYPES", "OCR_CACHE_TTL",
+	"CHAT_MESSAGE_FILE", "TRUSTED_PROXIES",
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		check    func(cfg *Config) bool
+		wantErrs []string // Parts of the error, one per unusable value
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{},
+			check: func(cfg *Config) bool {
+				return cfg.Port == "8080" && cfg.ShutdownTimeout == 30*time.Second && !cfg.ChatbotStrictMode &&
+					cfg.QuizDedupThreshold == 0.5 && cfg.ChatWordLimits["grammar_check"] == 60 &&
+					cfg.ImageMaxBytes == 4<<20 && cfg.ImageMaxEncodedBytes == (4<<20+2)/3*4 &&
+					reflect.DeepEqual(cfg.ImageAllowedTypes, supportedImageTypes) && len(cfg.ChatbotSafety) == 0 &&
+					cfg.AllowedOrigins == nil && cfg.FeedbackWebhookURL == "" && cfg.ChatMessageFile == "chat_messages.jsonl" &&
+					cfg.TrustedProxies == nil
+			},
+		},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"PORT": " 9090 ", "SHUTDOWN_TIMEOUT": "45s", "ALLOWED_ORIGINS": "https://a.example, ,https://b.example",
+				"CHATBOT_STRICT_MODE": "true", "QUIZ_DEDUP_THRESHOLD": "0.8", "CHAT_MAX_WORDS_GRAMMAR_CHECK": "80",
+				"CHATBOT_SAFETY_HARASSMENT": "block_only_high", "FEEDBACK_WEBHOOK_URL": "https://hooks.slack.com/services/x",
+				"IMAGE_MAX_BYTES": "3000", "IMAGE_ALLOWED_TYPES": "IMAGE/PNG, image/webp", "OCR_CACHE_TTL": "1h",
+				"CHAT_MESSAGE_FILE": "/data/chat_messages.jsonl", "TRUSTED_PROXIES": "10.0.0.0/8, ::ffff:192.0.2.1,2001:db8::/32",
+			},
+			check: func(cfg *Config) bool {
+				return cfg.Port == "9090" && cfg.ShutdownTimeout == 45*time.Second &&
+					reflect.DeepEqual(cfg.AllowedOrigins, []string{"https://a.example", "https://b.example"}) &&
+					cfg.ChatbotStrictMode && cfg.QuizDedupThreshold == 0.8 && cfg.ChatWordLimits["grammar_check"] == 80 &&
+					cfg.ChatWordLimits["chat"] == 30 && cfg.ChatbotSafety["HARASSMENT"] == "BLOCK_ONLY_HIGH" &&
+					cfg.FeedbackWebhookURL == "https://hooks.slack.com/services/x" &&
+					cfg.ImageMaxBytes == 3000 && cfg.ImageMaxEncodedBytes == 4000 &&
+					reflect.DeepEqual(cfg.ImageAllowedTypes, []string{"image/png", "image/webp"}) && cfg.OCRCacheTTL == time.Hour &&
+					cfg.ChatMessageFile == "/data/chat_messages.jsonl" &&
+					reflect.DeepEqual(cfg.TrustedProxies, []netip.Prefix{
+						netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("2001:db8::/32"),
+					})
+			},
+		},
+		{
+			name:     "missing Gemini key",
+			env:      map[string]string{"GEMINI_API_KEY": "  "},
+			check:    func(cfg *Config) bool { return cfg.GeminiAPIKey == "" },
+			wantErrs: []string{"GEMINI_API_KEY is required"},
+		},
+		{
+			name:     "port out of range",
+			env:      map[string]string{"PORT": "70000"},
+			check:    func(cfg *Config) bool { return cfg.Port == "8080" },
+			wantErrs: []string{"PORT must be a port number"},
+		},
+		{
+			name:     "negative integer",
+			env:      map[string]string{"CHAT_RATE_LIMIT": "-1"},
+			check:    func(cfg *Config) bool { return cfg.ChatRateLimit == 10 },
+			wantErrs: []string{"CHAT_RATE_LIMIT must be a positive integer"},
+		},
+		{
+			name:     "fraction above one",
+			env:      map[string]string{"QUIZ_DEDUP_THRESHOLD": "1.5"},
+			check:    func(cfg *Config) bool { return cfg.QuizDedupThreshold == 0.5 },
+			wantErrs: []string{"QUIZ_DEDUP_THRESHOLD must be a number above 0 and at most 1"},
+		},
+		{
+			name:     "duration without unit",
+			env:      map[string]string{"SHUTDOWN_TIMEOUT": "30"},
+			check:    func(cfg *Config) bool { return cfg.ShutdownTimeout == 30*time.Second },
+			wantErrs: []string{"SHUTDOWN_TIMEOUT must be a positive duration"},
+		},
+		{
+			name:     "not a boolean",
+			env:      map[string]string{"CHATBOT_STRICT_MODE": "sometimes"},
+			check:    func(cfg *Config) bool { return !cfg.ChatbotStrictMode },
+			wantErrs: []string{"CHATBOT_STRICT_MODE must be true or false"},
+		},
+		{
+			name:     "unknown safety threshold",
+			env:      map[string]string{"CHATBOT_SAFETY_THRESHOLD": "BLOCK_EVERYTHING"},
+			check:    func(cfg *Config) bool { return cfg.ChatbotSafety["THRESHOLD"] == "" },
+			wantErrs: []string{"CHATBOT_SAFETY_THRESHOLD must be one of"},
+		},
+		{
+			name:     "webhook URL without scheme",
+			env:      map[string]string{"FEEDBACK_WEBHOOK_URL": "hooks.slack.com/services/x"},
+			check:    func(cfg *Config) bool { return cfg.FeedbackWebhookURL == "" },
+			wantErrs: []string{"FEEDBACK_WEBHOOK_URL must be an http(s) URL"},
+		},
+		{
+			name:     "unsupported image type",
+			env:      map[string]string{"IMAGE_ALLOWED_TYPES": "image/gif"},
+			check:    func(cfg *Config) bool { return reflect.DeepEqual(cfg.ImageAllowedTypes, supportedImageTypes) },
+			wantErrs: []string{"IMAGE_ALLOWED_TYPES only image/jpeg, image/png, image/webp are supported"},
+		},
+		{
+			name:     "trusted proxy that is not an address",
+			env:      map[string]string{"TRUSTED_PROXIES": "10.0.0.1, proxy.internal"},
+			check:    func(cfg *Config) bool { return reflect.DeepEqual(cfg.TrustedProxies, []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}) },
+			wantErrs: []string{"TRUSTED_PROXIES must be IP addresses or CIDR ranges, not proxy.internal"},
+		},
+		{
+			name:     "every problem reported at once",
+			env:      map[string]string{"GEMINI_API_KEY": "", "PORT": "http", "OCR_CACHE_TTL": "-1h", "CHAT_MAX_WORDS_CHAT": "many"},
+			check:    func(cfg *Config) bool { return cfg.OCRCacheTTL == 24*time.Hour && cfg.ChatWordLimits["chat"] == 30 },
+			wantErrs: []string{"GEMINI_API_KEY is required", "PORT must be", "OCR_CACHE_TTL must be", "CHAT_MAX_WORDS_CHAT must be"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range testedVariables {
+				t.Setenv(key, "")
+			}
+			t.Setenv("GEMINI_API_KEY", "test-gemini-key")
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load()
+			if !test.check(cfg) {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+			if len(test.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("err = %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("err = nil, want %q", test.wantErrs)
+			}
+			if lines := strings.Split(err.Error(), "\n"); len(lines) != len(test.wantErrs) {
+				t.Errorf("got %d errors, want %d: %v", len(lines), len(test.wantErrs), err)
+			}
+			for _, want := range test.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGettersReadTheConfigInUse(t *testing.T) {
+	original := current.Load()
+	t.Cleanup(func() { current.Store(original) })
+
+	cfg, _ := Load()
+	cfg.FeedbackRateLimit = 42
+	cfg.ChatWordLimits = map[string]int{"chat": 25, "define": 3}
+	cfg.ChatbotSafety = map[string]string{"THRESHOLD": "BLOCK_NONE", "HARASSMENT": "BLOCK_ONLY_HIGH"}
+	Use(cfg)
+
+	if FeedbackRateLimit() != 42 {
+		t.Errorf("FeedbackRateLimit() = %d, want 42", FeedbackRateLimit())
+	}
+	for mode, want := range map[string]int{"define": 3, "chat": 25, "unknown": 25} {
+		if got := ChatWordLimit(mode); got != want {
+			t.Errorf("ChatWordLimit(%q) = %d, want %d", mode, got, want)
+		}
+	}
+	for category, want := range map[string]string{"HARASSMENT": "BLOCK_ONLY_HIGH", "HATE_SPEECH": "BLOCK_NONE"} {
+		if got := ChatbotSafetyThreshold(category); got != want {
+			t.Errorf("ChatbotSafetyThreshold(%q) = %q, want %q", category, got, want)
+		}
+	}
+}
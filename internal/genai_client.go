@@ -2,26 +2,91 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"log"
-	"os"
+	"net/http"
+	"time"
+
+	"EngPal/stats"
 
 	"google.golang.org/genai"
 )
 
 var GeminiClient *genai.Client
 
-func InitGeminiClient() {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("GEMINI_API_KEY not set")
-	}
+func InitGeminiClient(apiKey string) {
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
+		APIKey:     apiKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: &http.Client{Transport: geminiMetricsTransport{base: http.DefaultTransport}},
 	})
 	if err != nil {
 		log.Fatalf("Failed to create Gemini client: %v", err)
 	}
 	GeminiClient = client
 }
+
+// GeminiCallsDependency names the Gemini calls in the health history.
+const GeminiCallsDependency = "gemini_calls"
+
+// Records the outcome of every request the Gemini client makes in the health history
+type geminiMetricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t geminiMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	startTime := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(startTime)
+	switch {
+	case err != nil:
+		stats.RecordHealth(GeminiCallsDependency, false, latency, transportErrorType(err))
+	case resp.StatusCode >= 400:
+		stats.RecordHealth(GeminiCallsDependency, false, latency, statusErrorType(resp.StatusCode))
+	default:
+		stats.RecordHealth(GeminiCallsDependency, true, latency, "")
+	}
+	return resp, err
+}
+
+func transportErrorType(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "network"
+}
+
+func statusErrorType(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "auth"
+	case status == http.StatusServiceUnavailable:
+		return "unavailable"
+	case status >= 500:
+		return "server_error"
+	}
+	return "client_error"
+}
+
+// TokenUsage is the token accounting Gemini reports for a single call.
+type TokenUsage struct {
+	PromptTokens int
+	OutputTokens int
+}
+
+// UsageOf reads the token usage from a Gemini response.
+func UsageOf(result *genai.GenerateContentResponse) TokenUsage {
+	if result == nil || result.UsageMetadata == nil {
+		return TokenUsage{}
+	}
+	return TokenUsage{
+		PromptTokens: int(result.UsageMetadata.PromptTokenCount),
+		OutputTokens: int(result.UsageMetadata.CandidatesTokenCount + result.UsageMetadata.ThoughtsTokenCount),
+	}
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// ModelCooldown is how long an overloaded model is skipped before it is tried again.
+const ModelCooldown = 2 * time.Minute
+
+// Models that recently failed as overloaded, shared by all requests
+var (
+	modelCooldowns      = make(map[string]time.Time)
+	modelCooldownsMutex sync.Mutex
+)
+
+// IsOverloaded reports whether a Gemini error means the model is overloaded or rate limited.
+func IsOverloaded(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// MarkOverloaded skips a model for ModelCooldown.
+func MarkOverloaded(model string) {
+	modelCooldownsMutex.Lock()
+	defer modelCooldownsMutex.Unlock()
+	modelCooldowns[model] = time.Now().Add(ModelCooldown)
+	log.Printf("Model %s is overloaded, skipping it for %s", model, ModelCooldown)
+}
+
+// AvailableModels returns the models of a fallback chain that are not cooling down,
+// in order. If all of them are, the whole chain is returned rather than none.
+func AvailableModels(chain []string) []string {
+	modelCooldownsMutex.Lock()
+	defer modelCooldownsMutex.Unlock()
+
+	now := time.Now()
+	available := make([]string, 0, len(chain))
+	for _, model := range chain {
+		if until, cooling := modelCooldowns[model]; cooling && now.Before(until) {
+			continue
+		}
+		available = append(available, model)
+	}
+	if len(available) == 0 {
+		return chain
+	}
+	return available
+}
+
+// GenerateWithFallback calls each available model of the chain in order until one
+// is not overloaded, and returns its response together with the model that answered.
+// Errors other than overload are returned straight away.
+func GenerateWithFallback(ctx context.Context, chain []string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, string, error) {
+	if GeminiClient == nil {
+		return nil, "", errors.New("Gemini client not initialized")
+	}
+
+	var err error
+	for _, model := range AvailableModels(chain) {
+		var result *genai.GenerateContentResponse
+		result, err = GeminiClient.Models.GenerateContent(ctx, model, contents, config)
+		if err == nil {
+			return result, model, nil
+		}
+		if !IsOverloaded(err) {
+			return nil, model, err
+		}
+		MarkOverloaded(model)
+	}
+	return nil, "", err
+}
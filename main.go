@@ -1,25 +1,131 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"EngPal/handler"
 	"EngPal/internal"
+	"EngPal/internal/buildinfo"
+	"EngPal/internal/config"
+	"EngPal/repository/repo_impl"
 	"EngPal/router"
+	"EngPal/security"
+	"EngPal/stats"
 
 	"github.com/joho/godotenv"
 )
 
+// Time between failing /readyz and closing the listener, so load balancers stop routing here
+const SHUTDOWN_DRAIN_DELAY = 5 * time.Second
+
 func main() {
+	// Every log line goes through the redactor, so secrets never reach the logs
+	log.SetOutput(security.NewRedactingWriter(os.Stderr))
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("No .env file found or error loading .env")
 	}
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	config.Use(cfg)
+	for _, secret := range []string{cfg.GeminiAPIKey, cfg.JWTSecret, cfg.GitHubToken, cfg.FeedbackWebhookURL} {
+		security.RegisterSecret(secret)
+	}
+
+	handler.RegisterReadiness(handler.READINESS_CONFIG, handler.READINESS_GEMINI_CLIENT, handler.READINESS_CHAT_SESSION_SWEEPER,
+		handler.READINESS_CHAT_MESSAGE_SWEEPER)
+
+	build := buildinfo.Get()
+	log.Printf("EngPal %s (commit %s, built %s, %s), Gemini models: %s",
+		build.Version, build.Commit, build.BuildTime, build.GoVersion, strings.Join(handler.GeminiModels(), ", "))
+
+	handler.MarkReady(handler.READINESS_CONFIG)
+
+	internal.InitGeminiClient(cfg.GeminiAPIKey)
+	handler.SetChatQuotaRepo(repo_impl.NewChatQuotaRepoImpl())
+	handler.MarkReady(handler.READINESS_GEMINI_CLIENT)
+
+	// Background workers stop once the server has drained
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	handler.StartChatSessionSweeper(workersCtx)
+	if err := stats.Load(cfg.ScoreDistributionFile); err != nil {
+		log.Printf("Could not load score distribution: %v", err)
+	}
+	feedbackRepo, err := repo_impl.NewFeedbackRepoImpl(cfg.FeedbackFile)
+	if err != nil {
+		log.Fatalf("Could not open feedback store: %v", err)
+	}
+	handler.SetFeedbackRepo(feedbackRepo)
+	webhookWorkerDone := handler.StartFeedbackWebhookWorker(workersCtx)
+	chatMessageRepo, err := repo_impl.NewChatMessageRepoImpl(cfg.ChatMessageFile)
+	if err != nil {
+		log.Fatalf("Could not open chat message store: %v", err)
+	}
+	handler.SetChatMessageRepo(chatMessageRepo)
+	chatMessageSweeperDone := handler.StartChatMessageSweeper(workersCtx)
+	handler.SetGitHubRepo(repo_impl.NewGitHubRepoImpl(cfg))
+
+	healthcheckHandler := handler.NewHealthcheckHandler(repo_impl.NewHealthcheckRepoImpl(feedbackRepo), cfg.GeminiAPIKey)
+
+	r := router.SetupRouter(healthcheckHandler)
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: handler.Recoverer(handler.RequestLogger(r))}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Server is running on port %s...", cfg.Port)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serveUntilDone(ctx, server, listener, SHUTDOWN_DRAIN_DELAY, cfg.ShutdownTimeout); err != nil {
+		log.Printf("Shutdown did not finish cleanly: %v", err)
+	}
+	stopWorkers()
+	<-webhookWorkerDone // It may still be recording a delivery in the feedback store
+	<-chatMessageSweeperDone
+
+	if err := stats.Save(cfg.ScoreDistributionFile); err != nil {
+		log.Printf("Could not save score distribution: %v", err)
+	}
+	if err := feedbackRepo.Close(); err != nil {
+		log.Printf("Could not close feedback store: %v", err)
+	}
+	if err := chatMessageRepo.Close(); err != nil {
+		log.Printf("Could not close chat message store: %v", err)
+	}
+	log.Println("Server stopped")
+}
 
-	internal.InitGeminiClient()
+// Serve on the listener until ctx is done (SIGINT/SIGTERM in main). Then fail the
+// probes first, wait drainDelay for load balancers to stop routing here, and let
+// in-flight requests finish for up to timeout.
+func serveUntilDone(ctx context.Context, server *http.Server, listener net.Listener, drainDelay, timeout time.Duration) error {
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
 
-	r := router.SetupRouter()
+	log.Println("Shutting down...")
+	handler.BeginShutdown()
+	time.Sleep(drainDelay)
 
-	log.Println("Server is running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
 }
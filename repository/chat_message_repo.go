@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"EngPal/entities"
+)
+
+var ErrChatMessageNotFound = errors.New("chat message not found")
+
+type ChatMessageRepo interface {
+	// Create stores an answer under its message ID.
+	Create(message *entities.ChatMessage) error
+	// Get returns the answer with the ID, or ErrChatMessageNotFound.
+	Get(messageID string) (*entities.ChatMessage, error)
+	// SetFeedback records feedback on an answer under key, replacing earlier feedback
+	// with the same key. Returns ErrChatMessageNotFound for an unknown ID.
+	SetFeedback(messageID, key string, feedback entities.ChatFeedback) error
+	// ListDownRated returns up to limit down ratings with their answers, most
+	// recent feedback first.
+	ListDownRated(limit int) ([]entities.RatedChatMessage, error)
+	// DeleteBefore deletes the answers created before cutoff and returns how many
+	// it deleted.
+	DeleteBefore(cutoff time.Time) (int, error)
+}
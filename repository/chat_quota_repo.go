@@ -0,0 +1,20 @@
+package repository
+
+import "time"
+
+// ChatQuotaUsage is how much of its chatbot limits one identity has used in the
+// current minute and UTC day.
+type ChatQuotaUsage struct {
+	MinuteCount   int
+	MinuteResetAt time.Time
+	DailyCount    int
+	DailyResetAt  time.Time
+}
+
+type ChatQuotaRepo interface {
+	// Consume counts a message for the identity unless it has already sent perMinute
+	// messages this minute or perDay today, and returns its usage afterwards.
+	Consume(identity string, now time.Time, perMinute, perDay int) (ChatQuotaUsage, bool)
+	// Usage returns the identity's usage without counting a message.
+	Usage(identity string, now time.Time) ChatQuotaUsage
+}
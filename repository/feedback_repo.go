@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"EngPal/entities"
+)
+
+// FeedbackFilter selects a page of feedback, newest first. Zero From/To leave
+// that end of the date range open.
+type FeedbackFilter struct {
+	Limit  int
+	Offset int
+	From   time.Time
+	To     time.Time
+}
+
+var ErrFeedbackNotFound = errors.New("feedback not found")
+
+type FeedbackRepo interface {
+	// Create stores the feedback, setting its ID.
+	Create(feedback *entities.Feedback) error
+	// List returns the matching page and the total number of matches.
+	List(filter FeedbackFilter) ([]entities.Feedback, int, error)
+	// Summary aggregates the feedback created since the given time, listing up to
+	// recentLimit of the newest items rated at or below lowRating.
+	Summary(since time.Time, lowRating, recentLimit int) (*entities.FeedbackSummary, error)
+	// UpdateWebhookStatus records how forwarding the feedback to the webhook went.
+	// Returns ErrFeedbackNotFound for an unknown ID.
+	UpdateWebhookStatus(id int64, status, errorMessage string) error
+}
@@ -1,5 +1,27 @@
 package repository
 
+import (
+	"fmt"
+
+	"EngPal/entities"
+)
+
+// GitHubError is a failed or unusable response from the GitHub API. StatusCode is 0
+// when GitHub could not be reached.
+type GitHubError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *GitHubError) Error() string {
+	if e.StatusCode == 0 {
+		return "github: " + e.Message
+	}
+	return fmt.Sprintf("github: %d %s", e.StatusCode, e.Message)
+}
+
 type GitHubRepo interface {
-    FetchData()
-}
\ No newline at end of file
+	// LatestCommit returns the newest commit on the configured branch. Failures are
+	// returned as *GitHubError.
+	LatestCommit() (*entities.Commit, error)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// HealthStats are figures about the running process.
+type HealthStats struct {
+	UptimeSeconds int64
+	Goroutines    int
+}
+
+type HealthcheckRepo interface {
+	// PingGemini makes a cheap call with the server's Gemini client and returns how
+	// long it took.
+	PingGemini(ctx context.Context) (time.Duration, error)
+	// CheckAPIKey lists the models a Gemini API key can reach, keeping the given ones.
+	CheckAPIKey(ctx context.Context, apiKey string, models []string) ([]string, error)
+	// PingStore checks that the feedback store can still be written.
+	PingStore(ctx context.Context) error
+	// Stats returns figures about the running process.
+	Stats() HealthStats
+}
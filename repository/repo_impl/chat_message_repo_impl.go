@@ -0,0 +1,214 @@
+package repo_impl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"EngPal/entities"
+	"EngPal/repository"
+)
+
+// ChatMessageRepoImpl keeps chatbot answers in memory and appends every answer to a
+// JSON Lines file, which is read back on startup. Feedback appends the whole answer
+// again; the last line for a message ID wins. Deleting answers rewrites the file.
+type ChatMessageRepoImpl struct {
+	path     string
+	messages map[string]*entities.ChatMessage // Replaced on feedback, never changed in place, so copies may share their maps
+	mutex    sync.Mutex
+	appendTo *os.File
+}
+
+// NewChatMessageRepoImpl loads the answers stored at path, creating the file if needed.
+func NewChatMessageRepoImpl(path string) (*ChatMessageRepoImpl, error) {
+	repo := &ChatMessageRepoImpl{path: path, messages: make(map[string]*entities.ChatMessage)}
+
+	file, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			var message entities.ChatMessage
+			if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			if message.Feedback == nil {
+				message.Feedback = make(map[string]entities.ChatFeedback)
+			}
+			repo.messages[message.MessageID] = &message
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	repo.appendTo, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *ChatMessageRepoImpl) Create(message *entities.ChatMessage) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := *message
+	stored.Feedback = maps.Clone(message.Feedback)
+	if stored.Feedback == nil {
+		stored.Feedback = make(map[string]entities.ChatFeedback)
+	}
+	if err := r.write(&stored); err != nil {
+		return err
+	}
+	r.messages[stored.MessageID] = &stored
+	return nil
+}
+
+func (r *ChatMessageRepoImpl) Get(messageID string) (*entities.ChatMessage, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	message, found := r.messages[messageID]
+	if !found {
+		return nil, repository.ErrChatMessageNotFound
+	}
+	copied := *message
+	copied.Feedback = maps.Clone(message.Feedback)
+	return &copied, nil
+}
+
+func (r *ChatMessageRepoImpl) SetFeedback(messageID, key string, feedback entities.ChatFeedback) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	message, found := r.messages[messageID]
+	if !found {
+		return repository.ErrChatMessageNotFound
+	}
+	updated := *message
+	updated.Feedback = maps.Clone(message.Feedback)
+	updated.Feedback[key] = feedback
+	if err := r.write(&updated); err != nil {
+		return err
+	}
+	r.messages[messageID] = &updated
+	return nil
+}
+
+func (r *ChatMessageRepoImpl) ListDownRated(limit int) ([]entities.RatedChatMessage, error) {
+	r.mutex.Lock()
+	rated := []entities.RatedChatMessage{}
+	for _, message := range r.messages {
+		for _, feedback := range message.Feedback {
+			if feedback.Rating == entities.ChatRatingDown {
+				rated = append(rated, entities.RatedChatMessage{ChatMessage: *message, Feedback: feedback})
+			}
+		}
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(rated, func(i, j int) bool { return rated[i].Feedback.UpdatedAt.After(rated[j].Feedback.UpdatedAt) })
+	if len(rated) > limit {
+		rated = rated[:limit]
+	}
+	return rated, nil
+}
+
+func (r *ChatMessageRepoImpl) DeleteBefore(cutoff time.Time) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	kept := make(map[string]*entities.ChatMessage, len(r.messages))
+	for messageID, message := range r.messages {
+		if !message.CreatedAt.Before(cutoff) {
+			kept[messageID] = message
+		}
+	}
+	deleted := len(r.messages) - len(kept)
+	if deleted == 0 {
+		return 0, nil
+	}
+	if err := r.rewrite(kept); err != nil {
+		return 0, err
+	}
+	r.messages = kept
+	return deleted, nil
+}
+
+// Replace the file with one line per kept answer, oldest first. The caller holds
+// the mutex.
+func (r *ChatMessageRepoImpl) rewrite(kept map[string]*entities.ChatMessage) error {
+	messages := make([]*entities.ChatMessage, 0, len(kept))
+	for _, message := range kept {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
+
+	temporary := r.path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, r.path); err != nil {
+		return err
+	}
+
+	appendTo, err := os.OpenFile(r.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	r.appendTo.Close()
+	r.appendTo = appendTo
+	return nil
+}
+
+// Append an answer line to the file. The caller holds the mutex.
+func (r *ChatMessageRepoImpl) write(message *entities.ChatMessage) error {
+	line, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if _, err := r.appendTo.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return r.appendTo.Sync()
+}
+
+// Close closes the answer file.
+func (r *ChatMessageRepoImpl) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.appendTo.Close()
+}
@@ -0,0 +1,143 @@
+package repo_impl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"EngPal/entities"
+	"EngPal/repository"
+)
+
+func newTestChatMessageRepo(t *testing.T, path string) *ChatMessageRepoImpl {
+	t.Helper()
+	repo, err := NewChatMessageRepoImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestChatMessageRepoImplPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat_messages.jsonl")
+	repo := newTestChatMessageRepo(t, path)
+
+	createdAt := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	message := &entities.ChatMessage{MessageID: "a1", Question: "What is a verb?", Answer: "An action word.", Mode: "chat", CreatedAt: createdAt}
+	if err := repo.Create(message); err != nil {
+		t.Fatal(err)
+	}
+	up := entities.ChatFeedback{Rater: "lan", Rating: entities.ChatRatingUp, UpdatedAt: createdAt.Add(time.Minute)}
+	down := entities.ChatFeedback{Rater: "lan", Rating: entities.ChatRatingDown, Comment: "Too short", UpdatedAt: createdAt.Add(2 * time.Minute)}
+	for _, feedback := range []entities.ChatFeedback{up, down} {
+		if err := repo.SetFeedback("a1", "lan", feedback); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetFeedback("missing", "lan", up); err != repository.ErrChatMessageNotFound {
+		t.Errorf("rating an unknown ID: err = %v, want %v", err, repository.ErrChatMessageNotFound)
+	}
+	repo.Close()
+
+	// A new repo reads the file back, with the last line for an ID winning
+	reopened := newTestChatMessageRepo(t, path)
+	stored, err := reopened.Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message.Feedback = map[string]entities.ChatFeedback{"lan": down}
+	if !reflect.DeepEqual(stored, message) {
+		t.Errorf("reloaded %+v, want %+v", stored, message)
+	}
+	if _, err := reopened.Get("missing"); err != repository.ErrChatMessageNotFound {
+		t.Errorf("getting an unknown ID: err = %v, want %v", err, repository.ErrChatMessageNotFound)
+	}
+}
+
+func TestNewChatMessageRepoImplRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat_messages.jsonl")
+	if err := os.WriteFile(path, []byte(`{"message_id": "a1", "question": "ok"}`+"\n{not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewChatMessageRepoImpl(path); err == nil {
+		t.Error("loading a corrupt file succeeded")
+	}
+}
+
+func TestChatMessageRepoImplListDownRated(t *testing.T) {
+	repo := newTestChatMessageRepo(t, filepath.Join(t.TempDir(), "chat_messages.jsonl"))
+	minute := func(m int) time.Time { return time.Date(2026, 3, 2, 10, m, 0, 0, time.UTC) }
+	for _, messageID := range []string{"a1", "a2", "a3"} {
+		if err := repo.Create(&entities.ChatMessage{MessageID: messageID, CreatedAt: minute(0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ratings := []struct {
+		messageID, key, rating string
+		at                     int
+	}{
+		{"a1", "lan", entities.ChatRatingDown, 1},
+		{"a1", "mai", entities.ChatRatingDown, 4},
+		{"a2", "lan", entities.ChatRatingUp, 2},
+		{"a3", "lan", entities.ChatRatingDown, 3},
+	}
+	for _, r := range ratings {
+		if err := repo.SetFeedback(r.messageID, r.key, entities.ChatFeedback{Rater: r.key, Rating: r.rating, UpdatedAt: minute(r.at)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{10, []string{"a1 mai", "a3 lan", "a1 lan"}},
+		{2, []string{"a1 mai", "a3 lan"}},
+	}
+	for _, test := range tests {
+		rated, err := repo.ListDownRated(test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, message := range rated {
+			got = append(got, message.MessageID+" "+message.Feedback.Rater)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("limit %d: got %v, want %v", test.limit, got, test.want)
+		}
+	}
+}
+
+func TestChatMessageRepoImplDeleteBefore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat_messages.jsonl")
+	repo := newTestChatMessageRepo(t, path)
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+	for d, messageID := range []string{"a1", "a2", "a3"} {
+		if err := repo.Create(&entities.ChatMessage{MessageID: messageID, CreatedAt: day(d + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if deleted, err := repo.DeleteBefore(day(3)); err != nil || deleted != 2 {
+		t.Fatalf("deleted %d, err %v, want 2 deleted", deleted, err)
+	}
+	if deleted, err := repo.DeleteBefore(day(3)); err != nil || deleted != 0 {
+		t.Errorf("deleting again: deleted %d, err %v, want none", deleted, err)
+	}
+	// The file was rewritten and is still appended to
+	if err := repo.Create(&entities.ChatMessage{MessageID: "a4", CreatedAt: day(4)}); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	reopened := newTestChatMessageRepo(t, path)
+	for messageID, wantFound := range map[string]bool{"a1": false, "a2": false, "a3": true, "a4": true} {
+		if _, err := reopened.Get(messageID); (err == nil) != wantFound {
+			t.Errorf("%s: err = %v, want found %v", messageID, err, wantFound)
+		}
+	}
+}
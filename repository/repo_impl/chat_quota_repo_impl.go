@@ -0,0 +1,67 @@
+package repo_impl
+
+import (
+	"sync"
+	"time"
+
+	"EngPal/repository"
+)
+
+// Tracked identities above which those with nothing left to reset are swept
+const CHAT_QUOTA_SWEEP_SIZE = 10000
+
+// ChatQuotaRepoImpl counts chatbot messages in memory, so the counts are shared by
+// every request to this process and reset when it restarts. The minute window
+// starts with an identity's first message in it; the day is the UTC day.
+type ChatQuotaRepoImpl struct {
+	usage map[string]*repository.ChatQuotaUsage
+	mutex sync.Mutex
+}
+
+func NewChatQuotaRepoImpl() *ChatQuotaRepoImpl {
+	return &ChatQuotaRepoImpl{usage: make(map[string]*repository.ChatQuotaUsage)}
+}
+
+func (r *ChatQuotaRepoImpl) Consume(identity string, now time.Time, perMinute, perDay int) (repository.ChatQuotaUsage, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.usage) > CHAT_QUOTA_SWEEP_SIZE {
+		for key, usage := range r.usage {
+			if !usage.DailyResetAt.After(now) {
+				delete(r.usage, key)
+			}
+		}
+	}
+
+	usage := r.current(identity, now)
+	if usage.MinuteCount >= perMinute || usage.DailyCount >= perDay {
+		return *usage, false
+	}
+	usage.MinuteCount++
+	usage.DailyCount++
+	r.usage[identity] = usage
+	return *usage, true
+}
+
+func (r *ChatQuotaRepoImpl) Usage(identity string, now time.Time) repository.ChatQuotaUsage {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return *r.current(identity, now)
+}
+
+// The identity's usage with the windows that have passed reset
+func (r *ChatQuotaRepoImpl) current(identity string, now time.Time) *repository.ChatQuotaUsage {
+	usage, found := r.usage[identity]
+	if !found {
+		usage = &repository.ChatQuotaUsage{}
+	}
+	if !usage.MinuteResetAt.After(now) {
+		usage.MinuteCount = 0
+		usage.MinuteResetAt = now.Add(time.Minute)
+	}
+	if !usage.DailyResetAt.After(now) {
+		usage.DailyCount = 0
+		usage.DailyResetAt = now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	}
+	return usage
+}
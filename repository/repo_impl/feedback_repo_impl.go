@@ -0,0 +1,181 @@
+package repo_impl
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"EngPal/entities"
+	"EngPal/repository"
+)
+
+// FeedbackRepoImpl keeps feedback in memory and appends every item to a JSON Lines
+// file, which is read back on startup. Updates append the whole item again; the
+// last line for an ID wins.
+type FeedbackRepoImpl struct {
+	path     string
+	items    []entities.Feedback // Oldest first
+	nextID   int64
+	mutex    sync.Mutex
+	appendTo *os.File
+}
+
+// NewFeedbackRepoImpl loads the feedback stored at path, creating the file if needed.
+func NewFeedbackRepoImpl(path string) (*FeedbackRepoImpl, error) {
+	repo := &FeedbackRepoImpl{path: path, nextID: 1}
+
+	file, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			var feedback entities.Feedback
+			if err := json.Unmarshal(scanner.Bytes(), &feedback); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			if i, found := repo.index(feedback.ID); found {
+				repo.items[i] = feedback
+			} else {
+				repo.items = append(repo.items, feedback)
+			}
+			repo.nextID = max(repo.nextID, feedback.ID+1)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	repo.appendTo, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *FeedbackRepoImpl) Create(feedback *entities.Feedback) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	feedback.ID = r.nextID
+	if err := r.write(feedback); err != nil {
+		return err
+	}
+	r.nextID++
+	r.items = append(r.items, *feedback)
+	return nil
+}
+
+func (r *FeedbackRepoImpl) UpdateWebhookStatus(id int64, status, errorMessage string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i, found := r.index(id)
+	if !found {
+		return repository.ErrFeedbackNotFound
+	}
+	updated := r.items[i]
+	updated.WebhookStatus = status
+	updated.WebhookError = errorMessage
+	if err := r.write(&updated); err != nil {
+		return err
+	}
+	r.items[i] = updated
+	return nil
+}
+
+// Append a feedback line to the file. The caller holds the mutex.
+func (r *FeedbackRepoImpl) write(feedback *entities.Feedback) error {
+	line, err := json.Marshal(feedback)
+	if err != nil {
+		return err
+	}
+	if _, err := r.appendTo.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return r.appendTo.Sync()
+}
+
+// Position of the item with the ID; items are kept in ID order
+func (r *FeedbackRepoImpl) index(id int64) (int, bool) {
+	return slices.BinarySearchFunc(r.items, id, func(item entities.Feedback, id int64) int {
+		return cmp.Compare(item.ID, id)
+	})
+}
+
+func (r *FeedbackRepoImpl) List(filter repository.FeedbackFilter) ([]entities.Feedback, int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	page := []entities.Feedback{}
+	total := 0
+	for i := len(r.items) - 1; i >= 0; i-- {
+		item := r.items[i]
+		if (!filter.From.IsZero() && item.CreatedAt.Before(filter.From)) || (!filter.To.IsZero() && item.CreatedAt.After(filter.To)) {
+			continue
+		}
+		if total >= filter.Offset && len(page) < filter.Limit {
+			page = append(page, item)
+		}
+		total++
+	}
+	return page, total, nil
+}
+
+func (r *FeedbackRepoImpl) Summary(since time.Time, lowRating, recentLimit int) (*entities.FeedbackSummary, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	summary := &entities.FeedbackSummary{
+		Since:          since,
+		CategoryCounts: make(map[string]int),
+		RecentLowRated: []entities.Feedback{},
+	}
+	ratingSum := 0
+	for i := len(r.items) - 1; i >= 0 && !r.items[i].CreatedAt.Before(since); i-- {
+		item := r.items[i]
+		summary.Total++
+		category := item.Category
+		if category == "" {
+			category = "uncategorized"
+		}
+		summary.CategoryCounts[category]++
+		if item.Rating == 0 {
+			continue
+		}
+		summary.RatedCount++
+		ratingSum += item.Rating
+		if item.Rating <= lowRating && len(summary.RecentLowRated) < recentLimit {
+			summary.RecentLowRated = append(summary.RecentLowRated, item)
+		}
+	}
+	if summary.RatedCount > 0 {
+		summary.AverageRating = float64(ratingSum) / float64(summary.RatedCount)
+	}
+	return summary, nil
+}
+
+// Ping syncs the feedback file, failing if it can no longer be written.
+func (r *FeedbackRepoImpl) Ping() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.appendTo.Sync()
+}
+
+// Close closes the feedback file.
+func (r *FeedbackRepoImpl) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.appendTo.Close()
+}
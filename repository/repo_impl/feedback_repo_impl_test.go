@@ -0,0 +1,147 @@
+package repo_impl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"EngPal/entities"
+	"EngPal/repository"
+)
+
+func newTestFeedbackRepo(t *testing.T, path string) *FeedbackRepoImpl {
+	t.Helper()
+	repo, err := NewFeedbackRepoImpl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestFeedbackRepoImplPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	repo := newTestFeedbackRepo(t, path)
+
+	createdAt := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	first := &entities.Feedback{UserFeedback: "Great app", Rating: 5, CreatedAt: createdAt}
+	second := &entities.Feedback{UserFeedback: "Found a bug", Category: "bug", CreatedAt: createdAt.Add(time.Hour), WebhookStatus: entities.WebhookPending}
+	for _, feedback := range []*entities.Feedback{first, second} {
+		if err := repo.Create(feedback); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Fatalf("IDs = %d, %d, want 1, 2", first.ID, second.ID)
+	}
+	if err := repo.UpdateWebhookStatus(second.ID, entities.WebhookFailed, "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateWebhookStatus(99, entities.WebhookDelivered, ""); err != repository.ErrFeedbackNotFound {
+		t.Errorf("updating an unknown ID: err = %v, want %v", err, repository.ErrFeedbackNotFound)
+	}
+	repo.Close()
+
+	// A new repo reads the file back, with the last line for an ID winning
+	reopened := newTestFeedbackRepo(t, path)
+	items, total, err := reopened.List(repository.FeedbackFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.WebhookStatus, second.WebhookError = entities.WebhookFailed, "timeout"
+	if want := []entities.Feedback{*second, *first}; total != 2 || !reflect.DeepEqual(items, want) {
+		t.Errorf("reloaded %d items %+v, want %+v", total, items, want)
+	}
+
+	third := &entities.Feedback{UserFeedback: "More exercises please", CreatedAt: createdAt.Add(2 * time.Hour)}
+	if err := reopened.Create(third); err != nil {
+		t.Fatal(err)
+	}
+	if third.ID != 3 {
+		t.Errorf("ID after reloading = %d, want 3", third.ID)
+	}
+}
+
+func TestNewFeedbackRepoImplRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	if err := os.WriteFile(path, []byte(`{"id": 1, "user_feedback": "ok"}`+"\n{not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFeedbackRepoImpl(path); err == nil {
+		t.Error("loading a corrupt file succeeded")
+	}
+}
+
+func TestFeedbackRepoImplList(t *testing.T) {
+	repo := newTestFeedbackRepo(t, filepath.Join(t.TempDir(), "feedback.jsonl"))
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+	for d := 1; d <= 5; d++ {
+		if err := repo.Create(&entities.Feedback{UserFeedback: "feedback", CreatedAt: day(d)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		filter    repository.FeedbackFilter
+		wantIDs   []int64
+		wantTotal int
+	}{
+		{"everything", repository.FeedbackFilter{Limit: 10}, []int64{5, 4, 3, 2, 1}, 5},
+		{"first page", repository.FeedbackFilter{Limit: 2}, []int64{5, 4}, 5},
+		{"second page", repository.FeedbackFilter{Limit: 2, Offset: 2}, []int64{3, 2}, 5},
+		{"past the end", repository.FeedbackFilter{Limit: 2, Offset: 5}, []int64{}, 5},
+		{"from", repository.FeedbackFilter{Limit: 10, From: day(4)}, []int64{5, 4}, 2},
+		{"to", repository.FeedbackFilter{Limit: 10, To: day(2)}, []int64{2, 1}, 2},
+		{"range", repository.FeedbackFilter{Limit: 1, From: day(2), To: day(4)}, []int64{4}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items, total, err := repo.List(test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int64{}
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if total != test.wantTotal || !reflect.DeepEqual(ids, test.wantIDs) {
+				t.Errorf("got IDs %v of %d, want %v of %d", ids, total, test.wantIDs, test.wantTotal)
+			}
+		})
+	}
+}
+
+func TestFeedbackRepoImplSummary(t *testing.T) {
+	repo := newTestFeedbackRepo(t, filepath.Join(t.TempDir(), "feedback.jsonl"))
+	now := time.Now().UTC()
+	for _, feedback := range []entities.Feedback{
+		{UserFeedback: "old", Rating: 1, Category: "bug", CreatedAt: now.AddDate(0, 0, -10)},
+		{UserFeedback: "broken", Rating: 1, Category: "bug", CreatedAt: now.Add(-3 * time.Hour)},
+		{UserFeedback: "fine", Rating: 4, CreatedAt: now.Add(-2 * time.Hour)},
+		{UserFeedback: "meh", Rating: 2, Category: "content_quality", CreatedAt: now.Add(-time.Hour)},
+		{UserFeedback: "no rating", Category: "other", CreatedAt: now},
+	} {
+		if err := repo.Create(&feedback); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := now.AddDate(0, 0, -7)
+	summary, err := repo.Summary(since, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 4 || summary.RatedCount != 3 || summary.AverageRating != 7.0/3 {
+		t.Errorf("total %d, rated %d, average %v, want 4, 3, %v", summary.Total, summary.RatedCount, summary.AverageRating, 7.0/3)
+	}
+	wantCounts := map[string]int{"bug": 1, "content_quality": 1, "other": 1, "uncategorized": 1}
+	if !reflect.DeepEqual(summary.CategoryCounts, wantCounts) {
+		t.Errorf("category counts = %v, want %v", summary.CategoryCounts, wantCounts)
+	}
+	if len(summary.RecentLowRated) != 1 || summary.RecentLowRated[0].UserFeedback != "meh" {
+		t.Errorf("recent low rated = %+v, want only the newest, meh", summary.RecentLowRated)
+	}
+}
@@ -1,9 +1,139 @@
 package repo_impl
 
-import "log"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
-type GitHubRepoImpl struct{}
+	"EngPal/entities"
+	"EngPal/internal/config"
+	"EngPal/repository"
+)
 
-func (r *GitHubRepoImpl) FetchData() {
-    log.Println("Fetching data from GitHub")
-}
\ No newline at end of file
+const (
+	GITHUB_API_URL         = "https://api.github.com"
+	GITHUB_REQUEST_TIMEOUT = 10 * time.Second
+	MAX_GITHUB_ERROR_BYTES = 4096
+)
+
+// The fields of GET /repos/{owner}/{repo}/commits/{ref} that are used
+type githubCommitResponse struct {
+	SHA     string `json:"sha"`
+	HTMLURL string `json:"html_url"`
+	Commit  struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+			Date string `json:"date"`
+		} `json:"author"`
+	} `json:"commit"`
+}
+
+type cachedCommit struct {
+	commit    *entities.Commit
+	etag      string
+	expiresAt time.Time
+}
+
+// GitHubRepoImpl reads commits from the GitHub REST API. Results are cached for
+// the configured GitHubCommitCacheDuration and then revalidated with their ETag,
+// which does not count against the rate limit when nothing changed.
+type GitHubRepoImpl struct {
+	cfg    *config.Config
+	client *http.Client
+	cache  map[string]*cachedCommit // By owner/repo@branch
+	mutex  sync.Mutex
+}
+
+func NewGitHubRepoImpl(cfg *config.Config) *GitHubRepoImpl {
+	return &GitHubRepoImpl{
+		cfg:    cfg,
+		client: &http.Client{Timeout: GITHUB_REQUEST_TIMEOUT},
+		cache:  make(map[string]*cachedCommit),
+	}
+}
+
+func (r *GitHubRepoImpl) LatestCommit() (*entities.Commit, error) {
+	owner, name, branch := r.cfg.GitHubOwner, r.cfg.GitHubRepo, r.cfg.GitHubBranch
+	key := owner + "/" + name + "@" + branch
+
+	// Held during the request too, so concurrent misses make one call to GitHub
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	cached := r.cache[key]
+	if cached != nil && now.Before(cached.expiresAt) {
+		return cached.commit, nil
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/commits/%s", GITHUB_API_URL,
+		url.PathEscape(owner), url.PathEscape(name), url.PathEscape(branch))
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, &repository.GitHubError{Message: err.Error()}
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if token := r.cfg.GitHubToken; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, &repository.GitHubError{Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		cached.expiresAt = now.Add(r.cfg.GitHubCommitCacheDuration)
+		return cached.commit, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, githubResponseError(resp)
+	}
+
+	var body githubCommitResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, &repository.GitHubError{StatusCode: resp.StatusCode, Message: "invalid commit JSON: " + err.Error()}
+	}
+	date, err := time.Parse(time.RFC3339, body.Commit.Author.Date)
+	if body.SHA == "" || err != nil {
+		return nil, &repository.GitHubError{StatusCode: resp.StatusCode, Message: "commit without a SHA or a valid date"}
+	}
+
+	commit := &entities.Commit{
+		Repository: owner + "/" + name,
+		Branch:     branch,
+		SHA:        body.SHA,
+		Message:    body.Commit.Message,
+		Author:     body.Commit.Author.Name,
+		Date:       date,
+		URL:        body.HTMLURL,
+	}
+	r.cache[key] = &cachedCommit{commit: commit, etag: resp.Header.Get("ETag"), expiresAt: now.Add(r.cfg.GitHubCommitCacheDuration)}
+	return commit, nil
+}
+
+// A GitHubError from an error response, using GitHub's "message" when there is one
+func githubResponseError(resp *http.Response) error {
+	message := resp.Status
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, MAX_GITHUB_ERROR_BYTES)).Decode(&body); err == nil && body.Message != "" {
+		message = body.Message
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" && !strings.Contains(strings.ToLower(message), "rate limit") {
+		message += " (rate limit exceeded)"
+	}
+	return &repository.GitHubError{StatusCode: resp.StatusCode, Message: message}
+}
@@ -1,9 +1,77 @@
 package repo_impl
 
-import "log"
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
 
-type HealthcheckRepoImpl struct{}
+	"EngPal/internal"
+	"EngPal/repository"
 
-func (r *HealthcheckRepoImpl) CheckHealth() {
-	log.Println("Performing health check")
-}
\ No newline at end of file
+	"google.golang.org/genai"
+)
+
+// HealthcheckRepoImpl checks the Gemini client and the feedback store the server
+// was started with.
+type HealthcheckRepoImpl struct {
+	feedback  *FeedbackRepoImpl
+	startTime time.Time
+}
+
+// NewHealthcheckRepoImpl checks the given feedback store; nil skips the store check.
+func NewHealthcheckRepoImpl(feedback *FeedbackRepoImpl) *HealthcheckRepoImpl {
+	return &HealthcheckRepoImpl{feedback: feedback, startTime: time.Now()}
+}
+
+// PingGemini fetches one page of one model.
+func (r *HealthcheckRepoImpl) PingGemini(ctx context.Context) (time.Duration, error) {
+	client := internal.GeminiClient
+	if client == nil {
+		return 0, errors.New("Gemini client not initialized")
+	}
+	startTime := time.Now()
+	if _, err := client.Models.List(ctx, &genai.ListModelsConfig{PageSize: 1}); err != nil {
+		return time.Since(startTime), err
+	}
+	return time.Since(startTime), nil
+}
+
+// CheckAPIKey makes a real call to Gemini with a client for the key.
+func (r *HealthcheckRepoImpl) CheckAPIKey(ctx context.Context, apiKey string, models []string) ([]string, error) {
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	modelAccess := []string{}
+	for model, err := range client.Models.All(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(model.Name, "models/")
+		if slices.Contains(models, name) && !slices.Contains(modelAccess, name) {
+			modelAccess = append(modelAccess, name)
+		}
+	}
+	return modelAccess, nil
+}
+
+func (r *HealthcheckRepoImpl) PingStore(ctx context.Context) error {
+	if r.feedback == nil {
+		return nil
+	}
+	return r.feedback.Ping()
+}
+
+func (r *HealthcheckRepoImpl) Stats() repository.HealthStats {
+	return repository.HealthStats{
+		UptimeSeconds: int64(time.Since(r.startTime).Seconds()),
+		Goroutines:    runtime.NumGoroutine(),
+	}
+}
@@ -6,18 +6,82 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func SetupRouter() *mux.Router {
+// SetupRouter registers every route. Handlers with injected dependencies are passed in.
+func SetupRouter(healthcheckHandler *handler.HealthcheckHandler) *mux.Router {
 	r := mux.NewRouter()
 
+	// Healthcheck
+	r.HandleFunc("/livez", handler.Livez).Methods("GET")
+	r.HandleFunc("/readyz", handler.Readyz).Methods("GET")
+	r.HandleFunc("/api/healthcheck", healthcheckHandler.Healthcheck).Methods("GET")
+	r.HandleFunc("/api/healthcheck/deep", healthcheckHandler.DeepHealthcheck).Methods("GET")
+	r.HandleFunc("/api/healthcheck/metrics", handler.GetHealthcheckMetrics).Methods("GET")
+
+	// Version
+	r.HandleFunc("/api/version", handler.GetVersion).Methods("GET")
+	r.HandleFunc("/api/version/latest-commit", handler.GetLatestGithubCommit).Methods("GET")
+
+	// Feedback
+	r.HandleFunc("/api/feedback", handler.SendFeedback).Methods("POST")
+	r.HandleFunc("/api/feedback", handler.ListFeedback).Methods("GET")
+	r.HandleFunc("/api/feedback/summary", handler.GetFeedbackSummary).Methods("GET")
+
 	// Assignment routes
 	r.HandleFunc("/api/assignment/generate", handler.GenerateAssignment).Methods("POST")
 	r.HandleFunc("/api/assignment/suggest-topics", handler.SuggestTopics).Methods("GET")
+	r.HandleFunc("/api/assignment/time-estimates", handler.GetQuizTimeEstimates).Methods("GET")
 
 	// Review routes
 	r.HandleFunc("/api/review/generate", handler.GenerateReview).Methods("POST")
+	r.HandleFunc("/api/review/generate-stream", handler.GenerateReviewStream).Methods("POST")
+	r.HandleFunc("/api/review/portfolio", handler.GeneratePortfolioReview).Methods("POST")
+	r.HandleFunc("/api/review/scoring-weights", handler.GetScoringWeights).Methods("GET")
+	r.HandleFunc("/api/review/rubrics", handler.GetScoringRubrics).Methods("GET")
+	r.HandleFunc("/api/review/grammar-error-types", handler.GetGrammarErrorTypes).Methods("GET")
+	r.HandleFunc("/api/review/check-conclusion", handler.CheckConclusion).Methods("POST")
+	r.HandleFunc("/api/review/check-introduction", handler.CheckIntroduction).Methods("POST")
+	r.HandleFunc("/api/review/stats", handler.GetReviewStats).Methods("GET")
+	r.HandleFunc("/api/review/cache", handler.ClearReviewCache).Methods("DELETE")
+
+	// Text routes
+	r.HandleFunc("/api/text/passage-difficulty", handler.AnalysePassageDifficulty).Methods("POST")
+	r.HandleFunc("/api/text/gsl-list", handler.GetGSLList).Methods("GET")
+	r.HandleFunc("/api/text/discourse-markers", handler.CountDiscourseMarkers).Methods("POST")
+	r.HandleFunc("/api/text/discourse-marker-list", handler.GetDiscourseMarkerList).Methods("GET")
+	r.HandleFunc("/api/text/cohesive-device-quiz", handler.GenerateCohesiveDeviceQuiz).Methods("POST")
+	r.HandleFunc("/api/text/comma-splice", handler.DetectCommaSplices).Methods("POST")
+	r.HandleFunc("/api/text/passive-voice", handler.AnalyzePassiveVoice).Methods("POST")
+	r.HandleFunc("/api/text/readability", handler.AnalyzeReadability).Methods("POST")
+	r.HandleFunc("/api/text/extract-from-image", handler.RequireAccessKey(handler.ExtractTextFromImage)).Methods("POST")
+
+	// OCR routes
+	r.HandleFunc("/api/ocr/batch", handler.RequireAccessKey(handler.ExtractTextFromImageBatch)).Methods("POST")
+
+	// Pipeline routes
+	r.HandleFunc("/api/pipeline/handwritten-review", handler.RequireAccessKey(handler.GenerateHandwrittenReview)).Methods("POST")
+
+	// Vocabulary routes
+	r.HandleFunc("/api/vocabulary/example-sentences", handler.GenerateExamples).Methods("POST")
+	r.HandleFunc("/api/vocabulary/pronunciation-guide", handler.GetPronunciation).Methods("POST")
+	r.HandleFunc("/api/vocabulary/word-network", handler.GetWordNetwork).Methods("POST")
 
 	// Chatbot routes
 	r.HandleFunc("/api/chatbot/generate-answer", handler.GenerateAnswer).Methods("POST")
+	r.HandleFunc("/api/chatbot/generate-answer/audio", handler.GenerateAnswerFromAudio).Methods("POST")
+	r.HandleFunc("/api/chatbot/usage", handler.GetChatbotUsage).Methods("GET")
+	r.HandleFunc("/api/chatbot/quota", handler.GetChatbotQuota).Methods("GET")
+	r.HandleFunc("/api/chatbot/messages/{id}/feedback", handler.SubmitChatFeedback).Methods("POST")
+	r.HandleFunc("/api/chatbot/feedback/down-rated", handler.GetDownRatedChatMessages).Methods("GET")
+	r.HandleFunc("/api/chatbot/sessions/stats", handler.GetChatSessionStats).Methods("GET")
+	r.HandleFunc("/api/chatbot/sessions", handler.CreateChatSession).Methods("POST")
+	r.HandleFunc("/api/chatbot/sessions", handler.ListChatSessions).Methods("GET")
+	r.HandleFunc("/api/chatbot/sessions/{id}", handler.GetChatSession).Methods("GET")
+	r.HandleFunc("/api/chatbot/sessions/{id}", handler.UpdateChatSession).Methods("PATCH")
+	r.HandleFunc("/api/chatbot/sessions/{id}/export", handler.ExportChatSession).Methods("GET")
+	r.HandleFunc("/api/chatbot/sessions/{id}/vocabulary", handler.ExtractChatSessionVocabulary).Methods("POST")
+
+	// WebSocket routes
+	r.HandleFunc("/api/ws/chatbot", handler.ChatbotWebSocket).Methods("GET")
 
 	return r
 }
\ No newline at end of file
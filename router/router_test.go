@@ -0,0 +1,66 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"EngPal/handler"
+	"EngPal/internal/config"
+)
+
+// An HS256 token for the claims, signed with a JWT secret the test configures
+func signTestJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	const secret = "test-jwt-secret"
+	cfg, _ := config.Load()
+	cfg.JWTSecret = secret
+	config.Use(cfg)
+	t.Cleanup(func() {
+		cfg, _ := config.Load()
+		config.Use(cfg)
+	})
+
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestClearReviewCacheRouteIsAdminOnly(t *testing.T) {
+	router := SetupRouter(handler.NewHealthcheckHandler(nil, ""))
+	admin := signTestJWT(t, map[string]interface{}{"sub": "lan", "admin": true, "exp": time.Now().Add(time.Hour).Unix()})
+	learner := signTestJWT(t, map[string]interface{}{"sub": "minh", "exp": time.Now().Add(time.Hour).Unix()})
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{"admin", http.MethodDelete, admin, http.StatusOK},
+		{"not an admin", http.MethodDelete, learner, http.StatusForbidden},
+		{"without a token", http.MethodDelete, "", http.StatusUnauthorized},
+		{"access key instead of a token", http.MethodDelete, "admin-key-0123456789", http.StatusUnauthorized},
+		{"wrong method", http.MethodGet, admin, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, "/api/review/cache", nil)
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
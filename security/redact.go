@@ -0,0 +1,104 @@
+package security
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registered secrets shorter than this are not redacted, so common words are left alone
+const MIN_SECRET_LENGTH = 8
+
+// Secret values to remove from logs, longest first so a secret containing another
+// one is replaced whole
+var (
+	secrets      []string
+	secretsMutex sync.RWMutex
+)
+
+var (
+	// "api_key=...", "token: ...", "Authorization: Bearer ..." and similar, keeping the name
+	namedSecretPattern  = regexp.MustCompile(`(?i)\b(api[_-]?key|access[_-]?key|access[_-]?token|token|secret|password|authorization)(["']?\s*[:=]\s*["']?)((?:bearer\s+)?)([^\s"'&,;]+)`)
+	bearerPattern       = regexp.MustCompile(`(?i)\b(bearer\s+)([A-Za-z0-9._~+/=-]{8,})`)
+	googleAPIKeyPattern = regexp.MustCompile(`AIza[0-9A-Za-z_-]{35,}`)
+)
+
+// RegisterSecret makes Redact remove the value wherever it appears. Empty and very
+// short values are ignored.
+func RegisterSecret(value string) {
+	if len(value) < MIN_SECRET_LENGTH {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, secret := range secrets {
+		if secret == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+	sort.SliceStable(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// Fingerprint is the last 4 characters of a secret, safe to log and enough to tell
+// secrets apart.
+func Fingerprint(secret string) string {
+	if len(secret) <= MIN_SECRET_LENGTH {
+		return "****"
+	}
+	return "…" + secret[len(secret)-4:]
+}
+
+// Redact replaces registered secrets, Google API keys, bearer tokens and values of
+// key, token, secret, password and authorization fields with "[REDACTED…abcd]".
+func Redact(text string) string {
+	secretsMutex.RLock()
+	for _, secret := range secrets {
+		if strings.Contains(text, secret) {
+			text = strings.ReplaceAll(text, secret, redacted(secret))
+		}
+	}
+	secretsMutex.RUnlock()
+
+	text = googleAPIKeyPattern.ReplaceAllStringFunc(text, redacted)
+	text = bearerPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := bearerPattern.FindStringSubmatch(match)
+		return parts[1] + redactedOnce(parts[2])
+	})
+	return namedSecretPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := namedSecretPattern.FindStringSubmatch(match)
+		return parts[1] + parts[2] + parts[3] + redactedOnce(parts[4])
+	})
+}
+
+func redacted(secret string) string {
+	return "[REDACTED" + Fingerprint(secret) + "]"
+}
+
+// Redact a value unless an earlier pass already did
+func redactedOnce(value string) string {
+	if strings.HasPrefix(value, "[REDACTED") {
+		return value
+	}
+	return redacted(value)
+}
+
+type redactingWriter struct {
+	out io.Writer
+}
+
+// NewRedactingWriter returns a writer that passes everything through Redact, for
+// use with log.SetOutput. The log package writes each entry in one call, so secrets
+// are never split across writes.
+func NewRedactingWriter(out io.Writer) io.Writer {
+	return redactingWriter{out: out}
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthHistorySize is how many health events are kept across all dependencies.
+	HealthHistorySize = 5000
+	// HealthWindow is how far back the health summary looks.
+	HealthWindow = time.Hour
+	// MaxRecentFailures is how many failure times are listed per dependency.
+	MaxRecentFailures = 10
+)
+
+// HealthEvent is the outcome of one healthcheck probe or Gemini call.
+type HealthEvent struct {
+	Dependency string
+	Success    bool
+	Latency    time.Duration
+	ErrorType  string // Empty on success
+	At         time.Time
+}
+
+// DependencyHealth summarizes the recent events of one dependency.
+type DependencyHealth struct {
+	Checks         int            `json:"checks"`
+	Failures       int            `json:"failures"`
+	SuccessRate    float64        `json:"success_rate"` // 0-1
+	LatencyP50Ms   int64          `json:"latency_p50_ms"`
+	LatencyP95Ms   int64          `json:"latency_p95_ms"`
+	LatencyP99Ms   int64          `json:"latency_p99_ms"`
+	FailuresByType map[string]int `json:"failures_by_type"`
+	RecentFailures []time.Time    `json:"recent_failures"` // Newest first, at most MaxRecentFailures
+}
+
+// Circular buffer of the last HealthHistorySize events
+var (
+	healthEvents      = make([]HealthEvent, 0, HealthHistorySize)
+	healthEventsNext  int // Index overwritten by the next event once full
+	healthEventsMutex sync.Mutex
+)
+
+// RecordHealth adds the outcome of a probe or call, overwriting the oldest event
+// once the buffer holds HealthHistorySize.
+func RecordHealth(dependency string, success bool, latency time.Duration, errorType string) {
+	event := HealthEvent{Dependency: dependency, Success: success, Latency: latency, ErrorType: errorType, At: time.Now()}
+
+	healthEventsMutex.Lock()
+	defer healthEventsMutex.Unlock()
+	if len(healthEvents) < HealthHistorySize {
+		healthEvents = append(healthEvents, event)
+		return
+	}
+	healthEvents[healthEventsNext] = event
+	healthEventsNext = (healthEventsNext + 1) % HealthHistorySize
+}
+
+// HealthSummary returns the success rate, latency percentiles and recent failures
+// of each dependency over the last HealthWindow.
+func HealthSummary() map[string]DependencyHealth {
+	cutoff := time.Now().Add(-HealthWindow)
+
+	healthEventsMutex.Lock()
+	byDependency := make(map[string][]HealthEvent)
+	for _, event := range healthEvents {
+		if !event.At.Before(cutoff) {
+			byDependency[event.Dependency] = append(byDependency[event.Dependency], event)
+		}
+	}
+	healthEventsMutex.Unlock()
+
+	summary := make(map[string]DependencyHealth, len(byDependency))
+	for dependency, events := range byDependency {
+		sort.Slice(events, func(i, j int) bool { return events[i].At.After(events[j].At) })
+
+		health := DependencyHealth{Checks: len(events), FailuresByType: make(map[string]int), RecentFailures: []time.Time{}}
+		latencies := make([]time.Duration, len(events))
+		for i, event := range events {
+			latencies[i] = event.Latency
+			if event.Success {
+				continue
+			}
+			health.Failures++
+			health.FailuresByType[event.ErrorType]++
+			if len(health.RecentFailures) < MaxRecentFailures {
+				health.RecentFailures = append(health.RecentFailures, event.At)
+			}
+		}
+		health.SuccessRate = math.Round(float64(health.Checks-health.Failures)/float64(health.Checks)*1e4) / 1e4
+
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		health.LatencyP50Ms = latencyPercentile(latencies, 50).Milliseconds()
+		health.LatencyP95Ms = latencyPercentile(latencies, 95).Milliseconds()
+		health.LatencyP99Ms = latencyPercentile(latencies, 99).Milliseconds()
+		summary[dependency] = health
+	}
+	return summary
+}
+
+// Nearest-rank percentile of sorted latencies
+func latencyPercentile(sorted []time.Duration, percentile float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
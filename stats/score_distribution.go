@@ -0,0 +1,170 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WindowSize is how many overall scores are kept per CEFR level.
+	WindowSize = 10000
+	// MinSamples is how many recent scores a level needs before percentiles use them
+	// alone; below it they are topped up with a synthetic distribution.
+	MinSamples = 100
+	// RecentPeriod is how far back scores are compared.
+	RecentPeriod = 7 * 24 * time.Hour
+)
+
+// Sample is one overall score (0-10) and when it was submitted.
+type Sample struct {
+	Score float64   `json:"score"`
+	At    time.Time `json:"at"`
+}
+
+// Circular buffer of the last WindowSize samples of one level
+type scoreRing struct {
+	Samples []Sample `json:"samples"`
+	Next    int      `json:"next"` // Index overwritten by the next sample once full
+}
+
+// Assumed mean overall score of each level for the synthetic distribution
+var syntheticMeans = map[string]float64{
+	"A1": 3.5, "A2": 4.5, "B1": 5.5, "B2": 6.5, "C1": 7.5, "C2": 8.5,
+}
+
+const syntheticStandardDeviation = 1.2
+
+var (
+	distribution      = make(map[string]*scoreRing)
+	distributionMutex sync.Mutex
+)
+
+// NormalizeLevel maps "b2", " B2 " and "B2 - Upper Intermediate" to "B2".
+func NormalizeLevel(level string) string {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	if len(level) > 2 {
+		level = level[:2]
+	}
+	return level
+}
+
+// Record adds an overall score to its level's buffer, overwriting the oldest
+// score once the buffer holds WindowSize.
+func Record(level string, score float64) {
+	level = NormalizeLevel(level)
+	if level == "" {
+		return
+	}
+
+	distributionMutex.Lock()
+	defer distributionMutex.Unlock()
+
+	ring, exists := distribution[level]
+	if !exists {
+		ring = &scoreRing{}
+		distribution[level] = ring
+	}
+	sample := Sample{Score: score, At: time.Now()}
+	if len(ring.Samples) < WindowSize {
+		ring.Samples = append(ring.Samples, sample)
+		return
+	}
+	ring.Samples[ring.Next] = sample
+	ring.Next = (ring.Next + 1) % WindowSize
+}
+
+// Percentile returns the percentage (0-100) of scores at the level from the last
+// RecentPeriod that are lower than score. With fewer than MinSamples of them the
+// rest are taken from a synthetic normal distribution around the level's mean.
+func Percentile(level string, score float64) int {
+	level = NormalizeLevel(level)
+	cutoff := time.Now().Add(-RecentPeriod)
+
+	lower, total := 0, 0
+	distributionMutex.Lock()
+	if ring, exists := distribution[level]; exists {
+		for _, sample := range ring.Samples {
+			if sample.At.Before(cutoff) {
+				continue
+			}
+			total++
+			if sample.Score < score {
+				lower++
+			}
+		}
+	}
+	distributionMutex.Unlock()
+
+	if total < MinSamples {
+		for _, synthetic := range syntheticScores(level, MinSamples-total) {
+			total++
+			if synthetic < score {
+				lower++
+			}
+		}
+	}
+	return int(math.Round(100 * float64(lower) / float64(total)))
+}
+
+// Evenly spaced quantiles of a normal distribution around the level's mean, clamped to 0-10
+func syntheticScores(level string, count int) []float64 {
+	mean, exists := syntheticMeans[level]
+	if !exists {
+		mean = syntheticMeans["B1"]
+	}
+	scores := make([]float64, count)
+	for i := range scores {
+		p := (float64(i) + 0.5) / float64(count)
+		z := math.Sqrt2 * math.Erfinv(2*p-1)
+		scores[i] = math.Max(0, math.Min(10, mean+z*syntheticStandardDeviation))
+	}
+	return scores
+}
+
+// Load restores the buffers saved by Save. A missing file is not an error.
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]*scoreRing)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	for level, ring := range loaded {
+		if len(ring.Samples) > WindowSize || ring.Next < 0 || ring.Next >= WindowSize {
+			delete(loaded, level)
+		}
+	}
+
+	distributionMutex.Lock()
+	distribution = loaded
+	distributionMutex.Unlock()
+	return nil
+}
+
+// Save writes the buffers to path, replacing it atomically.
+func Save(path string) error {
+	distributionMutex.Lock()
+	data, err := json.Marshal(distribution)
+	distributionMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Placeholder kinds used by AnonymizeText
+const (
+	PlaceholderName         = "NAME"
+	PlaceholderPlace        = "PLACE"
+	PlaceholderOrganization = "ORGANIZATION"
+)
+
+var anonymizerWordPattern = regexp.MustCompile(`\p{L}[\p{L}\p{M}'’-]*`)
+
+// Capitalized words that are not personal information
+var anonymizerExemptWords = toSet(
+	"I", "I'm", "I've", "I'll", "I'd", "I’m", "I’ve", "I’ll", "I’d",
+	"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday",
+	"January", "February", "March", "April", "May", "June", "July", "August",
+	"September", "October", "November", "December",
+	"English", "Vietnamese", "Japanese", "Korean", "Chinese", "French", "German", "Spanish",
+	"American", "British", "Asian", "European", "Christmas", "Tet", "Internet", "Mr", "Mrs", "Ms", "Dr",
+)
+
+// Words that often open a sentence before a capitalized entity ("The ABC Company", "Yesterday Minh")
+var anonymizerLeadingWords = toSet(
+	"The", "A", "An", "My", "Our", "Your", "His", "Her", "Their", "This", "That", "These", "Those",
+	"In", "At", "On", "When", "After", "Before", "Yesterday", "Today", "Tomorrow", "Last", "Next",
+	"Dear", "Hi", "Hello", "Then", "But", "And", "So", "Because", "If",
+)
+
+// Words marking an entity as an organization
+var organizationKeywords = toSet(
+	"University", "School", "College", "Academy", "Institute", "Company", "Corporation", "Corp",
+	"Inc", "Ltd", "Bank", "Hospital", "Group", "Club", "Association", "Foundation", "Center", "Centre",
+)
+
+// Words marking an entity as a place, plus places common in learners' writing
+var placeKeywords = toSet(
+	"City", "Street", "Road", "Province", "District", "Village", "Town", "River", "Lake", "Mountain",
+	"Park", "Beach", "Island", "Bay", "Country", "State",
+	"Vietnam", "Hanoi", "Saigon", "Hue", "Danang", "Japan", "Korea", "China", "Thailand", "Singapore",
+	"America", "England", "France", "Germany", "Australia", "Canada", "London", "Paris", "Tokyo", "Seoul",
+)
+
+// AnonymizeText replaces likely named entities - capitalized words that do not start a
+// sentence - with [NAME], [PLACE] or [ORGANIZATION] placeholders. Repeated entities share a
+// placeholder and further entities of the same kind are numbered ([NAME_2]). It returns the
+// anonymized text and a map from each placeholder to the original text.
+func AnonymizeText(text string) (string, map[string]string) {
+	replacements := make(map[string]string)
+	placeholders := make(map[string]string) // Original -> placeholder
+	counts := make(map[string]int)
+
+	type entity struct{ start, end int }
+	var entities []entity
+
+	matches := anonymizerWordPattern.FindAllStringIndex(text, -1)
+	for i := 0; i < len(matches); {
+		if !isCapitalizedWord(text[matches[i][0]:matches[i][1]]) {
+			i++
+			continue
+		}
+
+		// Group consecutive capitalized words separated by a single space
+		j := i + 1
+		for j < len(matches) && text[matches[j-1][1]:matches[j][0]] == " " &&
+			isCapitalizedWord(text[matches[j][0]:matches[j][1]]) {
+			j++
+		}
+
+		first := i
+		if isSentenceStart(text, matches[i][0]) {
+			word := text[matches[i][0]:matches[i][1]]
+			if j-i == 1 || anonymizerLeadingWords[word] {
+				first++
+			}
+		}
+		for first < j && anonymizerExemptWords[text[matches[first][0]:matches[first][1]]] {
+			first++
+		}
+		last := j - 1
+		for last >= first && anonymizerExemptWords[text[matches[last][0]:matches[last][1]]] {
+			last--
+		}
+		if first <= last {
+			entities = append(entities, entity{matches[first][0], matches[last][1]})
+		}
+		i = j
+	}
+
+	var sb strings.Builder
+	previous := 0
+	for _, e := range entities {
+		original := text[e.start:e.end]
+		placeholder, exists := placeholders[original]
+		if !exists {
+			kind := classifyEntity(original)
+			counts[kind]++
+			placeholder = "[" + kind + "]"
+			if counts[kind] > 1 {
+				placeholder = fmt.Sprintf("[%s_%d]", kind, counts[kind])
+			}
+			placeholders[original] = placeholder
+			replacements[placeholder] = original
+		}
+		sb.WriteString(text[previous:e.start])
+		sb.WriteString(placeholder)
+		previous = e.end
+	}
+	sb.WriteString(text[previous:])
+
+	return sb.String(), replacements
+}
+
+// RestoreText puts the original entities back in place of the placeholders from AnonymizeText.
+func RestoreText(text string, replacements map[string]string) string {
+	// Longest placeholders first so [NAME_10] is not clobbered by [NAME_1]
+	placeholders := make([]string, 0, len(replacements))
+	for placeholder := range replacements {
+		placeholders = append(placeholders, placeholder)
+	}
+	sort.Slice(placeholders, func(i, j int) bool { return len(placeholders[i]) > len(placeholders[j]) })
+
+	for _, placeholder := range placeholders {
+		text = strings.ReplaceAll(text, placeholder, replacements[placeholder])
+	}
+	return text
+}
+
+// classifyEntity guesses whether an entity is a person, place or organization.
+func classifyEntity(entity string) string {
+	for _, word := range strings.Fields(entity) {
+		if organizationKeywords[word] {
+			return PlaceholderOrganization
+		}
+	}
+	for _, word := range strings.Fields(entity) {
+		if placeKeywords[word] {
+			return PlaceholderPlace
+		}
+	}
+	return PlaceholderName
+}
+
+// isCapitalizedWord reports whether a word starts with an upper-case letter and is not an acronym.
+func isCapitalizedWord(word string) bool {
+	first, _ := utf8.DecodeRuneInString(word)
+	if !unicode.IsUpper(first) {
+		return false
+	}
+	return utf8.RuneCountInString(word) == 1 || strings.ToUpper(word) != word
+}
+
+// isSentenceStart reports whether the word at offset starts a sentence or a line.
+func isSentenceStart(text string, offset int) bool {
+	before := strings.TrimRightFunc(text[:offset], func(r rune) bool {
+		return unicode.IsSpace(r) && r != '\n' || strings.ContainsRune(`"'“‘([`, r)
+	})
+	if before == "" {
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(before)
+	return strings.ContainsRune(".!?:\n", last)
+}
+
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
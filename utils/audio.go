@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxAudioBytes is the largest audio clip accepted (10 MB).
+const MaxAudioBytes = 10 << 20
+
+// MaxAudioDuration is the longest audio clip accepted.
+const MaxAudioDuration = 60 * time.Second
+
+var (
+	ErrInvalidAudio         = errors.New("invalid audio data")
+	ErrAudioTooLarge        = fmt.Errorf("audio is larger than %d MB", MaxAudioBytes>>20)
+	ErrAudioTooLong         = fmt.Errorf("audio is longer than %d seconds", int(MaxAudioDuration.Seconds()))
+	ErrUnsupportedAudioType = errors.New("audio must be WAV, MP3 or M4A")
+)
+
+// CheckAudio detects the format of a WAV, MP3 or M4A clip from its content, reads
+// its duration from the headers and enforces the size and duration limits.
+// It returns the MIME type to send to Gemini.
+func CheckAudio(data []byte) (string, time.Duration, error) {
+	if len(data) == 0 {
+		return "", 0, ErrInvalidAudio
+	}
+	if len(data) > MaxAudioBytes {
+		return "", 0, ErrAudioTooLarge
+	}
+
+	var mimeType string
+	var duration time.Duration
+	var err error
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		mimeType = "audio/wav"
+		duration, err = wavDuration(data)
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		mimeType = "audio/mp4"
+		duration, err = mp4Duration(data)
+	case bytes.HasPrefix(data, []byte("ID3")) || len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		mimeType = "audio/mp3"
+		duration, err = mp3Duration(data)
+	default:
+		return "", 0, ErrUnsupportedAudioType
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if duration > MaxAudioDuration {
+		return "", 0, ErrAudioTooLong
+	}
+	return mimeType, duration, nil
+}
+
+// wavDuration divides the size of the data chunk by the byte rate from the fmt chunk.
+func wavDuration(data []byte) (time.Duration, error) {
+	var byteRate, dataSize uint32
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := binary.LittleEndian.Uint32(data[pos+4 : pos+8])
+		body := data[pos+8:]
+		switch id {
+		case "fmt ":
+			if len(body) < 12 {
+				return 0, ErrInvalidAudio
+			}
+			byteRate = binary.LittleEndian.Uint32(body[8:12])
+		case "data":
+			dataSize = size
+		}
+		if byteRate > 0 && dataSize > 0 {
+			return time.Duration(float64(dataSize) / float64(byteRate) * float64(time.Second)), nil
+		}
+		pos += 8 + int(size) + int(size%2) // Chunks are padded to an even size
+	}
+	return 0, ErrInvalidAudio
+}
+
+// mp4Duration reads the duration and timescale of the movie header (moov/mvhd).
+func mp4Duration(data []byte) (time.Duration, error) {
+	moov := findMP4Box(data, "moov")
+	if moov == nil {
+		return 0, ErrInvalidAudio
+	}
+	mvhd := findMP4Box(moov, "mvhd")
+	if len(mvhd) < 4 {
+		return 0, ErrInvalidAudio
+	}
+
+	var timescale uint32
+	var units uint64
+	if mvhd[0] == 1 { // Version 1 uses 64-bit times
+		if len(mvhd) < 32 {
+			return 0, ErrInvalidAudio
+		}
+		timescale = binary.BigEndian.Uint32(mvhd[20:24])
+		units = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		if len(mvhd) < 20 {
+			return 0, ErrInvalidAudio
+		}
+		timescale = binary.BigEndian.Uint32(mvhd[12:16])
+		units = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, ErrInvalidAudio
+	}
+	return time.Duration(float64(units) / float64(timescale) * float64(time.Second)), nil
+}
+
+// findMP4Box returns the body of the first box of the given type among the boxes in data.
+func findMP4Box(data []byte, boxType string) []byte {
+	for pos := 0; pos+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		header := uint64(8)
+		switch size {
+		case 0: // Box extends to the end of the data
+			size = uint64(len(data) - pos)
+		case 1: // 64-bit size follows the type
+			if pos+16 > len(data) {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(data[pos+8 : pos+16])
+			header = 16
+		}
+		if size < header || uint64(pos)+size > uint64(len(data)) {
+			return nil
+		}
+		if string(data[pos+4:pos+8]) == boxType {
+			return data[uint64(pos)+header : uint64(pos)+size]
+		}
+		pos += int(size)
+	}
+	return nil
+}
+
+// Bitrates in kbps by MPEG version (1 or 2/2.5) for Layer III, indexed by the header field
+var mp3Bitrates = [2][16]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+}
+
+// Sample rates in Hz by MPEG version field (2.5, reserved, 2, 1)
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},
+	{0, 0, 0},
+	{22050, 24000, 16000},
+	{44100, 48000, 32000},
+}
+
+// mp3Duration uses the frame count of a Xing/Info header when there is one (VBR),
+// and otherwise estimates from the bitrate of the first frame (CBR).
+func mp3Duration(data []byte) (time.Duration, error) {
+	pos := 0
+	if bytes.HasPrefix(data, []byte("ID3")) {
+		if len(data) < 10 {
+			return 0, ErrInvalidAudio
+		}
+		// Tag size is a 28-bit synchsafe integer
+		tagSize := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		pos = 10 + tagSize
+	}
+	for pos+4 <= len(data) && !(data[pos] == 0xFF && data[pos+1]&0xE0 == 0xE0) {
+		pos++
+	}
+	if pos+4 > len(data) {
+		return 0, ErrInvalidAudio
+	}
+
+	header := data[pos : pos+4]
+	version := int(header[1]>>3) & 0x03 // 0: 2.5, 2: 2, 3: 1
+	layer := int(header[1]>>1) & 0x03   // 1: Layer III
+	bitrateIndex := int(header[2] >> 4)
+	sampleRateIndex := int(header[2]>>2) & 0x03
+	if version == 1 || layer != 1 || sampleRateIndex == 3 {
+		return 0, ErrUnsupportedAudioType
+	}
+	table, samplesPerFrame := 0, 1152
+	if version != 3 {
+		table, samplesPerFrame = 1, 576
+	}
+	bitrate := mp3Bitrates[table][bitrateIndex] * 1000
+	sampleRate := mp3SampleRates[version][sampleRateIndex]
+	if bitrate == 0 || sampleRate == 0 {
+		return 0, ErrInvalidAudio
+	}
+
+	// The Xing/Info tag sits in the first frame after the side information
+	head := data[pos:min(len(data), pos+64)]
+	if i := max(bytes.Index(head, []byte("Xing")), bytes.Index(head, []byte("Info"))); i >= 0 && pos+i+12 <= len(data) {
+		tag := data[pos+i:]
+		if tag[7]&0x01 != 0 { // Frame count present
+			frames := binary.BigEndian.Uint32(tag[8:12])
+			return time.Duration(float64(frames) * float64(samplesPerFrame) / float64(sampleRate) * float64(time.Second)), nil
+		}
+	}
+
+	audioBytes := len(data) - pos
+	return time.Duration(float64(audioBytes*8) / float64(bitrate) * float64(time.Second)), nil
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CitationAnalysis describes how a text cites its sources.
+type CitationAnalysis struct {
+	HasCitations      bool     `json:"has_citations"`
+	CitationCount     int      `json:"citation_count"`
+	CitationFormat    string   `json:"citation_format"`    // APA, MLA, Harvard, in-text or none
+	FormatConsistency bool     `json:"format_consistency"` // All citations follow one format
+	Issues            []string `json:"issues"`
+	MissingCitations  bool     `json:"missing_citations"` // No citations at all
+}
+
+// Citation formats reported by DetectCitations
+const (
+	CITATION_FORMAT_APA     = "APA"
+	CITATION_FORMAT_MLA     = "MLA"
+	CITATION_FORMAT_HARVARD = "Harvard"
+	CITATION_FORMAT_IN_TEXT = "in-text" // Only numbered or narrative citations
+	CITATION_FORMAT_NONE    = "none"
+)
+
+// An author as cited: "Smith", "Smith et al.", "Smith and Jones", "Smith & Jones"
+const citationAuthor = `[A-Z][A-Za-z'’-]+(?:\s+et\s+al\.?|(?:,?\s+(?:and|&)\s+[A-Z][A-Za-z'’-]+))?`
+
+var (
+	// (Smith, 2020), (Smith & Jones, 2020, p. 4), (Smith, n.d.)
+	apaCitationPattern = regexp.MustCompile(`\((` + citationAuthor + `),\s+(?:\d{4}[a-z]?|n\.d\.)(?:,\s+pp?\.\s*\d+(?:[-–]\d+)?)?\)`)
+	// (Smith 2020), (Smith and Jones 2020: 4), (Smith 2020, p. 4)
+	harvardCitationPattern = regexp.MustCompile(`\((` + citationAuthor + `)\s+\d{4}[a-z]?(?:(?::\s*|,\s+pp?\.\s*)\d+(?:[-–]\d+)?)?\)`)
+	// (Smith 45), (Smith and Jones 112-14)
+	mlaCitationPattern = regexp.MustCompile(`\((` + citationAuthor + `)\s+\d{1,3}(?:[-–]\d{1,3})?\)`)
+	// [1], [2, 3], [4-6]
+	numericCitationPattern = regexp.MustCompile(`\[(\d{1,3})(?:\s*[,–-]\s*\d{1,3})*\]`)
+	// Smith (2020), Smith et al. (2020)
+	narrativeCitationPattern = regexp.MustCompile(`\b(` + citationAuthor + `)\s+\((\d{4}[a-z]?|n\.d\.)\)`)
+
+	etAlWithoutPeriodPattern = regexp.MustCompile(`\bet\s+al\b[^.]`)
+	referenceListPattern     = regexp.MustCompile(`(?im)^\s*(?:references?|works\s+cited|bibliography|reference\s+list)\s*:?\s*$`)
+)
+
+// DetectCitations finds common in-text citation patterns (APA, MLA, Harvard,
+// numbered and narrative) and checks that they follow a single format.
+func DetectCitations(text string) CitationAnalysis {
+	apa := apaCitationPattern.FindAllStringSubmatch(text, -1)
+	harvard := harvardCitationPattern.FindAllStringSubmatch(text, -1)
+	mla := mlaCitationPattern.FindAllStringSubmatch(text, -1)
+	numeric := numericCitationPattern.FindAllStringSubmatch(text, -1)
+	narrative := narrativeCitationPattern.FindAllStringSubmatch(text, -1)
+
+	analysis := CitationAnalysis{
+		CitationCount:     len(apa) + len(harvard) + len(mla) + len(numeric) + len(narrative),
+		CitationFormat:    CITATION_FORMAT_NONE,
+		FormatConsistency: true,
+		Issues:            []string{},
+	}
+	if analysis.CitationCount == 0 {
+		analysis.MissingCitations = true
+		return analysis
+	}
+	analysis.HasCitations = true
+
+	// The parenthetical format used most; narrative and numbered citations decide
+	// the format only when there are no parenthetical ones
+	counts := map[string]int{
+		CITATION_FORMAT_APA:     len(apa),
+		CITATION_FORMAT_HARVARD: len(harvard),
+		CITATION_FORMAT_MLA:     len(mla),
+	}
+	best := 0
+	for _, format := range []string{CITATION_FORMAT_APA, CITATION_FORMAT_HARVARD, CITATION_FORMAT_MLA} {
+		if counts[format] > best {
+			analysis.CitationFormat, best = format, counts[format]
+		}
+	}
+	if best == 0 {
+		analysis.CitationFormat = CITATION_FORMAT_IN_TEXT
+	}
+
+	// Narrative citations with a year fit APA and Harvard, but not MLA or numbered styles
+	var styles []string
+	for _, format := range []string{CITATION_FORMAT_APA, CITATION_FORMAT_HARVARD, CITATION_FORMAT_MLA} {
+		if counts[format] > 0 {
+			styles = append(styles, format)
+		}
+	}
+	if len(numeric) > 0 {
+		styles = append(styles, "numbered")
+	}
+	if len(styles) > 1 {
+		analysis.FormatConsistency = false
+		analysis.Issues = append(analysis.Issues, fmt.Sprintf("Citations mix %s styles; use one format throughout", strings.Join(styles, ", ")))
+	}
+	if len(narrative) > 0 && (counts[CITATION_FORMAT_MLA] > 0 || len(numeric) > 0) {
+		analysis.FormatConsistency = false
+		analysis.Issues = append(analysis.Issues, "Narrative citations with a year, such as \"Smith (2020)\", do not match the MLA or numbered citations")
+	}
+
+	for _, match := range narrative {
+		if strings.Contains(match[1], "&") {
+			analysis.Issues = append(analysis.Issues, fmt.Sprintf("Use \"and\" instead of \"&\" outside parentheses: %s", match[0]))
+		}
+	}
+	if etAlWithoutPeriodPattern.MatchString(text + " ") {
+		analysis.Issues = append(analysis.Issues, "Write \"et al.\" with a period")
+	}
+	if issue := numberedCitationOrderIssue(numeric); issue != "" {
+		analysis.Issues = append(analysis.Issues, issue)
+	}
+	if !referenceListPattern.MatchString(text) {
+		analysis.Issues = append(analysis.Issues, "Cited sources are not listed in a References or Works Cited section")
+	}
+	return analysis
+}
+
+// Numbered citations should be introduced in order, starting at [1]
+func numberedCitationOrderIssue(numeric [][]string) string {
+	highest := 0
+	for _, match := range numeric {
+		number, _ := strconv.Atoi(match[1])
+		if number > highest+1 {
+			return fmt.Sprintf("Numbered citations should be introduced in order from [1]; [%d] comes before [%d]", number, highest+1)
+		}
+		highest = max(highest, number)
+	}
+	return ""
+}
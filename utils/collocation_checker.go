@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// CollocationEntry lists the words that naturally go with a noun and learners'
+// frequent wrong choices for it.
+type CollocationEntry struct {
+	Collocates []string          `json:"collocates"` // Verbs and adjectives, in their base form
+	Mistakes   map[string]string `json:"mistakes"`   // Wrong word -> right one
+}
+
+// CollocationError is a word combination a native speaker would not use.
+type CollocationError struct {
+	Phrase       string `json:"phrase"`
+	Issue        string `json:"issue"`
+	BetterPhrase string `json:"better_phrase"`
+	Frequency    string `json:"frequency"` // rare, unusual, natural
+}
+
+// How often native speakers use a word combination
+const (
+	COLLOCATION_RARE    = "rare" // A known learner mistake
+	COLLOCATION_UNUSUAL = "unusual"
+	COLLOCATION_NATURAL = "natural"
+)
+
+// Words before a noun checked for its collocate
+const COLLOCATE_WINDOW_WORDS = 4
+
+// Words skipped between a collocate and its noun ("make a big decision", "turn on the light")
+var collocationSkipWords = toSet(
+	"a", "an", "the", "my", "your", "his", "her", "its", "our", "their", "this", "that", "these", "those",
+	"some", "any", "no", "very", "really", "quite", "so", "such", "too", "on", "off", "up", "out", "down",
+)
+
+// Irregular past tense and, when different, past participle of the collocates
+var irregularVerbForms = map[string][]string{
+	"make": {"made"}, "do": {"did", "done"}, "take": {"took", "taken"}, "give": {"gave", "given"},
+	"have": {"had"}, "tell": {"told"}, "say": {"said"}, "keep": {"kept"}, "pay": {"paid"},
+	"catch": {"caught"}, "break": {"broke", "broken"}, "get": {"got", "gotten"}, "throw": {"threw", "thrown"},
+	"win": {"won"}, "speak": {"spoke", "spoken"}, "see": {"saw", "seen"}, "draw": {"drew", "drawn"},
+	"write": {"wrote", "written"}, "run": {"ran"}, "hear": {"heard"}, "meet": {"met"}, "lose": {"lost"},
+	"find": {"found"}, "leave": {"left"}, "sit": {"sat"}, "stand": {"stood"}, "go": {"went", "gone"},
+	"come": {"came"}, "hold": {"held"}, "learn": {"learnt"}, "put": {"put"}, "set": {"set"}, "read": {"read"},
+}
+
+// Base form of each irregular form
+var irregularVerbBases = func() map[string]string {
+	bases := map[string]string{"does": "do", "has": "have"}
+	for base, forms := range irregularVerbForms {
+		for _, form := range forms {
+			bases[form] = base
+		}
+	}
+	return bases
+}()
+
+// CheckCollocations looks up each noun of the collocations database in the text and
+// the verbs and adjectives in the COLLOCATE_WINDOW_WORDS before it. A known mistake
+// is reported as rare; a noun with neither a known collocate nor a mistake before
+// it gives an unknown pair, returned once each as "word noun" for checking
+// elsewhere.
+func CheckCollocations(text string, collocations map[string]CollocationEntry) ([]CollocationError, []string) {
+	errors := []CollocationError{}
+	var unknown []string
+	seen := make(map[string]bool)
+	for _, sentence := range SplitSentences(text) {
+		words := sentenceWords(sentence)
+		for i, word := range words {
+			noun, entry, found := lookupCollocationNoun(word.lower, collocations)
+			if !found {
+				continue
+			}
+
+			// A mistake is reported even with a natural adjective in between ("do a big mistake")
+			var mistake *CollocationError
+			natural := false
+			first := -1 // The word right before the noun, for the unknown pair
+			for j := i - 1; j >= 0 && j >= i-COLLOCATE_WINDOW_WORDS; j-- {
+				if words[j].endsClause || nounPhraseBreaks[words[j].lower] || finiteVerbs[words[j].lower] && !isIrregularVerbForm(words[j].lower) {
+					break
+				}
+				if collocationSkipWords[words[j].lower] {
+					continue
+				}
+				if first < 0 {
+					first = j
+				}
+				base, isCollocate, right := matchCollocate(words[j].lower, entry)
+				if isCollocate {
+					natural = true
+					continue
+				}
+				if right != "" && mistake == nil {
+					mistake = collocationMistake(words[j:i+1], base, right, noun)
+				}
+			}
+
+			switch {
+			case mistake != nil:
+				if !seen[strings.ToLower(mistake.Phrase)] {
+					seen[strings.ToLower(mistake.Phrase)] = true
+					errors = append(errors, *mistake)
+				}
+			case !natural && first >= 0:
+				pair := words[first].lower + " " + word.lower
+				if !seen[pair] {
+					seen[pair] = true
+					unknown = append(unknown, pair)
+				}
+			}
+		}
+	}
+	return errors, unknown
+}
+
+// Auxiliaries end the search for a collocate, but "do" and "have" can be collocates
+func isIrregularVerbForm(word string) bool {
+	_, isBase := irregularVerbForms[word]
+	return isBase || irregularVerbBases[word] != ""
+}
+
+// The database entry of a noun, singular or plural
+func lookupCollocationNoun(word string, collocations map[string]CollocationEntry) (string, CollocationEntry, bool) {
+	for _, noun := range []string{word, strings.TrimSuffix(word, "s"), strings.TrimSuffix(word, "es")} {
+		if entry, found := collocations[noun]; found {
+			return noun, entry, true
+		}
+	}
+	return "", CollocationEntry{}, false
+}
+
+// Whether the word is a form of a collocate of the entry and, if instead it is a
+// known mistake, its base form and the right word
+func matchCollocate(word string, entry CollocationEntry) (base string, isCollocate bool, right string) {
+	for _, candidate := range baseFormCandidates(word) {
+		for _, collocate := range entry.Collocates {
+			if candidate == collocate {
+				return candidate, true, ""
+			}
+		}
+		if right, found := entry.Mistakes[candidate]; found {
+			return candidate, false, right
+		}
+	}
+	return "", false, ""
+}
+
+// Possible base forms of a word: itself, its irregular base and its regular
+// inflections stripped ("making" -> "mak", "make")
+func baseFormCandidates(word string) []string {
+	candidates := []string{word}
+	if base, found := irregularVerbBases[word]; found {
+		candidates = append(candidates, base)
+	}
+	for _, suffix := range []string{"ing", "ed", "es", "s", "d"} {
+		stem, found := strings.CutSuffix(word, suffix)
+		if !found || len(stem) < 2 {
+			continue
+		}
+		candidates = append(candidates, stem, stem+"e")
+		if last := len(stem) - 1; last > 0 && stem[last] == stem[last-1] {
+			candidates = append(candidates, stem[:last]) // "committed" -> "commit"
+		}
+		if suffix == "es" || suffix == "ed" {
+			if base, found := strings.CutSuffix(stem, "i"); found {
+				candidates = append(candidates, base+"y") // "tried" -> "try"
+			}
+		}
+	}
+	return candidates
+}
+
+// The error for a known mistake, with the right word inflected like the wrong one
+func collocationMistake(phraseWords []sentenceWord, wrongBase, right, noun string) *CollocationError {
+	parts := make([]string, len(phraseWords))
+	for i, word := range phraseWords {
+		parts[i] = word.text
+	}
+	phrase := strings.Join(parts, " ")
+
+	wrong := phraseWords[0]
+	replacement := inflectLike(right, wrongBase, wrong.lower)
+	if first := []rune(wrong.text); len(first) > 0 && unicode.IsUpper(first[0]) {
+		replacement = capitalizeFirst(replacement)
+	}
+	parts[0] = replacement
+
+	return &CollocationError{
+		Phrase:       phrase,
+		Issue:        fmt.Sprintf("\"%s\" is not used with \"%s\"; the natural word is \"%s\"", wrongBase, noun, right),
+		BetterPhrase: strings.Join(parts, " "),
+		Frequency:    COLLOCATION_RARE,
+	}
+}
+
+// Put the right word ("make", "turn on") in the form the wrong one was used in
+func inflectLike(right, wrongBase, wrongForm string) string {
+	if wrongForm == wrongBase {
+		return right
+	}
+	verb, rest, _ := strings.Cut(right, " ")
+	switch {
+	case strings.HasSuffix(wrongForm, "ing"):
+		verb = ingForm(verb)
+	case wrongForm == "does" || wrongForm == "has" || strings.HasSuffix(wrongForm, "s") && !strings.HasSuffix(wrongBase, "s"):
+		verb = thirdPersonForm(verb)
+	case irregularVerbBases[wrongForm] != "" || strings.HasSuffix(wrongForm, "ed"):
+		verb = pastForm(verb, wrongForm)
+	}
+	if rest != "" {
+		return verb + " " + rest
+	}
+	return verb
+}
+
+func ingForm(verb string) string {
+	switch {
+	case strings.HasSuffix(verb, "ie"):
+		return strings.TrimSuffix(verb, "ie") + "ying"
+	case strings.HasSuffix(verb, "e") && !strings.HasSuffix(verb, "ee"):
+		return strings.TrimSuffix(verb, "e") + "ing"
+	case verb == "get" || verb == "set" || verb == "put" || verb == "run" || verb == "win" || verb == "commit":
+		return verb + verb[len(verb)-1:] + "ing"
+	}
+	return verb + "ing"
+}
+
+func thirdPersonForm(verb string) string {
+	switch {
+	case verb == "have":
+		return "has"
+	case verb == "do" || verb == "go":
+		return verb + "es"
+	case strings.HasSuffix(verb, "ch") || strings.HasSuffix(verb, "sh") || strings.HasSuffix(verb, "s") || strings.HasSuffix(verb, "x"):
+		return verb + "es"
+	}
+	return verb + "s"
+}
+
+// The past tense, or the past participle when the wrong word was one ("done")
+func pastForm(verb, wrongForm string) string {
+	if forms, found := irregularVerbForms[verb]; found {
+		wrongForms := irregularVerbForms[irregularVerbBases[wrongForm]]
+		if len(wrongForms) > 1 && len(forms) > 1 && wrongForm == wrongForms[1] {
+			return forms[1]
+		}
+		return forms[0]
+	}
+	switch {
+	case strings.HasSuffix(verb, "e"):
+		return verb + "d"
+	case verb == "commit":
+		return "committed"
+	}
+	return verb + "ed"
+}
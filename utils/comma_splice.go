@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CommaSplice is a comma joining two independent clauses.
+type CommaSplice struct {
+	Sentence   string `json:"sentence"`
+	Position   int    `json:"position"`   // Character offset of the comma in the text
+	Suggestion string `json:"suggestion"` // Period, semicolon and conjunction rewrites
+}
+
+// Pronouns that can be the subject of a clause
+var subjectPronouns = toSet(
+	"i", "you", "he", "she", "it", "we", "they", "there",
+	"everyone", "everybody", "someone", "somebody", "nobody", "nothing", "everything", "something",
+)
+
+// Subject pronoun contractions that already contain the verb ("it's", "they're")
+var subjectContractions = toSet(
+	"i'm", "i've", "i'll", "i'd", "you're", "you've", "you'll", "you'd",
+	"he's", "he'll", "he'd", "she's", "she'll", "she'd", "it's", "it'll",
+	"we're", "we've", "we'll", "we'd", "they're", "they've", "they'll", "they'd",
+	"there's", "that's", "what's", "here's",
+)
+
+// Determiners that open a noun-phrase subject ("the dog", "my sister")
+var subjectDeterminers = toSet(
+	"the", "a", "an", "my", "your", "his", "her", "its", "our", "their",
+	"this", "that", "these", "those", "some", "many", "most", "every", "each",
+)
+
+// Finite auxiliary and linking verbs
+var finiteVerbs = toSet(
+	"am", "is", "are", "was", "were", "has", "have", "had", "do", "does", "did",
+	"will", "would", "can", "could", "shall", "should", "may", "might", "must",
+	"isn't", "aren't", "wasn't", "weren't", "hasn't", "haven't", "hadn't", "don't", "doesn't", "didn't",
+	"won't", "wouldn't", "can't", "couldn't", "shouldn't", "mustn't",
+)
+
+// Words that cannot directly follow a subject pronoun as its verb
+var nonVerbsAfterSubject = toSet(
+	"and", "or", "but", "to", "of", "in", "on", "at", "for", "with", "from", "by", "too", "also",
+)
+
+// Words that make a clause dependent or already joined to the previous one
+var clauseOpeners = toSet(
+	"and", "but", "or", "nor", "so", "yet", "for",
+	"when", "while", "because", "although", "though", "if", "unless", "since", "after", "before",
+	"as", "until", "whereas", "once", "who", "which", "whom", "whose", "where", "that", "whether",
+)
+
+// FindCommaSplices finds commas that join two independent clauses, judged by a
+// subject-plus-verb heuristic on the clause on each side of the comma.
+func FindCommaSplices(text string) []CommaSplice {
+	splices := []CommaSplice{}
+	cursor := 0
+	for _, sentence := range SplitSentences(text) {
+		offset := strings.Index(text[cursor:], sentence)
+		if offset < 0 {
+			continue
+		}
+		start := cursor + offset
+		cursor = start + len(sentence)
+
+		commas := commaIndexes(sentence)
+		for i, comma := range commas {
+			leftStart, rightEnd := 0, len(sentence)
+			if i > 0 {
+				leftStart = commas[i-1] + 1
+			}
+			if i+1 < len(commas) {
+				rightEnd = commas[i+1]
+			}
+			left := sentence[leftStart:comma]
+			right := strings.TrimSpace(sentence[comma+1 : rightEnd])
+
+			// Reported speech: He said, "I am fine."
+			if strings.HasPrefix(right, `"`) || strings.HasPrefix(right, "“") {
+				continue
+			}
+			if containsClauseOpener(left) || !isIndependentClause(left) || !isIndependentClause(right) {
+				continue
+			}
+
+			splices = append(splices, CommaSplice{
+				Sentence:   sentence,
+				Position:   utf8.RuneCountInString(text[:start+comma]),
+				Suggestion: commaSpliceSuggestion(sentence, comma),
+			})
+		}
+	}
+	return splices
+}
+
+// Byte offsets of the commas in a sentence, skipping thousands separators like 1,000
+func commaIndexes(sentence string) []int {
+	var indexes []int
+	for i := 0; i < len(sentence); i++ {
+		if sentence[i] != ',' {
+			continue
+		}
+		if i > 0 && i+1 < len(sentence) && isASCIIDigit(sentence[i-1]) && isASCIIDigit(sentence[i+1]) {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+func isASCIIDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// containsClauseOpener reports whether a clause contains a subordinator or conjunction,
+// in which case the comma after it is usually correct.
+func containsClauseOpener(clause string) bool {
+	for _, word := range ExtractWords(clause) {
+		if clauseOpeners[normalizeApostrophe(word)] {
+			return true
+		}
+	}
+	return false
+}
+
+// isIndependentClause reports whether a clause looks like it has its own subject and verb.
+func isIndependentClause(clause string) bool {
+	words := ExtractWords(clause)
+	if len(words) < 2 {
+		return false
+	}
+	for i := range words {
+		words[i] = normalizeApostrophe(words[i])
+	}
+	if clauseOpeners[words[0]] {
+		return false
+	}
+
+	for i, word := range words {
+		if subjectContractions[word] {
+			return true
+		}
+		if subjectPronouns[word] && i+1 < len(words) && !nonVerbsAfterSubject[words[i+1]] {
+			return true
+		}
+		if i > 0 && finiteVerbs[word] {
+			return true
+		}
+	}
+
+	// Noun-phrase subject with a regular verb: "the dog barked", "my sister lives here"
+	if subjectDeterminers[words[0]] {
+		for _, word := range words[2:] {
+			if len(word) > 3 && (strings.HasSuffix(word, "ed") || strings.HasSuffix(word, "s")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Rewrite a spliced sentence three ways: with a period, a semicolon and a conjunction.
+func commaSpliceSuggestion(sentence string, comma int) string {
+	left := strings.TrimSpace(sentence[:comma])
+	right := strings.TrimSpace(sentence[comma+1:])
+	return fmt.Sprintf(`Add a period: "%s. %s" | Add a semicolon: "%s; %s" | Add a conjunction: "%s, and %s"`,
+		left, capitalizeFirst(right), left, right, left, right)
+}
+
+func capitalizeFirst(text string) string {
+	first, size := utf8.DecodeRuneInString(text)
+	if first == utf8.RuneError {
+		return text
+	}
+	return string(unicode.ToUpper(first)) + text[size:]
+}
+
+func normalizeApostrophe(word string) string {
+	return strings.ReplaceAll(word, "’", "'")
+}
@@ -0,0 +1,57 @@
+package utils
+
+import "testing"
+
+func TestFindCommaSplices(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		wantPositions []int
+	}{
+		{"pronoun subjects", "I like tea, she likes coffee.", []int{10}},
+		{"contraction subject", "It was late, we're going home.", []int{11}},
+		{"curly apostrophe", "It was late, we’re going home.", []int{11}},
+		{"noun-phrase subject", "The dog barked, the cat hissed.", []int{14}},
+		{"auxiliary verb", "My brother is tall, he can play basketball.", []int{18}},
+		{"second sentence offset", "Hello there. I was tired, I went to bed.", []int{24}},
+		{"non-ASCII before the comma", "Phở is great, I eat it every day.", []int{12}},
+		{"coordinating conjunction", "I like tea, but she likes coffee.", nil},
+		{"subordinate clause first", "When I got home, I made dinner.", nil},
+		{"introductory phrase", "After dinner, we watched a film.", nil},
+		{"list of nouns", "I bought apples, pears, and bananas.", nil},
+		{"reported speech", `He said, "I am fine."`, nil},
+		{"thousands separator", "There were 1,000 people there.", nil},
+		{"no commas", "She reads every night.", nil},
+		{"empty", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			splices := FindCommaSplices(test.text)
+			if len(splices) != len(test.wantPositions) {
+				t.Fatalf("FindCommaSplices(%q) = %+v, want commas at %v", test.text, splices, test.wantPositions)
+			}
+			for i, splice := range splices {
+				if splice.Position != test.wantPositions[i] {
+					t.Errorf("splice %d at %d, want %d", i, splice.Position, test.wantPositions[i])
+				}
+				if []rune(test.text)[splice.Position] != ',' {
+					t.Errorf("splice %d position %d is not a comma in %q", i, splice.Position, test.text)
+				}
+			}
+		})
+	}
+}
+
+func TestFindCommaSplicesSuggestion(t *testing.T) {
+	splices := FindCommaSplices("I like tea, she likes coffee.")
+	if len(splices) != 1 {
+		t.Fatalf("got %d splices, want 1", len(splices))
+	}
+	if want := "I like tea, she likes coffee."; splices[0].Sentence != want {
+		t.Errorf("sentence = %q, want %q", splices[0].Sentence, want)
+	}
+	want := `Add a period: "I like tea. She likes coffee." | Add a semicolon: "I like tea; she likes coffee." | Add a conjunction: "I like tea, and she likes coffee."`
+	if splices[0].Suggestion != want {
+		t.Errorf("suggestion = %q, want %q", splices[0].Suggestion, want)
+	}
+}
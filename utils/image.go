@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"EngPal/internal/config"
+)
+
+// The limits are read from internal/config on every call (IMAGE_MAX_BYTES,
+// IMAGE_MAX_ENCODED_BYTES, IMAGE_MAX_DIMENSION, IMAGE_ALLOWED_TYPES).
+var (
+	ErrInvalidImage         = errors.New("invalid image data")
+	ErrImageTooLarge        = errors.New("image is larger than the size limit")
+	ErrUnsupportedImageType = errors.New("image type is not allowed")
+	ErrImageDimensions      = errors.New("image is wider or taller than the dimension limit")
+
+	ErrImageURLNotAllowed = errors.New("image URL must be https and point to a public address")
+	ErrImageFetchFailed   = errors.New("image could not be fetched")
+	ErrNotAnImage         = errors.New("image URL did not return an image")
+)
+
+// Most redirects followed when fetching an image URL
+const maxImageRedirects = 3
+
+// JPEG quality used when re-encoding a downscaled photo
+const downscaleJPEGQuality = 90
+
+// Fetches images from public addresses only, so image_url cannot reach internal
+// services. The address is checked after DNS resolution, on every redirect too.
+var imageHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: rejectPrivateAddress,
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxImageRedirects {
+			return fmt.Errorf("%w: too many redirects", ErrImageFetchFailed)
+		}
+		if req.URL.Scheme != "https" {
+			return ErrImageURLNotAllowed
+		}
+		return nil
+	},
+}
+
+// DecodeBase64Image decodes a base64 image, optionally given as a data URI, and
+// returns its bytes and detected MIME type.
+func DecodeBase64Image(encoded string) ([]byte, string, error) {
+	encoded = strings.TrimSpace(encoded)
+	if strings.HasPrefix(encoded, "data:") {
+		comma := strings.Index(encoded, ",")
+		if comma < 0 {
+			return nil, "", ErrInvalidImage
+		}
+		encoded = encoded[comma+1:]
+	}
+	if len(encoded) > config.ImageMaxEncodedBytes() {
+		return nil, "", ErrImageTooLarge
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+	return checkImage(data)
+}
+
+// ReadImage reads an uploaded image file within the size limit and returns its
+// bytes and detected MIME type.
+func ReadImage(r io.Reader) ([]byte, string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(config.ImageMaxBytes())+1))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+	return checkImage(data)
+}
+
+// FetchImage downloads an https image within the size limit and returns its bytes
+// and detected MIME type. Private addresses and non-https URLs are rejected with
+// ErrImageURLNotAllowed, network and HTTP failures are ErrImageFetchFailed, and
+// responses that are not images are ErrNotAnImage.
+func FetchImage(rawURL string) ([]byte, string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" {
+		return nil, "", ErrInvalidImage
+	}
+	if parsed.Scheme != "https" {
+		return nil, "", ErrImageURLNotAllowed
+	}
+
+	resp, err := imageHTTPClient.Get(parsed.String())
+	if err != nil {
+		if errors.Is(err, ErrImageURLNotAllowed) {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("%w: %v", ErrImageFetchFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%w: status %d", ErrImageFetchFailed, resp.StatusCode)
+	}
+	if mediaType := strings.ToLower(resp.Header.Get("Content-Type")); mediaType != "" && !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", fmt.Errorf("%w: content type %s", ErrNotAnImage, mediaType)
+	}
+	if resp.ContentLength > int64(config.ImageMaxBytes()) {
+		return nil, "", ErrImageTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(config.ImageMaxBytes())+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrImageFetchFailed, err)
+	}
+	if len(data) > 0 && !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, "", ErrNotAnImage
+	}
+	return checkImage(data)
+}
+
+// checkImage enforces the size and dimension limits and sniffs the MIME type from
+// the content.
+func checkImage(data []byte) ([]byte, string, error) {
+	if len(data) == 0 {
+		return nil, "", ErrInvalidImage
+	}
+	if len(data) > config.ImageMaxBytes() {
+		return nil, "", ErrImageTooLarge
+	}
+	mimeType := http.DetectContentType(data)
+	if !toSet(config.ImageAllowedTypes()...)[mimeType] {
+		return nil, "", ErrUnsupportedImageType
+	}
+
+	width, height, err := imageDimensions(data, mimeType)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit := config.ImageMaxDimension(); width > limit || height > limit {
+		return nil, "", ErrImageDimensions
+	}
+	return data, mimeType, nil
+}
+
+// imageDimensions reads the width and height from the image header without
+// decoding the pixels.
+func imageDimensions(data []byte, mimeType string) (width, height int, err error) {
+	if mimeType == "image/webp" {
+		width, height, ok := webpDimensions(data)
+		if !ok {
+			return 0, 0, ErrInvalidImage
+		}
+		return width, height, nil
+	}
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, ErrInvalidImage
+	}
+	return imageConfig.Width, imageConfig.Height, nil
+}
+
+// DownscaleImage shrinks a checked JPEG or PNG so that neither side is longer than
+// maxDimension, keeping its aspect ratio and format, and reports whether it did.
+// WebP images are returned unchanged, as the standard library cannot decode them.
+func DownscaleImage(data []byte, mimeType string, maxDimension int) ([]byte, bool, error) {
+	if mimeType == "image/webp" {
+		return data, false, nil
+	}
+	width, height, err := imageDimensions(data, mimeType)
+	if err != nil {
+		return nil, false, err
+	}
+	if width <= maxDimension && height <= maxDimension {
+		return data, false, nil
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, ErrInvalidImage
+	}
+	scale := float64(maxDimension) / float64(max(width, height))
+	resized := resizeImage(source, max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale)))
+
+	var buf bytes.Buffer
+	if mimeType == "image/png" {
+		err = png.Encode(&buf, resized)
+	} else {
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: downscaleJPEGQuality})
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode downscaled image: %w", err)
+	}
+	return buf.Bytes(), true, nil
+}
+
+// resizeImage shrinks an image with an area-averaging (box) filter, which keeps
+// thin strokes such as printed text legible.
+func resizeImage(source image.Image, width, height int) *image.NRGBA {
+	bounds := source.Bounds()
+	sourceWidth, sourceHeight := bounds.Dx(), bounds.Dy()
+	resized := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sourceHeight/height, max((y+1)*sourceHeight/height, y*sourceHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sourceWidth/width, max((x+1)*sourceWidth/width, x*sourceWidth/width+1)
+
+			var r, g, b, a uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := source.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+				}
+			}
+
+			// Averaged premultiplied values, converted back to non-premultiplied 8-bit
+			count := uint64((x1 - x0) * (y1 - y0))
+			offset := resized.PixOffset(x, y)
+			if a == 0 {
+				continue
+			}
+			resized.Pix[offset] = uint8(r * 0xff / a)
+			resized.Pix[offset+1] = uint8(g * 0xff / a)
+			resized.Pix[offset+2] = uint8(b * 0xff / a)
+			resized.Pix[offset+3] = uint8(a / count >> 8)
+		}
+	}
+	return resized
+}
+
+// webpDimensions reads the canvas size from the header of a lossy (VP8), lossless
+// (VP8L) or extended (VP8X) WebP file.
+func webpDimensions(data []byte) (width, height int, ok bool) {
+	if len(data) < 30 {
+		return 0, 0, false
+	}
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// Frame header: 3-byte tag, start code, then 14-bit width and height
+		return int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff), int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff), true
+	case "VP8L":
+		// Signature byte, then 14 bits each of width-1 and height-1
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	case "VP8X":
+		// Flags and reserved bytes, then 24 bits each of width-1 and height-1
+		return int(uint32(data[24])|uint32(data[25])<<8|uint32(data[26])<<16) + 1,
+			int(uint32(data[27])|uint32(data[28])<<8|uint32(data[29])<<16) + 1, true
+	}
+	return 0, 0, false
+}
+
+// rejectPrivateAddress refuses connections to loopback, private and link-local addresses.
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrImageURLNotAllowed, host)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// JSONField is a complete top-level field of a JSON object.
+type JSONField struct {
+	Name  string
+	Value json.RawMessage
+}
+
+// Parser states
+const (
+	partialJSONStart = iota // Before the opening brace (skips ```json fences)
+	partialJSONBeforeKey
+	partialJSONKey
+	partialJSONBeforeColon
+	partialJSONValue
+	partialJSONDone
+)
+
+// PartialJSONParser accumulates a streamed JSON object and reports each top-level
+// field as soon as its value is complete.
+type PartialJSONParser struct {
+	buffer []byte
+	pos    int
+	state  int
+
+	key        string
+	keyStart   int
+	valueStart int
+	depth      int
+	inString   bool
+	escaped    bool
+}
+
+// Feed appends a chunk of the stream and returns the fields completed by it.
+func (p *PartialJSONParser) Feed(chunk string) []JSONField {
+	p.buffer = append(p.buffer, chunk...)
+	return p.parsePartialJSON()
+}
+
+// Done reports whether the closing brace of the object has been read.
+func (p *PartialJSONParser) Done() bool {
+	return p.state == partialJSONDone
+}
+
+// parsePartialJSON advances the state machine over the unread part of the buffer.
+func (p *PartialJSONParser) parsePartialJSON() []JSONField {
+	var fields []JSONField
+
+	for ; p.pos < len(p.buffer) && p.state != partialJSONDone; p.pos++ {
+		c := p.buffer[p.pos]
+
+		switch p.state {
+		case partialJSONStart:
+			if c == '{' {
+				p.state = partialJSONBeforeKey
+			}
+
+		case partialJSONBeforeKey:
+			switch c {
+			case '"':
+				p.state = partialJSONKey
+				p.keyStart = p.pos + 1
+			case '}':
+				p.state = partialJSONDone
+			}
+
+		case partialJSONKey:
+			if p.escaped {
+				p.escaped = false
+			} else if c == '\\' {
+				p.escaped = true
+			} else if c == '"' {
+				var key string
+				if err := json.Unmarshal(p.buffer[p.keyStart-1:p.pos+1], &key); err != nil {
+					key = string(p.buffer[p.keyStart:p.pos])
+				}
+				p.key = key
+				p.state = partialJSONBeforeColon
+			}
+
+		case partialJSONBeforeColon:
+			if c == ':' {
+				p.state = partialJSONValue
+				p.valueStart = p.pos + 1
+				p.depth = 0
+			}
+
+		case partialJSONValue:
+			if p.inString {
+				if p.escaped {
+					p.escaped = false
+				} else if c == '\\' {
+					p.escaped = true
+				} else if c == '"' {
+					p.inString = false
+				}
+				continue
+			}
+
+			switch c {
+			case '"':
+				p.inString = true
+			case '{', '[':
+				p.depth++
+			case ']':
+				p.depth--
+			case '}':
+				if p.depth > 0 {
+					p.depth--
+					continue
+				}
+				fields = append(fields, p.completeField())
+				p.state = partialJSONDone
+			case ',':
+				if p.depth == 0 {
+					fields = append(fields, p.completeField())
+					p.state = partialJSONBeforeKey
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// completeField returns the field whose value ends just before the current position.
+func (p *PartialJSONParser) completeField() JSONField {
+	value := strings.TrimSpace(string(p.buffer[p.valueStart:p.pos]))
+	return JSONField{Name: p.key, Value: json.RawMessage(value)}
+}
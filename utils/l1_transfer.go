@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// L1Warning is an error a learner likely carries over from their native language.
+type L1Warning struct {
+	Pattern     string `json:"pattern"`
+	Example     string `json:"example"` // As written
+	Correction  string `json:"correction"`
+	Explanation string `json:"explanation"`
+}
+
+// Vietnamese transfer patterns reported by DetectVietnameseTransferErrors
+const (
+	L1_MISSING_ARTICLE     = "missing_article"
+	L1_PRONOUN_GENDER      = "he_she_confusion"
+	L1_MISSING_AUXILIARY   = "missing_auxiliary_in_question"
+	L1_ING_WITHOUT_BE      = "ing_without_be"
+	L1_BE_WITH_BASE_VERB   = "be_with_base_verb"
+	MAX_L1_TRANSFER_ERRORS = 10
+)
+
+var vietnameseTransferExplanations = map[string]string{
+	L1_MISSING_ARTICLE:   "Vietnamese does not use articles, but English needs a, an or the before a singular countable noun",
+	L1_PRONOUN_GENDER:    "Vietnamese pronouns such as \"nó\" or \"bạn ấy\" do not show gender, but English he and she must match the person",
+	L1_MISSING_AUXILIARY: "Vietnamese forms questions with question words alone, but English questions need do, does or did before the subject",
+	L1_ING_WITHOUT_BE:    "Vietnamese marks ongoing actions with \"đang\" alone, but English needs am, is or are before the -ing verb",
+	L1_BE_WITH_BASE_VERB: "\"là\" is only used before nouns in Vietnamese, and English does not put am, is or are before a main verb either",
+}
+
+// Singular countable nouns learners often leave without an article
+const countableNouns = `dog|cat|book|car|house|job|computer|phone|bike|bicycle|friend|teacher|student|doctor|engineer|nurse|problem|question|idea|letter|pen|bag|room|apartment|table|chair|ticket|picture|photo|movie|film|song|gift|boyfriend|girlfriend|brother|sister|camera|laptop|garden|shop|restaurant|hotel|company|city|village|dream|plan|decision|mistake|chance|umbrella|orange|apple|egg|uniform`
+
+// Words that start with a vowel letter but take "a"
+var consonantSoundWords = toSet("uniform")
+
+var (
+	// "I saw dog", "She has car"
+	missingArticlePattern = regexp.MustCompile(`(?i)\b((?:i|you|he|she|we|they)\s+)?(saw|see|sees|have|has|had|buy|buys|bought|want|wants|wanted|need|needs|needed|get|gets|got|am|is|was|found|made|met|own|owns|rent|rented)\s+(` + countableNouns + `)\b`)
+	// "My mother is a teacher and he loves it", "my brother, she is tall": the
+	// pronoun right after the noun or after a comma or conjunction following it
+	femaleThenMalePattern = genderedPronounPattern(wordAlternation(femaleNouns), "he")
+	maleThenFemalePattern = genderedPronounPattern(wordAlternation(maleNouns), "she")
+	femaleNounPattern     = regexp.MustCompile(`(?i)\b(?:` + wordAlternation(femaleNouns) + `|she|her)\b`)
+	maleNounPattern       = regexp.MustCompile(`(?i)\b(?:` + wordAlternation(maleNouns) + `|he|him|his)\b`)
+	// "Where you go?", "What she like?"
+	missingAuxiliaryPattern = regexp.MustCompile(`(?i)^(what|where|when|why|how|who|which)\s+(i|you|he|she|it|we|they)\s+([a-z]+)\b[^?]*\?$`)
+	// "I going", "they playing"
+	ingWithoutBePattern = regexp.MustCompile(`(?i)\b(i|you|he|she|it|we|they)\s+([a-z]{2,}ing)\b`)
+	// "I am go", "she is like"
+	beWithBaseVerbPattern = regexp.MustCompile(`(?i)\b(i|you|he|she|it|we|they)\s+(am|is|are)\s+(go|like|want|live|work|study|play|eat|need|love|know|think|come|have|agree|understand|prefer)\b`)
+)
+
+// The words of a set as a regular expression alternation, longest first
+func wordAlternation(words map[string]bool) string {
+	list := make([]string, 0, len(words))
+	for word := range words {
+		list = append(list, word)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return len(list[i]) > len(list[j]) || len(list[i]) == len(list[j]) && list[i] < list[j]
+	})
+	return strings.Join(list, "|")
+}
+
+func genderedPronounPattern(nouns, pronoun string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b(?:my|his|her|our|your|their|the|a)\s+(?:` + nouns + `)\b([^.!?]{0,60}?(?:,|\s(?:and|but|so|because|when|although|while|then)))?\s+(` + pronoun + `)\b`)
+}
+
+// Words ending in -ing that are not verbs after a pronoun ("they bring", "I sing")
+var nonProgressiveIng = toSet(
+	"bring", "sing", "ring", "cling", "fling", "sting", "swing", "wring", "thing", "king", "spring",
+	"nothing", "something", "anything", "everything", "during", "morning", "evening", "building",
+)
+
+// Words before a pronoun that make a following -ing verb correct ("are you going",
+// "I heard you singing")
+var ingAllowedBefore = toSet(
+	"am", "is", "are", "was", "were", "be", "been", "being", "aren't", "isn't", "wasn't", "weren't",
+	"saw", "see", "sees", "seen", "watch", "watched", "heard", "hear", "felt", "feel", "noticed", "imagine", "keep", "kept",
+)
+
+// Verbs that are already auxiliaries after the subject of a question
+var questionAuxiliaries = toSet(
+	"do", "does", "did", "am", "is", "are", "was", "were", "have", "has", "had",
+	"will", "would", "can", "could", "shall", "should", "may", "might", "must",
+)
+
+// DetectVietnameseTransferErrors finds errors Vietnamese learners commonly make
+// because of their native language: missing articles, he/she confusion, questions
+// without an auxiliary, -ing verbs without be and be before a base verb. It returns
+// at most MAX_L1_TRANSFER_ERRORS warnings, each example once.
+func DetectVietnameseTransferErrors(text string) []L1Warning {
+	warnings := []L1Warning{}
+	seen := make(map[string]bool)
+	add := func(pattern, example, correction string) {
+		key := strings.ToLower(example)
+		if seen[key] || len(warnings) == MAX_L1_TRANSFER_ERRORS {
+			return
+		}
+		seen[key] = true
+		warnings = append(warnings, L1Warning{
+			Pattern:     pattern,
+			Example:     example,
+			Correction:  correction,
+			Explanation: vietnameseTransferExplanations[pattern],
+		})
+	}
+
+	for _, sentence := range SplitSentences(normalizeApostrophe(text)) {
+		for _, match := range missingArticlePattern.FindAllStringSubmatch(sentence, -1) {
+			noun := match[3]
+			article := "a"
+			if strings.ContainsRune("aeiouAEIOU", rune(noun[0])) && !consonantSoundWords[strings.ToLower(noun)] {
+				article = "an"
+			}
+			add(L1_MISSING_ARTICLE, match[0], match[1]+match[2]+" "+article+" "+noun)
+		}
+
+		for _, check := range []struct {
+			pattern, others *regexp.Regexp
+		}{{femaleThenMalePattern, maleNounPattern}, {maleThenFemalePattern, femaleNounPattern}} {
+			for _, match := range check.pattern.FindAllStringSubmatchIndex(sentence, -1) {
+				// Another man or woman, or a name, between them could be who the pronoun means
+				if match[2] >= 0 && (check.others.MatchString(sentence[match[2]:match[3]]) || hasCapitalizedWord(sentence[match[2]:match[3]])) {
+					continue
+				}
+				pronoun := sentence[match[4]:match[5]]
+				add(L1_PRONOUN_GENDER, sentence[match[0]:match[1]], sentence[match[0]:match[4]]+matchCase(oppositePronoun(pronoun), pronoun))
+			}
+		}
+
+		if match := missingAuxiliaryPattern.FindStringSubmatchIndex(sentence); match != nil {
+			if correction, found := questionWithAuxiliary(sentence, match); found {
+				add(L1_MISSING_AUXILIARY, sentence, correction)
+			}
+		}
+
+		for _, match := range ingWithoutBePattern.FindAllStringSubmatchIndex(sentence, -1) {
+			subject, verb := sentence[match[2]:match[3]], sentence[match[4]:match[5]]
+			if nonProgressiveIng[strings.ToLower(verb)] || ingAllowedBefore[lastWord(sentence[:match[0]])] {
+				continue
+			}
+			add(L1_ING_WITHOUT_BE, sentence[match[0]:match[1]], subject+" "+beFormFor(subject)+" "+verb)
+		}
+
+		for _, match := range beWithBaseVerbPattern.FindAllStringSubmatch(sentence, -1) {
+			verb := match[3]
+			if subject := strings.ToLower(match[1]); subject == "he" || subject == "she" || subject == "it" {
+				verb = thirdPersonForm(verb)
+			}
+			add(L1_BE_WITH_BASE_VERB, match[0], match[1]+" "+verb)
+		}
+	}
+	return warnings
+}
+
+// "Where you go?" with do, does or did before the subject and the verb in its base
+// form; false when the verb is already an auxiliary or its base form is unclear
+func questionWithAuxiliary(sentence string, match []int) (string, bool) {
+	subject := strings.ToLower(sentence[match[4]:match[5]])
+	verb := strings.ToLower(sentence[match[6]:match[7]])
+	if questionAuxiliaries[verb] {
+		return "", false
+	}
+
+	auxiliary := "do"
+	if base, found := irregularVerbBases[verb]; found {
+		auxiliary, verb = "did", base
+	} else if strings.HasSuffix(verb, "ed") {
+		return "", false // "lived" or "stopped" cannot be reliably reduced
+	} else {
+		if subject == "he" || subject == "she" || subject == "it" {
+			auxiliary = "does"
+		}
+		verb = baseFromThirdPerson(verb)
+	}
+	wh := sentence[match[2]:match[3]]
+	return wh + " " + auxiliary + " " + sentence[match[4]:match[5]] + " " + verb + sentence[match[7]:], true
+}
+
+// "watches" -> "watch", "studies" -> "study", "likes" -> "like"; other words unchanged
+func baseFromThirdPerson(verb string) string {
+	switch {
+	case strings.HasSuffix(verb, "ss") || !strings.HasSuffix(verb, "s"):
+		return verb
+	case strings.HasSuffix(verb, "ies"):
+		return strings.TrimSuffix(verb, "ies") + "y"
+	case strings.HasSuffix(verb, "ches") || strings.HasSuffix(verb, "shes") || strings.HasSuffix(verb, "xes") || strings.HasSuffix(verb, "oes"):
+		return strings.TrimSuffix(verb, "es")
+	}
+	return strings.TrimSuffix(verb, "s")
+}
+
+func oppositePronoun(pronoun string) string {
+	if strings.EqualFold(pronoun, "he") {
+		return "she"
+	}
+	return "he"
+}
+
+// Whether a word other than the first is capitalized, as a name would be
+func hasCapitalizedWord(text string) bool {
+	for _, word := range strings.Fields(text) {
+		if word != "I" && word[0] >= 'A' && word[0] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+func lastWord(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.Trim(fields[len(fields)-1], ",;:\"'"))
+}
+
+func beFormFor(subject string) string {
+	switch strings.ToLower(subject) {
+	case "i":
+		return "am"
+	case "he", "she", "it":
+		return "is"
+	}
+	return "are"
+}
+
+// The replacement capitalized like the original ("He" -> "She")
+func matchCase(replacement, original string) string {
+	if original != "" && original[0] >= 'A' && original[0] <= 'Z' {
+		return capitalizeFirst(replacement)
+	}
+	return replacement
+}
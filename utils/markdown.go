@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	scriptBlockPattern  = regexp.MustCompile(`(?is)<(script|style|iframe|object|embed)\b[^>]*>.*?</\s*(script|style|iframe|object|embed)\s*>`)
+	htmlCommentPattern  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTagPattern      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	unsafeLinkPattern   = regexp.MustCompile(`(?i)!?\[([^\]]*)\]\(\s*<?\s*(?:javascript|vbscript|data):(?:[^()]|\([^()]*\))*\)`)
+	unsafeSchemePattern = regexp.MustCompile(`(?i)\b(?:javascript|vbscript)\s*:`)
+	dataURIPattern      = regexp.MustCompile(`(?i)\bdata:[a-z0-9.+-]+/[a-z0-9.+-]+[^\s)"']*`)
+
+	codeFencePattern     = regexp.MustCompile("(?m)^\\s*```[^\\n]*\\n?")
+	headingPattern       = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	blockquotePattern    = regexp.MustCompile(`(?m)^\s{0,3}>\s?`)
+	horizontalRule       = regexp.MustCompile(`(?m)^\s{0,3}([-*_])(\s*([-*_])){2,}\s*$\n?`)
+	imagePattern         = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	linkPattern          = regexp.MustCompile(`\[([^\]]*)\]\(([^)]*)\)`)
+	boldPattern          = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	italicPattern        = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\s][^*_]*?)[*_]([^\w*]|$)`)
+	strikethroughPattern = regexp.MustCompile(`~~(.+?)~~`)
+	inlineCodePattern    = regexp.MustCompile("`([^`]*)`")
+	listMarkerPattern    = regexp.MustCompile(`(?m)^(\s*)[*+]\s+`)
+)
+
+// SanitizeMarkdown removes HTML tags, script-like content, javascript: links and data URIs
+// from model-generated markdown so it is safe for clients that render it as HTML.
+func SanitizeMarkdown(text string) string {
+	text = scriptBlockPattern.ReplaceAllString(text, "")
+	text = htmlCommentPattern.ReplaceAllString(text, "")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = unsafeLinkPattern.ReplaceAllString(text, "$1")
+	text = unsafeSchemePattern.ReplaceAllString(text, "")
+	text = dataURIPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(text)
+}
+
+// MarkdownToPlainText strips markdown syntax, keeping the readable text.
+func MarkdownToPlainText(text string) string {
+	text = codeFencePattern.ReplaceAllString(text, "")
+	text = horizontalRule.ReplaceAllString(text, "")
+	text = headingPattern.ReplaceAllString(text, "")
+	text = blockquotePattern.ReplaceAllString(text, "")
+	text = imagePattern.ReplaceAllString(text, "$1")
+	text = linkPattern.ReplaceAllString(text, "$1 ($2)")
+	text = boldPattern.ReplaceAllString(text, "$2")
+	text = italicPattern.ReplaceAllString(text, "$1$2$3")
+	text = strikethroughPattern.ReplaceAllString(text, "$1")
+	text = inlineCodePattern.ReplaceAllString(text, "$1")
+	text = listMarkerPattern.ReplaceAllString(text, "$1- ")
+	return strings.TrimSpace(text)
+}
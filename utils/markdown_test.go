@@ -0,0 +1,68 @@
+package utils
+
+import "testing"
+
+func TestSanitizeMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain markdown untouched", "**Good** job! Use *past* tense.\n\n- one\n- two", "**Good** job! Use *past* tense.\n\n- one\n- two"},
+		{"safe link kept", "See [the guide](https://example.com/guide).", "See [the guide](https://example.com/guide)."},
+		{"script block", "Hi<script>alert('x')</script> there", "Hi there"},
+		{"uppercase script block", "Hi<SCRIPT type=\"text/javascript\">\nalert(1)\n</SCRIPT> there", "Hi there"},
+		{"style block", "<style>body{display:none}</style>Text", "Text"},
+		{"iframe block", "A<iframe src=\"https://evil.example\"></iframe>B", "AB"},
+		{"object and embed", "<object data=\"x\"></object><embed src=\"y\"></embed>ok", "ok"},
+		{"html comment", "Before<!-- hidden\ncomment -->After", "BeforeAfter"},
+		{"inline tags", "<b>bold</b> and <span style=\"color:red\">red</span>", "bold and red"},
+		{"self-closing tag", "line<br/>break", "linebreak"},
+		{"event handler tag", "<img src=x onerror=alert(1)>caption", "caption"},
+		{"comparison kept", "Use 3 < 5 and 5 > 3.", "Use 3 < 5 and 5 > 3."},
+		{"javascript link", "Click [here](javascript:alert(1)) now", "Click here now"},
+		{"javascript link with spaces", "[x]( JavaScript:alert('y') )", "x"},
+		{"vbscript link", "[run](vbscript:msgbox)", "run"},
+		{"data link", "[file](data:text/html;base64,PHNjcmlwdD4=)", "file"},
+		{"data image", "![pic](data:image/png;base64,iVBORw0KGgo=)", "pic"},
+		{"bare javascript scheme", "Type javascript:alert(1) in the bar", "Type alert(1) in the bar"},
+		{"bare data uri", "src data:image/svg+xml;base64,PHN2Zz4= end", "src  end"},
+		{"surrounding space trimmed", "  \n hello \n ", "hello"},
+		{"empty", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SanitizeMarkdown(test.input); got != test.want {
+				t.Errorf("SanitizeMarkdown(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownToPlainText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"heading", "## Past tense\nUse -ed.", "Past tense\nUse -ed."},
+		{"bold and italic", "**Great** and *good* and __fine__", "Great and good and fine"},
+		{"strikethrough", "~~goed~~ went", "goed went"},
+		{"inline code", "Say `went`, not `goed`.", "Say went, not goed."},
+		{"code fence", "```\nI went home.\n```", "I went home."},
+		{"link", "[guide](https://example.com)", "guide (https://example.com)"},
+		{"image", "![a cat](https://example.com/cat.png)", "a cat"},
+		{"blockquote", "> I goed home.\n> I went home.", "I goed home.\nI went home."},
+		{"list markers", "* one\n+ two\n- three", "- one\n- two\n- three"},
+		{"horizontal rule", "above\n---\nbelow", "above\nbelow"},
+		{"snake case kept", "use my_variable_name here", "use my_variable_name here"},
+		{"plain text untouched", "Just a sentence.", "Just a sentence."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := MarkdownToPlainText(test.input); got != test.want {
+				t.Errorf("MarkdownToPlainText(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
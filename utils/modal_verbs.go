@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+)
+
+// ModalVerbAnalysis counts the modal verbs of a text.
+type ModalVerbAnalysis struct {
+	ModalVerbsFound map[string]int `json:"modal_verbs_found"` // Modal -> occurrences, negative forms included
+	Variety         string         `json:"variety"`           // high, medium, low
+	OverusedModals  []string       `json:"overused_modals"`   // Used more than MODAL_OVERUSE_THRESHOLD times
+}
+
+const (
+	MODAL_OVERUSE_THRESHOLD    = 3
+	HIGH_MODAL_VARIETY_COUNT   = 4 // Distinct modals for high variety
+	MEDIUM_MODAL_VARIETY_COUNT = 2
+)
+
+// Modal verbs and their negative and contracted forms, by the modal they count towards.
+// "need" and "dare" are counted however they are used.
+var modalForms = map[string]string{
+	"can": "can", "cannot": "can", "can't": "can",
+	"could": "could", "couldn't": "could",
+	"may":   "may",
+	"might": "might", "mightn't": "might",
+	"must": "must", "mustn't": "must",
+	"shall": "shall", "shan't": "shall",
+	"should": "should", "shouldn't": "should",
+	"will": "will", "won't": "will",
+	"would": "would", "wouldn't": "would",
+	"need": "need", "needn't": "need",
+	"dare": "dare", "daren't": "dare",
+	"ought": "ought", "oughtn't": "ought",
+}
+
+// AnalyzeModals counts the modal verbs of the text and rates their variety by the
+// number of distinct modals used.
+func AnalyzeModals(text string) ModalVerbAnalysis {
+	analysis := ModalVerbAnalysis{ModalVerbsFound: make(map[string]int), OverusedModals: []string{}}
+	for _, word := range ExtractWords(strings.ReplaceAll(text, "’", "'")) {
+		if modal, exists := modalForms[word]; exists {
+			analysis.ModalVerbsFound[modal]++
+		}
+	}
+
+	for modal, count := range analysis.ModalVerbsFound {
+		if count > MODAL_OVERUSE_THRESHOLD {
+			analysis.OverusedModals = append(analysis.OverusedModals, modal)
+		}
+	}
+	sort.Strings(analysis.OverusedModals)
+
+	switch distinct := len(analysis.ModalVerbsFound); {
+	case distinct >= HIGH_MODAL_VARIETY_COUNT:
+		analysis.Variety = "high"
+	case distinct >= MEDIUM_MODAL_VARIETY_COUNT:
+		analysis.Variety = "medium"
+	default:
+		analysis.Variety = "low"
+	}
+	return analysis
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Moderation categories reported by CheckModeration
+const (
+	ModerationProfanity       = "profanity"
+	ModerationPromptInjection = "prompt_injection"
+)
+
+// Profanity and abuse blocklist in English and Vietnamese, matched as whole words.
+var profanityBlocklist = []string{
+	// English
+	"fuck", "fucking", "fucker", "motherfucker", "shit", "bullshit", "bitch", "bastard",
+	"asshole", "cunt", "dick", "pussy", "slut", "whore", "retard", "nigger", "faggot",
+	// Vietnamese
+	"địt", "đụ", "đéo", "lồn", "cặc", "buồi", "đĩ", "đm", "đmm", "dmm", "vcl", "vkl",
+	"clgt", "óc chó", "mẹ mày", "thằng chó", "đồ chó",
+}
+
+var profanityPattern = buildWordPattern(profanityBlocklist)
+
+// The blocklist matched in any case, for masking text that was not lowercased
+var profanityMaskPattern = regexp.MustCompile(`(?i)` + profanityPattern.String())
+
+// Phrases commonly used to override the assistant's instructions.
+var promptInjectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,30}\b(instructions?|rules|prompts?|guidelines)\b`),
+	regexp.MustCompile(`(?i)\b(system|developer) prompt\b`),
+	regexp.MustCompile(`(?i)\byou are now\b|\bfrom now on,? you (are|will)\b|\bact as (an? )?(unfiltered|jailbroken|dan)\b`),
+	regexp.MustCompile(`(?i)\bpretend (that )?you (have no|are not bound by)\b`),
+	regexp.MustCompile(`(?i)(bỏ qua|phớt lờ|quên|lờ đi).{0,30}(hướng dẫn|chỉ dẫn|quy tắc|lệnh)`),
+	regexp.MustCompile(`(?i)từ (giờ|bây giờ) (trở đi )?(bạn|mày|em|anh) (là|sẽ)`),
+}
+
+// CheckModeration runs the local pre-flight moderation check on user input.
+// It returns whether the text should be blocked and the matching category.
+func CheckModeration(text string) (bool, string) {
+	lower := strings.ToLower(text)
+	if profanityPattern.MatchString(lower) {
+		return true, ModerationProfanity
+	}
+	for _, pattern := range promptInjectionPatterns {
+		if pattern.MatchString(lower) {
+			return true, ModerationPromptInjection
+		}
+	}
+	return false, ""
+}
+
+// MaskProfanity replaces every letter but the first of each blocklisted word with
+// '*', keeping the rest of the text as it is.
+func MaskProfanity(text string) string {
+	// Adjacent words share the boundary between them, so repeat until none is left
+	for {
+		match := profanityMaskPattern.FindStringSubmatchIndex(text)
+		if match == nil {
+			return text
+		}
+		start, end := match[4], match[5] // The word, without its boundaries
+		word := []rune(text[start:end])
+		masked := string(word[0])
+		for _, r := range word[1:] {
+			if r == ' ' {
+				masked += " "
+			} else {
+				masked += "*"
+			}
+		}
+		text = text[:start] + masked + text[end:]
+	}
+}
+
+// buildWordPattern compiles a whole-word, Unicode-aware alternation of the given terms.
+func buildWordPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	// \b only understands ASCII word characters, so spell the boundaries out for Vietnamese letters
+	return regexp.MustCompile(`(^|[^\p{L}\p{N}])(` + strings.Join(quoted, "|") + `)($|[^\p{L}\p{N}])`)
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PassiveInstance is a passive construction found in a text.
+type PassiveInstance struct {
+	Sentence         string `json:"sentence"`
+	PassiveClause    string `json:"passive_clause"`
+	ActiveSuggestion string `json:"active_suggestion"`
+	Tense            string `json:"tense"`
+}
+
+// Irregular past participles and their simple past forms
+var irregularParticiples = map[string]string{
+	"begun": "began", "bitten": "bit", "blown": "blew", "broken": "broke", "brought": "brought",
+	"built": "built", "bought": "bought", "caught": "caught", "chosen": "chose", "cut": "cut", "done": "did",
+	"drawn": "drew", "driven": "drove", "eaten": "ate", "fed": "fed", "felt": "felt", "forbidden": "forbade",
+	"forgiven": "forgave", "forgotten": "forgot", "found": "found", "frozen": "froze", "given": "gave",
+	"grown": "grew", "heard": "heard", "held": "held", "hidden": "hid", "hit": "hit", "hurt": "hurt",
+	"kept": "kept", "known": "knew", "laid": "laid", "led": "led", "left": "left", "lent": "lent", "lost": "lost",
+	"made": "made", "meant": "meant", "met": "met", "paid": "paid", "put": "put", "read": "read", "ridden": "rode",
+	"rung": "rang", "said": "said", "seen": "saw", "sent": "sent", "set": "set", "shaken": "shook", "shot": "shot",
+	"shown": "showed", "shut": "shut", "sold": "sold", "spent": "spent", "spoken": "spoke", "spread": "spread",
+	"stolen": "stole", "struck": "struck", "sung": "sang", "taken": "took", "taught": "taught", "thrown": "threw",
+	"told": "told", "thought": "thought", "understood": "understood", "woken": "woke", "won": "won",
+	"worn": "wore", "written": "wrote",
+}
+
+// Words ending in -ed or -en after "be" that are not participles ("is often", "was open")
+var notParticiples = toSet(
+	"often", "even", "open", "then", "when", "seven", "ten", "eleven", "seventeen", "between", "golden",
+	"wooden", "children", "kitchen", "garden", "chicken", "sudden", "need", "bed", "red", "shed",
+	"speed", "seed", "feed", "hundred", "indeed", "naked", "wicked", "sacred", "rugged",
+)
+
+// A form of "be", optional adverbs, then an -ed/-en word or irregular participle
+var passivePattern = regexp.MustCompile(`(?i)\b(am|is|are|was|were|be|been|being)\s+((?:(?:not|never|also|often|always|already|usually|still|just)\s+)*)([a-z]+(?:ed|en)|` +
+	irregularParticipleAlternation() + `)\b`)
+
+// "by" and the agent up to punctuation or the next preposition or conjunction
+var passiveAgentPattern = regexp.MustCompile(`(?i)^\s+by\s+(.+?)(?:\s+(?:in|on|at|for|with|from|to|during|after|before|because|and|but|since|when|while)\b|[,.;:!?]|$)`)
+
+// Words a clause can begin with that are not part of its subject
+var subjectLeadWords = toSet(
+	"and", "but", "or", "so", "yet", "because", "although", "though", "when", "while", "if", "since",
+	"after", "before", "as", "that", "however", "therefore", "then",
+)
+
+// Subject pronouns and their object forms
+var objectPronouns = map[string]string{"i": "me", "he": "him", "she": "her", "we": "us", "they": "them"}
+
+func irregularParticipleAlternation() string {
+	participles := make([]string, 0, len(irregularParticiples))
+	for participle := range irregularParticiples {
+		participles = append(participles, participle)
+	}
+	return strings.Join(participles, "|")
+}
+
+// FindPassiveVoice finds passive constructions (a form of "be" followed by a past
+// participle) and suggests an active rewrite for each.
+func FindPassiveVoice(text string) []PassiveInstance {
+	instances := []PassiveInstance{}
+	for _, sentence := range SplitSentences(text) {
+		for _, match := range passivePattern.FindAllStringSubmatchIndex(sentence, -1) {
+			auxiliary := strings.ToLower(sentence[match[2]:match[3]])
+			participle := strings.ToLower(sentence[match[6]:match[7]])
+			if notParticiples[participle] {
+				continue
+			}
+
+			before := sentence[:match[0]]
+			subject, helper := passiveSubject(before)
+			tense := passiveTense(auxiliary, helper)
+
+			clauseEnd := match[1]
+			agent := ""
+			if agentMatch := passiveAgentPattern.FindStringSubmatchIndex(sentence[match[1]:]); agentMatch != nil {
+				agent = strings.TrimSpace(sentence[match[1]+agentMatch[2] : match[1]+agentMatch[3]])
+				clauseEnd = match[1] + agentMatch[3]
+			}
+
+			clauseStart := match[0]
+			if subject != "" {
+				clauseStart = strings.LastIndex(before, subject)
+			}
+			instances = append(instances, PassiveInstance{
+				Sentence:         sentence,
+				PassiveClause:    strings.TrimSpace(sentence[clauseStart:clauseEnd]),
+				ActiveSuggestion: activeSuggestion(subject, participle, agent, tense),
+				Tense:            tense,
+			})
+		}
+	}
+	return instances
+}
+
+// passiveSubject returns the subject before the "be" form, taken from the start of
+// its clause, and the helper verb directly before "be" ("will", "has", ...), if any.
+func passiveSubject(before string) (subject, helper string) {
+	clause := before
+	if i := strings.LastIndexAny(clause, ",;:"); i >= 0 {
+		clause = clause[i+1:]
+	}
+	words := strings.Fields(clause)
+	for len(words) > 0 && subjectLeadWords[strings.ToLower(words[0])] {
+		words = words[1:]
+	}
+	if len(words) > 0 {
+		switch last := strings.ToLower(words[len(words)-1]); last {
+		case "will", "would", "can", "could", "may", "might", "must", "should", "shall",
+			"has", "have", "had", "am", "is", "are", "was", "were", "to":
+			helper = last
+			words = words[:len(words)-1]
+		}
+	}
+	// Relative clauses ("which was built") have no usable subject
+	if len(words) == 1 && (strings.EqualFold(words[0], "which") || strings.EqualFold(words[0], "who") || strings.EqualFold(words[0], "that")) {
+		return "", helper
+	}
+	return strings.Join(words, " "), helper
+}
+
+// passiveTense names the tense of a passive from its "be" form and the word before it.
+func passiveTense(auxiliary, helper string) string {
+	switch auxiliary {
+	case "am", "is", "are":
+		return "present simple"
+	case "was", "were":
+		return "past simple"
+	case "been":
+		switch helper {
+		case "had":
+			return "past perfect"
+		case "will":
+			return "future perfect"
+		}
+		return "present perfect"
+	case "being":
+		if helper == "was" || helper == "were" {
+			return "past continuous"
+		}
+		return "present continuous"
+	}
+	switch helper {
+	case "will":
+		return "future simple"
+	case "", "to":
+		return "infinitive"
+	}
+	return "modal"
+}
+
+// activeSuggestion rewrites the passive with its agent as the subject. Only the
+// simple past is rewritten in full; other tenses get an instruction.
+func activeSuggestion(subject, participle, agent, tense string) string {
+	actor := agent
+	if actor == "" {
+		actor = "[who did it]"
+	} else if pronoun, found := subjectPronounOf(actor); found {
+		actor = pronoun
+	}
+	object := subject
+	if pronoun, found := objectPronouns[strings.ToLower(subject)]; found {
+		object = pronoun
+	} else if words := strings.Fields(object); len(words) > 0 && subjectDeterminers[strings.ToLower(words[0])] {
+		object = strings.ToLower(object[:1]) + object[1:] // "The report" -> "the report", but not names
+	}
+
+	if tense == "past simple" && object != "" {
+		past, irregular := irregularParticiples[participle]
+		if !irregular {
+			past = participle
+		}
+		return fmt.Sprintf(`%s %s %s.`, capitalizeFirst(actor), past, object)
+	}
+	if agent == "" {
+		return fmt.Sprintf(`Say who does the action and make them the subject, using the %s active`, tense)
+	}
+	return fmt.Sprintf(`Make "%s" the subject, using the %s active`, actor, tense)
+}
+
+// Subject form of an object pronoun agent ("by them" -> "they")
+func subjectPronounOf(agent string) (string, bool) {
+	for subject, object := range objectPronouns {
+		if strings.EqualFold(agent, object) {
+			if subject == "i" {
+				return "I", true
+			}
+			return subject, true
+		}
+	}
+	return "", false
+}
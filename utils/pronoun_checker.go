@@ -0,0 +1,369 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PronounIssue is a pronoun whose antecedent is unclear.
+type PronounIssue struct {
+	Pronoun    string `json:"pronoun"`
+	Sentence   string `json:"sentence"`
+	Issue      string `json:"issue"` // ambiguous_antecedent, missing_antecedent, gender_inconsistency
+	Suggestion string `json:"suggestion"`
+
+	Context     string   `json:"-"` // The sentence before, for confirming with Gemini
+	Antecedents []string `json:"-"` // Nouns the pronoun could refer to
+}
+
+// Pronoun reference issues reported by CheckPronounReferences
+const (
+	PRONOUN_AMBIGUOUS_ANTECEDENT = "ambiguous_antecedent"
+	PRONOUN_MISSING_ANTECEDENT   = "missing_antecedent"
+	PRONOUN_GENDER_INCONSISTENCY = "gender_inconsistency"
+)
+
+const (
+	PRONOUN_WINDOW_WORDS = 30 // Pronouns further into a sentence are not checked
+	MAX_PRONOUN_ISSUES   = 10
+)
+
+// What a noun phrase or pronoun refers to
+const (
+	referentThing  = "thing"
+	referentPerson = "person" // Gender unknown
+	referentMale   = "male"
+	referentFemale = "female"
+)
+
+// The checked pronouns, with whether they are plural and what they refer to
+var checkedPronouns = map[string]struct {
+	plural   bool
+	referent string
+}{
+	"it":    {false, referentThing},
+	"this":  {false, referentThing},
+	"they":  {true, ""},
+	"these": {true, ""},
+	"those": {true, ""},
+	"he":    {false, referentMale},
+	"she":   {false, referentFemale},
+}
+
+// Forms of a pronoun that continue an earlier reference ("He ... His ...")
+var pronounFamilies = map[string][]string{
+	"it":   {"it", "its", "itself"},
+	"they": {"they", "them", "their", "theirs", "themselves"},
+	"he":   {"he", "him", "his", "himself"},
+	"she":  {"she", "her", "hers", "herself"},
+}
+
+// Verbs after which "it" is usually a dummy subject ("It is important to ...")
+var dummyItVerbs = toSet("is", "was", "seems", "seemed", "appears", "appeared", "takes", "took", "becomes", "became", "has", "will", "would", "can", "could", "may", "might")
+
+// Verbs that commonly follow "these" and "those" used as pronouns
+var demonstrativeVerbs = toSet("show", "mean", "suggest", "include", "make", "help", "seem", "cause", "who")
+
+// Endings of nouns that need no determiner ("education", "reading")
+var nounSuffixes = []string{"tion", "sion", "ment", "ness", "ity", "ism", "ance", "ence", "ship", "ing"}
+
+// Adjectives that commonly come between a determiner and its noun
+var commonAdjectives = toSet(
+	"big", "small", "old", "new", "young", "good", "bad", "little", "great", "long", "short", "high", "low",
+	"whole", "other", "same", "first", "last", "next", "main", "best", "own", "few", "large", "important",
+)
+
+// Endings of adjectives ("careful", "expensive", "difficult" is caught by neither)
+var adjectiveSuffixes = []string{"ful", "ous", "ive", "al", "ic", "able", "ible", "less", "est"}
+
+// Words that end a noun phrase opened by a determiner
+var nounPhraseBreaks = toSet(
+	"and", "or", "but", "to", "of", "in", "on", "at", "for", "with", "from", "by", "about", "than", "as",
+	"who", "which", "that", "because", "when", "while", "if",
+)
+
+var (
+	pluralDeterminers = toSet("these", "those", "many", "several", "both", "few", "two", "three")
+	irregularPlurals  = toSet("people", "children", "men", "women", "police", "data", "media", "teeth", "feet", "mice")
+	maleNouns         = toSet("man", "men", "boy", "father", "dad", "brother", "son", "husband", "uncle", "grandfather", "king", "boyfriend", "mr", "gentleman")
+	femaleNouns       = toSet("woman", "women", "girl", "mother", "mom", "mum", "sister", "daughter", "wife", "aunt", "grandmother", "queen", "girlfriend", "mrs", "ms", "lady")
+	personNouns       = toSet(
+		"person", "people", "teacher", "student", "friend", "doctor", "child", "children", "parent", "parents",
+		"classmate", "neighbor", "neighbour", "manager", "boss", "worker", "employee", "customer", "player",
+		"author", "writer", "scientist", "researcher", "leader", "member", "user", "kid", "baby", "partner",
+	)
+)
+
+// A noun phrase that a pronoun could refer to
+type antecedent struct {
+	phrase   string // e.g. "the old house"
+	head     string // Lowercased last word, e.g. "house"
+	plural   bool
+	referent string
+}
+
+// A word of a sentence with its original case
+type sentenceWord struct {
+	text       string // Without surrounding punctuation
+	lower      string
+	endsClause bool // Followed by a comma, semicolon or colon
+}
+
+// CheckPronounReferences looks for the pronouns it, they, he, she, this, these and
+// those within PRONOUN_WINDOW_WORDS of the start of a sentence and checks the nouns
+// of the preceding sentence and of the sentence before the pronoun for an
+// antecedent that agrees in number and gender. It returns the pronouns whose
+// antecedent is missing, mismatched in gender or possibly ambiguous, and how many
+// pronouns were checked. Ambiguous cases are candidates that need confirming.
+func CheckPronounReferences(text string) ([]PronounIssue, int) {
+	issues := []PronounIssue{}
+	checked := 0
+	var previous []sentenceWord
+	previousSentence := ""
+	for _, sentence := range SplitSentences(text) {
+		words := sentenceWords(sentence)
+		previousNouns := findAntecedents(previous)
+		for i, word := range words {
+			if i >= PRONOUN_WINDOW_WORDS || len(issues) == MAX_PRONOUN_ISSUES {
+				break
+			}
+			pronoun, isPronoun := checkedPronouns[word.lower]
+			if !isPronoun || !isPronounUse(words, i) {
+				continue
+			}
+			checked++
+			if continuesReference(word.lower, previous, words[:i]) {
+				continue
+			}
+
+			candidates := append(findAntecedents(words[:i]), previousNouns...)
+			issue := PronounIssue{Pronoun: word.text, Sentence: sentence, Context: previousSentence}
+			var agreeing, mismatched []antecedent
+			seen := make(map[string]bool)
+			for _, candidate := range candidates {
+				if seen[candidate.head] {
+					continue
+				}
+				seen[candidate.head] = true
+				switch {
+				case agreesWith(candidate, pronoun.plural, pronoun.referent):
+					agreeing = append(agreeing, candidate)
+				case !candidate.plural && oppositeGender(candidate.referent, pronoun.referent):
+					mismatched = append(mismatched, candidate)
+				}
+			}
+
+			switch {
+			case len(agreeing) == 1:
+				continue
+			case len(agreeing) > 1:
+				issue.Issue = PRONOUN_AMBIGUOUS_ANTECEDENT
+				for _, candidate := range agreeing {
+					issue.Antecedents = append(issue.Antecedents, candidate.phrase)
+				}
+				issue.Suggestion = fmt.Sprintf("\"%s\" could refer to %s; repeat the noun you mean", word.text, joinAlternatives(issue.Antecedents))
+			case len(mismatched) > 0:
+				issue.Issue = PRONOUN_GENDER_INCONSISTENCY
+				issue.Antecedents = []string{mismatched[0].phrase}
+				other := "he"
+				if word.lower == "he" {
+					other = "she"
+				}
+				issue.Suggestion = fmt.Sprintf("\"%s\" does not match \"%s\"; use \"%s\" or name the person", word.text, mismatched[0].phrase, other)
+			default:
+				issue.Issue = PRONOUN_MISSING_ANTECEDENT
+				issue.Suggestion = fmt.Sprintf("It is not clear what \"%s\" refers to; name it here or in the sentence before", word.text)
+			}
+			issues = append(issues, issue)
+		}
+		previous, previousSentence = words, sentence
+	}
+	return issues, checked
+}
+
+func sentenceWords(sentence string) []sentenceWord {
+	var words []sentenceWord
+	for _, field := range strings.Fields(normalizeApostrophe(sentence)) {
+		text := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+		})
+		text = strings.Trim(text, "'")
+		if text == "" {
+			continue
+		}
+		// "it's", "they're": the pronoun is what counts
+		if apostrophe := strings.Index(text, "'"); apostrophe > 0 {
+			text = text[:apostrophe]
+		}
+		words = append(words, sentenceWord{
+			text:       text,
+			lower:      strings.ToLower(text),
+			endsClause: strings.ContainsAny(field[len(field)-1:], ",;:"),
+		})
+	}
+	return words
+}
+
+// Demonstratives are pronouns only without a noun after them ("This shows", not
+// "This book"), and "it" before "is ... to/that" is usually a dummy subject
+func isPronounUse(words []sentenceWord, i int) bool {
+	next := ""
+	if i+1 < len(words) {
+		next = words[i+1].lower
+	}
+	switch words[i].lower {
+	case "this":
+		return next == "" || words[i].endsClause || finiteVerbs[next] || strings.HasSuffix(next, "ed") || strings.HasSuffix(next, "s") && !strings.HasSuffix(next, "ss")
+	case "these", "those":
+		return next == "" || words[i].endsClause || finiteVerbs[next] || strings.HasSuffix(next, "ed") || demonstrativeVerbs[next]
+	case "it":
+		if dummyItVerbs[next] {
+			for _, word := range words[i+2:] {
+				if word.lower == "to" || word.lower == "that" {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// The same pronoun family already appears in the sentence before or earlier in
+// this one, so the reference was established before
+func continuesReference(pronoun string, previous, before []sentenceWord) bool {
+	family, exists := pronounFamilies[pronoun]
+	if !exists {
+		return false
+	}
+	for _, words := range [][]sentenceWord{previous, before} {
+		for _, word := range words {
+			for _, form := range family {
+				if word.lower == form {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Noun phrases opened by a determiner and capitalized names, in order
+func findAntecedents(words []sentenceWord) []antecedent {
+	var found []antecedent
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if subjectDeterminers[word.lower] && !word.endsClause {
+			// The head is the word after the determiner, or the one after that when
+			// the first looks like an adjective ("the old house")
+			end := i
+			for j := i + 1; j < len(words) && j <= i+2; j++ {
+				if !canBeInNounPhrase(words[j].lower) {
+					break
+				}
+				end = j
+				if words[j].endsClause || !isAdjectiveLike(words[j].lower) {
+					break
+				}
+			}
+			if end > i {
+				found = append(found, nounPhrase(words[i:end+1]))
+				i = end
+			}
+			continue
+		}
+		if head := strings.TrimSuffix(word.lower, "s"); len(head) > 5 && hasNounSuffix(head) && !nounPhraseBreaks[word.lower] {
+			found = append(found, antecedent{phrase: word.text, head: word.lower, plural: head != word.lower, referent: referentThing})
+			continue
+		}
+		if i > 0 && isCapitalizedWord(word.text) && !anonymizerExemptWords[word.text] && !subjectPronouns[word.lower] {
+			referent := referentPerson
+			if placeKeywords[word.text] || organizationKeywords[word.text] {
+				referent = referentThing
+			} else if previous := words[i-1].lower; maleNouns[previous] || femaleNouns[previous] {
+				referent = genderOf(previous) // "Mr Nam", "Mrs Lan"
+			}
+			found = append(found, antecedent{phrase: word.text, head: word.lower, referent: referent})
+		}
+	}
+	return found
+}
+
+func canBeInNounPhrase(word string) bool {
+	return !nounPhraseBreaks[word] && !finiteVerbs[word] && !subjectDeterminers[word] && !subjectPronouns[word]
+}
+
+func isAdjectiveLike(word string) bool {
+	if commonAdjectives[word] {
+		return true
+	}
+	for _, suffix := range adjectiveSuffixes {
+		if strings.HasSuffix(word, suffix) && len(word) > len(suffix)+2 {
+			return true
+		}
+	}
+	return false
+}
+
+func nounPhrase(words []sentenceWord) antecedent {
+	parts := make([]string, len(words))
+	for i, word := range words {
+		parts[i] = word.text
+	}
+	head := words[len(words)-1].lower
+	plural := pluralDeterminers[words[0].lower] || irregularPlurals[head] ||
+		strings.HasSuffix(head, "s") && !strings.HasSuffix(head, "ss") && !strings.HasSuffix(head, "us") && !strings.HasSuffix(head, "is")
+	return antecedent{phrase: strings.Join(parts, " "), head: head, plural: plural, referent: genderOf(head)}
+}
+
+func hasNounSuffix(word string) bool {
+	for _, suffix := range nounSuffixes {
+		if strings.HasSuffix(word, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func genderOf(noun string) string {
+	switch {
+	case maleNouns[noun]:
+		return referentMale
+	case femaleNouns[noun]:
+		return referentFemale
+	case personNouns[noun] || personNouns[strings.TrimSuffix(noun, "s")]:
+		return referentPerson
+	}
+	return referentThing
+}
+
+// "they", "these" and "those" take any plural; "it" and "this" a singular thing;
+// "he" and "she" a singular person of that or unknown gender
+func agreesWith(candidate antecedent, plural bool, referent string) bool {
+	if candidate.plural != plural {
+		return false
+	}
+	switch referent {
+	case "":
+		return true
+	case referentThing:
+		return candidate.referent == referentThing
+	}
+	return candidate.referent == referent || candidate.referent == referentPerson
+}
+
+func oppositeGender(candidate, pronoun string) bool {
+	return candidate == referentMale && pronoun == referentFemale || candidate == referentFemale && pronoun == referentMale
+}
+
+// e.g. "the teacher", "the student" or "Lan"
+func joinAlternatives(phrases []string) string {
+	quoted := make([]string, len(phrases))
+	for i, phrase := range phrases {
+		quoted[i] = "\"" + phrase + "\""
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
@@ -0,0 +1,468 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PhonemeSyllable is one syllable of an ARPAbet transcription.
+type PhonemeSyllable struct {
+	Phonemes []string // Without stress digits
+	Stress   int      // 1 primary, 2 secondary, 0 none
+}
+
+// General American IPA for each ARPAbet phoneme
+var arpabetIPA = map[string]string{
+	"AA": "ɑ", "AE": "æ", "AH": "ʌ", "AO": "ɔ", "AW": "aʊ", "AY": "aɪ", "EH": "ɛ", "ER": "ɜr",
+	"EY": "eɪ", "IH": "ɪ", "IY": "i", "OW": "oʊ", "OY": "ɔɪ", "UH": "ʊ", "UW": "u",
+	"B": "b", "CH": "tʃ", "D": "d", "DH": "ð", "F": "f", "G": "ɡ", "HH": "h", "JH": "dʒ", "K": "k",
+	"L": "l", "M": "m", "N": "n", "NG": "ŋ", "P": "p", "R": "r", "S": "s", "SH": "ʃ", "T": "t",
+	"TH": "θ", "V": "v", "W": "w", "Y": "j", "Z": "z", "ZH": "ʒ",
+}
+
+// Received Pronunciation vowels that differ from General American
+var britishVowelIPA = map[string]string{
+	"AA": "ɑː", "AO": "ɔː", "EH": "e", "IY": "iː", "OW": "əʊ", "UW": "uː",
+}
+
+// RP vowels of a vowel followed by a dropped (non-prevocalic) r
+var britishRColoredIPA = map[string]string{
+	"AA": "ɑː", "AO": "ɔː", "OW": "ɔː", "EH": "eə", "EY": "eə", "IH": "ɪə", "IY": "ɪə", "UH": "ʊə", "UW": "ʊə",
+	"AY": "aɪə", "AW": "aʊə", "ER1": "ɜː", "ER2": "ɜː", "ER0": "ə",
+}
+
+// Words with the RP "bath" vowel /ɑː/ where General American has /æ/
+var britishBathWords = toSet(
+	"after", "advantage", "answer", "ask", "aunt", "banana", "bath", "branch", "can't", "castle",
+	"chance", "class", "command", "dance", "demand", "example", "fast", "glass", "grass", "half",
+	"last", "laugh", "master", "pass", "password", "past", "path", "plant", "rather",
+)
+
+// Consonant sequences that can start an English syllable
+var legalOnsets = toSet(
+	"P R", "P L", "B R", "B L", "T R", "D R", "K R", "K L", "G R", "G L", "F R", "F L", "TH R",
+	"SH R", "S P", "S T", "S K", "S M", "S N", "S L", "S W", "K W", "T W", "D W", "G W", "TH W",
+	"P Y", "B Y", "F Y", "K Y", "M Y", "V Y", "HH Y", "G Y", "L Y", "N Y",
+	"S P R", "S T R", "S K R", "S P L", "S K W", "S K Y", "S P Y",
+)
+
+// IsArpabetVowel reports whether an ARPAbet phoneme (with or without stress digit) is a vowel.
+func IsArpabetVowel(phoneme string) bool {
+	base := strings.TrimRight(phoneme, "012")
+	return len(base) == 2 && strings.ContainsRune("AEIOU", rune(base[0]))
+}
+
+// SyllabifyArpabet splits a CMU dictionary transcription into syllables,
+// giving each syllable the longest legal onset.
+func SyllabifyArpabet(phonemes []string) []PhonemeSyllable {
+	var vowels []int
+	for i, phoneme := range phonemes {
+		if IsArpabetVowel(phoneme) {
+			vowels = append(vowels, i)
+		}
+	}
+	if len(vowels) == 0 {
+		return []PhonemeSyllable{{Phonemes: stripStress(phonemes)}}
+	}
+
+	syllables := make([]PhonemeSyllable, len(vowels))
+	start := 0
+	for n, vowel := range vowels {
+		end := len(phonemes)
+		if n+1 < len(vowels) {
+			next := vowels[n+1]
+			end = next
+			for split := vowel + 1; split < next; split++ {
+				onset := stripStress(phonemes[split:next])
+				if len(onset) == 1 && onset[0] != "NG" || legalOnsets[strings.Join(onset, " ")] {
+					end = split
+					break
+				}
+			}
+		}
+		syllables[n] = PhonemeSyllable{
+			Phonemes: stripStress(phonemes[start:end]),
+			Stress:   stressOf(phonemes[vowel]),
+		}
+		start = end
+	}
+	return syllables
+}
+
+// ArpabetToIPA converts a CMU dictionary transcription to slash-delimited IPA with
+// stress marks. British output is approximated from the American transcription:
+// non-rhotic, RP vowel qualities and the "bath" vowel for a list of common words.
+func ArpabetToIPA(word string, phonemes []string, british bool) string {
+	syllables := SyllabifyArpabet(phonemes)
+	flat := []string{}
+	for _, syllable := range syllables {
+		flat = append(flat, syllable.Phonemes...)
+	}
+	bathWord := britishBathWords[strings.ToLower(word)]
+	hasO := strings.Contains(strings.ToLower(word), "o") || strings.Contains(strings.ToLower(word), "wa")
+
+	var sb strings.Builder
+	sb.WriteString("/")
+	index := 0
+	carryR := false // The r of an ER before a vowel starts the next syllable
+	for _, syllable := range syllables {
+		if len(syllables) > 1 {
+			switch syllable.Stress {
+			case 1:
+				sb.WriteString("ˈ")
+			case 2:
+				sb.WriteString("ˌ")
+			}
+		}
+		if carryR {
+			sb.WriteString("r")
+			carryR = false
+		}
+		for _, phoneme := range syllable.Phonemes {
+			nextIsVowel := index+1 < len(flat) && IsArpabetVowel(flat[index+1])
+			nextIsR := index+1 < len(flat) && flat[index+1] == "R"
+			afterR := index+2 < len(flat) && IsArpabetVowel(flat[index+2])
+			ipa := phonemeIPA(phoneme, syllable.Stress, british, nextIsVowel, nextIsR && !afterR, bathWord, hasO)
+			if phoneme == "ER" && nextIsVowel {
+				ipa, carryR = strings.TrimSuffix(ipa, "r"), true
+			}
+			sb.WriteString(ipa)
+			index++
+		}
+	}
+	sb.WriteString("/")
+
+	ipa := sb.String()
+	if british {
+		// The r after a vowel is only pronounced before another vowel
+		ipa = dropBritishR(ipa)
+	}
+	return ipa
+}
+
+// phonemeIPA converts one phoneme given its surroundings.
+// droppedRNext is set when the following R is not pronounced in RP.
+func phonemeIPA(phoneme string, stress int, british, nextIsVowel, droppedRNext, bathWord, hasO bool) string {
+	if phoneme == "ER" {
+		switch {
+		case british && !nextIsVowel:
+			return britishRColoredIPA[fmt.Sprintf("ER%d", stress)]
+		case stress == 0:
+			return "ər"
+		case british:
+			return "ɜːr"
+		}
+		return "ɜr"
+	}
+	if phoneme == "AH" && stress == 0 {
+		return "ə"
+	}
+	if phoneme == "IY" && stress == 0 {
+		return "i"
+	}
+	if !british {
+		return arpabetIPA[phoneme]
+	}
+
+	if droppedRNext {
+		if ipa, exists := britishRColoredIPA[phoneme]; exists {
+			return ipa + "\x00" // Marks the following r for removal
+		}
+	}
+	switch {
+	case phoneme == "AE" && bathWord && stress == 1:
+		return "ɑː"
+	case phoneme == "AA" && hasO:
+		return "ɒ"
+	}
+	if ipa, exists := britishVowelIPA[phoneme]; exists {
+		return ipa
+	}
+	return arpabetIPA[phoneme]
+}
+
+// dropBritishR removes the r after vowels that were marked as r-colored.
+func dropBritishR(ipa string) string {
+	var sb strings.Builder
+	skipR := false
+	for _, r := range ipa {
+		switch {
+		case r == 0:
+			skipR = true
+			continue
+		case skipR && r == 'r':
+			skipR = false
+			continue
+		case skipR && (r == 'ˈ' || r == 'ˌ'):
+			// The r may sit after a stress mark in the next syllable
+		default:
+			skipR = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// StressPattern renders syllable stress as "O" for the primary stress and "o" otherwise.
+func StressPattern(syllables []PhonemeSyllable) string {
+	var sb strings.Builder
+	for _, syllable := range syllables {
+		if syllable.Stress == 1 {
+			sb.WriteString("O")
+		} else {
+			sb.WriteString("o")
+		}
+	}
+	return sb.String()
+}
+
+// A vowel group in a written word
+type spellingNucleus struct {
+	start, end int
+}
+
+// HyphenateWord splits a word into written syllables ("par-ti-cu-lar-ly"), aiming for
+// the given number of spoken syllables. It is a spelling heuristic, not a dictionary split.
+func HyphenateWord(word string, syllableCount int) string {
+	lower := strings.ToLower(word)
+	letters := []rune(lower)
+
+	// Vowel groups are the syllable nuclei
+	var nuclei []spellingNucleus
+	for i := 0; i < len(letters); {
+		if !isSpellingVowel(letters, i) {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(letters) && isSpellingVowel(letters, j) {
+			j++
+		}
+		nuclei = append(nuclei, spellingNucleus{start: i, end: j})
+		i = j
+	}
+
+	// Silent endings: "make", "science", "clothes", "washed" (but not "table", "wanted").
+	// Keep the ending when dropping it leaves too few syllables ("recipe").
+	if n := len(nuclei); n > 1 {
+		last := nuclei[n-1]
+		ending := string(letters[last.start:])
+		beforeEnding := letters[last.start-1]
+		consonantLe := strings.HasSuffix(lower, "le") && len(letters) > 2 && !isSpellingVowel(letters, len(letters)-3)
+		if ending == "e" && !consonantLe || ending == "es" || ending == "ue" && beforeEnding == 'g' ||
+			ending == "ed" && beforeEnding != 't' && beforeEnding != 'd' {
+			if trimmed := splitHiatus(letters, nuclei[:n-1], syllableCount); len(trimmed) == syllableCount || n > syllableCount {
+				nuclei = trimmed
+			}
+		}
+	}
+	nuclei = splitHiatus(letters, nuclei, syllableCount)
+
+	// Silent internal e before a consonant: "care-ful", "ad-ver-tise-ment", "vege-ta-ble".
+	// An e after a single consonant ("-tise-") is the likelier silent one, so it goes first.
+	for _, singleConsonantOnly := range []bool{true, false} {
+		for i := 1; len(nuclei) > syllableCount && i+1 < len(nuclei); {
+			nucleus := nuclei[i]
+			if string(letters[nucleus.start:nucleus.end]) != "e" || isSpellingVowel(letters, nucleus.end) ||
+				singleConsonantOnly && nucleus.start-nuclei[i-1].end != 1 {
+				i++
+				continue
+			}
+			nuclei = append(nuclei[:i], nuclei[i+1:]...)
+			nuclei[i-1].end = nucleus.end // The e closes the previous syllable
+		}
+	}
+	if len(nuclei) < 2 {
+		return lower
+	}
+
+	var parts []string
+	start := 0
+	for n := 0; n+1 < len(nuclei); n++ {
+		consonants := letters[nuclei[n].end:nuclei[n+1].start]
+		split := nuclei[n].end
+		finalLe := nuclei[n+1].end == len(letters) && strings.HasSuffix(lower, "le") && len(consonants) >= 2 &&
+			consonants[len(consonants)-1] == 'l'
+		switch {
+		case finalLe:
+			split = nuclei[n+1].start - 2 // "ta-ble", "lit-tle"
+		case len(consonants) == 0:
+			// Hiatus: "i-de-a"
+		case len(consonants) == 1 && consonants[0] == 'x':
+			split = nuclei[n+1].start
+		case len(consonants) == 1:
+			// V-CV
+		default:
+			split = nuclei[n+1].start - spellingOnsetLength(consonants) // "hap-py", "a-cross", "kit-chen"
+		}
+		parts = append(parts, string(letters[start:split]))
+		start = split
+	}
+	parts = append(parts, string(letters[start:]))
+	return strings.Join(parts, "-")
+}
+
+// splitHiatus splits vowel groups pronounced as two syllables ("i-de-a", "qui-et")
+// until there are target nuclei.
+func splitHiatus(letters []rune, nuclei []spellingNucleus, target int) []spellingNucleus {
+	result := append([]spellingNucleus{}, nuclei...)
+	for i := 0; len(result) < target && i < len(result); i++ {
+		group := string(letters[result[i].start:result[i].end])
+		for _, pair := range []string{"ia", "ie", "io", "iu", "ea", "eo", "ua", "ue", "uo"} {
+			k := strings.Index(group, pair)
+			if k < 0 || pair == "ue" && result[i].start > 0 && letters[result[i].start-1] == 'q' {
+				continue
+			}
+			split := result[i].start + len([]rune(group[:k])) + 1
+			result = append(result[:i+1], result[i:]...)
+			result[i] = spellingNucleus{start: result[i].start, end: split}
+			result[i+1] = spellingNucleus{start: split, end: result[i+1].end}
+			break
+		}
+	}
+	return result
+}
+
+// isSpellingVowel treats y as a vowel except at the start of a word or before a vowel.
+func isSpellingVowel(letters []rune, i int) bool {
+	switch letters[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return !(letters[i] == 'u' && i > 0 && letters[i-1] == 'q')
+	case 'y':
+		return i > 0 && (i+1 == len(letters) || !strings.ContainsRune("aeiou", letters[i+1]))
+	}
+	return false
+}
+
+// Consonant spellings that can start a written syllable besides single letters
+var spellingOnsets = toSet(
+	"ch", "sh", "th", "ph", "wh",
+	"bl", "br", "cl", "cr", "dr", "fl", "fr", "gl", "gr", "pl", "pr", "tr", "tw", "wr",
+	"thr", "shr", "chr", "phr",
+)
+
+// S-clusters only start a written syllable after another consonant ("un-der-stand", "an-swer")
+var spellingSOnsets = toSet("sc", "sk", "sl", "sm", "sn", "sp", "st", "sw", "scr", "spl", "spr", "str")
+
+// spellingOnsetLength returns how many letters at the end of a consonant cluster start
+// the next written syllable. A lone s-cluster is split ("sis-ter") and ck stays whole ("chick-en").
+func spellingOnsetLength(consonants []rune) int {
+	if strings.HasSuffix(string(consonants), "ck") {
+		return 0
+	}
+	for length := min(3, len(consonants)); length > 1; length-- {
+		onset := string(consonants[len(consonants)-length:])
+		if spellingOnsets[onset] {
+			return length
+		}
+		if before := len(consonants) - length - 1; spellingSOnsets[onset] && before >= 0 && consonants[before] != 's' {
+			return length
+		}
+	}
+	return 1
+}
+
+// MaxPronunciationPitfalls caps the tips returned by PronunciationPitfalls.
+const MaxPronunciationPitfalls = 4
+
+// PronunciationPitfalls lists likely mispronunciations of a word by Vietnamese
+// learners, from its spelling and CMU dictionary transcription.
+func PronunciationPitfalls(word string, phonemes []string) []string {
+	lower := strings.ToLower(word)
+	syllables := SyllabifyArpabet(phonemes)
+	bare := stripStress(phonemes)
+	var pitfalls []string
+
+	if len(syllables) > 1 {
+		pitfalls = append(pitfalls, fmt.Sprintf("Stressing the wrong syllable; the stress pattern is %s", StressPattern(syllables)))
+	}
+	for _, phoneme := range bare {
+		if phoneme == "TH" {
+			pitfalls = append(pitfalls, "Replacing /θ/ with /t/ or /s/; put the tongue between the teeth")
+			break
+		}
+		if phoneme == "DH" {
+			pitfalls = append(pitfalls, "Replacing /ð/ with /d/ or /z/; put the tongue between the teeth and voice it")
+			break
+		}
+	}
+	if silent := silentLetter(lower, bare); silent != "" {
+		pitfalls = append(pitfalls, silent)
+	}
+
+	// Final consonants and clusters are often dropped or simplified
+	final := []string{}
+	for i := len(bare) - 1; i >= 0 && !IsArpabetVowel(bare[i]); i-- {
+		final = append([]string{bare[i]}, final...)
+	}
+	switch {
+	case strings.HasSuffix(lower, "ed") && len(final) > 0 && (final[len(final)-1] == "T" || final[len(final)-1] == "D") &&
+		!strings.HasSuffix(lower, "ted") && !strings.HasSuffix(lower, "ded"):
+		pitfalls = append(pitfalls, fmt.Sprintf("Pronouncing -ed as an extra syllable /ɪd/; it is just /%s/", arpabetIPA[final[len(final)-1]]))
+	case len(final) > 1:
+		pitfalls = append(pitfalls, fmt.Sprintf("Simplifying the final cluster /%s/; pronounce every consonant", phonemesIPA(final)))
+	case len(final) == 1 && (final[0] == "Z" || final[0] == "ZH" || final[0] == "JH" || final[0] == "V"):
+		pitfalls = append(pitfalls, fmt.Sprintf("Devoicing the final /%s/", arpabetIPA[final[0]]))
+	case len(final) == 1 && final[0] != "R" && final[0] != "TH" && final[0] != "DH": // /r/ is silent in British English; /θ ð/ are covered above
+		pitfalls = append(pitfalls, fmt.Sprintf("Dropping the final /%s/ sound", arpabetIPA[final[0]]))
+	}
+	if len(bare) > 1 && !IsArpabetVowel(bare[0]) && !IsArpabetVowel(bare[1]) && bare[1] != "Y" && bare[1] != "W" {
+		onset := []string{}
+		for _, phoneme := range bare {
+			if IsArpabetVowel(phoneme) {
+				break
+			}
+			onset = append(onset, phoneme)
+		}
+		pitfalls = append(pitfalls, fmt.Sprintf("Inserting a vowel inside /%s/ at the start", phonemesIPA(onset)))
+	}
+	if len(pitfalls) > MaxPronunciationPitfalls {
+		pitfalls = pitfalls[:MaxPronunciationPitfalls]
+	}
+	return pitfalls
+}
+
+// silentLetter describes a common silent letter in the word, if any.
+func silentLetter(word string, phonemes []string) string {
+	switch {
+	case strings.HasPrefix(word, "kn") && phonemes[0] != "K":
+		return "Pronouncing the silent k"
+	case strings.HasPrefix(word, "wr"):
+		return "Pronouncing the silent w"
+	case strings.HasPrefix(word, "h") && phonemes[0] != "HH":
+		return "Pronouncing the silent h"
+	case strings.Contains(word, "bt") || strings.HasSuffix(word, "mb"):
+		return "Pronouncing the silent b"
+	case strings.Contains(word, "stle") || strings.Contains(word, "sten"):
+		return "Pronouncing the silent t"
+	case strings.Contains(word, "alk") || strings.Contains(word, "alf") || strings.Contains(word, "alm"):
+		return "Pronouncing the silent l"
+	}
+	return ""
+}
+
+func phonemesIPA(phonemes []string) string {
+	var sb strings.Builder
+	for _, phoneme := range phonemes {
+		sb.WriteString(arpabetIPA[phoneme])
+	}
+	return sb.String()
+}
+
+func stripStress(phonemes []string) []string {
+	stripped := make([]string, len(phonemes))
+	for i, phoneme := range phonemes {
+		stripped[i] = strings.TrimRight(phoneme, "012")
+	}
+	return stripped
+}
+
+func stressOf(phoneme string) int {
+	switch {
+	case strings.HasSuffix(phoneme, "1"):
+		return 1
+	case strings.HasSuffix(phoneme, "2"):
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// countSyllables estimates the number of syllables in an English word by counting vowel groups.
+func countSyllables(word string) int {
+	word = strings.ToLower(word)
+	count := 0
+	prevVowel := false
+	for _, r := range word {
+		isVowel := strings.ContainsRune("aeiouy", r)
+		if isVowel && !prevVowel {
+			count++
+		}
+		prevVowel = isVowel
+	}
+
+	// Silent trailing "e" ("make"), but not "-le" endings ("table")
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+	if count == 0 && strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+		count = 1
+	}
+	return count
+}
+
+// AverageSyllablesPerWord returns the mean syllable count of the words in text.
+func AverageSyllablesPerWord(text string) float64 {
+	words := ExtractWords(text)
+	if len(words) == 0 {
+		return 0
+	}
+	total := 0
+	for _, word := range words {
+		total += countSyllables(word)
+	}
+	return float64(total) / float64(len(words))
+}
+
+// FleschKincaidGrade computes the Flesch-Kincaid grade level of text.
+func FleschKincaidGrade(text string) float64 {
+	sentences := len(SplitSentences(text))
+	words := len(ExtractWords(text))
+	if sentences == 0 || words == 0 {
+		return 0
+	}
+	return 0.39*float64(words)/float64(sentences) + 11.8*AverageSyllablesPerWord(text) - 15.59
+}
+
+// FleschReadingEase computes the Flesch reading-ease score of text (higher is easier).
+func FleschReadingEase(text string) float64 {
+	sentences := len(SplitSentences(text))
+	words := len(ExtractWords(text))
+	if sentences == 0 || words == 0 {
+		return 0
+	}
+	return 206.835 - 1.015*float64(words)/float64(sentences) - 84.6*AverageSyllablesPerWord(text)
+}
+
+// Counts the readability formulas are built from
+type textStats struct {
+	Sentences     int
+	Words         int
+	Letters       int
+	Polysyllables int // Words of three or more syllables
+}
+
+func computeTextStats(text string) textStats {
+	stats := textStats{Sentences: len(SplitSentences(text))}
+	for _, word := range ExtractWords(text) {
+		stats.Words++
+		for _, r := range word {
+			if unicode.IsLetter(r) {
+				stats.Letters++
+			}
+		}
+		if countSyllables(word) >= 3 {
+			stats.Polysyllables++
+		}
+	}
+	return stats
+}
+
+// GunningFog computes the Gunning Fog index of text, the years of schooling needed
+// to understand it on first reading.
+func GunningFog(text string) float64 {
+	stats := computeTextStats(text)
+	if stats.Sentences == 0 || stats.Words == 0 {
+		return 0
+	}
+	return 0.4 * (float64(stats.Words)/float64(stats.Sentences) + 100*float64(stats.Polysyllables)/float64(stats.Words))
+}
+
+// SMOG computes the SMOG grade of text from its polysyllables per 30 sentences.
+func SMOG(text string) float64 {
+	stats := computeTextStats(text)
+	if stats.Sentences == 0 {
+		return 0
+	}
+	return 1.0430*math.Sqrt(float64(stats.Polysyllables)*30/float64(stats.Sentences)) + 3.1291
+}
+
+// LinsearWrite computes the Linsear Write grade of text: easy words (up to two
+// syllables) score 1, hard words 3, and the total per sentence is scaled to a grade.
+func LinsearWrite(text string) float64 {
+	stats := computeTextStats(text)
+	if stats.Sentences == 0 || stats.Words == 0 {
+		return 0
+	}
+	easy := stats.Words - stats.Polysyllables
+	score := float64(easy+3*stats.Polysyllables) / float64(stats.Sentences)
+	if score > 20 {
+		return score / 2
+	}
+	return (score - 2) / 2
+}
+
+// ColemanLiau computes the Coleman-Liau index of text from letters and sentences
+// per 100 words.
+func ColemanLiau(text string) float64 {
+	stats := computeTextStats(text)
+	if stats.Words == 0 {
+		return 0
+	}
+	letters := float64(stats.Letters) / float64(stats.Words) * 100
+	sentences := float64(stats.Sentences) / float64(stats.Words) * 100
+	return 0.0588*letters - 0.296*sentences - 15.8
+}
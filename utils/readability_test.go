@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCountSyllables(t *testing.T) {
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"cat", 1},
+		{"make", 1},  // Silent e
+		{"table", 2}, // -le ending
+		{"every", 3},
+		{"education", 4},
+		{"the", 1},
+		{"rhythm", 1},
+		{"Important", 3},
+	}
+	for _, test := range tests {
+		if got := countSyllables(test.word); got != test.want {
+			t.Errorf("countSyllables(%q) = %d, want %d", test.word, got, test.want)
+		}
+	}
+}
+
+func TestReadabilityMetrics(t *testing.T) {
+	const simple = "The cat sat on the mat. The dog ran."                // 2 sentences, 9 words, 26 letters, no polysyllables
+	const academic = "Education is important. Students study every day." // 2 sentences, 7 words, 3 polysyllables
+	tests := []struct {
+		name   string
+		metric func(string) float64
+		text   string
+		want   float64
+	}{
+		{"Gunning Fog, simple", GunningFog, simple, 1.8},
+		{"Gunning Fog, academic", GunningFog, academic, 18.5429},
+		{"SMOG, simple", SMOG, simple, 3.1291},
+		{"SMOG, academic", SMOG, academic, 10.1258},
+		{"Linsear Write, simple", LinsearWrite, simple, 1.25},
+		{"Linsear Write, academic", LinsearWrite, academic, 2.25},
+		{"Linsear Write, long sentence", LinsearWrite, strings.Repeat("cat ", 24) + "cat.", 12.5},
+		{"Coleman-Liau, simple", ColemanLiau, simple, -5.3911},
+		{"Gunning Fog, empty", GunningFog, "", 0},
+		{"SMOG, empty", SMOG, "", 0},
+		{"Linsear Write, empty", LinsearWrite, "", 0},
+		{"Coleman-Liau, empty", ColemanLiau, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.metric(test.text); math.Abs(got-test.want) > 0.001 {
+				t.Errorf("got %.4f, want %.4f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadabilityMetricsRankHarderTextHigher(t *testing.T) {
+	easy := "I like my dog. He is big. We run in the park."
+	hard := "Contemporary educational institutions increasingly emphasize interdisciplinary collaboration. " +
+		"Consequently, administrators continuously reevaluate organizational priorities."
+	for name, metric := range map[string]func(string) float64{
+		"Flesch-Kincaid": FleschKincaidGrade,
+		"Gunning Fog":    GunningFog,
+		"SMOG":           SMOG,
+		"Linsear Write":  LinsearWrite,
+		"Coleman-Liau":   ColemanLiau,
+	} {
+		if metric(easy) >= metric(hard) {
+			t.Errorf("%s grades the easy text %.2f and the hard one %.2f", name, metric(easy), metric(hard))
+		}
+	}
+}
+
+func BenchmarkReadabilityMetrics(b *testing.B) {
+	text := strings.Repeat("Contemporary educational institutions emphasize collaboration between students. The cat sat on the mat. ", 360) // About 5,000 words
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FleschKincaidGrade(text)
+		FleschReadingEase(text)
+		GunningFog(text)
+		SMOG(text)
+		LinsearWrite(text)
+		ColemanLiau(text)
+	}
+}
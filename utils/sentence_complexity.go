@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// SentenceComplexityMetrics is the distribution of sentence types in a text.
+type SentenceComplexityMetrics struct {
+	SimpleCount          int     `json:"simple_count"`
+	CompoundCount        int     `json:"compound_count"`
+	ComplexCount         int     `json:"complex_count"`
+	CompoundComplexCount int     `json:"compound_complex_count"`
+	AverageClauses       float64 `json:"average_clauses"` // Clauses per sentence
+}
+
+// Conjunctions that join two independent clauses
+var coordinatingConjunctions = toSet("for", "and", "nor", "but", "or", "yet", "so")
+
+// Words that always open a dependent clause
+var subordinators = toSet(
+	"because", "although", "though", "unless", "whereas", "whenever", "wherever", "while", "if", "when",
+	"who", "whom", "whose", "which",
+)
+
+// Words that open a dependent clause only when a subject follows ("after we left", not "after lunch")
+var subordinatorsBeforeSubject = toSet("after", "before", "since", "until", "as", "that", "where", "once")
+
+// ClassifySentences sorts the sentences of a text into simple, compound, complex and
+// compound-complex, judged by the conjunctions each one contains.
+func ClassifySentences(text string) SentenceComplexityMetrics {
+	var metrics SentenceComplexityMetrics
+	sentences := SplitSentences(text)
+	totalClauses := 0
+	for _, sentence := range sentences {
+		coordinate, subordinate := countClauseLinks(sentence)
+		totalClauses += 1 + coordinate + subordinate
+		switch {
+		case coordinate > 0 && subordinate > 0:
+			metrics.CompoundComplexCount++
+		case subordinate > 0:
+			metrics.ComplexCount++
+		case coordinate > 0:
+			metrics.CompoundCount++
+		default:
+			metrics.SimpleCount++
+		}
+	}
+	if len(sentences) > 0 {
+		metrics.AverageClauses = math.Round(float64(totalClauses)/float64(len(sentences))*100) / 100
+	}
+	return metrics
+}
+
+// countClauseLinks counts the coordinating conjunctions that join clauses and the
+// subordinators that open dependent clauses in a sentence.
+func countClauseLinks(sentence string) (coordinate, subordinate int) {
+	words := ExtractWords(sentence)
+	for i := range words {
+		words[i] = normalizeApostrophe(words[i])
+	}
+	commas := commasAfterWords(sentence)
+
+	for i, word := range words {
+		subjectNext := i+1 < len(words) && (subjectPronouns[words[i+1]] || subjectDeterminers[words[i+1]] || subjectContractions[words[i+1]])
+		switch {
+		case coordinatingConjunctions[word] && i > 0:
+			// "bread and butter" joins words; ", and" or "and she" joins clauses
+			if commas[i-1] || subjectNext {
+				coordinate++
+			}
+		case subordinators[word]:
+			subordinate++
+		case subordinatorsBeforeSubject[word] && subjectNext:
+			subordinate++
+		}
+	}
+	return coordinate, subordinate
+}
+
+// commasAfterWords reports, for each word ExtractWords returns, whether a comma follows it.
+func commasAfterWords(text string) []bool {
+	var commas []bool
+	for _, field := range strings.Fields(text) {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if word != "" {
+			commas = append(commas, strings.Contains(field[strings.LastIndex(field, word)+len(word):], ","))
+		}
+	}
+	return commas
+}
+
+// SentenceVarietyScore rates how evenly sentences are spread over the four types,
+// from 0 (all one type) to 10 (equally many of each), using normalized entropy.
+func SentenceVarietyScore(metrics SentenceComplexityMetrics) float64 {
+	counts := []int{metrics.SimpleCount, metrics.CompoundCount, metrics.ComplexCount, metrics.CompoundComplexCount}
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log(p)
+	}
+	return math.Round(entropy/math.Log(float64(len(counts)))*100) / 10
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifySentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want SentenceComplexityMetrics
+	}{
+		{"simple", "I like tea.", SentenceComplexityMetrics{SimpleCount: 1, AverageClauses: 1}},
+		{"compound phrase is still simple", "I like bread and butter.", SentenceComplexityMetrics{SimpleCount: 1, AverageClauses: 1}},
+		{"prepositional after", "We went home after lunch.", SentenceComplexityMetrics{SimpleCount: 1, AverageClauses: 1}},
+		{"compound with comma", "I like tea, but she likes coffee.", SentenceComplexityMetrics{CompoundCount: 1, AverageClauses: 2}},
+		{"compound with subject", "I was tired so I went to bed.", SentenceComplexityMetrics{CompoundCount: 1, AverageClauses: 2}},
+		{"complex", "I stayed home because it was raining.", SentenceComplexityMetrics{ComplexCount: 1, AverageClauses: 2}},
+		{"complex with relative clause", "The man who lives next door is a doctor.", SentenceComplexityMetrics{ComplexCount: 1, AverageClauses: 2}},
+		{"subordinator before subject", "We left after the film ended.", SentenceComplexityMetrics{ComplexCount: 1, AverageClauses: 2}},
+		{"compound-complex", "When I got home, I cooked dinner, and my sister washed up.", SentenceComplexityMetrics{CompoundComplexCount: 1, AverageClauses: 3}},
+		{
+			"mixed text",
+			"I like tea. I like tea, but she likes coffee. I stayed home because it was raining.",
+			SentenceComplexityMetrics{SimpleCount: 1, CompoundCount: 1, ComplexCount: 1, AverageClauses: 1.67},
+		},
+		{"empty", "", SentenceComplexityMetrics{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ClassifySentences(test.text); got != test.want {
+				t.Errorf("ClassifySentences(%q) = %+v, want %+v", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSentenceVarietyScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics SentenceComplexityMetrics
+		want    float64
+	}{
+		{"no sentences", SentenceComplexityMetrics{}, 0},
+		{"one type", SentenceComplexityMetrics{SimpleCount: 5}, 0},
+		{"all four evenly", SentenceComplexityMetrics{SimpleCount: 2, CompoundCount: 2, ComplexCount: 2, CompoundComplexCount: 2}, 10},
+		{"two types evenly", SentenceComplexityMetrics{SimpleCount: 3, ComplexCount: 3}, 5},
+		{"mostly simple", SentenceComplexityMetrics{SimpleCount: 9, ComplexCount: 1}, 2.3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SentenceVarietyScore(test.metrics); got != test.want {
+				t.Errorf("SentenceVarietyScore(%+v) = %v, want %v", test.metrics, got, test.want)
+			}
+		})
+	}
+}
+
+func BenchmarkClassifySentences(b *testing.B) {
+	essay := strings.Repeat("When I got home, I cooked dinner, and my sister washed up. I like tea, but she likes coffee. "+
+		"The man who lives next door is a doctor. We went home after lunch. ", 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ClassifySentences(essay)
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var blankLinePattern = regexp.MustCompile(`\n[ \t\r]*\n`)
+
+// SplitParagraphs splits text into paragraphs separated by blank lines.
+func SplitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, block := range blankLinePattern.Split(strings.ReplaceAll(text, "\r\n", "\n"), -1) {
+		if paragraph := strings.TrimSpace(block); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// SplitSentences splits text into sentences on '.', '!' and '?' boundaries.
+func SplitSentences(text string) []string {
+	var sentences []string
+	var current strings.Builder
+
+	runes := []rune(text)
+	for i, r := range runes {
+		current.WriteRune(r)
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		// Keep runs like "?!" or "..." inside the same sentence
+		if i+1 < len(runes) && (runes[i+1] == '.' || runes[i+1] == '!' || runes[i+1] == '?') {
+			continue
+		}
+		// Only split when followed by whitespace or end of text, so "3.5" stays intact
+		if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			continue
+		}
+		if sentence := strings.TrimSpace(current.String()); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		current.Reset()
+	}
+
+	if sentence := strings.TrimSpace(current.String()); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
+
+// ExtractWords returns the words in text, lowercased and stripped of surrounding punctuation.
+func ExtractWords(text string) []string {
+	var words []string
+	for _, field := range strings.Fields(text) {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if word != "" {
+			words = append(words, strings.ToLower(word))
+		}
+	}
+	return words
+}
+
+// NormalizeContent canonicalizes text for cache-key generation: it normalizes line endings,
+// trims and collapses whitespace on each line, drops blank lines and lowercases the result.
+func NormalizeContent(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.ToLower(strings.Join(lines, "\n"))
+}
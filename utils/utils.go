@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"os"
 	"strings"
 	"unicode"
 )
@@ -23,7 +22,3 @@ func IsEnglish(input string) bool {
 	}
 	return true
 }
-
-func getGeminiAPIKey() string {
-	return os.Getenv("GEMINI_API_KEY")
-}